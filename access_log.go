@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// AccessLogPayload defines the payload for changing the access log settings.
+// Zero values log every request.
+type AccessLogPayload struct {
+	Disabled     bool    `json:"disabled"`       // Stop writing access logs.
+	SampleRate   DuckInt `json:"sample_rate"`    // Log 1 of every N requests.
+	SampleErrors bool    `json:"sample_errors"`  // Sample responses with status >= 500 too instead of always logging them.
+	MaxPerSecond DuckInt `json:"max_per_second"` // Upper bound of access log lines per second; 0 for no limit.
+}
+
+// accessLogStats counts what happened to the access log line of each request.
+type accessLogStats struct {
+	logged      int64
+	sampledOut  int64
+	rateLimited int64
+}
+
+func (s *accessLogStats) toMap() gin.H {
+	return gin.H{
+		"logged":       atomic.LoadInt64(&s.logged),
+		"sampled_out":  atomic.LoadInt64(&s.sampledOut),
+		"rate_limited": atomic.LoadInt64(&s.rateLimited),
+	}
+}
+
+// accessLogSettings decide which requests get an access log line.
+type accessLogSettings struct {
+	Enabled      bool
+	SampleRate   int  // Log 1 of every N requests.
+	AlwaysErrors bool // Log every response with status >= 400, whatever the sampling.
+	MaxPerSecond int  // 0 for no limit.
+}
+
+// Global variables for access log sampling. The settings are read without locking because
+// every request consults them, and logging must stay cheap during flood tests.
+var (
+	accessLogConfig      atomic.Pointer[accessLogSettings]
+	accessLogRequests    int64
+	accessLogWindow      int64 // Unix second of the current rate limit window.
+	accessLogWindowCount int64
+	accessLogCounters    = &accessLogStats{}
+)
+
+// initAccessLog reads ACCESS_LOG_ENABLED, ACCESS_LOG_SAMPLE_RATE, ACCESS_LOG_ALWAYS_ERRORS
+// and ACCESS_LOG_MAX_PER_SECOND.
+func initAccessLog() {
+	accessLogConfig.Store(&accessLogSettings{
+		Enabled:      viper.GetBool("ACCESS_LOG_ENABLED"),
+		SampleRate:   max(1, viper.GetInt("ACCESS_LOG_SAMPLE_RATE")),
+		AlwaysErrors: viper.GetBool("ACCESS_LOG_ALWAYS_ERRORS"),
+		MaxPerSecond: max(0, viper.GetInt("ACCESS_LOG_MAX_PER_SECOND")),
+	})
+}
+
+// shouldLogAccess decides whether the access log line of a request with the given status
+// is written: client and server errors always if always_log_errors is set, other requests
+// 1 of every sample_rate, all within max_per_second.
+func shouldLogAccess(status int) bool {
+	settings := accessLogConfig.Load()
+	n := atomic.AddInt64(&accessLogRequests, 1)
+	if !settings.Enabled ||
+		(!(settings.AlwaysErrors && status >= http.StatusBadRequest) && n%int64(settings.SampleRate) != 0) {
+		atomic.AddInt64(&accessLogCounters.sampledOut, 1)
+		return false
+	}
+	if settings.MaxPerSecond > 0 {
+		now := time.Now().Unix()
+		if window := atomic.LoadInt64(&accessLogWindow); window != now &&
+			atomic.CompareAndSwapInt64(&accessLogWindow, window, now) {
+			atomic.StoreInt64(&accessLogWindowCount, 0)
+		}
+		if atomic.AddInt64(&accessLogWindowCount, 1) > int64(settings.MaxPerSecond) {
+			atomic.AddInt64(&accessLogCounters.rateLimited, 1)
+			return false
+		}
+	}
+	atomic.AddInt64(&accessLogCounters.logged, 1)
+	return true
+}
+
+// accessLogStatus returns the current access log settings and counters.
+func accessLogStatus() gin.H {
+	settings := accessLogConfig.Load()
+	return gin.H{
+		"enabled":           settings.Enabled,
+		"sample_rate":       settings.SampleRate,
+		"always_log_errors": settings.AlwaysErrors,
+		"max_per_second":    settings.MaxPerSecond,
+		"results":           accessLogCounters.toMap(),
+	}
+}
+
+// AccessLogStatusHandler handles GET /admin/access_log.
+func AccessLogStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, accessLogStatus())
+}
+
+// AccessLogHandler handles POST /admin/access_log.
+// It replaces the access log settings at runtime, e.g. to turn logging down before a flood
+// test so that logging does not become the bottleneck.
+func AccessLogHandler(c *gin.Context) {
+	var payload AccessLogPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.SampleRate < 0 || payload.MaxPerSecond < 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "sample_rate and max_per_second must not be negative")
+		return
+	}
+
+	settings := &accessLogSettings{
+		Enabled:      !payload.Disabled,
+		SampleRate:   max(1, int(payload.SampleRate)),
+		AlwaysErrors: !payload.SampleErrors,
+		MaxPerSecond: int(payload.MaxPerSecond),
+	}
+	accessLogConfig.Store(settings)
+	logInfo("Access log settings changed",
+		zap.Bool("enabled", settings.Enabled),
+		zap.Int("sample_rate", settings.SampleRate),
+		zap.Bool("always_log_errors", settings.AlwaysErrors),
+		zap.Int("max_per_second", settings.MaxPerSecond))
+
+	status := accessLogStatus()
+	status["message"] = "access log settings changed"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// AccessLogResetHandler handles DELETE /admin/access_log.
+// It restores the settings configured by the environment.
+func AccessLogResetHandler(c *gin.Context) {
+	initAccessLog()
+	status := accessLogStatus()
+	status["message"] = "access log settings reset"
+	ResponseJSON(c, http.StatusOK, status)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// AZ failure modes.
+const (
+	azModeUnavailable = "unavailable" // Answer every request with 503.
+	azModeBlackhole   = "blackhole"   // Hold requests and drop the connection without answering.
+)
+
+// AZFailurePayload defines the payload for the AZ failure emulation.
+type AZFailurePayload struct {
+	AvailabilityZones []string `json:"availability_zones"` // Zones to fail; instances elsewhere ignore the call.
+	Mode              string   `json:"mode"`               // unavailable (default) or blackhole.
+	MaintainSecond    DuckInt  `json:"maintain_second"`
+	Async             bool     `json:"async"`
+	Peers             []string `json:"peers"` // Base URLs of other instances to forward the call to.
+}
+
+// Global variables for AZ failure emulation.
+var (
+	azFailureMutex  sync.Mutex
+	azFailureZones  []string
+	azFailureMode   string
+	azFailureExpiry time.Time = time.Now()
+
+	availabilityZone     string
+	availabilityZoneOnce sync.Once
+)
+
+// getAvailabilityZone returns the availability zone of this instance, looked up once from
+// AVAILABILITY_ZONE, the ECS task metadata (v4) or the EC2 instance metadata service.
+// It returns "" when the zone cannot be determined.
+func getAvailabilityZone() string {
+	availabilityZoneOnce.Do(func() {
+		if az := viper.GetString("AVAILABILITY_ZONE"); az != "" {
+			availabilityZone = az
+			return
+		}
+		client := &http.Client{Timeout: 2 * time.Second}
+		if ecsURI := os.Getenv("ECS_CONTAINER_METADATA_URI_V4"); ecsURI != "" {
+			if resp, err := client.Get(ecsURI + "/task"); err == nil {
+				var task struct {
+					AvailabilityZone string
+				}
+				json.NewDecoder(resp.Body).Decode(&task)
+				resp.Body.Close()
+				if task.AvailabilityZone != "" {
+					availabilityZone = task.AvailabilityZone
+					return
+				}
+			}
+		}
+		// EC2 (and EKS nodes): IMDSv2 with a v1 fallback.
+		azURL := "http://169.254.169.254/latest/meta-data/placement/availability-zone"
+		req, _ := http.NewRequest("GET", azURL, nil)
+		tokenReq, _ := http.NewRequest("PUT", "http://169.254.169.254/latest/api/token", nil)
+		tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+		if resp, err := client.Do(tokenReq); err == nil {
+			token, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				req.Header.Set("X-aws-ec2-metadata-token", string(token))
+			}
+		}
+		if resp, err := client.Do(req); err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				availabilityZone = strings.TrimSpace(string(body))
+			}
+		}
+	})
+	return availabilityZone
+}
+
+// setAZFailure fails this instance until expiry if it runs in one of zones.
+// It reports whether the instance matched.
+func setAZFailure(zones []string, mode string, expiry time.Time) bool {
+	az := getAvailabilityZone()
+	matched := false
+	for _, zone := range zones {
+		if az != "" && strings.EqualFold(strings.TrimSpace(zone), az) {
+			matched = true
+		}
+	}
+	azFailureMutex.Lock()
+	azFailureZones = zones
+	azFailureMode = mode
+	azFailureExpiry = time.Now()
+	if matched {
+		azFailureExpiry = expiry
+	}
+	azFailureMutex.Unlock()
+	if matched {
+		recordFaultActivated("az_failure", "", gin.H{"zones": zones, "mode": mode}, expiry)
+	} else {
+		recordFaultDeactivated("az_failure", "", "cleared")
+	}
+	return matched
+}
+
+// applyAZFailureLabels fails the instance from startup when AZ_FAILURE_ZONES (a comma-separated
+// list, e.g. set through a shared ConfigMap or task definition) contains its zone.
+func applyAZFailureLabels() {
+	zones := viper.GetString("AZ_FAILURE_ZONES")
+	if zones == "" {
+		return
+	}
+	mode := viper.GetString("AZ_FAILURE_MODE")
+	if mode == "" {
+		mode = azModeUnavailable
+	}
+	// Labels stay in effect for the lifetime of the process.
+	matched := setAZFailure(strings.Split(zones, ","), mode, time.Now().AddDate(100, 0, 0))
+	logWarn("AZ failure labels applied",
+		zap.String("availability_zone", getAvailabilityZone()),
+		zap.String("zones", zones),
+		zap.String("mode", mode),
+		zap.Bool("failed", matched))
+}
+
+// forwardAZFailure sends the same AZ failure call to every peer and returns the outcome per peer.
+func forwardAZFailure(payload AZFailurePayload) gin.H {
+	results := gin.H{}
+	peers := payload.Peers
+	payload.Peers = nil
+	// Peers apply it in the background so a failing zone cannot hold the call.
+	payload.Async = true
+	body, _ := json.Marshal(payload)
+	client, _ := newOutboundClient(10*time.Second, "", "")
+	for _, peer := range peers {
+		resp, err := client.Post(strings.TrimRight(peer, "/")+"/stress/az_failure", "application/json", bytes.NewReader(body))
+		if err != nil {
+			results[peer] = err.Error()
+			continue
+		}
+		var peerResp map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&peerResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			results[peer] = fmt.Sprintf("status %d", resp.StatusCode)
+			continue
+		}
+		results[peer] = gin.H{"availability_zone": peerResp["availability_zone"], "failed": peerResp["failed"]}
+	}
+	return results
+}
+
+// AZFailureStatusHandler handles GET /stress/az_failure.
+func AZFailureStatusHandler(c *gin.Context) {
+	azFailureMutex.Lock()
+	zones := azFailureZones
+	mode := azFailureMode
+	active := time.Now().Before(azFailureExpiry)
+	azFailureMutex.Unlock()
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"availability_zone":  getAvailabilityZone(),
+		"availability_zones": zones,
+		"mode":               mode,
+		"failed":             active,
+	})
+}
+
+// AZFailureHandler handles POST /stress/az_failure.
+// Every instance receiving the call fails for maintain_second only if its own availability zone
+// is listed, so the same call can be sent to a whole fleet (directly, through peers or a load
+// balancer) to emulate an AZ outage. maintain_second 0 ends a running emulation.
+func AZFailureHandler(c *gin.Context) {
+	var payload AZFailurePayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if len(payload.AvailabilityZones) == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "availability_zones is required")
+		return
+	}
+	mode := payload.Mode
+	if mode == "" {
+		mode = azModeUnavailable
+	}
+	if mode != azModeUnavailable && mode != azModeBlackhole {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "mode must be unavailable or blackhole")
+		return
+	}
+	for _, peer := range payload.Peers {
+		if err := checkTargetAllowed(peer); err != nil {
+			ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+			return
+		}
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	expiry := time.Now().Add(time.Duration(maintainSec) * time.Second)
+	matched := setAZFailure(payload.AvailabilityZones, mode, expiry)
+	logWarn("AZ failure emulation requested",
+		zap.String("availability_zone", getAvailabilityZone()),
+		zap.Strings("availability_zones", payload.AvailabilityZones),
+		zap.String("mode", mode),
+		zap.Bool("failed", matched),
+		zap.Int("duration_sec", maintainSec))
+
+	var peers gin.H
+	if len(payload.Peers) > 0 {
+		peers = forwardAZFailure(payload)
+	}
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if sleepContext(ctx, time.Until(expiry)) || !matched {
+			return
+		}
+		// Cancelled: end the emulation unless a newer one replaced it.
+		azFailureMutex.Lock()
+		ours := azFailureExpiry.Equal(expiry)
+		if ours {
+			azFailureExpiry = time.Now()
+		}
+		azFailureMutex.Unlock()
+		if ours {
+			recordFaultDeactivated("az_failure", "", "cancelled")
+		}
+	}
+
+	if payload.Async {
+		go job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":            "az failure emulation started",
+			"availability_zone":  getAvailabilityZone(),
+			"availability_zones": payload.AvailabilityZones,
+			"mode":               mode,
+			"failed":             matched,
+			"maintain_second":    maintainSec,
+			"peers":              peers,
+		})
+	} else {
+		job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":            "az failure emulation completed",
+			"availability_zone":  getAvailabilityZone(),
+			"availability_zones": payload.AvailabilityZones,
+			"mode":               mode,
+			"failed":             matched,
+			"maintain_second":    maintainSec,
+			"peers":              peers,
+		})
+	}
+}
+
+// AZFailureMiddleware fails every request while this instance's zone is emulated as down.
+// /stress/az_failure stays reachable so the emulation can be inspected and ended.
+func AZFailureMiddleware(c *gin.Context) {
+	azFailureMutex.Lock()
+	active := time.Now().Before(azFailureExpiry)
+	mode := azFailureMode
+	expiry := azFailureExpiry
+	azFailureMutex.Unlock()
+	if !active || c.Request.URL.Path == "/stress/az_failure" {
+		c.Next()
+		return
+	}
+
+	if mode == azModeBlackhole {
+		// Like traffic into a dead zone: no answer until the client gives up or the outage ends.
+		timer := time.NewTimer(time.Until(expiry))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+		}
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+		c.Abort()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error":             "AZ_UNAVAILABLE",
+		"message":           "availability zone is unavailable",
+		"availability_zone": getAvailabilityZone(),
+		"requested_at":      time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// calibration holds the measured throughput of this node and the normalization factors
+// against the reference node (CALIBRATION_REFERENCE_*). A factor above 1 means this node is
+// slower than the reference.
+type calibration struct {
+	Arch                string    `json:"arch"`
+	CPUs                int       `json:"cpus"`
+	MeasuredAt          time.Time `json:"measured_at"`
+	CPUOpsPerSecond     float64   `json:"cpu_ops_per_second_per_core"`
+	DiskWriteMBps       float64   `json:"disk_write_mbps"`
+	MemoryBandwidthMBps float64   `json:"memory_bandwidth_mbps"`
+	CPUFactor           float64   `json:"cpu_factor"`
+	DiskFactor          float64   `json:"disk_factor"`
+	MemoryFactor        float64   `json:"memory_factor"`
+}
+
+// Global variables for the stress calibration.
+var (
+	calibrationMutex   sync.Mutex
+	calibrationRunning sync.Mutex
+	currentCalibration *calibration
+	busyLoopSink       uint64
+)
+
+// errCalibrationRunning is returned when a calibration is requested while one runs.
+var errCalibrationRunning = errors.New("a calibration is already running")
+
+// busyLoop runs a fixed integer workload for d and returns the iterations done.
+func busyLoop(d time.Duration) uint64 {
+	var ops, x uint64 = 0, 88172645463325252
+	end := time.Now().Add(d)
+	for {
+		for i := 0; i < 1024; i++ {
+			// xorshift64
+			x ^= x << 13
+			x ^= x >> 7
+			x ^= x << 17
+		}
+		ops += 1024
+		if !time.Now().Before(end) {
+			break
+		}
+	}
+	atomic.AddUint64(&busyLoopSink, x)
+	return ops
+}
+
+// measureCPU runs the busy loop on every core at once for a second and returns the
+// iterations per second of one core, so SMT siblings and throttling are accounted for.
+func measureCPU() float64 {
+	cores := runtime.GOMAXPROCS(0)
+	counts := make([]uint64, cores)
+	var wg sync.WaitGroup
+	for i := 0; i < cores; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i] = busyLoop(time.Second)
+		}(i)
+	}
+	wg.Wait()
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	return float64(total) / float64(cores)
+}
+
+// measureDiskWrite writes and syncs 64 MiB in the temporary directory and returns MB/s.
+func measureDiskWrite() (float64, error) {
+	const size, chunk = 64 * 1024 * 1024, 1024 * 1024
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("biggie_calibrate_%d.tmp", time.Now().UnixNano()))
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(path)
+	defer f.Close()
+	data := make([]byte, chunk)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	start := time.Now()
+	for written := 0; written < size; written += chunk {
+		if _, err := f.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	return size / 1e6 / time.Since(start).Seconds(), nil
+}
+
+// measureMemoryBandwidth copies a 64 MiB buffer for half a second and returns the MB/s copied.
+func measureMemoryBandwidth() float64 {
+	const size = 64 * 1024 * 1024
+	src, dst := make([]byte, size), make([]byte, size)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	copies := 0
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		copy(dst, src)
+		copies++
+	}
+	return float64(copies) * size / 1e6 / time.Since(start).Seconds()
+}
+
+// calibrationFactor returns reference / measured, or 1 without a usable measure.
+func calibrationFactor(reference, measured float64) float64 {
+	if reference <= 0 || measured <= 0 {
+		return 1
+	}
+	return math.Round(reference/measured*1000) / 1000
+}
+
+// runCalibration measures this node and stores its normalization factors.
+func runCalibration() (*calibration, error) {
+	if !calibrationRunning.TryLock() {
+		return nil, errCalibrationRunning
+	}
+	defer calibrationRunning.Unlock()
+
+	cal := &calibration{Arch: runtime.GOARCH, CPUs: runtime.GOMAXPROCS(0), MeasuredAt: time.Now().UTC()}
+	cal.CPUOpsPerSecond = measureCPU()
+	disk, err := measureDiskWrite()
+	if err != nil {
+		return nil, fmt.Errorf("disk write: %w", err)
+	}
+	cal.DiskWriteMBps = math.Round(disk*10) / 10
+	cal.MemoryBandwidthMBps = math.Round(measureMemoryBandwidth()*10) / 10
+	cal.CPUFactor = calibrationFactor(viper.GetFloat64("CALIBRATION_REFERENCE_CPU_OPS"), cal.CPUOpsPerSecond)
+	cal.DiskFactor = calibrationFactor(viper.GetFloat64("CALIBRATION_REFERENCE_DISK_MBPS"), cal.DiskWriteMBps)
+	cal.MemoryFactor = calibrationFactor(viper.GetFloat64("CALIBRATION_REFERENCE_MEMORY_MBPS"), cal.MemoryBandwidthMBps)
+
+	calibrationMutex.Lock()
+	currentCalibration = cal
+	calibrationMutex.Unlock()
+	logInfo("Stress calibration completed",
+		zap.String("arch", cal.Arch),
+		zap.Float64("cpu_ops_per_second_per_core", cal.CPUOpsPerSecond),
+		zap.Float64("disk_write_mbps", cal.DiskWriteMBps),
+		zap.Float64("memory_bandwidth_mbps", cal.MemoryBandwidthMBps),
+		zap.Float64("cpu_factor", cal.CPUFactor))
+	return cal, nil
+}
+
+// getCalibration returns the current calibration, or nil.
+func getCalibration() *calibration {
+	calibrationMutex.Lock()
+	defer calibrationMutex.Unlock()
+	return currentCalibration
+}
+
+// normalizeCPUPercent converts a CPU percentage of a reference core into the percentage of a
+// core of this node, capped at 100. It is unchanged until the node is calibrated.
+func normalizeCPUPercent(percent int) int {
+	cal := getCalibration()
+	if cal == nil {
+		return percent
+	}
+	normalized := int(math.Round(float64(percent) * cal.CPUFactor))
+	if normalized > 100 {
+		normalized = 100
+	}
+	return normalized
+}
+
+// calibrateOnStartup calibrates the node before it serves traffic when CALIBRATION_ON_STARTUP is set.
+func calibrateOnStartup() {
+	if !viper.GetBool("CALIBRATION_ON_STARTUP") {
+		return
+	}
+	if _, err := runCalibration(); err != nil {
+		logError("Stress calibration failed, stress is not normalized", zap.Error(err))
+	}
+}
+
+// CalibrationStatusHandler handles GET /admin/calibrate.
+func CalibrationStatusHandler(c *gin.Context) {
+	cal := getCalibration()
+	if cal == nil {
+		ResponseJSON(c, http.StatusOK, gin.H{"calibrated": false})
+		return
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{"calibrated": true, "calibration": cal})
+}
+
+// CalibrateHandler handles POST /admin/calibrate.
+// It measures the per-core busy-loop throughput, disk write speed and memory bandwidth of
+// this node (about two seconds) and stores the normalization factors against the reference
+// node, so that cpu_percent produces comparable pressure on Graviton and x86 nodes.
+func CalibrateHandler(c *gin.Context) {
+	cal, err := runCalibration()
+	if errors.Is(err, errCalibrationRunning) {
+		ErrorJSON(c, http.StatusConflict, "CALIBRATION_RUNNING", err.Error())
+		return
+	} else if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CALIBRATION_FAILED", err.Error())
+		return
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{"calibrated": true, "calibration": cal})
+}
+
+// CalibrationResetHandler handles DELETE /admin/calibrate.
+// It forgets the calibration, so stress parameters are used as given again.
+func CalibrationResetHandler(c *gin.Context) {
+	calibrationMutex.Lock()
+	currentCalibration = nil
+	calibrationMutex.Unlock()
+	ResponseJSON(c, http.StatusOK, gin.H{"calibrated": false})
+}
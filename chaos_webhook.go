@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// litmusEngine is the part of a Litmus ChaosEngine that names the experiments and their
+// tunables (the TOTAL_CHAOS_DURATION, CPU_LOAD, ... environment variables).
+type litmusEngine struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Experiments []struct {
+			Name string `json:"name"`
+			Spec struct {
+				Components struct {
+					Env []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"env"`
+				} `json:"components"`
+			} `json:"spec"`
+		} `json:"experiments"`
+	} `json:"spec"`
+}
+
+// gremlinAttack is the part of a Gremlin attack that names the attack type and its CLI
+// arguments, e.g. {"command": {"type": "cpu", "args": ["-l", "60", "-p", "80"]}}.
+type gremlinAttack struct {
+	Command struct {
+		Type string   `json:"type"`
+		Args []string `json:"args"`
+	} `json:"command"`
+}
+
+// webhookAction is a biggie action translated from an orchestrator payload.
+type webhookAction struct {
+	name       string
+	action     string
+	parameters map[string]interface{}
+	duration   time.Duration
+}
+
+// webhookNumber returns the first of values that parses as a number, or fallback.
+func webhookNumber(fallback float64, values ...string) float64 {
+	for _, v := range values {
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+// translateLitmus translates the experiments of a ChaosEngine.
+func translateLitmus(engine litmusEngine) ([]webhookAction, error) {
+	var actions []webhookAction
+	for _, experiment := range engine.Spec.Experiments {
+		env := map[string]string{}
+		for _, e := range experiment.Spec.Components.Env {
+			env[e.Name] = e.Value
+		}
+		duration := webhookNumber(60, env["TOTAL_CHAOS_DURATION"])
+		a := webhookAction{name: experiment.Name, duration: time.Duration(duration) * time.Second}
+		switch experiment.Name {
+		case "pod-cpu-hog", "node-cpu-hog":
+			a.action = "/stress/cpu"
+			a.parameters = gin.H{"cpu_percent": webhookNumber(100, env["CPU_LOAD"])}
+		case "pod-memory-hog", "node-memory-hog":
+			// /stress/memory allocates memory_percent MiB.
+			a.action = "/stress/memory"
+			a.parameters = gin.H{"memory_percent": webhookNumber(500, env["MEMORY_CONSUMPTION"])}
+		case "pod-network-latency", "pod-http-latency":
+			a.action = "/stress/network/latency"
+			a.parameters = gin.H{"latency_ms": webhookNumber(2000, env["NETWORK_LATENCY"], env["LATENCY"])}
+		case "pod-network-loss":
+			a.action = "/stress/network/packet_loss"
+			a.parameters = gin.H{"loss_percentage": webhookNumber(100, env["NETWORK_PACKET_LOSS_PERCENTAGE"])}
+		case "pod-http-status-code":
+			a.action = "/stress/error_injection"
+			a.parameters = gin.H{"error_rate": webhookNumber(100, env["TOXICITY"]) / 100}
+		case "pod-network-partition", "pod-dns-error":
+			a.action = "/stress/downtime"
+			a.parameters = gin.H{}
+		case "pod-delete", "container-kill":
+			// The crash is immediate; the duration only bounds the experiment.
+			a.action = "/stress/crash"
+			a.parameters = gin.H{"maintain_second": 0}
+		default:
+			return nil, fmt.Errorf("unsupported litmus experiment %q", experiment.Name)
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// gremlinArgs parses Gremlin CLI arguments such as ["-l", "60", "--percent", "80"].
+func gremlinArgs(args []string) map[string]string {
+	parsed := map[string]string{}
+	for i := 0; i+1 < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			parsed[strings.TrimLeft(args[i], "-")] = args[i+1]
+			i++
+		}
+	}
+	return parsed
+}
+
+// translateGremlin translates a Gremlin attack.
+func translateGremlin(attack gremlinAttack) ([]webhookAction, error) {
+	args := gremlinArgs(attack.Command.Args)
+	duration := webhookNumber(60, args["l"], args["length"])
+	a := webhookAction{name: attack.Command.Type, duration: time.Duration(duration) * time.Second}
+	switch attack.Command.Type {
+	case "cpu":
+		a.action = "/stress/cpu"
+		a.parameters = gin.H{"cpu_percent": webhookNumber(100, args["p"], args["percent"])}
+	case "memory":
+		a.action = "/stress/memory"
+		mb := webhookNumber(0, args["m"], args["mb"])
+		if gb := webhookNumber(0, args["g"], args["gb"]); gb > 0 {
+			mb = gb * 1024
+		}
+		if mb == 0 {
+			mb = 500
+		}
+		a.parameters = gin.H{"memory_percent": mb}
+	case "latency":
+		a.action = "/stress/network/latency"
+		a.parameters = gin.H{"latency_ms": webhookNumber(100, args["m"], args["ms"])}
+	case "packet_loss":
+		a.action = "/stress/network/packet_loss"
+		a.parameters = gin.H{"loss_percentage": webhookNumber(1, args["r"], args["p"], args["percent"])}
+	case "blackhole":
+		a.action = "/stress/downtime"
+		a.parameters = gin.H{}
+	case "shutdown":
+		a.action = "/stress/crash"
+		a.parameters = gin.H{"maintain_second": webhookNumber(0, args["d"], args["delay"]) * 60}
+	default:
+		return nil, fmt.Errorf("unsupported gremlin attack type %q", attack.Command.Type)
+	}
+	return []webhookAction{a}, nil
+}
+
+// ChaosWebhookHandler handles POST /integrations/webhook.
+// It translates a Litmus ChaosEngine or a Gremlin attack into biggie actions and starts them
+// as orchestrator actions, so they can be followed and stopped under /integrations/actions.
+// The id query parameter makes retried deliveries idempotent.
+func ChaosWebhookHandler(c *gin.Context) {
+	raw, _ := c.Get("rawBody")
+	body, _ := raw.(string)
+	var attack gremlinAttack
+	var engine litmusEngine
+	if json.Unmarshal([]byte(body), &attack) != nil || json.Unmarshal([]byte(body), &engine) != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "body must be a litmus chaosengine or a gremlin attack")
+		return
+	}
+	var source string
+	var actions []webhookAction
+	var err error
+	switch {
+	case attack.Command.Type != "":
+		source = "gremlin"
+		actions, err = translateGremlin(attack)
+	case len(engine.Spec.Experiments) > 0:
+		source = "litmus"
+		actions, err = translateLitmus(engine)
+	default:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "body must be a litmus chaosengine or a gremlin attack")
+		return
+	}
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "UNSUPPORTED_EXPERIMENT", err.Error())
+		return
+	}
+
+	id := c.Query("id")
+	if id == "" {
+		id = engine.Metadata.Name
+	}
+	if id == "" {
+		id = source + "-" + newJobID()
+	}
+	if !actionIDRegex.MatchString(id) {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "id must be 1-128 letters, digits, '_', '.', ':' or '-'")
+		return
+	}
+	status := http.StatusOK
+	results := make([]gin.H, 0, len(actions))
+	for _, wa := range actions {
+		actionID := id
+		if len(actions) > 1 {
+			actionID = id + "-" + wa.name
+		}
+		a, created := launchOrchestratorAction(actionID, wa.action, wa.parameters, wa.duration, getNamespace(c))
+		result := a.toMap()
+		result["created"] = created
+		result["experiment"] = wa.name
+		results = append(results, result)
+		switch {
+		case a.action != wa.action:
+			result["error"] = fmt.Sprintf("id %s already runs %s", actionID, a.action)
+			status = http.StatusConflict
+		case created && result["state"] == actionFailed:
+			status = http.StatusBadGateway
+		case created && status == http.StatusOK:
+			status = http.StatusCreated
+		}
+	}
+	ResponseJSON(c, status, gin.H{
+		"source":  source,
+		"id":      id,
+		"actions": results,
+	})
+}
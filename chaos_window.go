@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ChaosWindowPayload defines the payload for opening an experiment window.
+type ChaosWindowPayload struct {
+	DurationSecond DuckInt `json:"duration_second"` // Capped at CHAOS_WINDOW_MAX_SECOND.
+	Reason         string  `json:"reason"`
+}
+
+// Global variables for the experiment window.
+var (
+	chaosWindowMutex    sync.Mutex
+	chaosWindowOpen     bool
+	chaosWindowOpenedAt time.Time
+	chaosWindowExpiry   time.Time
+	chaosWindowReason   string
+	chaosWindowTimer    *time.Timer
+)
+
+// chaosRoutePrefixes are the routes that inject faults or load and are therefore gated by the window.
+var chaosRoutePrefixes = []string{
+	"/stress/", "/proxy", "/mock/",
+	"/mysql/", "/postgres/", "/redshift/", "/redis/", "/kafka/", "/smtp/", "/sftp/",
+	"/simulate/", "/traffic/", "/integrations/", "/scenario/",
+	"/healthcheck/live/toggle", "/healthcheck/ready/toggle",
+	"/admin/proxy_pass", "/admin/response_headers", "/admin/timeouts", "/admin/ports",
+}
+
+// chaosDurationFields are the payload fields capped to the time left in the window.
+var chaosDurationFields = []string{"maintain_second", "downtime_second", "duration_second"}
+
+// isChaosRoute reports whether a request injects faults or load. Reads (GET) and removals
+// (DELETE), which can only end faults, are never gated.
+func isChaosRoute(c *gin.Context) bool {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodDelete {
+		return false
+	}
+	for _, prefix := range chaosRoutePrefixes {
+		if strings.HasPrefix(c.Request.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// revertAllFaults turns off every injected fault and releases leaked resources. Running
+// workloads are left alone; closeChaosWindow stops them as well.
+func revertAllFaults() {
+	faultState.Reset()
+
+	loadSheddingMutex.Lock()
+	loadSheddingExpiry = time.Now()
+	loadSheddingMutex.Unlock()
+
+	queueSimMutex.Lock()
+	activeQueueSim = nil
+	queueSimMutex.Unlock()
+
+	egressMutex.Lock()
+	activeEgressFaults = nil
+	egressMutex.Unlock()
+
+	connChaosMutex.Lock()
+	connChaosExpiry = time.Now()
+	connChaosMutex.Unlock()
+
+	mirrorMutex.Lock()
+	activeMirror = nil
+	mirrorMutex.Unlock()
+
+	metricsNoiseMutex.Lock()
+	activeMetricsNoise = nil
+	metricsNoiseMutex.Unlock()
+
+	labelExplosionMutex.Lock()
+	activeLabelExplosion = nil
+	labelExplosionMutex.Unlock()
+
+	azFailureMutex.Lock()
+	azFailureExpiry = time.Now()
+	azFailureMutex.Unlock()
+
+	cancelInstanceEvents()
+	resetProbeToggles()
+	initRequestTimeouts()
+	initPortPersonas()
+
+	responseHeaderMutex.Lock()
+	responseHeaderRules.Store(&map[string]map[string]string{})
+	responseHeaderMutex.Unlock()
+
+	proxyPassMutex.Lock()
+	proxyPassRules.Store(&[]*proxyPassRule{})
+	proxyPassMutex.Unlock()
+
+	mockMutex.Lock()
+	for kind := range mockBehaviors {
+		mockBehaviors[kind] = mockBehavior{ErrorStatus: http.StatusInternalServerError}
+	}
+	mockMutex.Unlock()
+
+	proxyMutex.Lock()
+	for _, p := range proxies {
+		p.mutex.Lock()
+		p.toxics = proxyToxics{}
+		p.mutex.Unlock()
+	}
+	proxyMutex.Unlock()
+
+	releaseLeakedMemory()
+	closeLeakedConnections()
+	recordAllFaultsDeactivated("reverted")
+}
+
+// releaseLeakedMemory frees the memory held by /stress/memory_leak.
+func releaseLeakedMemory() {
+	memoryLeakMutex.Lock()
+	memoryLeakStore = nil
+	memoryLeakMutex.Unlock()
+}
+
+// closeLeakedConnections closes the database sessions and Redis connections leaked on purpose.
+func closeLeakedConnections() {
+	leakedDBMutex.Lock()
+	for _, tx := range leakedDBSessions {
+		tx.Rollback()
+	}
+	leakedDBSessions = nil
+	leakedDBMutex.Unlock()
+
+	leakedRedisMutex.Lock()
+	for _, client := range leakedRedisClients {
+		client.Close()
+	}
+	leakedRedisClients = nil
+	leakedRedisMutex.Unlock()
+}
+
+// closeChaosWindow closes the window, reverts all faults and stops every running job.
+func closeChaosWindow(cause string) {
+	chaosWindowMutex.Lock()
+	if !chaosWindowOpen {
+		chaosWindowMutex.Unlock()
+		return
+	}
+	chaosWindowOpen = false
+	if chaosWindowTimer != nil {
+		chaosWindowTimer.Stop()
+		chaosWindowTimer = nil
+	}
+	openedAt := chaosWindowOpenedAt
+	chaosWindowMutex.Unlock()
+
+	revertAllFaults()
+	stopped := stopAllJobs("chaos window closed")
+	persistState()
+	publishEvent(eventConfigChanged, gin.H{"chaos_window": "closed", "cause": cause})
+	logInfo("Chaos window closed, all faults reverted",
+		zap.String("cause", cause),
+		zap.Int("stopped_jobs", len(stopped)),
+		zap.Duration("open_for", time.Since(openedAt)))
+}
+
+// restoreChaosWindow reopens a window persisted before a restart, until its original expiry.
+func restoreChaosWindow(openedAt, expiry time.Time, reason string) {
+	chaosWindowMutex.Lock()
+	defer chaosWindowMutex.Unlock()
+	chaosWindowOpen, chaosWindowOpenedAt, chaosWindowExpiry, chaosWindowReason = true, openedAt, expiry, reason
+	if chaosWindowTimer != nil {
+		chaosWindowTimer.Stop()
+	}
+	chaosWindowTimer = time.AfterFunc(time.Until(expiry), func() {
+		closeChaosWindow("expired")
+	})
+}
+
+// chaosWindowStatus returns the current window state.
+func chaosWindowStatus() gin.H {
+	chaosWindowMutex.Lock()
+	defer chaosWindowMutex.Unlock()
+	status := gin.H{
+		"open":     chaosWindowOpen,
+		"required": viper.GetBool("CHAOS_WINDOW_REQUIRED"),
+	}
+	if chaosWindowOpen {
+		status["reason"] = chaosWindowReason
+		status["opened_at"] = chaosWindowOpenedAt.UTC().Format(time.RFC3339)
+		status["closes_at"] = chaosWindowExpiry.UTC().Format(time.RFC3339)
+		status["remaining_second"] = int(time.Until(chaosWindowExpiry).Seconds())
+	}
+	return status
+}
+
+// ChaosWindowStatusHandler handles GET /admin/window.
+func ChaosWindowStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, chaosWindowStatus())
+}
+
+// ChaosWindowOpenHandler handles POST /admin/window.
+// It opens (or extends) the experiment window for duration_second. When the window closes,
+// every injected fault is reverted, even if no cleanup call is ever made.
+func ChaosWindowOpenHandler(c *gin.Context) {
+	var payload ChaosWindowPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	durationSec := int(payload.DurationSecond)
+	maxSec := viper.GetInt("CHAOS_WINDOW_MAX_SECOND")
+	if durationSec <= 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "duration_second must be positive")
+		return
+	}
+	if durationSec > maxSec {
+		durationSec = maxSec
+	}
+
+	chaosWindowMutex.Lock()
+	if !chaosWindowOpen {
+		chaosWindowOpen = true
+		chaosWindowOpenedAt = time.Now()
+	}
+	chaosWindowExpiry = time.Now().Add(time.Duration(durationSec) * time.Second)
+	chaosWindowReason = payload.Reason
+	if chaosWindowTimer != nil {
+		chaosWindowTimer.Stop()
+	}
+	chaosWindowTimer = time.AfterFunc(time.Duration(durationSec)*time.Second, func() {
+		closeChaosWindow("expired")
+	})
+	chaosWindowMutex.Unlock()
+	persistState()
+	logInfo("Chaos window opened",
+		zap.Int("duration_sec", durationSec),
+		zap.String("reason", payload.Reason))
+
+	status := chaosWindowStatus()
+	status["message"] = "chaos window opened"
+	status["duration_second"] = durationSec
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// ChaosWindowCloseHandler handles DELETE /admin/window.
+// It closes the window early and reverts every injected fault.
+func ChaosWindowCloseHandler(c *gin.Context) {
+	closeChaosWindow("closed by request")
+	status := chaosWindowStatus()
+	status["message"] = "chaos window closed"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// ChaosWindowMiddleware gates fault injection on the experiment window. With
+// CHAOS_WINDOW_REQUIRED=true, fault requests outside an open window are rejected; inside a
+// window, maintain_second and downtime_second are capped to the time left so nothing outlives it.
+func ChaosWindowMiddleware(c *gin.Context) {
+	if !isChaosRoute(c) {
+		c.Next()
+		return
+	}
+	chaosWindowMutex.Lock()
+	open := chaosWindowOpen
+	remaining := int(time.Until(chaosWindowExpiry).Seconds())
+	chaosWindowMutex.Unlock()
+
+	if !open {
+		if viper.GetBool("CHAOS_WINDOW_REQUIRED") {
+			ErrorJSON(c, http.StatusForbidden, "CHAOS_WINDOW_CLOSED", "fault injection requires an open chaos window")
+			c.Abort()
+			return
+		}
+		c.Next()
+		return
+	}
+
+	raw, _ := c.Get("rawBody")
+	body, _ := raw.(string)
+	var fields map[string]json.RawMessage
+	if body == "" || json.Unmarshal([]byte(body), &fields) != nil {
+		c.Next()
+		return
+	}
+	capped := false
+	for _, name := range chaosDurationFields {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var d DuckInt
+		if err := json.Unmarshal(value, &d); err != nil {
+			continue
+		}
+		// RANDOM values are resolved here so the handler sees the capped number.
+		if int(d) > remaining {
+			d = DuckInt(remaining)
+			capped = true
+		}
+		fields[name], _ = json.Marshal(int(d))
+	}
+	newBody, err := json.Marshal(fields)
+	if err == nil {
+		c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+		c.Request.ContentLength = int64(len(newBody))
+		c.Set("rawBody", string(newBody))
+	}
+	if capped {
+		c.Header("X-Chaos-Window-Capped", "true")
+	}
+	c.Next()
+}
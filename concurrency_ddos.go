@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,12 +20,14 @@ type ConcurrentFloodPayload struct {
 	MaintainSecond DuckInt `json:"maintain_second"` // Duration of the simulation.
 	Async          bool    `json:"async"`
 	IntervalSecond DuckInt `json:"interval_second"` // Interval between bursts.
+	ConnectionMode string  `json:"connection_mode"` // "reuse" (default) or "churn".
+	ProxyURL       string  `json:"proxy_url"`       // Overrides HTTP(S)_PROXY; "direct" bypasses it.
 }
 
 // ConcurrentFloodHandler handles POST /stress/concurrent_flood.
 func ConcurrentFloodHandler(c *gin.Context) {
 	var payload ConcurrentFloodPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -31,33 +35,49 @@ func ConcurrentFloodHandler(c *gin.Context) {
 	reqCount := int(payload.RequestCount)
 	intervalSec := int(payload.IntervalSecond)
 	target := payload.TargetEndpoint
+	if err := checkProxyAllowed(payload.ProxyURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	client, err := newOutboundClient(5*time.Second, payload.ConnectionMode, payload.ProxyURL)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	// Build the full URL: assume the target endpoint is relative; use current host.
+	fullURL := fmt.Sprintf("http://%s%s", c.Request.Host, target)
+	if err := checkTargetAllowed(fullURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
 
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
 	// Define a function to run the flood.
-	floodFunc := func() {
+	floodFunc := func(ctx context.Context) {
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		client := &http.Client{Timeout: 5 * time.Second}
-		// Build the full URL: assume the target endpoint is relative; use current host.
-		fullURL := fmt.Sprintf("http://%s%s", c.Request.Host, target)
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			var wg sync.WaitGroup
 			for i := 0; i < reqCount; i++ {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
 					// We ignore the response; errors are logged.
-					if _, err := client.Get(fullURL); err != nil {
-						fmt.Println("concurrent flood request failed", zap.Error(err))
+					resp, err := client.Get(fullURL)
+					if err != nil {
+						logWarn("concurrent flood request failed", zap.Bool("proxy_error", isProxyError(err)), zap.Error(err))
+						return
 					}
+					discardResponse(resp)
 				}()
 			}
 			wg.Wait()
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
-		fmt.Println("Concurrent flood simulation completed", zap.Int("duration_sec", maintainSec))
+		logInfo("Concurrent flood simulation completed", zap.Int("duration_sec", maintainSec))
 	}
 
 	if payload.Async {
-		go floodFunc()
+		go job.run(floodFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "concurrent flood simulation started",
 			"target_endpoint": target,
@@ -66,7 +86,7 @@ func ConcurrentFloodHandler(c *gin.Context) {
 			"interval_second": intervalSec,
 		})
 	} else {
-		floodFunc()
+		job.run(floodFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "concurrent flood simulation completed",
 			"target_endpoint": target,
@@ -83,56 +103,58 @@ type DowntimePayload struct {
 	Async          bool    `json:"async"`
 }
 
-// Global variable to control downtime.
-var (
-	downtimeActive bool
-	downtimeMutex  sync.Mutex
-)
-
 // DowntimeHandler handles POST /stress/downtime.
 func DowntimeHandler(c *gin.Context) {
 	var payload DowntimePayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	downtimeSec := int(payload.DowntimeSecond)
+	ns := getNamespace(c)
 
 	// Activate downtime.
-	downtimeMutex.Lock()
-	downtimeActive = true
-	downtimeMutex.Unlock()
-	fmt.Println("Downtime simulation started", zap.Int("downtime_sec", downtimeSec))
+	expiry := time.Now().Add(time.Duration(downtimeSec) * time.Second)
+	faultState.Update(ns, func(f *faultSnapshot) {
+		f.DowntimeExpiry = expiry
+	})
+	logInfo("Downtime simulation started", zap.String("namespace", ns), zap.Int("downtime_sec", downtimeSec))
 
-	resetFunc := func() {
-		time.Sleep(time.Duration(downtimeSec) * time.Second)
-		downtimeMutex.Lock()
-		downtimeActive = false
-		downtimeMutex.Unlock()
-		fmt.Println("Downtime simulation ended")
+	job := startJob(c, time.Duration(downtimeSec)*time.Second)
+	resetFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Until(expiry)) {
+			// Cancelled: end the downtime unless a later request replaced it.
+			faultState.Update(ns, func(f *faultSnapshot) {
+				if f.DowntimeExpiry.Equal(expiry) {
+					f.DowntimeExpiry = time.Now()
+				}
+			})
+		}
+		logInfo("Downtime simulation ended", zap.String("namespace", ns))
 	}
 
 	if payload.Async {
-		go resetFunc()
+		go job.run(resetFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "downtime simulation started",
+			"namespace":       ns,
 			"downtime_second": downtimeSec,
 		})
 	} else {
-		resetFunc()
+		job.run(resetFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "downtime simulation completed",
+			"namespace":       ns,
 			"downtime_second": downtimeSec,
 		})
 	}
 }
 
-// DowntimeMiddleware intercepts requests when downtime is active.
+// DowntimeMiddleware intercepts requests when downtime is active, globally or for the
+// request's namespace.
 func DowntimeMiddleware(c *gin.Context) {
-	downtimeMutex.Lock()
-	active := downtimeActive
-	downtimeMutex.Unlock()
-	if active {
+	if faultState.Effective(getNamespace(c), time.Now()).down(time.Now()) {
+		markInjectedFault(c, "downtime")
 		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
 			"error":        "SERVICE_DOWN",
 			"message":      "Service is temporarily unavailable",
@@ -151,12 +173,121 @@ type ThirdPartyPayload struct {
 	CallRate       DuckInt `json:"call_rate"`       // Number of calls per interval.
 	IntervalSecond DuckInt `json:"interval_second"` // Interval between bursts.
 	SimulateErrors bool    `json:"simulate_errors"`
+	ConnectionMode string  `json:"connection_mode"` // "reuse" (default) or "churn".
+	ProxyURL       string  `json:"proxy_url"`       // Overrides HTTP(S)_PROXY; "direct" bypasses it.
+	MaxRetries     DuckInt `json:"max_retries"`     // Retries per call after a failed attempt.
+	BackoffMs      DuckInt `json:"backoff_ms"`      // Base retry backoff, doubled on every retry.
+	HedgeDelayMs   DuckInt `json:"hedge_delay_ms"`  // If set, a duplicate request is sent when an attempt is slower than this.
+}
+
+// thirdPartyStats counts logical calls and the outbound requests they caused,
+// so the load amplification of retries and hedging can be reported.
+type thirdPartyStats struct {
+	calls     int64
+	requests  int64
+	retries   int64
+	hedges    int64
+	succeeded int64
+	failed    int64
+}
+
+func (s *thirdPartyStats) toMap() gin.H {
+	calls := atomic.LoadInt64(&s.calls)
+	requests := atomic.LoadInt64(&s.requests)
+	amplification := 0.0
+	if calls > 0 {
+		amplification = float64(requests) / float64(calls)
+	}
+	return gin.H{
+		"calls":         calls,
+		"requests":      requests,
+		"retries":       atomic.LoadInt64(&s.retries),
+		"hedges":        atomic.LoadInt64(&s.hedges),
+		"succeeded":     atomic.LoadInt64(&s.succeeded),
+		"failed":        atomic.LoadInt64(&s.failed),
+		"amplification": amplification,
+	}
+}
+
+// thirdPartyRetryPolicy holds the retry and hedging options of a third-party simulation.
+type thirdPartyRetryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	hedgeDelay time.Duration
+}
+
+// callThirdParty performs one logical call, retrying failed attempts with exponential
+// backoff and jitter according to policy.
+func callThirdParty(client *http.Client, targetURL string, simErr bool, policy thirdPartyRetryPolicy, stats *thirdPartyStats) {
+	atomic.AddInt64(&stats.calls, 1)
+	for attempt := 0; attempt <= policy.maxRetries; attempt++ {
+		if attempt > 0 {
+			atomic.AddInt64(&stats.retries, 1)
+			if policy.backoff > 0 {
+				shift := attempt - 1
+				if shift > 10 {
+					shift = 10
+				}
+				wait := policy.backoff << shift
+				time.Sleep(wait + time.Duration(rand.Int63n(int64(policy.backoff))))
+			}
+		}
+		if thirdPartyAttempt(client, targetURL, simErr, policy.hedgeDelay, stats) {
+			atomic.AddInt64(&stats.succeeded, 1)
+			return
+		}
+	}
+	atomic.AddInt64(&stats.failed, 1)
+}
+
+// thirdPartyAttempt sends a request and, if hedgeDelay is set and the request has not
+// completed in time, a duplicate one. It reports whether either request succeeded.
+// Responses with status 429 or 5xx count as failures.
+func thirdPartyAttempt(client *http.Client, targetURL string, simErr bool, hedgeDelay time.Duration, stats *thirdPartyStats) bool {
+	results := make(chan bool, 2)
+	send := func() {
+		// If simulate_errors is enabled, randomly decide to inject an error.
+		if simErr && rand.Float64() < 0.2 {
+			logWarn("Simulated third-party call error")
+			results <- false
+			return
+		}
+		atomic.AddInt64(&stats.requests, 1)
+		resp, err := client.Get(targetURL)
+		if err != nil {
+			logWarn("Third-party API call failed", zap.Bool("proxy_error", isProxyError(err)), zap.Error(err))
+			results <- false
+			return
+		}
+		discardResponse(resp)
+		results <- resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+	}
+	go send()
+	if hedgeDelay <= 0 {
+		return <-results
+	}
+	timer := time.NewTimer(hedgeDelay)
+	defer timer.Stop()
+	select {
+	case ok := <-results:
+		return ok
+	case <-timer.C:
+		atomic.AddInt64(&stats.hedges, 1)
+		go send()
+	}
+	// Use whichever request succeeds first; the other one is left to finish on its own.
+	for i := 0; i < 2; i++ {
+		if <-results {
+			return true
+		}
+	}
+	return false
 }
 
 // ThirdPartyHandler handles POST /stress/third_party.
 func ThirdPartyHandler(c *gin.Context) {
 	var payload ThirdPartyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -165,34 +296,46 @@ func ThirdPartyHandler(c *gin.Context) {
 	intervalSec := int(payload.IntervalSecond)
 	targetURL := payload.TargetURL
 	simErr := payload.SimulateErrors
+	if err := checkTargetAllowed(targetURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	if err := checkProxyAllowed(payload.ProxyURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	client, err := newOutboundClient(5*time.Second, payload.ConnectionMode, payload.ProxyURL)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	policy := thirdPartyRetryPolicy{
+		maxRetries: int(payload.MaxRetries),
+		backoff:    time.Duration(payload.BackoffMs) * time.Millisecond,
+		hedgeDelay: time.Duration(payload.HedgeDelayMs) * time.Millisecond,
+	}
+	stats := &thirdPartyStats{}
 
-	floodFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	floodFunc := func(ctx context.Context) {
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		client := &http.Client{Timeout: 5 * time.Second}
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			var wg sync.WaitGroup
 			for i := 0; i < callRate; i++ {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
-					// If simulate_errors is enabled, randomly decide to inject an error.
-					if simErr && rand.Float64() < 0.2 {
-						fmt.Println("Simulated third-party call error")
-						return
-					}
-					if _, err := client.Get(targetURL); err != nil {
-						fmt.Println("Third-party API call failed", zap.Error(err))
-					}
+					callThirdParty(client, targetURL, simErr, policy, stats)
 				}()
 			}
 			wg.Wait()
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
-		fmt.Println("Third-party API call simulation completed", zap.Int("duration_sec", maintainSec))
+		logInfo("Third-party API call simulation completed", zap.Int("duration_sec", maintainSec))
 	}
 
 	if payload.Async {
-		go floodFunc()
+		go job.run(floodFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "third-party API call simulation started",
 			"target_url":      targetURL,
@@ -200,9 +343,12 @@ func ThirdPartyHandler(c *gin.Context) {
 			"call_rate":       callRate,
 			"interval_second": intervalSec,
 			"simulate_errors": simErr,
+			"max_retries":     policy.maxRetries,
+			"backoff_ms":      int(payload.BackoffMs),
+			"hedge_delay_ms":  int(payload.HedgeDelayMs),
 		})
 	} else {
-		floodFunc()
+		job.run(floodFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "third-party API call simulation completed",
 			"target_url":      targetURL,
@@ -210,6 +356,10 @@ func ThirdPartyHandler(c *gin.Context) {
 			"call_rate":       callRate,
 			"interval_second": intervalSec,
 			"simulate_errors": simErr,
+			"max_retries":     policy.maxRetries,
+			"backoff_ms":      int(payload.BackoffMs),
+			"hedge_delay_ms":  int(payload.HedgeDelayMs),
+			"results":         stats.toMap(),
 		})
 	}
 }
@@ -221,12 +371,13 @@ type DDoSPayload struct {
 	MaintainSecond  DuckInt `json:"maintain_second"`
 	Async           bool    `json:"async"`
 	IntervalSecond  DuckInt `json:"interval_second"`
+	ConnectionMode  string  `json:"connection_mode"` // "reuse" (default) or "churn".
 }
 
 // DDoSHandler handles POST /stress/ddos.
 func DDoSHandler(c *gin.Context) {
 	var payload DDoSPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -234,30 +385,42 @@ func DDoSHandler(c *gin.Context) {
 	attackIntensity := int(payload.AttackIntensity)
 	intervalSec := int(payload.IntervalSecond)
 	target := payload.TargetEndpoint
+	client, err := newOutboundClient(5*time.Second, payload.ConnectionMode, "")
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	fullURL := fmt.Sprintf("http://%s%s", c.Request.Host, target)
+	if err := checkTargetAllowed(fullURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
 
-	ddosFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	ddosFunc := func(ctx context.Context) {
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		client := &http.Client{Timeout: 5 * time.Second}
-		fullURL := fmt.Sprintf("http://%s%s", c.Request.Host, target)
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			var wg sync.WaitGroup
 			for i := 0; i < attackIntensity; i++ {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
-					if _, err := client.Get(fullURL); err != nil {
-						fmt.Println("DDoS attack request failed", zap.Error(err))
+					resp, err := client.Get(fullURL)
+					if err != nil {
+						logWarn("DDoS attack request failed", zap.Error(err))
+						return
 					}
+					discardResponse(resp)
 				}()
 			}
 			wg.Wait()
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
-		fmt.Println("DDoS attack simulation completed", zap.Int("duration_sec", maintainSec))
+		logInfo("DDoS attack simulation completed", zap.Int("duration_sec", maintainSec))
 	}
 
 	if payload.Async {
-		go ddosFunc()
+		go job.run(ddosFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":          "DDoS attack simulation started",
 			"target_endpoint":  target,
@@ -266,7 +429,7 @@ func DDoSHandler(c *gin.Context) {
 			"interval_second":  intervalSec,
 		})
 	} else {
-		ddosFunc()
+		job.run(ddosFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":          "DDoS attack simulation completed",
 			"target_endpoint":  target,
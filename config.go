@@ -112,6 +112,81 @@ func initConfig() {
 	_ = viper.ReadInConfig() // ignore error, use defaults if no file
 	viper.AutomaticEnv()     // read environment variables
 	viper.SetDefault("LOG_FORMAT", "apache")
+	viper.SetDefault("APP_LOG_ENCODING", "json")
+	viper.SetDefault("APP_LOG_LEVEL", "info")
+	viper.SetDefault("SMTP_PORT", "587")
+	viper.SetDefault("SFTP_PORT", "22")
+	viper.SetDefault("SFTP_REMOTE_DIR", ".")
+	viper.SetDefault("HTTP_CLIENT_MAX_IDLE_CONNS", 1000)
+	viper.SetDefault("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", 100)
+	viper.SetDefault("HTTP_CLIENT_MAX_CONNS_PER_HOST", 0)
+	viper.SetDefault("HTTP_CLIENT_IDLE_CONN_TIMEOUT_SECOND", 90)
+	viper.SetDefault("HTTP_CLIENT_TLS_INSECURE_SKIP_VERIFY", false)
+	viper.SetDefault("HTTP_CLIENT_HTTP2_ENABLED", true)
+	viper.SetDefault("SERVER_TIMING_ENABLED", false)
+	viper.SetDefault("SQLITE_PATH", "/tmp/biggie.sqlite")
+	viper.SetDefault("MOCK_SERVERS_ENABLED", false)
+	viper.SetDefault("MOCK_HTTP_PORT", 18080)
+	viper.SetDefault("MOCK_REDIS_PORT", 16379)
+	viper.SetDefault("MOCK_TCP_PORT", 15432)
+	viper.SetDefault("STARTUP_DEPENDENCY_RETRIES", 3)
+	viper.SetDefault("STARTUP_DEPENDENCY_BACKOFF_SECOND", 2)
+	viper.SetDefault("STARTUP_DEPENDENCY_MAX_BACKOFF_SECOND", 30)
+	viper.SetDefault("STARTUP_DEPENDENCY_EXIT_CODE", 1)
+	viper.SetDefault("STARTUP_CRASH_LOOP_COUNT", 0)
+	viper.SetDefault("STARTUP_CRASH_LOOP_FILE", "")
+	viper.SetDefault("READINESS_CHECK_INTERVAL_SECOND", 5)
+	viper.SetDefault("STARTUP_SMOKE_TEST", false)
+	viper.SetDefault("STARTUP_SMOKE_TEST_STRESS", false)
+	viper.SetDefault("STRESS_TOOLS", "stress-ng,fio")
+	viper.SetDefault("STRESS_TOOL_DIR", "/tmp")
+	viper.SetDefault("CHAOS_WINDOW_REQUIRED", false)
+	viper.SetDefault("CHAOS_WINDOW_MAX_SECOND", 3600)
+	viper.SetDefault("NOTIFY_SLACK_WEBHOOK_URL", "")
+	viper.SetDefault("NOTIFY_PAGERDUTY_ROUTING_KEY", "")
+	viper.SetDefault("NOTIFY_PAGERDUTY_URL", "https://events.pagerduty.com/v2/enqueue")
+	viper.SetDefault("NOTIFY_PAGERDUTY_SEVERITY", "warning")
+	viper.SetDefault("EVENTS_HISTORY_SIZE", 1000)
+	viper.SetDefault("TRACE_EXEMPLARS_ENABLED", false)
+	viper.SetDefault("METRICS_NOISE_MAX_SERIES", 100000)
+	viper.SetDefault("LABEL_EXPLOSION_MAX_SERIES", 100000)
+	viper.SetDefault("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	viper.SetDefault("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	viper.SetDefault("OTEL_EXPORTER_OTLP_HEADERS", "")
+	viper.SetDefault("OTEL_EXPORTER_OTLP_COMPRESSION", "")
+	viper.SetDefault("OTEL_SERVICE_NAME", "biggie")
+	viper.SetDefault("STATE_PERSISTENCE", "")
+	viper.SetDefault("STATE_FILE", "biggie-state.json")
+	viper.SetDefault("STATE_REDIS_KEY", "biggie:state")
+	viper.SetDefault("CALIBRATION_ON_STARTUP", false)
+	viper.SetDefault("CALIBRATION_REFERENCE_CPU_OPS", 0)
+	viper.SetDefault("CALIBRATION_REFERENCE_DISK_MBPS", 0)
+	viper.SetDefault("CALIBRATION_REFERENCE_MEMORY_MBPS", 0)
+	viper.SetDefault("SIMPLE_LARGE_MAX_BYTES", 10*1024*1024*1024)
+	viper.SetDefault("SLOW_READ_MAX_BYTES_PER_SECOND", 100*1024*1024)
+	viper.SetDefault("GRAPHQL_MAX_DEPTH", 50)
+	viper.SetDefault("GRAPHQL_MAX_ALIASES", 1000)
+	viper.SetDefault("STATIC_DIR", "")
+	viper.SetDefault("STATIC_CACHE_CONTROL", "")
+	viper.SetDefault("REQUEST_BODY_CAPTURE_LIMIT", 1024*1024)
+	viper.SetDefault("REQUEST_DECOMPRESSION_ENABLED", true)
+	viper.SetDefault("REQUEST_DECOMPRESSION_MAX_BYTES", 10*1024*1024)
+	viper.SetDefault("LATENCY_MAX_DELAYED_REQUESTS", 10000)
+	viper.SetDefault("REQUEST_TIMEOUT_MS", 0)
+	viper.SetDefault("REQUEST_TIMEOUT_ROUTES", "")
+	viper.SetDefault("H2C_ENABLED", false)
+	viper.SetDefault("UNIX_SOCKET_PATH", "")
+	viper.SetDefault("UNIX_SOCKET_MODE", "0666")
+	viper.SetDefault("PORT_PERSONAS", "")
+	viper.SetDefault("ACCESS_LOG_ENABLED", true)
+	viper.SetDefault("ACCESS_LOG_SAMPLE_RATE", 1)
+	viper.SetDefault("ACCESS_LOG_ALWAYS_ERRORS", true)
+	viper.SetDefault("ACCESS_LOG_MAX_PER_SECOND", 0)
+	viper.SetDefault("FANOUT_DOWNSTREAMS", "")
+	viper.SetDefault("FANOUT_MAX_HOPS", 5)
+
+	initLogger(viper.GetString("APP_LOG_ENCODING"), viper.GetString("APP_LOG_LEVEL"))
+	initAccessLog()
 
 	logFormat := viper.GetString("LOG_FORMAT")
 	switch strings.ToLower(logFormat) {
@@ -127,16 +202,20 @@ func initConfig() {
 		// If user supplied custom format with placeholders, use it.
 		globalLogFormat = logFormat
 	}
-	// Print the selected global log format.
-	fmt.Println("Global Log Format:", globalLogFormat)
+	// Log the selected global log format.
+	logInfo("global log format selected", zap.String("format", globalLogFormat))
 }
 
+// listenPort is the port of the main listener, set at startup, so that features can send
+// requests to this instance.
+var listenPort = 8080
+
 // processPort reads the PORT env variable and uses processRandomInt to support "RANDOM" values.
 func processPort() int {
 	portStr := viper.GetString("PORT")
 	port, err := processRandomInt(portStr, 1024, 65535)
 	if err != nil {
-		fmt.Println("invalid PORT env var", zap.Error(err))
+		logWarn("invalid PORT env var", zap.Error(err))
 		return 8080
 	}
 	return port
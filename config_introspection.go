@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// Sources of a configuration value.
+const (
+	configSourceEnv     = "env"
+	configSourceFile    = "file"
+	configSourceSecret  = "secret"
+	configSourceDefault = "default"
+	configSourceUnset   = "unset"
+)
+
+// configExtraKeys are the settings read without a default, which viper does not list.
+var configExtraKeys = []string{
+	"PORT", "STARTUP_DELAY_SECOND", "STARTUP_DEPENDENCIES", "READINESS_DEPENDENCIES",
+	"AWS_REGION", "AVAILABILITY_ZONE", "AZ_FAILURE_MODE", "AZ_FAILURE_ZONES",
+	"DB_ENGINE", "TARGET_ALLOWLIST", "RANDOM_HTML_API_COLOR",
+	"MYSQL_SECRET", "MYSQL_DBINFO", "MYSQL_HOST", "MYSQL_PORT", "MYSQL_USERNAME", "MYSQL_PASSWORD", "MYSQL_DBNAME", "MYSQL_READER_HOST",
+	"POSTGRES_SECRET", "POSTGRES_DBINFO", "POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USERNAME", "POSTGRES_PASSWORD", "POSTGRES_DBNAME", "POSTGRES_READER_HOST",
+	"REDSHIFT_SECRET", "REDSHIFT_DBINFO", "REDSHIFT_HOST", "REDSHIFT_PORT", "REDSHIFT_USERNAME", "REDSHIFT_PASSWORD", "REDSHIFT_DBNAME",
+	"REDIS_HOST", "REDIS_PORT", "REDIS_TLS_ENABLED",
+	"KAFKA_SERVERS", "KAFKA_TLS_ENABLED", "KAFKA_TOPIC",
+	"SMTP_HOST", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM", "SMTP_TO", "SMTP_TLS_ENABLED",
+	"SFTP_HOST", "SFTP_USERNAME", "SFTP_PASSWORD", "SFTP_PRIVATE_KEY",
+}
+
+// sensitiveConfigKey matches the settings holding credentials. DBINFO holds a JSON document
+// with a password, Slack webhook URLs embed their token and OTLP headers usually carry an API key.
+var sensitiveConfigKey = regexp.MustCompile(`PASSWORD|PRIVATE_KEY|ROUTING_KEY|TOKEN|DBINFO|WEBHOOK_URL|OTLP_HEADERS`)
+
+// maskedValue replaces a credential.
+const maskedValue = "********"
+
+// maskConfigValue masks the value of key if it is a credential, and the password of URLs.
+func maskConfigValue(key string, value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if sensitiveConfigKey.MatchString(key) {
+		if s == "" {
+			return ""
+		}
+		return maskedValue
+	}
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), maskedValue)
+			return u.String()
+		}
+	}
+	return s
+}
+
+// configKeySource returns where the effective value of key comes from. The environment
+// overrides the config file, which overrides the defaults.
+func configKeySource(key string) string {
+	if _, ok := os.LookupEnv(key); ok {
+		return configSourceEnv
+	}
+	if viper.InConfig(key) {
+		return configSourceFile
+	}
+	if viper.IsSet(key) {
+		return configSourceDefault
+	}
+	return configSourceUnset
+}
+
+// configSetting describes one setting: its effective value, its source, and the values of
+// the sources it shadows.
+func configSetting(key string) gin.H {
+	source := configKeySource(key)
+	setting := gin.H{"value": maskConfigValue(key, viper.Get(key)), "source": source}
+	if source == configSourceEnv && viper.InConfig(key) {
+		// viper.Get returns the environment value; read the file value from its config map.
+		setting["shadowed"] = gin.H{configSourceFile: maskConfigValue(key, fileConfigValue(key))}
+	}
+	return setting
+}
+
+// fileConfigValue returns the value of key in the config file.
+func fileConfigValue(key string) interface{} {
+	file := viper.New()
+	file.SetConfigFile(viper.ConfigFileUsed())
+	if file.ReadInConfig() != nil {
+		return nil
+	}
+	return file.Get(key)
+}
+
+// databaseConfigView describes the endpoint of a database and where it was configured, in the
+// order GetMySQLConfig, GetPostgresConfig and GetRedshiftConfig resolve it.
+func databaseConfigView(prefix string, secretConfig interface{}, resolve func() (gin.H, error)) gin.H {
+	view := gin.H{}
+	var ignored []string
+	secretName := viper.GetString(prefix + "_SECRET")
+	region := viper.GetString("AWS_REGION")
+	switch {
+	case region != "" && viper.IsSet(prefix+"_SECRET") && secretUsable(secretName, region, secretConfig):
+		view["source"], view["via"] = configSourceSecret, prefix+"_SECRET"
+		ignored = []string{prefix + "_DBINFO", prefix + "_HOST"}
+	case viper.IsSet(prefix + "_DBINFO"):
+		view["source"], view["via"] = configKeySource(prefix+"_DBINFO"), prefix+"_DBINFO"
+		ignored = []string{prefix + "_HOST"}
+	case viper.GetString(prefix+"_HOST") != "":
+		view["source"], view["via"] = configKeySource(prefix+"_HOST"), prefix+"_HOST"
+	default:
+		view["source"] = configSourceUnset
+	}
+	if viper.IsSet(prefix+"_SECRET") && view["source"] != configSourceSecret {
+		view["warning"] = fmt.Sprintf("%s is set but could not be used (AWS_REGION %q), falling back", prefix+"_SECRET", region)
+	}
+	var shadowed []string
+	for _, key := range ignored {
+		if viper.GetString(key) != "" {
+			shadowed = append(shadowed, key)
+		}
+	}
+	if len(shadowed) > 0 {
+		view["ignored"] = shadowed
+	}
+	if endpoint, err := resolve(); err == nil {
+		for k, v := range endpoint {
+			view[k] = v
+		}
+	} else {
+		view["error"] = err.Error()
+	}
+	return view
+}
+
+// secretUsable reports whether the secret can be fetched and decoded into cfg, the condition
+// for the database configuration to come from it.
+func secretUsable(secretName, region string, cfg interface{}) bool {
+	secret, err := fetchSecret(secretName, region)
+	return err == nil && json.Unmarshal([]byte(secret), cfg) == nil
+}
+
+// dependencyConfigViews describes the endpoint of every dependency, with credentials masked.
+func dependencyConfigViews() gin.H {
+	endpoint := func(host string, port int, dbName, username, password string) gin.H {
+		return gin.H{
+			"host":     host,
+			"port":     port,
+			"dbname":   dbName,
+			"username": username,
+			"password": maskConfigValue("PASSWORD", password),
+		}
+	}
+	views := gin.H{
+		"mysql": databaseConfigView("MYSQL", &MySQLConfig{}, func() (gin.H, error) {
+			cfg, err := GetMySQLConfig()
+			if err != nil {
+				return nil, err
+			}
+			view := endpoint(cfg.Host, cfg.Port, cfg.DBName, cfg.Username, cfg.Password)
+			view["reader_host"] = cfg.ReaderHost
+			if host := viper.GetString("MYSQL_READER_HOST"); host != "" {
+				view["reader_host"] = host
+			}
+			return view, nil
+		}),
+		"postgres": databaseConfigView("POSTGRES", &PostgresConfig{}, func() (gin.H, error) {
+			cfg, err := GetPostgresConfig()
+			if err != nil {
+				return nil, err
+			}
+			view := endpoint(cfg.Host, cfg.Port, cfg.DBName, cfg.Username, cfg.Password)
+			view["reader_host"] = cfg.ReaderHost
+			if host := viper.GetString("POSTGRES_READER_HOST"); host != "" {
+				view["reader_host"] = host
+			}
+			return view, nil
+		}),
+		"redshift": databaseConfigView("REDSHIFT", &RedshiftConfig{}, func() (gin.H, error) {
+			cfg, err := GetRedshiftConfig()
+			if err != nil {
+				return nil, err
+			}
+			return endpoint(cfg.Host, cfg.Port, cfg.DBName, cfg.Username, cfg.Password), nil
+		}),
+	}
+	if cfg, err := GetRedisConfig(); err == nil {
+		views["redis"] = gin.H{"source": configKeySource("REDIS_HOST"), "host": cfg.Host, "port": cfg.Port, "tls": cfg.TLSEnabled}
+	} else {
+		views["redis"] = gin.H{"source": configKeySource("REDIS_HOST"), "error": err.Error()}
+	}
+	if cfg, err := GetKafkaConfig(); err == nil {
+		views["kafka"] = gin.H{"source": configKeySource("KAFKA_SERVERS"), "servers": cfg.Servers, "topic": cfg.Topic, "tls": cfg.TLSEnabled}
+	} else {
+		views["kafka"] = gin.H{"source": configKeySource("KAFKA_SERVERS"), "error": err.Error()}
+	}
+	if cfg, err := GetSMTPConfig(); err == nil {
+		views["smtp"] = gin.H{"source": configKeySource("SMTP_HOST"), "host": cfg.Host, "port": cfg.Port, "username": cfg.Username, "password": maskConfigValue("PASSWORD", cfg.Password), "from": cfg.From, "to": cfg.To, "tls": cfg.TLSEnabled}
+	} else {
+		views["smtp"] = gin.H{"source": configKeySource("SMTP_HOST"), "error": err.Error()}
+	}
+	if cfg, err := GetSFTPConfig(); err == nil {
+		views["sftp"] = gin.H{"source": configKeySource("SFTP_HOST"), "host": cfg.Host, "port": cfg.Port, "username": cfg.Username, "password": maskConfigValue("PASSWORD", cfg.Password), "private_key": maskConfigValue("PRIVATE_KEY", cfg.PrivateKey), "remote_dir": cfg.RemoteDir}
+	} else {
+		views["sftp"] = gin.H{"source": configKeySource("SFTP_HOST"), "error": err.Error()}
+	}
+	return views
+}
+
+// ConfigHandler handles GET /admin/config.
+// It returns the effective value of every setting and where it comes from (env, file or
+// default), the file values shadowed by the environment, and the dependency endpoints with the
+// source they were resolved from (including AWS Secrets Manager). Credentials are masked.
+func ConfigHandler(c *gin.Context) {
+	keys := map[string]bool{}
+	for _, key := range viper.AllKeys() {
+		keys[strings.ToUpper(key)] = true
+	}
+	for _, key := range configExtraKeys {
+		keys[key] = true
+	}
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	settings := gin.H{}
+	for _, key := range names {
+		settings[key] = configSetting(key)
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"config_file":  viper.ConfigFileUsed(),
+		"settings":     settings,
+		"dependencies": dependencyConfigViews(),
+	})
+}
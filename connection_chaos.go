@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ConnectionChaosPayload defines the payload for the connection-level chaos simulation.
+type ConnectionChaosPayload struct {
+	DisableKeepAlive bool    `json:"disable_keepalive"` // Close the connection after every response.
+	ClosePercent     DuckInt `json:"close_percent"`     // Percentage of responses sent with Connection: close.
+	IdleCloseMs      DuckInt `json:"idle_close_ms"`     // Close connections idle for this long; 0 disables.
+	MaintainSecond   DuckInt `json:"maintain_second"`
+	Async            bool    `json:"async"`
+}
+
+// connectionStats counts client connections of the main server.
+type connectionStats struct {
+	opened      int64
+	open        int64
+	forcedClose int64 // Responses sent with Connection: close by the simulation.
+	idleClosed  int64 // Idle connections closed by the simulation.
+}
+
+func (s *connectionStats) toMap() gin.H {
+	return gin.H{
+		"opened":       atomic.LoadInt64(&s.opened),
+		"open":         atomic.LoadInt64(&s.open),
+		"forced_close": atomic.LoadInt64(&s.forcedClose),
+		"idle_closed":  atomic.LoadInt64(&s.idleClosed),
+	}
+}
+
+// Global variables for connection-level chaos.
+var (
+	connChaosMutex     sync.Mutex
+	connChaosExpiry    = time.Now()
+	connChaosKeepAlive = true
+	connChaosPercent   int
+	connChaosIdleClose time.Duration
+
+	connStats      = &connectionStats{}
+	idleConnsMutex sync.Mutex
+	idleConns      = map[net.Conn]*time.Timer{} // Idle connections, with their close timer while idle_close_ms is active.
+)
+
+// connectionChaos returns the active settings, or ok false when the simulation is off.
+func connectionChaos() (keepAlive bool, closePercent int, idleClose time.Duration, ok bool) {
+	connChaosMutex.Lock()
+	defer connChaosMutex.Unlock()
+	if !time.Now().Before(connChaosExpiry) {
+		return true, 0, 0, false
+	}
+	return connChaosKeepAlive, connChaosPercent, connChaosIdleClose, true
+}
+
+// connectionChaosStatus returns the current simulation state and connection counters.
+func connectionChaosStatus() gin.H {
+	keepAlive, closePercent, idleClose, active := connectionChaos()
+	connChaosMutex.Lock()
+	remaining := remainingSecond(time.Now(), connChaosExpiry)
+	connChaosMutex.Unlock()
+	return gin.H{
+		"active":            active,
+		"disable_keepalive": !keepAlive,
+		"close_percent":     closePercent,
+		"idle_close_ms":     idleClose.Milliseconds(),
+		"remaining_second":  remaining,
+		"connections":       connStats.toMap(),
+	}
+}
+
+// closeIdleConn closes conn if it is still idle.
+func closeIdleConn(conn net.Conn) {
+	idleConnsMutex.Lock()
+	_, idle := idleConns[conn]
+	delete(idleConns, conn)
+	idleConnsMutex.Unlock()
+	if idle {
+		conn.Close()
+		atomic.AddInt64(&connStats.idleClosed, 1)
+	}
+}
+
+// trackConnState is the ConnState hook of the main server. It counts connections and, while
+// idle_close_ms is active, closes connections that stay idle for longer.
+func trackConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&connStats.opened, 1)
+		atomic.AddInt64(&connStats.open, 1)
+	case http.StateIdle:
+		keepAlive, _, idleClose, active := connectionChaos()
+		var timer *time.Timer
+		switch {
+		case active && !keepAlive:
+			// Keep-alive is disabled: do not let the connection wait for another request.
+			timer = time.AfterFunc(0, func() { closeIdleConn(conn) })
+		case active && idleClose > 0:
+			timer = time.AfterFunc(idleClose, func() { closeIdleConn(conn) })
+		}
+		idleConnsMutex.Lock()
+		if prev := idleConns[conn]; prev != nil {
+			prev.Stop()
+		}
+		idleConns[conn] = timer
+		idleConnsMutex.Unlock()
+	case http.StateActive, http.StateHijacked, http.StateClosed:
+		idleConnsMutex.Lock()
+		if timer := idleConns[conn]; timer != nil {
+			timer.Stop()
+		}
+		delete(idleConns, conn)
+		idleConnsMutex.Unlock()
+		if state != http.StateActive {
+			atomic.AddInt64(&connStats.open, -1)
+		}
+	}
+}
+
+// ConnectionChaosHandler handles POST /stress/connections.
+// For maintain_second it disables keep-alive, sends Connection: close on close_percent of
+// responses and/or closes connections idle for idle_close_ms, so client connection pools
+// churn and load balancer connection reuse can be observed.
+func ConnectionChaosHandler(c *gin.Context) {
+	var payload ConnectionChaosPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	closePercent := int(payload.ClosePercent)
+	idleCloseMs := int(payload.IdleCloseMs)
+	if closePercent < 0 || closePercent > 100 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "close_percent must be between 0 and 100")
+		return
+	}
+	if idleCloseMs < 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "idle_close_ms must not be negative")
+		return
+	}
+	if !payload.DisableKeepAlive && closePercent == 0 && idleCloseMs == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "disable_keepalive, close_percent or idle_close_ms is required")
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	connChaosMutex.Lock()
+	connChaosKeepAlive = !payload.DisableKeepAlive
+	connChaosPercent = closePercent
+	connChaosIdleClose = time.Duration(idleCloseMs) * time.Millisecond
+	connChaosExpiry = time.Now().Add(time.Duration(maintainSec) * time.Second)
+	expiry := connChaosExpiry
+	connChaosMutex.Unlock()
+	recordFaultActivated("connections", "", gin.H{
+		"disable_keepalive": payload.DisableKeepAlive,
+		"close_percent":     closePercent,
+		"idle_close_ms":     idleCloseMs,
+	}, expiry)
+	atomic.StoreInt64(&connStats.forcedClose, 0)
+	atomic.StoreInt64(&connStats.idleClosed, 0)
+
+	// Connections already idle would otherwise wait for their next request.
+	idleConnsMutex.Lock()
+	idle := make([]net.Conn, 0, len(idleConns))
+	for conn := range idleConns {
+		idle = append(idle, conn)
+	}
+	idleConnsMutex.Unlock()
+	for _, conn := range idle {
+		trackConnState(conn, http.StateIdle)
+	}
+	logInfo("Connection chaos started",
+		zap.Bool("disable_keepalive", payload.DisableKeepAlive),
+		zap.Int("close_percent", closePercent),
+		zap.Int("idle_close_ms", idleCloseMs),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the connection chaos unless a later request replaced it.
+			connChaosMutex.Lock()
+			ours := connChaosExpiry.Equal(expiry)
+			if ours {
+				connChaosExpiry = time.Now()
+			}
+			connChaosMutex.Unlock()
+			if ours {
+				recordFaultDeactivated("connections", "", "cancelled")
+			}
+		}
+		logInfo("Connection chaos ended", zap.Any("connections", connStats.toMap()))
+	}
+
+	if payload.Async {
+		go job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":           "connection chaos started",
+			"disable_keepalive": payload.DisableKeepAlive,
+			"close_percent":     closePercent,
+			"idle_close_ms":     idleCloseMs,
+			"maintain_second":   maintainSec,
+		})
+	} else {
+		job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":           "connection chaos completed",
+			"disable_keepalive": payload.DisableKeepAlive,
+			"close_percent":     closePercent,
+			"idle_close_ms":     idleCloseMs,
+			"maintain_second":   maintainSec,
+			"results":           connStats.toMap(),
+		})
+	}
+}
+
+// ConnectionChaosStatusHandler handles GET /stress/connections.
+func ConnectionChaosStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, connectionChaosStatus())
+}
+
+// ConnectionChaosMiddleware sends Connection: close while keep-alive is disabled and on
+// close_percent of responses, so the server closes the connection after the response.
+func ConnectionChaosMiddleware(c *gin.Context) {
+	keepAlive, closePercent, _, active := connectionChaos()
+	if active && (!keepAlive || rand.Intn(100) < closePercent) {
+		c.Header("Connection", "close")
+		atomic.AddInt64(&connStats.forcedClose, 1)
+	}
+	c.Next()
+}
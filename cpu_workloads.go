@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// CPU stress workloads, each burning the CPU in a different way: a plain loop stays in the
+// core, hashing exercises the crypto instructions, the sieve is branchy and the matrix
+// multiply pulls floating point and memory bandwidth.
+const (
+	cpuWorkloadBusyLoop = "busy_loop"
+	cpuWorkloadSHA256   = "sha256"
+	cpuWorkloadPrimes   = "prime_sieve"
+	cpuWorkloadMatrix   = "matrix_multiply"
+)
+
+// maxCPUGoroutines bounds the goroutines of one CPU stress.
+const maxCPUGoroutines = 1024
+
+// cpuWorkloads returns the unit of work of each workload, run repeatedly during the busy part
+// of a cycle. Each unit takes a few microseconds so the duty cycle stays accurate.
+var cpuWorkloads = map[string]func() func(){
+	cpuWorkloadBusyLoop: func() func() {
+		return func() {
+			for i := 0; i < 1000; i++ {
+			}
+		}
+	},
+	cpuWorkloadSHA256: func() func() {
+		block := make([]byte, 4096)
+		for i := range block {
+			block[i] = byte(i)
+		}
+		return func() {
+			sum := sha256.Sum256(block)
+			copy(block, sum[:])
+		}
+	},
+	cpuWorkloadPrimes: func() func() {
+		composite := make([]bool, 20000)
+		return func() {
+			for i := range composite {
+				composite[i] = false
+			}
+			for i := 2; i*i < len(composite); i++ {
+				if !composite[i] {
+					for j := i * i; j < len(composite); j += i {
+						composite[j] = true
+					}
+				}
+			}
+		}
+	},
+	cpuWorkloadMatrix: func() func() {
+		const n = 24
+		a, b, out := make([]float64, n*n), make([]float64, n*n), make([]float64, n*n)
+		for i := range a {
+			a[i], b[i] = float64(i%7)+0.5, float64(i%5)+0.25
+		}
+		return func() {
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					var sum float64
+					for k := 0; k < n; k++ {
+						sum += a[i*n+k] * b[k*n+j]
+					}
+					out[i*n+j] = sum
+				}
+			}
+			// Feed the result back so the work is not optimized away.
+			a[0] = out[n*n-1] / 1e9
+		}
+	},
+}
+
+// cpuWorkloadNames lists the CPU workloads, for error messages.
+var cpuWorkloadNames = []string{cpuWorkloadBusyLoop, cpuWorkloadSHA256, cpuWorkloadPrimes, cpuWorkloadMatrix}
+
+// parseCPUWorkload returns the workload named s, busy_loop when empty. Dashes are accepted
+// for underscores.
+func parseCPUWorkload(s string) (string, error) {
+	name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "-", "_")
+	if name == "" {
+		return cpuWorkloadBusyLoop, nil
+	}
+	if _, ok := cpuWorkloads[name]; !ok {
+		return "", fmt.Errorf("unknown workload %q, expected one of %s", s, strings.Join(cpuWorkloadNames, ", "))
+	}
+	return name, nil
+}
+
+// cpuWorkerCount returns the number of CPU stress workers: goroutines as given (capped at
+// maxCPUGoroutines) to oversubscribe the node, else cores capped at GOMAXPROCS, else one.
+func cpuWorkerCount(cores, goroutines int) int {
+	switch {
+	case goroutines > 0:
+		return min(goroutines, maxCPUGoroutines)
+	case cores > 0:
+		return min(cores, runtime.GOMAXPROCS(0))
+	}
+	return 1
+}
+
+// activeCPUWorkers counts the CPU stress workers running in every job, each holding a
+// GOMAXPROCS slot while it is busy, so concurrent stresses can tell the node is oversubscribed.
+var activeCPUWorkers atomic.Int64
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/spf13/viper"
+)
+
+// dbEngineSQLite is the DB_ENGINE value that redirects the DB stress endpoints to a local SQLite file.
+const dbEngineSQLite = "sqlite"
+
+// stressDBTarget resolves the database used by the heavy, multi_heavy and connection endpoints
+// of dbType ("mysql", "postgres" or "redshift"). With DB_ENGINE=sqlite the local SQLite file at
+// SQLITE_PATH is used instead, so the workloads run without any external database.
+// It returns the engine (which decides the SQL dialect), the database/sql driver name and the DSN.
+func stressDBTarget(dbType string) (string, string, string, error) {
+	if strings.EqualFold(viper.GetString("DB_ENGINE"), dbEngineSQLite) {
+		// WAL and a busy timeout let concurrent connections write without failing immediately on locks.
+		dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", viper.GetString("SQLITE_PATH"))
+		return dbEngineSQLite, "sqlite3", dsn, nil
+	}
+	switch dbType {
+	case "mysql":
+		cfg, err := GetMySQLConfig()
+		if err != nil {
+			return "", "", "", err
+		}
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+		return dbType, "mysql", dsn, nil
+	case "postgres":
+		cfg, err := GetPostgresConfig()
+		if err != nil {
+			return "", "", "", err
+		}
+		dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+			cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+		return dbType, pgxEgressDriver, dsn, nil
+	case "redshift":
+		cfg, err := GetRedshiftConfig()
+		if err != nil {
+			return "", "", "", err
+		}
+		// Redshift uses a DSN similar to PostgreSQL.
+		dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+			cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+		return dbType, pgxEgressDriver, dsn, nil
+	default:
+		return "", "", "", fmt.Errorf("unsupported dbType: %s", dbType)
+	}
+}
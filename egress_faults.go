@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"go.uber.org/zap"
+)
+
+// Egress targets, one per client family dialing through egressDialer.
+const (
+	egressMySQL    = "mysql"
+	egressPostgres = "postgres" // Also used for Redshift, which shares the pgx driver.
+	egressRedis    = "redis"
+	egressKafka    = "kafka"
+	egressHTTP     = "http"
+)
+
+// pgxEgressDriver is the database/sql driver name for pgx connections dialed through egressDialer.
+const pgxEgressDriver = "pgx-egress"
+
+// EgressFaultsPayload defines the payload for outbound DNS and connect fault injection.
+type EgressFaultsPayload struct {
+	Targets               []string `json:"targets"`                 // Default: all targets.
+	ResolveFailurePercent DuckInt  `json:"resolve_failure_percent"` // Dials to host names failing with "no such host".
+	ConnectTimeoutPercent DuckInt  `json:"connect_timeout_percent"` // Dials hanging until connect_timeout_ms, then timing out.
+	ConnectTimeoutMs      DuckInt  `json:"connect_timeout_ms"`      // Default 5000; capped by the caller's own dial timeout.
+	HandshakeDelayMs      DuckInt  `json:"handshake_delay_ms"`      // Added to successful dials.
+	HandshakeDelayPercent DuckInt  `json:"handshake_delay_percent"` // Default 100 when handshake_delay_ms is set.
+	MaintainSecond        DuckInt  `json:"maintain_second"`
+	Async                 bool     `json:"async"`
+}
+
+// egressFaults is an active outbound fault injection.
+type egressFaults struct {
+	targets               map[string]bool
+	resolveFailurePercent int
+	connectTimeoutPercent int
+	connectTimeout        time.Duration
+	handshakeDelay        time.Duration
+	handshakeDelayPercent int
+	expiry                time.Time
+
+	dials           int64
+	resolveFailures int64
+	connectTimeouts int64
+	delayed         int64
+}
+
+func (f *egressFaults) toMap() gin.H {
+	return gin.H{
+		"dials":            atomic.LoadInt64(&f.dials),
+		"resolve_failures": atomic.LoadInt64(&f.resolveFailures),
+		"connect_timeouts": atomic.LoadInt64(&f.connectTimeouts),
+		"delayed":          atomic.LoadInt64(&f.delayed),
+	}
+}
+
+// Global variables for egress fault injection.
+var (
+	egressMutex        sync.Mutex
+	activeEgressFaults *egressFaults
+)
+
+// egressPgxDriver opens pgx connections whose DialFunc goes through egressDialer.
+type egressPgxDriver struct{}
+
+func (d egressPgxDriver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (egressPgxDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DialFunc = egressDialer(egressPostgres)
+	return stdlib.GetConnector(*cfg), nil
+}
+
+func init() {
+	mysqlDial := egressDialer(egressMySQL)
+	mysql.RegisterDialContext("tcp", func(ctx context.Context, addr string) (net.Conn, error) {
+		return mysqlDial(ctx, "tcp", addr)
+	})
+	sql.Register(pgxEgressDriver, egressPgxDriver{})
+}
+
+// egressDialer returns a dial function for target that injects the active egress faults
+// before dialing normally.
+func egressDialer(target string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		egressMutex.Lock()
+		f := activeEgressFaults
+		egressMutex.Unlock()
+		if f == nil || !time.Now().Before(f.expiry) || !f.targets[target] {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		atomic.AddInt64(&f.dials, 1)
+
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		// Only names are resolved; literal IPs never hit DNS.
+		if net.ParseIP(host) == nil && rand.Intn(100) < f.resolveFailurePercent {
+			atomic.AddInt64(&f.resolveFailures, 1)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{
+				Err:        "no such host",
+				Name:       host,
+				IsNotFound: true,
+			}}
+		}
+		if rand.Intn(100) < f.connectTimeoutPercent {
+			atomic.AddInt64(&f.connectTimeouts, 1)
+			timer := time.NewTimer(f.connectTimeout)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			return nil, &net.OpError{Op: "dial", Net: network, Err: os.ErrDeadlineExceeded}
+		}
+		if f.handshakeDelay > 0 && rand.Intn(100) < f.handshakeDelayPercent {
+			atomic.AddInt64(&f.delayed, 1)
+			select {
+			case <-time.After(f.handshakeDelay):
+			case <-ctx.Done():
+				return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// egressRedisDialer returns a go-redis Dialer going through egressDialer. A custom Dialer
+// replaces the client's built-in TLS handling, so TLS is applied here.
+func egressRedisDialer(tlsConfig *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := egressDialer(egressRedis)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil || tlsConfig == nil {
+			return conn, err
+		}
+		return tls.Client(conn, tlsConfig), nil
+	}
+}
+
+// EgressFaultsHandler handles POST /stress/egress_faults.
+// It makes the app's own outbound dials (MySQL, PostgreSQL/Redshift, Redis, Kafka and the shared
+// HTTP client) fail DNS resolution, time out while connecting or connect slowly at the given rates.
+// Only new connections are affected; pooled connections keep working.
+func EgressFaultsHandler(c *gin.Context) {
+	var payload EgressFaultsPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	targets := payload.Targets
+	if len(targets) == 0 {
+		targets = []string{egressMySQL, egressPostgres, egressRedis, egressKafka, egressHTTP}
+	}
+	targetSet := map[string]bool{}
+	for _, target := range targets {
+		switch target {
+		case egressMySQL, egressPostgres, egressRedis, egressKafka, egressHTTP:
+			targetSet[target] = true
+		default:
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "unknown target: "+target)
+			return
+		}
+	}
+	connectTimeoutMs := int(payload.ConnectTimeoutMs)
+	if connectTimeoutMs <= 0 {
+		connectTimeoutMs = 5000
+	}
+	handshakeDelayPercent := int(payload.HandshakeDelayPercent)
+	if handshakeDelayPercent <= 0 {
+		handshakeDelayPercent = 100
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	f := &egressFaults{
+		targets:               targetSet,
+		resolveFailurePercent: int(payload.ResolveFailurePercent),
+		connectTimeoutPercent: int(payload.ConnectTimeoutPercent),
+		connectTimeout:        time.Duration(connectTimeoutMs) * time.Millisecond,
+		handshakeDelay:        time.Duration(int(payload.HandshakeDelayMs)) * time.Millisecond,
+		handshakeDelayPercent: handshakeDelayPercent,
+		expiry:                time.Now().Add(time.Duration(maintainSec) * time.Second),
+	}
+	egressMutex.Lock()
+	activeEgressFaults = f
+	egressMutex.Unlock()
+	recordFaultActivated("egress_faults", "", gin.H{
+		"targets":                 targets,
+		"resolve_failure_percent": f.resolveFailurePercent,
+		"connect_timeout_percent": f.connectTimeoutPercent,
+		"handshake_delay_ms":      int(payload.HandshakeDelayMs),
+	}, f.expiry)
+	logInfo("Egress fault injection started",
+		zap.Strings("targets", targets),
+		zap.Int("resolve_failure_percent", f.resolveFailurePercent),
+		zap.Int("connect_timeout_percent", f.connectTimeoutPercent),
+		zap.Int("handshake_delay_ms", int(payload.HandshakeDelayMs)),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the egress faults unless a later request replaced it.
+			egressMutex.Lock()
+			ours := activeEgressFaults == f
+			if ours {
+				activeEgressFaults = nil
+			}
+			egressMutex.Unlock()
+			if ours {
+				recordFaultDeactivated("egress_faults", "", "cancelled")
+			}
+		}
+		logInfo("Egress fault injection ended",
+			zap.Int64("dials", atomic.LoadInt64(&f.dials)),
+			zap.Int64("resolve_failures", atomic.LoadInt64(&f.resolveFailures)),
+			zap.Int64("connect_timeouts", atomic.LoadInt64(&f.connectTimeouts)))
+	}
+
+	if payload.Async {
+		go job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":                 "egress fault injection started",
+			"targets":                 targets,
+			"resolve_failure_percent": f.resolveFailurePercent,
+			"connect_timeout_percent": f.connectTimeoutPercent,
+			"connect_timeout_ms":      connectTimeoutMs,
+			"handshake_delay_ms":      int(payload.HandshakeDelayMs),
+			"handshake_delay_percent": handshakeDelayPercent,
+			"maintain_second":         maintainSec,
+		})
+	} else {
+		job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":                 "egress fault injection completed",
+			"targets":                 targets,
+			"resolve_failure_percent": f.resolveFailurePercent,
+			"connect_timeout_percent": f.connectTimeoutPercent,
+			"connect_timeout_ms":      connectTimeoutMs,
+			"handshake_delay_ms":      int(payload.HandshakeDelayMs),
+			"handshake_delay_percent": handshakeDelayPercent,
+			"maintain_second":         maintainSec,
+			"results":                 f.toMap(),
+		})
+	}
+}
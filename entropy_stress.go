@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// EntropyStressPayload defines the payload for the crypto randomness stress.
+type EntropyStressPayload struct {
+	Readers         DuckInt `json:"readers"`           // Goroutines reading crypto/rand continuously, default 1.
+	ReadSizeBytes   DuckInt `json:"read_size_bytes"`   // Bytes per read, default 4096.
+	KeyType         string  `json:"key_type"`          // rsa (default), ecdsa or ed25519.
+	KeyBits         DuckInt `json:"key_bits"`          // RSA key size, default 2048.
+	KeysPerInterval DuckInt `json:"keys_per_interval"` // Key generations per interval.
+	IntervalSecond  DuckInt `json:"interval_second"`
+	MaintainSecond  DuckInt `json:"maintain_second"`
+	Async           bool    `json:"async"`
+}
+
+// Limits of the entropy stress. Readers and read size are checked on their own before their
+// product, the memory held by the read buffers.
+const (
+	maxEntropyReaders     = 1024
+	maxEntropyReadBytes   = 16 << 20
+	maxEntropyBufferBytes = 256 << 20
+	maxEntropyKeyBits     = 8192
+)
+
+// entropyStats counts crypto/rand reads and key generations.
+type entropyStats struct {
+	reads         int64
+	bytes         int64
+	maxReadNs     int64
+	keys          int64
+	keyFailures   int64
+	totalKeygenNs int64
+}
+
+func (s *entropyStats) toMap() gin.H {
+	keys := atomic.LoadInt64(&s.keys)
+	avgKeygenMs := 0.0
+	if keys > 0 {
+		avgKeygenMs = float64(atomic.LoadInt64(&s.totalKeygenNs)) / float64(keys) / 1e6
+	}
+	return gin.H{
+		"reads":          atomic.LoadInt64(&s.reads),
+		"bytes_read":     atomic.LoadInt64(&s.bytes),
+		"max_read_ms":    float64(atomic.LoadInt64(&s.maxReadNs)) / 1e6,
+		"keys_generated": keys,
+		"key_failures":   atomic.LoadInt64(&s.keyFailures),
+		"avg_keygen_ms":  avgKeygenMs,
+		"entropy_avail":  readEntropyAvail(),
+	}
+}
+
+// readEntropyAvail returns the kernel's entropy estimate in bits, or -1 if unavailable.
+// Kernels since 5.18 always report 256.
+func readEntropyAvail() int {
+	data, err := os.ReadFile("/proc/sys/kernel/random/entropy_avail")
+	if err != nil {
+		return -1
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// generateKey generates one key of the given type.
+func generateKey(keyType string, bits int) error {
+	var err error
+	switch keyType {
+	case "ecdsa":
+		_, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, _, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		_, err = rsa.GenerateKey(rand.Reader, bits)
+	}
+	return err
+}
+
+// EntropyStressHandler handles POST /stress/entropy.
+// It reads crypto/rand as fast as possible from several goroutines and generates keys at a
+// fixed rate, to evaluate hosts with constrained entropy sources or slow FIPS modules.
+func EntropyStressHandler(c *gin.Context) {
+	var payload EntropyStressPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	readers := int(payload.Readers)
+	if readers <= 0 {
+		readers = 1
+	}
+	readSize := int(payload.ReadSizeBytes)
+	if readSize <= 0 {
+		readSize = 4096
+	}
+	keyType := payload.KeyType
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	if keyType != "rsa" && keyType != "ecdsa" && keyType != "ed25519" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "key_type must be rsa, ecdsa or ed25519")
+		return
+	}
+	keyBits := int(payload.KeyBits)
+	if keyBits <= 0 {
+		keyBits = 2048
+	}
+	switch {
+	case readers > maxEntropyReaders:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("readers must not exceed %d", maxEntropyReaders))
+		return
+	case readSize > maxEntropyReadBytes:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("read_size_bytes must not exceed %d", maxEntropyReadBytes))
+		return
+	case readers*readSize > maxEntropyBufferBytes:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("readers x read_size_bytes must not exceed %d", maxEntropyBufferBytes))
+		return
+	case keyType == "rsa" && keyBits > maxEntropyKeyBits:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("key_bits must not exceed %d", maxEntropyKeyBits))
+		return
+	}
+	keysPerInterval := int(payload.KeysPerInterval)
+	intervalSec := int(payload.IntervalSecond)
+	maintainSec := int(payload.MaintainSecond)
+	entropyBefore := readEntropyAvail()
+
+	var stats entropyStats
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		var wg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				buf := make([]byte, readSize)
+				for time.Now().Before(endTime) && ctx.Err() == nil {
+					start := time.Now()
+					n, err := rand.Read(buf)
+					if err != nil {
+						logWarn("crypto/rand read failed", zap.Error(err))
+						return
+					}
+					elapsed := int64(time.Since(start))
+					atomic.AddInt64(&stats.reads, 1)
+					atomic.AddInt64(&stats.bytes, int64(n))
+					for {
+						prev := atomic.LoadInt64(&stats.maxReadNs)
+						if elapsed <= prev || atomic.CompareAndSwapInt64(&stats.maxReadNs, prev, elapsed) {
+							break
+						}
+					}
+				}
+			}()
+		}
+		for time.Now().Before(endTime) && keysPerInterval > 0 && ctx.Err() == nil {
+			for j := 0; j < keysPerInterval; j++ {
+				start := time.Now()
+				if err := generateKey(keyType, keyBits); err != nil {
+					atomic.AddInt64(&stats.keyFailures, 1)
+					logWarn("Key generation failed", zap.String("key_type", keyType), zap.Error(err))
+					continue
+				}
+				atomic.AddInt64(&stats.keys, 1)
+				atomic.AddInt64(&stats.totalKeygenNs, int64(time.Since(start)))
+			}
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
+		}
+		wg.Wait()
+		logInfo("Entropy stress completed",
+			zap.Int64("bytes_read", atomic.LoadInt64(&stats.bytes)),
+			zap.Int64("keys_generated", atomic.LoadInt64(&stats.keys)))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":           "entropy stress started",
+			"readers":           readers,
+			"read_size_bytes":   readSize,
+			"key_type":          keyType,
+			"key_bits":          keyBits,
+			"keys_per_interval": keysPerInterval,
+			"interval_second":   intervalSec,
+			"maintain_second":   maintainSec,
+			"entropy_before":    entropyBefore,
+		})
+	} else {
+		job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":           "entropy stress completed",
+			"readers":           readers,
+			"read_size_bytes":   readSize,
+			"key_type":          keyType,
+			"key_bits":          keyBits,
+			"keys_per_interval": keysPerInterval,
+			"interval_second":   intervalSec,
+			"maintain_second":   maintainSec,
+			"entropy_before":    entropyBefore,
+			"results":           stats.toMap(),
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -24,77 +25,208 @@ type CrashSimulationPayload struct {
 	Async          bool    `json:"async"`
 }
 
-// Global variables to control error injection.
-var (
-	activeErrorRate      float64   = 0.0
-	errorInjectionExpiry time.Time = time.Now()
-)
-
 // ErrorInjectionHandler handles POST /stress/error_injection.
 // It sets a global error injection rate for the specified duration.
 func ErrorInjectionHandler(c *gin.Context) {
 	var payload ErrorInjectionPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	durationSec := int(payload.MaintainSecond)
 	// Convert DuckFloat to float64.
-	activeErrorRate = float64(payload.ErrorRate)
-	errorInjectionExpiry = time.Now().Add(time.Duration(durationSec) * time.Second)
-	fmt.Println("Error injection started",
-		zap.Float64("error_rate", activeErrorRate),
+	errorRate := float64(payload.ErrorRate)
+	expiry := time.Now().Add(time.Duration(durationSec) * time.Second)
+	ns := getNamespace(c)
+	faultState.Update(ns, func(f *faultSnapshot) {
+		f.ErrorRate = errorRate
+		f.ErrorExpiry = expiry
+	})
+	logWarn("Error injection started",
+		zap.String("namespace", ns),
+		zap.Float64("error_rate", errorRate),
 		zap.Int("duration_sec", durationSec))
 
-	resetFunc := func() {
-		time.Sleep(time.Duration(durationSec) * time.Second)
-		activeErrorRate = 0.0
-		fmt.Println("Error injection ended")
+	job := startJob(c, time.Duration(durationSec)*time.Second)
+	resetFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Until(expiry)) {
+			clearErrorInjection(ns, expiry)
+		}
+		logWarn("Error injection ended", zap.String("namespace", ns))
 	}
 
 	if payload.Async {
-		go resetFunc()
+		go job.run(resetFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "error injection started",
-			"error_rate":      activeErrorRate,
+			"namespace":       ns,
+			"error_rate":      errorRate,
 			"maintain_second": durationSec,
 		})
 	} else {
-		resetFunc()
+		job.run(resetFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "error injection completed",
-			"error_rate":      activeErrorRate,
+			"namespace":       ns,
+			"error_rate":      errorRate,
 			"maintain_second": durationSec,
 		})
 	}
 }
 
+// SLOBurnPayload defines the JSON payload for the error budget burner API.
+type SLOBurnPayload struct {
+	SLO                DuckFloat `json:"slo"`                  // Target SLO, as a percentage (99.9) or ratio (0.999).
+	SLOWindowDays      DuckInt   `json:"slo_window_days"`      // SLO period, default 30.
+	BurnRate           DuckFloat `json:"burn_rate"`            // Desired burn rate, default 14.4.
+	LongWindowMinutes  DuckInt   `json:"long_window_minutes"`  // Alert long window; defaults follow the SRE workbook.
+	ShortWindowMinutes DuckInt   `json:"short_window_minutes"` // Alert short window, default long window / 12.
+	Margin             DuckFloat `json:"margin"`               // Multiplier on the threshold error rate, default 1.1.
+	Async              bool      `json:"async"`
+}
+
+// defaultLongWindowMinutes returns the long alert window recommended by the SRE workbook
+// for common burn rates: 14.4x over 1h, 6x over 6h and 1x over 3d.
+func defaultLongWindowMinutes(burnRate float64) int {
+	switch {
+	case burnRate >= 14.4:
+		return 60
+	case burnRate >= 6:
+		return 6 * 60
+	default:
+		return 3 * 24 * 60
+	}
+}
+
+// SLOBurnHandler handles POST /stress/slo_burn.
+// It computes the error rate that burns the error budget of the given SLO at burn_rate
+// (times margin) and injects it for the long alert window, which is enough for both the
+// long- and short-window burn-rate conditions to fire.
+func SLOBurnHandler(c *gin.Context) {
+	var payload SLOBurnPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	slo := float64(payload.SLO)
+	if slo > 1 {
+		slo /= 100
+	}
+	if slo <= 0 || slo >= 1 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "slo must be between 0 and 100 (exclusive)")
+		return
+	}
+	windowDays := int(payload.SLOWindowDays)
+	if windowDays <= 0 {
+		windowDays = 30
+	}
+	burnRate := float64(payload.BurnRate)
+	if burnRate <= 0 {
+		burnRate = 14.4
+	}
+	longWindow := int(payload.LongWindowMinutes)
+	if longWindow <= 0 {
+		longWindow = defaultLongWindowMinutes(burnRate)
+	}
+	shortWindow := int(payload.ShortWindowMinutes)
+	if shortWindow <= 0 {
+		shortWindow = longWindow / 12
+	}
+	margin := float64(payload.Margin)
+	if margin <= 0 {
+		margin = 1.1
+	}
+
+	errorBudget := 1 - slo
+	threshold := burnRate * errorBudget
+	errorRate := threshold * margin
+	if errorRate > 1 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD",
+			fmt.Sprintf("burn rate %.1f needs an error rate above 100%% for slo %g", burnRate, slo*100))
+		return
+	}
+	durationSec := longWindow * 60
+	// Fraction of the whole error budget consumed by this experiment.
+	budgetConsumed := errorRate * float64(durationSec) / (errorBudget * float64(windowDays*24*60*60))
+	// With steady traffic and no other errors, the long-window error rate reaches the
+	// threshold after long window / margin; the short window is crossed much earlier.
+	expectedAlertSec := float64(durationSec) / margin
+
+	expiry := time.Now().Add(time.Duration(durationSec) * time.Second)
+	ns := getNamespace(c)
+	faultState.Update(ns, func(f *faultSnapshot) {
+		f.ErrorRate = errorRate
+		f.ErrorExpiry = expiry
+	})
+	logInfo("SLO burn started",
+		zap.String("namespace", ns),
+		zap.Float64("slo", slo),
+		zap.Float64("burn_rate", burnRate),
+		zap.Float64("error_rate", errorRate),
+		zap.Int("duration_sec", durationSec))
+
+	job := startJob(c, time.Duration(durationSec)*time.Second)
+	resetFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Until(expiry)) {
+			clearErrorInjection(ns, expiry)
+		}
+		logInfo("SLO burn ended", zap.String("namespace", ns))
+	}
+
+	result := gin.H{
+		"namespace":                   ns,
+		"slo":                         slo,
+		"slo_window_days":             windowDays,
+		"burn_rate":                   burnRate,
+		"error_budget":                errorBudget,
+		"threshold_error_rate":        threshold,
+		"error_rate":                  errorRate,
+		"long_window_minutes":         longWindow,
+		"short_window_minutes":        shortWindow,
+		"maintain_second":             durationSec,
+		"expected_alert_after_second": expectedAlertSec,
+		"budget_consumed_ratio":       budgetConsumed,
+	}
+	if payload.Async {
+		go job.run(resetFunc)
+		result["message"] = "slo burn started"
+	} else {
+		job.run(resetFunc)
+		result["message"] = "slo burn completed"
+	}
+	ResponseJSON(c, http.StatusOK, result)
+}
+
 // CrashSimulationHandler handles POST /stress/crash.
 // It simulates a crash by exiting the process after the specified duration.
 func CrashSimulationHandler(c *gin.Context) {
 	var payload CrashSimulationPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	durationSec := int(payload.MaintainSecond)
-	fmt.Println("Crash simulation scheduled", zap.Int("maintain_second", durationSec))
+	logInfo("Crash simulation scheduled", zap.Int("maintain_second", durationSec))
 
-	crashFunc := func() {
-		time.Sleep(time.Duration(durationSec) * time.Second)
-		fmt.Println("Simulated crash: exiting process")
+	job := startJob(c, time.Duration(durationSec)*time.Second)
+	crashFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(durationSec)*time.Second) {
+			logInfo("Crash simulation cancelled")
+			return
+		}
+		logError("Simulated crash: exiting process")
 		os.Exit(1)
 	}
 
 	if payload.Async {
-		go crashFunc()
+		go job.run(crashFunc)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "crash simulation started",
 			"maintain_second": durationSec,
 		})
 	} else {
-		crashFunc()
-		// Will not reach here.
+		job.run(crashFunc)
+		// Only reached if the job is cancelled.
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "crash simulation completed",
 			"maintain_second": durationSec,
@@ -102,11 +234,24 @@ func CrashSimulationHandler(c *gin.Context) {
 	}
 }
 
+// clearErrorInjection ends the error injection of namespace early, unless a later request
+// replaced it (its expiry differs).
+func clearErrorInjection(namespace string, expiry time.Time) {
+	faultState.Update(namespace, func(f *faultSnapshot) {
+		if f.ErrorExpiry.Equal(expiry) {
+			f.ErrorExpiry = time.Now()
+		}
+	})
+}
+
 // ErrorInjectionMiddleware is a global middleware that, if error injection is active,
 // randomly aborts requests with an error response based on the active error rate.
+// Requests of a namespace use the namespace's rate while it is active.
 func ErrorInjectionMiddleware(c *gin.Context) {
-	if time.Now().Before(errorInjectionExpiry) && activeErrorRate > 0 {
-		if rand.Float64() < activeErrorRate {
+	now := time.Now()
+	if errorRate := faultState.Effective(getNamespace(c), now).errorRate(now); errorRate > 0 {
+		if rand.Float64() < errorRate {
+			markInjectedFault(c, "error_injection")
 			ErrorJSON(c, http.StatusInternalServerError, "RANDOM_ERROR", "simulated random error injection")
 			c.Abort()
 			return
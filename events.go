@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// Types of state events.
+const (
+	eventFaultActivated   = "fault.activated"
+	eventFaultDeactivated = "fault.deactivated"
+	eventJobStarted       = "job.started"
+	eventJobAborted       = "job.aborted"
+	eventJobEvicted       = "job.evicted"
+	eventConfigChanged    = "config.changed"
+	eventScenarioStep     = "scenario.step"
+)
+
+// stateEvent is one change of the state of this instance.
+type stateEvent struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Data gin.H     `json:"data"`
+}
+
+// Global variables for the event log.
+var (
+	eventsMutex      sync.Mutex
+	eventsHistory    []stateEvent
+	eventsLastID     int64
+	eventSubscribers = map[chan stateEvent]struct{}{}
+)
+
+// eventSubscriberBuffer bounds the events waiting for a slow /events client. A client that
+// falls behind is disconnected and resumes from the history with Last-Event-ID.
+const eventSubscriberBuffer = 256
+
+// publishEvent records an event in the history and sends it to every /events client.
+func publishEvent(typ string, data gin.H) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	eventsLastID++
+	e := stateEvent{ID: eventsLastID, Time: time.Now().UTC(), Type: typ, Data: data}
+	eventsHistory = append(eventsHistory, e)
+	if size := viper.GetInt("EVENTS_HISTORY_SIZE"); size > 0 && len(eventsHistory) > size {
+		eventsHistory = append([]stateEvent(nil), eventsHistory[len(eventsHistory)-size:]...)
+	}
+	for ch := range eventSubscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(eventSubscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// eventsSince returns the recorded events after id whose type starts with prefix.
+func eventsSince(id int64, prefix string) []stateEvent {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	return filterEvents(eventsHistory, id, prefix)
+}
+
+func filterEvents(events []stateEvent, id int64, prefix string) []stateEvent {
+	filtered := []stateEvent{}
+	for _, e := range events {
+		if e.ID > id && strings.HasPrefix(e.Type, prefix) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// activeFault is a fault announced as activated, waiting for its expiry.
+type activeFault struct {
+	fault     string
+	namespace string
+	gen       uint64
+	timer     *time.Timer
+}
+
+// Global variables for the faults announced as active.
+var (
+	activeFaultsMutex sync.Mutex
+	activeFaults      = map[string]*activeFault{}
+	activeFaultsGen   uint64
+)
+
+// recordFaultActivated announces that fault became active in namespace ("" for global) with
+// the settings in data until expiry, and announces its deactivation when it expires.
+// Activating a fault that is already active announces its new settings.
+func recordFaultActivated(fault, namespace string, data gin.H, expiry time.Time) {
+	activeFaultsMutex.Lock()
+	defer activeFaultsMutex.Unlock()
+	key := fault + "/" + namespace
+	if a, ok := activeFaults[key]; ok {
+		a.timer.Stop()
+	}
+	activeFaultsGen++
+	gen := activeFaultsGen
+	event := gin.H{"fault": fault, "namespace": namespace, "expires_at": expiry.UTC().Format(time.RFC3339Nano)}
+	for k, v := range data {
+		event[k] = v
+	}
+	publishEvent(eventFaultActivated, event)
+	activeFaults[key] = &activeFault{
+		fault:     fault,
+		namespace: namespace,
+		gen:       gen,
+		timer: time.AfterFunc(time.Until(expiry), func() {
+			activeFaultsMutex.Lock()
+			defer activeFaultsMutex.Unlock()
+			if a, ok := activeFaults[key]; ok && a.gen == gen {
+				delete(activeFaults, key)
+				publishEvent(eventFaultDeactivated, gin.H{"fault": fault, "namespace": namespace, "reason": "expired"})
+			}
+		}),
+	}
+}
+
+// recordFaultDeactivated announces that an active fault was turned off before its expiry.
+func recordFaultDeactivated(fault, namespace, reason string) {
+	activeFaultsMutex.Lock()
+	defer activeFaultsMutex.Unlock()
+	key := fault + "/" + namespace
+	if a, ok := activeFaults[key]; ok {
+		a.timer.Stop()
+		delete(activeFaults, key)
+		publishEvent(eventFaultDeactivated, gin.H{"fault": fault, "namespace": namespace, "reason": reason})
+	}
+}
+
+// recordAllFaultsDeactivated announces that every active fault was turned off.
+func recordAllFaultsDeactivated(reason string) {
+	activeFaultsMutex.Lock()
+	list := make([]*activeFault, 0, len(activeFaults))
+	for _, a := range activeFaults {
+		list = append(list, a)
+	}
+	activeFaultsMutex.Unlock()
+	for _, a := range list {
+		recordFaultDeactivated(a.fault, a.namespace, reason)
+	}
+}
+
+// faultSetting is the settings and expiry of an active fault.
+type faultSetting struct {
+	data   gin.H
+	expiry time.Time
+}
+
+// requestPathFaults returns the active request-path faults of f with their settings and expiry.
+func requestPathFaults(f faultSnapshot, now time.Time) map[string]faultSetting {
+	faults := map[string]faultSetting{}
+	if rate := f.errorRate(now); rate > 0 {
+		faults["error_injection"] = faultSetting{gin.H{"error_rate": rate}, f.ErrorExpiry}
+	}
+	if ms := f.latency(now); ms > 0 {
+		faults["latency"] = faultSetting{gin.H{"latency_ms": ms, "latency_mode": f.LatencyMode}, f.LatencyExpiry}
+	}
+	if loss := f.packetLoss(now); loss > 0 {
+		faults["packet_loss"] = faultSetting{gin.H{"loss_percentage": loss}, f.PacketLossExpiry}
+	}
+	if f.down(now) {
+		faults["downtime"] = faultSetting{gin.H{}, f.DowntimeExpiry}
+	}
+	return faults
+}
+
+// recordFaultChanges announces the request-path faults of namespace that changed from old to cur.
+func recordFaultChanges(namespace string, old, cur faultSnapshot) {
+	now := time.Now()
+	before, after := requestPathFaults(old, now), requestPathFaults(cur, now)
+	for fault, b := range before {
+		a, ok := after[fault]
+		if !ok {
+			recordFaultDeactivated(fault, namespace, "cleared")
+			continue
+		}
+		if !a.expiry.Equal(b.expiry) || fmt.Sprint(a.data) != fmt.Sprint(b.data) {
+			recordFaultActivated(fault, namespace, a.data, a.expiry)
+		}
+	}
+	for fault, a := range after {
+		if _, ok := before[fault]; !ok {
+			recordFaultActivated(fault, namespace, a.data, a.expiry)
+		}
+	}
+}
+
+// ConfigEventMiddleware records a config.changed event for every successful change made
+// through the /admin APIs. The self-test changes nothing and is not recorded.
+func ConfigEventMiddleware(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || !strings.HasPrefix(c.Request.URL.Path, "/admin/") ||
+		c.Request.URL.Path == "/admin/selftest" {
+		c.Next()
+		return
+	}
+	c.Next()
+	if c.Writer.Status() >= 400 {
+		return
+	}
+	data := gin.H{"method": c.Request.Method, "path": c.Request.URL.Path, "namespace": getNamespace(c)}
+	if raw, ok := c.Get("rawBody"); ok {
+		var body interface{}
+		if json.Unmarshal([]byte(raw.(string)), &body) == nil {
+			data["body"] = body
+		}
+	}
+	publishEvent(eventConfigChanged, data)
+}
+
+// EventsHistoryHandler handles GET /events/history.
+// It returns the recorded events after the since id, optionally only those whose type starts
+// with the type query parameter (e.g. "fault." or "job.").
+func EventsHistoryHandler(c *gin.Context) {
+	since, _ := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"events": eventsSince(since, c.Query("type")),
+	})
+}
+
+// EventsHandler handles GET /events.
+// It streams events as Server-Sent Events. Clients reconnecting with the Last-Event-ID
+// header (or the since query parameter) first receive the events they missed.
+func EventsHandler(c *gin.Context) {
+	prefix := c.Query("type")
+	since, _ := strconv.ParseInt(c.DefaultQuery("since", "-1"), 10, 64)
+	if id, err := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64); err == nil {
+		since = id
+	}
+
+	ch := make(chan stateEvent, eventSubscriberBuffer)
+	eventsMutex.Lock()
+	var backlog []stateEvent
+	if since >= 0 {
+		backlog = filterEvents(eventsHistory, since, prefix)
+	}
+	eventSubscribers[ch] = struct{}{}
+	eventsMutex.Unlock()
+	defer func() {
+		eventsMutex.Lock()
+		if _, ok := eventSubscribers[ch]; ok {
+			delete(eventSubscribers, ch)
+			close(ch)
+		}
+		eventsMutex.Unlock()
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	write := func(e stateEvent) {
+		raw, _ := json.Marshal(e)
+		fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, raw)
+	}
+	for _, e := range backlog {
+		write(e)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(e.Type, prefix) {
+				write(e)
+				c.Writer.Flush()
+			}
+		}
+	}
+}
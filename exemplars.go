@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// requestDurationBuckets are the upper bounds of the request duration histogram, in seconds.
+var requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// traceparentRegex matches a W3C traceparent header and captures the trace and span ids.
+var traceparentRegex = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// exemplar links an observation to the trace of the request it came from.
+type exemplar struct {
+	traceID string
+	spanID  string
+	value   float64
+	time    time.Time
+}
+
+// format returns the exemplar in the OpenMetrics text format.
+func (e *exemplar) format() string {
+	labels := fmt.Sprintf(`trace_id="%s"`, e.traceID)
+	if e.spanID != "" {
+		labels += fmt.Sprintf(`,span_id="%s"`, e.spanID)
+	}
+	return fmt.Sprintf(" # {%s} %s %.3f", labels, formatMetricValue(e.value), float64(e.time.UnixMilli())/1000)
+}
+
+// durationHistogram is the request duration histogram of one fault label. Each bucket keeps
+// the exemplar of the last faulted request it counted.
+type durationHistogram struct {
+	buckets   []int64 // Non-cumulative; the last one counts durations above every bound.
+	exemplars []*exemplar
+	count     int64
+	sum       float64
+}
+
+// faultCounter counts the requests affected by one fault, with the exemplar of the last one.
+type faultCounter struct {
+	count    int64
+	exemplar *exemplar
+}
+
+// Global variables for the request metrics.
+var (
+	requestMetricsMutex sync.Mutex
+	requestDurations    = map[string]*durationHistogram{}
+	injectedFaultCounts = map[string]*faultCounter{}
+)
+
+// markInjectedFault records that fault affected the request in c.
+func markInjectedFault(c *gin.Context, fault string) {
+	faults := c.GetStringSlice("injected_faults")
+	c.Set("injected_faults", append(faults, fault))
+}
+
+// requestTraceID returns the trace and span ids propagated with the request, from a W3C
+// traceparent header or an AWS X-Amzn-Trace-Id header, which X-Ray maps to the same ids.
+func requestTraceID(c *gin.Context) (traceID, spanID string) {
+	if m := traceparentRegex.FindStringSubmatch(c.GetHeader("traceparent")); m != nil && strings.Trim(m[1], "0") != "" {
+		return m[1], m[2]
+	}
+	fields := parseAmznTraceID(c.GetHeader("X-Amzn-Trace-Id"))
+	if parts := strings.Split(fields["Root"], "-"); len(parts) == 3 && len(parts[1])+len(parts[2]) == 32 {
+		return strings.ToLower(parts[1] + parts[2]), strings.ToLower(fields["Parent"])
+	}
+	return "", ""
+}
+
+// observeRequest records the duration of a request under the faults that affected it.
+// With TRACE_EXEMPLARS_ENABLED, faulted requests carrying a trace id become exemplars.
+func observeRequest(faults []string, duration time.Duration, traceID, spanID string) {
+	label := "none"
+	if len(faults) > 0 {
+		label = strings.Join(faults, ",")
+	}
+	seconds := duration.Seconds()
+	var ex *exemplar
+	if traceID != "" && len(faults) > 0 && viper.GetBool("TRACE_EXEMPLARS_ENABLED") {
+		ex = &exemplar{traceID: traceID, spanID: spanID, value: seconds, time: time.Now()}
+	}
+
+	requestMetricsMutex.Lock()
+	defer requestMetricsMutex.Unlock()
+	h, ok := requestDurations[label]
+	if !ok {
+		h = &durationHistogram{
+			buckets:   make([]int64, len(requestDurationBuckets)+1),
+			exemplars: make([]*exemplar, len(requestDurationBuckets)+1),
+		}
+		requestDurations[label] = h
+	}
+	i := sort.SearchFloat64s(requestDurationBuckets, seconds)
+	h.buckets[i]++
+	h.count++
+	h.sum += seconds
+	if ex != nil {
+		h.exemplars[i] = ex
+	}
+	for _, fault := range faults {
+		counter, ok := injectedFaultCounts[fault]
+		if !ok {
+			counter = &faultCounter{}
+			injectedFaultCounts[fault] = counter
+		}
+		counter.count++
+		if ex != nil {
+			counter.exemplar = &exemplar{traceID: traceID, spanID: spanID, value: 1, time: ex.time}
+		}
+	}
+}
+
+// RequestMetricsMiddleware measures every request for GET /metrics/prometheus, labelled with
+// the faults injected into it.
+func RequestMetricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	traceID, spanID := requestTraceID(c)
+	observeRequest(c.GetStringSlice("injected_faults"), time.Since(start), traceID, spanID)
+	observeLabelExplosion(c, c.GetStringSlice("injected_faults"), time.Since(start))
+}
+
+// formatMetricValue formats v like Prometheus does.
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// PrometheusMetricsHandler handles GET /metrics/prometheus.
+// It exposes the request duration histogram and the injected fault counter, and the series of
+// /stress/label_explosion and the synthetic metrics of /stress/metrics_noise while they run.
+// Clients that accept OpenMetrics (Prometheus with exemplar storage enabled) also receive
+// exemplars that link faulted requests to their traces.
+func PrometheusMetricsHandler(c *gin.Context) {
+	openMetrics := strings.Contains(c.GetHeader("Accept"), "application/openmetrics-text")
+	var b strings.Builder
+
+	requestMetricsMutex.Lock()
+	labels := make([]string, 0, len(requestDurations))
+	for label := range requestDurations {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	b.WriteString("# HELP biggie_http_request_duration_seconds Duration of HTTP requests by injected fault.\n")
+	b.WriteString("# TYPE biggie_http_request_duration_seconds histogram\n")
+	for _, label := range labels {
+		h := requestDurations[label]
+		var cumulative int64
+		for i := range h.buckets {
+			cumulative += h.buckets[i]
+			le := "+Inf"
+			if i < len(requestDurationBuckets) {
+				le = formatMetricValue(requestDurationBuckets[i])
+			}
+			fmt.Fprintf(&b, "biggie_http_request_duration_seconds_bucket{fault=%q,le=%q} %d", label, le, cumulative)
+			if openMetrics && h.exemplars[i] != nil {
+				b.WriteString(h.exemplars[i].format())
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "biggie_http_request_duration_seconds_sum{fault=%q} %s\n", label, formatMetricValue(h.sum))
+		fmt.Fprintf(&b, "biggie_http_request_duration_seconds_count{fault=%q} %d\n", label, h.count)
+	}
+	writeLabelExplosionHistograms(&b)
+
+	faults := make([]string, 0, len(injectedFaultCounts))
+	for fault := range injectedFaultCounts {
+		faults = append(faults, fault)
+	}
+	sort.Strings(faults)
+	name := "biggie_injected_faults_total"
+	if openMetrics {
+		// OpenMetrics names counters without the _total suffix of their samples.
+		name = "biggie_injected_faults"
+	}
+	b.WriteString("# HELP " + name + " Requests affected by an injected fault.\n")
+	b.WriteString("# TYPE " + name + " counter\n")
+	for _, fault := range faults {
+		counter := injectedFaultCounts[fault]
+		fmt.Fprintf(&b, "biggie_injected_faults_total{fault=%q} %d", fault, counter.count)
+		if openMetrics && counter.exemplar != nil {
+			b.WriteString(counter.exemplar.format())
+		}
+		b.WriteString("\n")
+	}
+	requestMetricsMutex.Unlock()
+	writeLabelExplosionCounters(&b, openMetrics)
+	writeMetricsNoise(&b, openMetrics)
+
+	contentType := "text/plain; version=0.0.4; charset=utf-8"
+	if openMetrics {
+		b.WriteString("# EOF\n")
+		contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	}
+	c.Data(http.StatusOK, contentType, []byte(b.String()))
+}
@@ -39,12 +39,13 @@ func fetchSecret(secretName string, region string) (string, error) {
 
 // MySQLConfig holds credentials for MySQL connections.
 type MySQLConfig struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Engine   string `json:"engine"`
-	Host     string `json:"host"`
-	Port     int    `json:"port,string"`
-	DBName   string `json:"dbname"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Engine     string `json:"engine"`
+	Host       string `json:"host"`
+	Port       int    `json:"port,string"`
+	DBName     string `json:"dbname"`
+	ReaderHost string `json:"reader_host"`
 }
 
 // GetMySQLConfig retrieves MySQL configuration in the following order:
@@ -93,14 +94,33 @@ func GetMySQLConfig() (*MySQLConfig, error) {
 	return cfg, nil
 }
 
+// GetMySQLReaderConfig returns the MySQL configuration with Host replaced by the reader endpoint,
+// taken from MYSQL_READER_HOST or the reader_host field of MYSQL_SECRET / MYSQL_DBINFO.
+func GetMySQLReaderConfig() (*MySQLConfig, error) {
+	cfg, err := GetMySQLConfig()
+	if err != nil {
+		return nil, err
+	}
+	if host := viper.GetString("MYSQL_READER_HOST"); host != "" {
+		cfg.ReaderHost = host
+	}
+	if cfg.ReaderHost == "" {
+		return nil, errors.New("MySQL reader host not configured (MYSQL_READER_HOST)")
+	}
+	reader := *cfg
+	reader.Host = cfg.ReaderHost
+	return &reader, nil
+}
+
 // PostgresConfig holds credentials for PostgreSQL connections.
 type PostgresConfig struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Engine   string `json:"engine"`
-	Host     string `json:"host"`
-	Port     int    `json:"port,string"`
-	DBName   string `json:"dbname"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Engine     string `json:"engine"`
+	Host       string `json:"host"`
+	Port       int    `json:"port,string"`
+	DBName     string `json:"dbname"`
+	ReaderHost string `json:"reader_host"`
 }
 
 // GetPostgresConfig retrieves PostgreSQL configuration in the following order:
@@ -149,6 +169,24 @@ func GetPostgresConfig() (*PostgresConfig, error) {
 	return cfg, nil
 }
 
+// GetPostgresReaderConfig returns the PostgreSQL configuration with Host replaced by the reader endpoint,
+// taken from POSTGRES_READER_HOST or the reader_host field of POSTGRES_SECRET / POSTGRES_DBINFO.
+func GetPostgresReaderConfig() (*PostgresConfig, error) {
+	cfg, err := GetPostgresConfig()
+	if err != nil {
+		return nil, err
+	}
+	if host := viper.GetString("POSTGRES_READER_HOST"); host != "" {
+		cfg.ReaderHost = host
+	}
+	if cfg.ReaderHost == "" {
+		return nil, errors.New("PostgreSQL reader host not configured (POSTGRES_READER_HOST)")
+	}
+	reader := *cfg
+	reader.Host = cfg.ReaderHost
+	return &reader, nil
+}
+
 // RedshiftConfig holds credentials for Redshift connections.
 type RedshiftConfig struct {
 	Username string `json:"username"`
@@ -260,3 +298,112 @@ func GetKafkaConfig() (*KafkaConfig, error) {
 		Topic:      topic,
 	}, nil
 }
+
+// SMTPConfig holds configuration for an SMTP relay.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	// AllowedRecipients lists further addresses, or whole domains as "@example.com",
+	// that a request may send to besides To.
+	AllowedRecipients []string
+	TLSEnabled        bool
+}
+
+// recipientAllowed reports whether addr is one of To or matches AllowedRecipients.
+func (cfg *SMTPConfig) recipientAllowed(addr string) bool {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	for _, list := range [][]string{cfg.To, cfg.AllowedRecipients} {
+		for _, allowed := range list {
+			allowed = strings.ToLower(allowed)
+			if addr == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(addr, allowed)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetSMTPConfig retrieves SMTP configuration using individual variables:
+// SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM, SMTP_TO, SMTP_ALLOWED_RECIPIENTS,
+// SMTP_TLS_ENABLED.
+func GetSMTPConfig() (*SMTPConfig, error) {
+	host := viper.GetString("SMTP_HOST")
+	if host == "" {
+		return nil, errors.New("SMTP configuration not found")
+	}
+	port, err := processRandomInt(viper.GetString("SMTP_PORT"), 587, 587)
+	if err != nil {
+		return nil, err
+	}
+	from := viper.GetString("SMTP_FROM")
+	if from == "" {
+		return nil, errors.New("SMTP_FROM not provided")
+	}
+	var to, allowed []string
+	for _, addr := range strings.Split(viper.GetString("SMTP_TO"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	for _, addr := range strings.Split(viper.GetString("SMTP_ALLOWED_RECIPIENTS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			allowed = append(allowed, addr)
+		}
+	}
+	tlsStr := viper.GetString("SMTP_TLS_ENABLED")
+	tlsEnabled := strings.ToLower(tlsStr) == "true"
+	return &SMTPConfig{
+		Host:              host,
+		Port:              port,
+		Username:          viper.GetString("SMTP_USERNAME"),
+		Password:          viper.GetString("SMTP_PASSWORD"),
+		From:              from,
+		To:                to,
+		AllowedRecipients: allowed,
+		TLSEnabled:        tlsEnabled,
+	}, nil
+}
+
+// SFTPConfig holds configuration for an SSH/SFTP server.
+type SFTPConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	PrivateKey string
+	RemoteDir  string
+}
+
+// GetSFTPConfig retrieves SFTP configuration using individual variables:
+// SFTP_HOST, SFTP_PORT, SFTP_USERNAME, SFTP_PASSWORD, SFTP_PRIVATE_KEY, SFTP_REMOTE_DIR.
+func GetSFTPConfig() (*SFTPConfig, error) {
+	host := viper.GetString("SFTP_HOST")
+	if host == "" {
+		return nil, errors.New("SFTP configuration not found")
+	}
+	port, err := processRandomInt(viper.GetString("SFTP_PORT"), 22, 22)
+	if err != nil {
+		return nil, err
+	}
+	username := viper.GetString("SFTP_USERNAME")
+	if username == "" {
+		return nil, errors.New("SFTP_USERNAME not provided")
+	}
+	password := viper.GetString("SFTP_PASSWORD")
+	privateKey := viper.GetString("SFTP_PRIVATE_KEY")
+	if password == "" && privateKey == "" {
+		return nil, errors.New("SFTP_PASSWORD or SFTP_PRIVATE_KEY not provided")
+	}
+	return &SFTPConfig{
+		Host:       host,
+		Port:       port,
+		Username:   username,
+		Password:   password,
+		PrivateKey: privateKey,
+		RemoteDir:  viper.GetString("SFTP_REMOTE_DIR"),
+	}, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// FailoverProbePayload defines the payload for the database failover probe.
+type FailoverProbePayload struct {
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+	IntervalMs     DuckInt `json:"interval_ms"` // Pause between probe writes, default 100.
+	TimeoutMs      DuckInt `json:"timeout_ms"`  // Timeout of a single write, default 2000.
+}
+
+// failoverOutage is a period in which probe writes failed.
+type failoverOutage struct {
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	ReconnectMs int64     `json:"reconnect_ms"` // Until a new connection could be established.
+	Errors      int       `json:"errors"`
+	FirstError  string    `json:"first_error"`
+}
+
+// failoverReport is the downtime report produced by a failover probe.
+type failoverReport struct {
+	Attempts   int              `json:"attempts"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	DowntimeMs int64            `json:"downtime_ms"`
+	Outages    []failoverOutage `json:"outages"`
+	Servers    []string         `json:"servers"` // Server identities seen, in order; more than one means a failover happened.
+	Ongoing    bool             `json:"ongoing_outage"`
+}
+
+// failoverServerQuery returns a query identifying the server a connection landed on.
+func failoverServerQuery(dbType string) string {
+	if dbType == "mysql" {
+		return "SELECT @@hostname"
+	}
+	return "SELECT coalesce(inet_server_addr()::text, '') || ':' || pg_is_in_recovery()::text"
+}
+
+// runFailoverProbe writes a row every interval until maintainSec has passed or ctx is done. After a failed
+// write the connection pool is discarded and reopened, so that DNS is resolved again and
+// connections to a demoted writer are not reused.
+func runFailoverProbe(ctx context.Context, dbType, driver, dsn string, maintainSec int, interval, timeout time.Duration) *failoverReport {
+	report := &failoverReport{Outages: []failoverOutage{}, Servers: []string{}}
+	var db *sql.DB
+	var outage *failoverOutage
+
+	connect := func() error {
+		newDB, err := sql.Open(driver, dsn)
+		if err != nil {
+			return err
+		}
+		newDB.SetMaxOpenConns(1)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var server string
+		if err := newDB.QueryRowContext(ctx, failoverServerQuery(dbType)).Scan(&server); err != nil {
+			newDB.Close()
+			return err
+		}
+		if len(report.Servers) == 0 || report.Servers[len(report.Servers)-1] != server {
+			report.Servers = append(report.Servers, server)
+			logWarn("Failover probe connected", zap.String("db", dbType), zap.String("server", server))
+		}
+		db = newDB
+		return nil
+	}
+
+	endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+	for time.Now().Before(endTime) && ctx.Err() == nil {
+		attemptAt := time.Now()
+		report.Attempts++
+		var err error
+		if db == nil {
+			err = connect()
+			if err == nil && outage != nil && outage.ReconnectMs == 0 {
+				outage.ReconnectMs = time.Since(outage.StartedAt).Milliseconds()
+			}
+		}
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			_, err = db.ExecContext(ctx, "INSERT INTO "+testTableName(dbType)+"(value) VALUES('failover_probe')")
+			cancel()
+		}
+		if err != nil {
+			report.Failed++
+			if outage == nil {
+				outage = &failoverOutage{StartedAt: attemptAt, FirstError: err.Error()}
+				logWarn("Failover probe write failed", zap.String("db", dbType), zap.Error(err))
+			}
+			outage.Errors++
+			if db != nil {
+				db.Close()
+				db = nil
+			}
+		} else {
+			report.Succeeded++
+			if outage != nil {
+				outage.EndedAt = time.Now()
+				outage.DurationMs = outage.EndedAt.Sub(outage.StartedAt).Milliseconds()
+				report.DowntimeMs += outage.DurationMs
+				report.Outages = append(report.Outages, *outage)
+				logWarn("Failover probe recovered", zap.String("db", dbType), zap.Int64("downtime_ms", outage.DurationMs))
+				outage = nil
+			}
+		}
+		sleepContext(ctx, interval)
+	}
+	if outage != nil {
+		outage.EndedAt = time.Now()
+		outage.DurationMs = outage.EndedAt.Sub(outage.StartedAt).Milliseconds()
+		report.DowntimeMs += outage.DurationMs
+		report.Outages = append(report.Outages, *outage)
+		report.Ongoing = true
+	}
+	if db != nil {
+		db.Close()
+	}
+	return report
+}
+
+// failoverProbeHandler runs the failover probe for a handler with the given database.
+func failoverProbeHandler(c *gin.Context, dbType, driver, dsn string) {
+	var payload FailoverProbePayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	intervalMs := int(payload.IntervalMs)
+	if intervalMs <= 0 {
+		intervalMs = 100
+	}
+	timeoutMs := int(payload.TimeoutMs)
+	if timeoutMs <= 0 {
+		timeoutMs = 2000
+	}
+
+	setupDB, err := sql.Open(driver, dsn)
+	if err == nil {
+		err = SetupTestDatabase(dbType, setupDB)
+		setupDB.Close()
+	}
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
+		return
+	}
+
+	var report *failoverReport
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		report = runFailoverProbe(ctx, dbType, driver, dsn, maintainSec, time.Duration(intervalMs)*time.Millisecond, time.Duration(timeoutMs)*time.Millisecond)
+		job.setReport(report)
+		logWarn("Failover probe completed",
+			zap.String("db", dbType),
+			zap.Int("attempts", report.Attempts),
+			zap.Int("failed", report.Failed),
+			zap.Int64("downtime_ms", report.DowntimeMs),
+			zap.Strings("servers", report.Servers),
+			zap.Any("outages", report.Outages))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "failover probe started",
+			"db":              dbType,
+			"maintain_second": maintainSec,
+			"interval_ms":     intervalMs,
+			"timeout_ms":      timeoutMs,
+		})
+	} else {
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "failover probe completed",
+			"db":              dbType,
+			"maintain_second": maintainSec,
+			"interval_ms":     intervalMs,
+			"timeout_ms":      timeoutMs,
+			"report":          report,
+		})
+	}
+}
+
+// MySQLFailoverProbeHandler handles POST /mysql/failover_probe.
+// It continuously writes to MySQL and reports outages and reconnect times, e.g. during a Multi-AZ failover.
+func MySQLFailoverProbeHandler(c *gin.Context) {
+	cfg, err := GetMySQLConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	failoverProbeHandler(c, "mysql", "mysql", dsn)
+}
+
+// PostgresFailoverProbeHandler handles POST /postgres/failover_probe.
+// It continuously writes to PostgreSQL and reports outages and reconnect times, e.g. during a Multi-AZ failover.
+func PostgresFailoverProbeHandler(c *gin.Context) {
+	cfg, err := GetPostgresConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	failoverProbeHandler(c, "postgres", pgxEgressDriver, dsn)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// fanoutHopsHeader counts the fan-outs a request has passed through, so a call graph that
+// points back at itself ends after FANOUT_MAX_HOPS instead of multiplying forever.
+const fanoutHopsHeader = "X-Biggie-Fanout-Hops"
+
+// FanoutDownstream defines one downstream service of a fan-out.
+type FanoutDownstream struct {
+	URL    string          `json:"url"`
+	Method string          `json:"method"` // Default GET, or POST when body is set.
+	Body   json.RawMessage `json:"body"`   // E.g. the fan-out payload of the next tier.
+}
+
+// FanoutPayload defines the payload for the fan-out simulation.
+type FanoutPayload struct {
+	Downstreams []FanoutDownstream `json:"downstreams"` // Default: FANOUT_DOWNSTREAMS.
+	Parallel    DuckInt            `json:"parallel"`    // Calls made at once, spread over the downstreams.
+	Sequential  DuckInt            `json:"sequential"`  // Calls made one after another once the parallel ones are done.
+	TimeoutMs   DuckInt            `json:"timeout_ms"`  // Per call, default 5000.
+	FailOnError bool               `json:"fail_on_error"`
+}
+
+// fanoutCall is the outcome of one downstream call.
+type fanoutCall struct {
+	URL        string  `json:"url"`
+	Phase      string  `json:"phase"`
+	StatusCode int     `json:"status_code"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+func (call fanoutCall) failed() bool {
+	return call.Error != "" || call.StatusCode >= http.StatusInternalServerError
+}
+
+// fanoutDownstreams returns the downstreams of FANOUT_DOWNSTREAMS (comma separated URLs).
+func fanoutDownstreams() []FanoutDownstream {
+	downstreams := []FanoutDownstream{}
+	for _, u := range strings.Split(viper.GetString("FANOUT_DOWNSTREAMS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			downstreams = append(downstreams, FanoutDownstream{URL: u})
+		}
+	}
+	return downstreams
+}
+
+// FanoutHandler handles POST /simulate/fanout.
+// For every incoming request it makes parallel calls at once and then sequential calls one
+// after another to the downstream services, and reports how their latencies add up. Pointing
+// the downstreams at other Biggie instances (with their own fan-out payload as body) builds
+// realistic call graphs, including their tail-latency amplification.
+func FanoutHandler(c *gin.Context) {
+	hops, _ := strconv.Atoi(c.GetHeader(fanoutHopsHeader))
+	if maxHops := viper.GetInt("FANOUT_MAX_HOPS"); hops >= maxHops {
+		ErrorJSON(c, http.StatusLoopDetected, "FANOUT_LOOP_DETECTED",
+			fmt.Sprintf("request already passed %d fan-outs, the maximum is FANOUT_MAX_HOPS=%d", hops, maxHops))
+		return
+	}
+	var payload FanoutPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	downstreams := payload.Downstreams
+	if len(downstreams) == 0 {
+		downstreams = fanoutDownstreams()
+	}
+	if len(downstreams) == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "downstreams or FANOUT_DOWNSTREAMS is required")
+		return
+	}
+	for _, d := range downstreams {
+		if err := checkTargetAllowed(d.URL); err != nil {
+			ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+			return
+		}
+	}
+	parallel := int(payload.Parallel)
+	sequential := int(payload.Sequential)
+	if parallel < 0 || sequential < 0 || parallel+sequential > 1000 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "parallel and sequential must be between 0 and 1000 in total")
+		return
+	}
+	if parallel == 0 && sequential == 0 {
+		parallel = len(downstreams)
+	}
+	timeoutMs := int(payload.TimeoutMs)
+	if timeoutMs <= 0 {
+		timeoutMs = 5000
+	}
+	client, err := newOutboundClient(time.Duration(timeoutMs)*time.Millisecond, connectionModeReuse, "")
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	ns := getNamespace(c)
+
+	call := func(d FanoutDownstream, phase string) fanoutCall {
+		method := d.Method
+		if method == "" {
+			method = http.MethodGet
+			if len(d.Body) > 0 {
+				method = http.MethodPost
+			}
+		}
+		result := fanoutCall{URL: d.URL, Phase: phase}
+		req, err := http.NewRequestWithContext(c.Request.Context(), method, d.URL, bytes.NewReader(d.Body))
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if len(d.Body) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set(fanoutHopsHeader, strconv.Itoa(hops+1))
+		if ns != "" {
+			// Keep the whole call graph in the caller's namespace.
+			req.Header.Set(namespaceHeader, ns)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		discardResponse(resp)
+		result.StatusCode = resp.StatusCode
+		return result
+	}
+
+	start := time.Now()
+	calls := make([]fanoutCall, parallel, parallel+sequential)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			calls[i] = call(downstreams[i%len(downstreams)], "parallel")
+		}(i)
+	}
+	wg.Wait()
+	parallelMs := float64(time.Since(start).Microseconds()) / 1000
+	sequentialStart := time.Now()
+	for i := 0; i < sequential; i++ {
+		calls = append(calls, call(downstreams[i%len(downstreams)], "sequential"))
+	}
+	sequentialMs := float64(time.Since(sequentialStart).Microseconds()) / 1000
+
+	failed := 0
+	sumMs, slowestParallelMs := 0.0, 0.0
+	for _, call := range calls {
+		if call.failed() {
+			failed++
+		}
+		sumMs += call.DurationMs
+		if call.Phase == "parallel" && call.DurationMs > slowestParallelMs {
+			slowestParallelMs = call.DurationMs
+		}
+	}
+	result := gin.H{
+		"message":             "fanout completed",
+		"namespace":           ns,
+		"parallel":            parallel,
+		"sequential":          sequential,
+		"failed":              failed,
+		"total_ms":            float64(time.Since(start).Microseconds()) / 1000,
+		"parallel_ms":         parallelMs,
+		"slowest_parallel_ms": slowestParallelMs,
+		"sequential_ms":       sequentialMs,
+		"sum_of_calls_ms":     sumMs,
+		"calls":               calls,
+	}
+	if payload.FailOnError && failed > 0 {
+		result["error"] = "DOWNSTREAM_FAILED"
+		result["message"] = "fanout failed"
+		ResponseJSON(c, http.StatusBadGateway, result)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, result)
+}
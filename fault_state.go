@@ -0,0 +1,229 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// faultSnapshot is an immutable view of the request-path faults of one scope (global or a
+// namespace). Every fault carries its own expiry; an expired fault is simply inactive, so no
+// reset goroutine can clobber a newer injection.
+type faultSnapshot struct {
+	ErrorRate        float64
+	ErrorExpiry      time.Time
+	LatencyMs        int
+	LatencyMode      string // latencyModeRequest or latencyModeResponse.
+	LatencyExpiry    time.Time
+	PacketLoss       int // Percentage (0-100)
+	PacketLossExpiry time.Time
+	DowntimeExpiry   time.Time
+}
+
+// errorRate returns the active error rate at now, or 0.
+func (f faultSnapshot) errorRate(now time.Time) float64 {
+	if now.Before(f.ErrorExpiry) {
+		return f.ErrorRate
+	}
+	return 0
+}
+
+// latency returns the active latency in milliseconds at now, or 0.
+func (f faultSnapshot) latency(now time.Time) int {
+	if now.Before(f.LatencyExpiry) {
+		return f.LatencyMs
+	}
+	return 0
+}
+
+// packetLoss returns the active packet loss percentage at now, or 0.
+func (f faultSnapshot) packetLoss(now time.Time) int {
+	if now.Before(f.PacketLossExpiry) {
+		return f.PacketLoss
+	}
+	return 0
+}
+
+// down reports whether downtime is active at now.
+func (f faultSnapshot) down(now time.Time) bool {
+	return now.Before(f.DowntimeExpiry)
+}
+
+// active reports whether any fault is in effect at now.
+func (f faultSnapshot) active(now time.Time) bool {
+	return now.Before(f.ErrorExpiry) || now.Before(f.LatencyExpiry) ||
+		now.Before(f.PacketLossExpiry) || now.Before(f.DowntimeExpiry)
+}
+
+// remainingSecond returns the seconds left until expiry, or 0.
+func remainingSecond(now, expiry time.Time) int {
+	if now.Before(expiry) {
+		return int(expiry.Sub(now).Seconds())
+	}
+	return 0
+}
+
+func (f faultSnapshot) toMap(now time.Time) gin.H {
+	return gin.H{
+		"error_rate":                   f.errorRate(now),
+		"error_remaining_second":       remainingSecond(now, f.ErrorExpiry),
+		"latency_ms":                   f.latency(now),
+		"latency_mode":                 f.LatencyMode,
+		"latency_remaining_second":     remainingSecond(now, f.LatencyExpiry),
+		"loss_percentage":              f.packetLoss(now),
+		"packet_loss_remaining_second": remainingSecond(now, f.PacketLossExpiry),
+		"downtime_active":              f.down(now),
+		"downtime_remaining_second":    remainingSecond(now, f.DowntimeExpiry),
+	}
+}
+
+// FaultState holds the global and per-namespace request-path faults. Readers (the
+// middlewares) load snapshots atomically without locking; writers are serialized and
+// replace the snapshots copy-on-write.
+type FaultState struct {
+	mutex      sync.Mutex
+	global     atomic.Pointer[faultSnapshot]
+	namespaces atomic.Pointer[map[string]faultSnapshot]
+}
+
+// newFaultState returns a FaultState without active faults.
+func newFaultState() *FaultState {
+	s := &FaultState{}
+	s.Reset()
+	return s
+}
+
+// faultState is the fault state of this instance.
+var faultState = newFaultState()
+
+// Global returns the global faults.
+func (s *FaultState) Global() faultSnapshot {
+	return *s.global.Load()
+}
+
+// Namespaces returns the faults of every namespace.
+func (s *FaultState) Namespaces() map[string]faultSnapshot {
+	return *s.namespaces.Load()
+}
+
+// Effective returns the faults applying to a request of ns ("" for none): the namespace's
+// own faults while they are active, the global ones otherwise.
+func (s *FaultState) Effective(ns string, now time.Time) faultSnapshot {
+	f := s.Global()
+	if ns == "" {
+		return f
+	}
+	n, ok := s.Namespaces()[ns]
+	if !ok {
+		return f
+	}
+	if now.Before(n.ErrorExpiry) {
+		f.ErrorRate, f.ErrorExpiry = n.ErrorRate, n.ErrorExpiry
+	}
+	if now.Before(n.LatencyExpiry) {
+		f.LatencyMs, f.LatencyMode, f.LatencyExpiry = n.LatencyMs, n.LatencyMode, n.LatencyExpiry
+	}
+	if now.Before(n.PacketLossExpiry) {
+		f.PacketLoss, f.PacketLossExpiry = n.PacketLoss, n.PacketLossExpiry
+	}
+	if now.Before(n.DowntimeExpiry) {
+		f.DowntimeExpiry = n.DowntimeExpiry
+	}
+	return f
+}
+
+// Update applies update to the faults of ns ("" for global) and records the faults it
+// activates or clears in the event log and the persisted state. Namespaces without active faults are dropped on the way.
+func (s *FaultState) Update(ns string, update func(f *faultSnapshot)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ns == "" {
+		old := s.Global()
+		f := old
+		update(&f)
+		s.global.Store(&f)
+		recordFaultChanges(ns, old, f)
+		persistState()
+		return
+	}
+	now := time.Now()
+	namespaces := make(map[string]faultSnapshot)
+	for name, f := range s.Namespaces() {
+		if f.active(now) {
+			namespaces[name] = f
+		}
+	}
+	old := namespaces[ns]
+	f := old
+	update(&f)
+	namespaces[ns] = f
+	s.namespaces.Store(&namespaces)
+	recordFaultChanges(ns, old, f)
+	persistState()
+}
+
+// Reset clears every global and namespaced fault.
+func (s *FaultState) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.global.Store(&faultSnapshot{})
+	s.namespaces.Store(&map[string]faultSnapshot{})
+	persistState()
+}
+
+// FaultStateHandler handles GET /stress/state.
+// It returns a single snapshot of every active fault: the request-path faults (global and
+// per namespace) and the other simulations that change how the instance behaves.
+func FaultStateHandler(c *gin.Context) {
+	now := time.Now()
+	namespaces := gin.H{}
+	for name, f := range faultState.Namespaces() {
+		if f.active(now) {
+			namespaces[name] = f.toMap(now)
+		}
+	}
+
+	loadSheddingMutex.Lock()
+	loadShedding := gin.H{
+		"active":           now.Before(loadSheddingExpiry),
+		"remaining_second": remainingSecond(now, loadSheddingExpiry),
+	}
+	loadSheddingMutex.Unlock()
+
+	queueSimMutex.Lock()
+	queue := gin.H{"active": activeQueueSim != nil && now.Before(activeQueueSim.expiry)}
+	queueSimMutex.Unlock()
+
+	egressMutex.Lock()
+	egress := gin.H{"active": activeEgressFaults != nil && now.Before(activeEgressFaults.expiry)}
+	egressMutex.Unlock()
+
+	azFailureMutex.Lock()
+	azFailure := gin.H{
+		"active":           now.Before(azFailureExpiry),
+		"mode":             azFailureMode,
+		"zones":            azFailureZones,
+		"remaining_second": remainingSecond(now, azFailureExpiry),
+	}
+	azFailureMutex.Unlock()
+
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"global":          faultState.Global().toMap(now),
+		"namespaces":      namespaces,
+		"load_shedding":   loadShedding,
+		"queue":           queue,
+		"egress_faults":   egress,
+		"az_failure":      azFailure,
+		"connections":     connectionChaosStatus(),
+		"mirror":          mirrorStatus(),
+		"metrics_noise":   metricsNoiseStatus(),
+		"label_explosion": labelExplosionStatus(),
+		"draining":        isDraining(),
+		"maintenance":     maintenanceStatus(),
+		"chaos_window":    chaosWindowStatus(),
+		"timeouts":        requestTimeoutStatus(),
+	})
+}
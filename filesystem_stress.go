@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -26,7 +26,7 @@ type FileWritePayload struct {
 // FileWriteHandler handles POST /stress/filesystem/write.
 func FileWriteHandler(c *gin.Context) {
 	var payload FileWritePayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -36,8 +36,10 @@ func FileWriteHandler(c *gin.Context) {
 	maintainSec := int(payload.MaintainSecond)
 	intervalSec := int(payload.IntervalSecond)
 
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	work := func(ctx context.Context) { runFileWriteStress(ctx, fileSize, fileCount, maintainSec, intervalSec) }
 	if payload.Async {
-		go runFileWriteStress(fileSize, fileCount, maintainSec, intervalSec)
+		go job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "file write stress started",
 			"file_size":       fileSize,
@@ -46,7 +48,7 @@ func FileWriteHandler(c *gin.Context) {
 			"interval_second": intervalSec,
 		})
 	} else {
-		runFileWriteStress(fileSize, fileCount, maintainSec, intervalSec)
+		job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "file write stress completed",
 			"file_size":       fileSize,
@@ -57,13 +59,13 @@ func FileWriteHandler(c *gin.Context) {
 	}
 }
 
-func runFileWriteStress(fileSize, fileCount, maintainSec, intervalSec int) {
+func runFileWriteStress(ctx context.Context, fileSize, fileCount, maintainSec, intervalSec int) {
 	// Determine temporary directory.
 	tmpDir := os.TempDir()
 	endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
 	interval := time.Duration(intervalSec) * time.Second
 
-	for time.Now().Before(endTime) {
+	for time.Now().Before(endTime) && ctx.Err() == nil {
 		for i := 0; i < fileCount; i++ {
 			// Create a temporary file name.
 			filename := filepath.Join(tmpDir, "biggie_write_"+strconv.FormatInt(time.Now().UnixNano(), 10)+"_"+strconv.Itoa(i)+".tmp")
@@ -73,15 +75,15 @@ func runFileWriteStress(fileSize, fileCount, maintainSec, intervalSec int) {
 			// Write data to file.
 			err := ioutil.WriteFile(filename, data, 0644)
 			if err != nil {
-				fmt.Println("failed to write file", zap.String("file", filename), zap.Error(err))
+				logError("failed to write file", zap.String("file", filename), zap.Error(err))
 			} else {
 				// Optionally remove file immediately to avoid disk fill.
 				os.Remove(filename)
 			}
 		}
-		time.Sleep(interval)
+		sleepContext(ctx, interval)
 	}
-	fmt.Println("File write stress completed", zap.Int("file_size", fileSize), zap.Int("file_count", fileCount))
+	logInfo("File write stress completed", zap.Int("file_size", fileSize), zap.Int("file_count", fileCount))
 }
 
 // FileReadPayload defines the JSON payload for heavy file read stress.
@@ -96,7 +98,7 @@ type FileReadPayload struct {
 // FileReadHandler handles POST /stress/filesystem/read.
 func FileReadHandler(c *gin.Context) {
 	var payload FileReadPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -106,8 +108,10 @@ func FileReadHandler(c *gin.Context) {
 	intervalSec := int(payload.IntervalSecond)
 	filePath := payload.FilePath
 
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	work := func(ctx context.Context) { runFileReadStress(ctx, filePath, maintainSec, readFreq, intervalSec) }
 	if payload.Async {
-		go runFileReadStress(filePath, maintainSec, readFreq, intervalSec)
+		go job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "file read stress started",
 			"file_path":       filePath,
@@ -116,7 +120,7 @@ func FileReadHandler(c *gin.Context) {
 			"interval_second": intervalSec,
 		})
 	} else {
-		runFileReadStress(filePath, maintainSec, readFreq, intervalSec)
+		job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "file read stress completed",
 			"file_path":       filePath,
@@ -127,18 +131,18 @@ func FileReadHandler(c *gin.Context) {
 	}
 }
 
-func runFileReadStress(filePath string, maintainSec, readFreq, intervalSec int) {
+func runFileReadStress(ctx context.Context, filePath string, maintainSec, readFreq, intervalSec int) {
 	endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
 	interval := time.Duration(intervalSec) * time.Second
 
-	for time.Now().Before(endTime) {
+	for time.Now().Before(endTime) && ctx.Err() == nil {
 		for i := 0; i < readFreq; i++ {
 			_, err := ioutil.ReadFile(filePath)
 			if err != nil {
-				fmt.Println("failed to read file", zap.String("file", filePath), zap.Error(err))
+				logError("failed to read file", zap.String("file", filePath), zap.Error(err))
 			}
 		}
-		time.Sleep(interval)
+		sleepContext(ctx, interval)
 	}
-	fmt.Println("File read stress completed", zap.String("file_path", filePath))
+	logInfo("File read stress completed", zap.String("file_path", filePath))
 }
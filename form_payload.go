@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formContentType is the content type of HTML form posts.
+const formContentType = "application/x-www-form-urlencoded"
+
+// jsonUnmarshalerType is used to find the duck-typed fields, which take strings.
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// FormPayloadMiddleware accepts payloads as application/x-www-form-urlencoded bodies or, for
+// the /stress/ endpoints called without a body, as query parameters, for schedulers and
+// probes that cannot send JSON. The values are kept in the Gin context for bindPayload, and
+// rawBody is replaced with their JSON equivalent for the middlewares reading it. Fields those
+// middlewares rewrite in rawBody (capped durations, resolved RANDOM values) apply to the
+// values as well, see formValues.
+func FormPayloadMiddleware(c *gin.Context) {
+	var values url.Values
+	switch {
+	case c.ContentType() == formContentType:
+		raw, _ := c.Get("rawBody")
+		s, _ := raw.(string)
+		parsed, err := url.ParseQuery(s)
+		if err != nil {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+			c.Abort()
+			return
+		}
+		values = parsed
+	case strings.HasPrefix(c.Request.URL.Path, "/stress/") && c.Request.Method != http.MethodGet &&
+		c.Request.ContentLength <= 0 && c.Request.URL.RawQuery != "":
+		raw, _ := c.Get("rawBody")
+		if s, _ := raw.(string); strings.TrimSpace(s) != "" {
+			break
+		}
+		values = c.Request.URL.Query()
+	}
+	if len(values) > 0 {
+		c.Set("formPayload", values)
+		if body, err := json.Marshal(inferFormJSON(values)); err == nil {
+			c.Set("rawBody", string(body))
+			c.Set("formRawBody", string(body))
+		}
+	}
+	c.Next()
+}
+
+// inferFormJSON returns values as a JSON object without knowing the payload, guessing each
+// value's type: JSON objects, arrays, numbers and booleans are kept, anything else is a string.
+func inferFormJSON(values url.Values) map[string]interface{} {
+	infer := func(s string) interface{} {
+		var v interface{}
+		if json.Unmarshal([]byte(s), &v) == nil {
+			return v
+		}
+		return s
+	}
+	object := make(map[string]interface{}, len(values))
+	for key, vals := range values {
+		if len(vals) == 1 {
+			object[key] = infer(vals[0])
+			continue
+		}
+		list := make([]interface{}, len(vals))
+		for i, s := range vals {
+			list[i] = infer(s)
+		}
+		object[key] = list
+	}
+	return object
+}
+
+// formValues returns the form or query values found by FormPayloadMiddleware, with the
+// fields that later middlewares rewrote in rawBody replaced, and false for other requests.
+func formValues(c *gin.Context) (url.Values, bool) {
+	raw, ok := c.Get("formPayload")
+	if !ok {
+		return nil, false
+	}
+	values := raw.(url.Values)
+	original, _ := c.Get("formRawBody")
+	current, _ := c.Get("rawBody")
+	originalBody, _ := original.(string)
+	currentBody, _ := current.(string)
+	var before, after map[string]json.RawMessage
+	if originalBody == currentBody || json.Unmarshal([]byte(originalBody), &before) != nil ||
+		json.Unmarshal([]byte(currentBody), &after) != nil {
+		return values, true
+	}
+	rewritten := make(url.Values, len(values))
+	for name, vals := range values {
+		rewritten[name] = vals
+	}
+	for name, value := range after {
+		if bytes.Equal(before[name], value) {
+			continue
+		}
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			s = string(value)
+		}
+		rewritten[name] = []string{s}
+	}
+	return rewritten, true
+}
+
+// bindPayload binds the request payload into obj, a pointer to a payload struct: the JSON
+// body, or the form or query values found by FormPayloadMiddleware.
+func bindPayload(c *gin.Context, obj interface{}) error {
+	values, ok := formValues(c)
+	if !ok {
+		return c.ShouldBindJSON(obj)
+	}
+	body, err := formToJSON(values, reflect.TypeOf(obj).Elem())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, obj)
+}
+
+// formToJSON converts form values into a JSON object for the struct type t, following its
+// json tags. Duck-typed fields (DuckInt, DuckFloat...) get the string as is, so RANDOM works
+// as in JSON; slices take repeated or comma-separated values, and maps and structs a JSON value.
+func formToJSON(values url.Values, t reflect.Type) ([]byte, error) {
+	object := map[string]json.RawMessage{}
+	if err := collectFormFields(values, t, object); err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
+
+// collectFormFields adds the JSON values of the fields of struct t found in values to object.
+func collectFormFields(values url.Values, t reflect.Type, object map[string]json.RawMessage) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := collectFormFields(values, field.Type, object); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		vals, ok := values[name]
+		if !ok || name == "-" || !field.IsExported() {
+			continue
+		}
+		value, err := formFieldJSON(vals, field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+		object[name] = value
+	}
+	return nil
+}
+
+// formFieldJSON returns the JSON value of the form values vals for a field of type t.
+func formFieldJSON(vals []string, t reflect.Type) (json.RawMessage, error) {
+	s := vals[0]
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return json.Marshal(s)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return json.Marshal(s)
+	case reflect.Bool:
+		if s == "" || s == "on" {
+			return json.RawMessage("true"), nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, 64); err != nil || !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return json.RawMessage(s), nil
+	case reflect.Slice, reflect.Array:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return json.RawMessage(s), nil
+		}
+		items := vals
+		if len(vals) == 1 && t.Elem().Kind() != reflect.Struct && t.Elem().Kind() != reflect.Map {
+			items = strings.Split(s, ",")
+		}
+		list := make([]json.RawMessage, len(items))
+		for i, item := range items {
+			value, err := formFieldJSON([]string{strings.TrimSpace(item)}, t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return json.Marshal(list)
+	case reflect.Ptr:
+		return formFieldJSON(vals, t.Elem())
+	}
+	// Maps, structs and interfaces take a JSON value, or a plain string.
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s), nil
+	}
+	return json.Marshal(s)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryPayloadCappedByChaosWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	chaosWindowMutex.Lock()
+	chaosWindowOpen, chaosWindowExpiry = true, time.Now().Add(60*time.Second)
+	chaosWindowMutex.Unlock()
+	defer func() {
+		chaosWindowMutex.Lock()
+		chaosWindowOpen = false
+		chaosWindowMutex.Unlock()
+	}()
+
+	var payload struct {
+		MaintainSecond DuckInt `json:"maintain_second"`
+		Async          bool    `json:"async"`
+	}
+	router := gin.New()
+	router.Use(RequestBodyMiddleware(), FormPayloadMiddleware, ChaosWindowMiddleware)
+	router.POST("/stress/test", func(c *gin.Context) {
+		if err := bindPayload(c, &payload); err != nil {
+			t.Fatalf("bindPayload: %v", err)
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/stress/test?maintain_second=86400&async=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if payload.MaintainSecond <= 0 || payload.MaintainSecond > 60 {
+		t.Errorf("maintain_second = %d, want capped to at most 60", payload.MaintainSecond)
+	}
+	if !payload.Async {
+		t.Error("async = false, want true")
+	}
+	if w.Header().Get("X-Chaos-Window-Capped") != "true" {
+		t.Error("X-Chaos-Window-Capped header missing")
+	}
+}
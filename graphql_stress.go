@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// GraphQLStressPayload defines the payload for the GraphQL stress test.
+type GraphQLStressPayload struct {
+	TargetURL     string                 `json:"target_url"`
+	Query         string                 `json:"query"` // If empty, a query is generated from the knobs below.
+	OperationName string                 `json:"operation_name"`
+	Variables     map[string]interface{} `json:"variables"` // String values support RANDOM syntax and {i}.
+	Headers       map[string]string      `json:"headers"`
+
+	// Query generation knobs, used only when query is empty.
+	RootField  string   `json:"root_field"`  // e.g. "user(id: 1)"
+	NestField  string   `json:"nest_field"`  // Field repeated at each nesting level, e.g. "friends".
+	LeafFields []string `json:"leaf_fields"` // Fields selected at every level, e.g. ["id", "name"].
+	Depth      DuckInt  `json:"depth"`       // Nesting depth of nest_field.
+	Aliases    DuckInt  `json:"aliases"`     // Number of aliased copies of the root selection.
+
+	MaintainSecond     DuckInt `json:"maintain_second"`
+	Async              bool    `json:"async"`
+	RequestPerInterval DuckInt `json:"request_per_interval"`
+	IntervalSecond     DuckInt `json:"interval_second"`
+}
+
+// generateGraphQLQuery builds a query whose depth and breadth grow with the given knobs,
+// so resolver fan-out and query-cost limits on the target can be exercised.
+func generateGraphQLQuery(rootField, nestField string, leafFields []string, depth, aliases int) string {
+	if rootField == "" {
+		rootField = "__typename"
+	}
+	if len(leafFields) == 0 {
+		leafFields = []string{"__typename"}
+	}
+	if aliases <= 0 {
+		aliases = 1
+	}
+	leaves := strings.Join(leafFields, " ")
+	selection := leaves
+	if nestField != "" {
+		for i := 0; i < depth; i++ {
+			selection = fmt.Sprintf("%s { %s } %s", nestField, selection, leaves)
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("query BiggieStress {")
+	for i := 0; i < aliases; i++ {
+		if rootField == "__typename" {
+			sb.WriteString(fmt.Sprintf(" a%d: __typename", i))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(" a%d: %s { %s }", i, rootField, selection))
+	}
+	sb.WriteString(" }")
+	return sb.String()
+}
+
+// renderGraphQLVariables resolves templated variable values for a single request.
+// String values are passed through processRandomValue and "{i}" is replaced by the request number.
+func renderGraphQLVariables(vars map[string]interface{}, i int64) map[string]interface{} {
+	if len(vars) == 0 {
+		return nil
+	}
+	rendered := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		s, ok := v.(string)
+		if !ok {
+			rendered[k] = v
+			continue
+		}
+		s = strings.ReplaceAll(s, "{i}", strconv.FormatInt(i, 10))
+		if processed, err := processRandomValue(s); err == nil {
+			rendered[k] = processed
+		} else {
+			rendered[k] = s
+		}
+	}
+	return rendered
+}
+
+// GraphQLStressHandler handles POST /stress/graphql.
+// It sends GraphQL operations to target_url at the configured rate for maintain_second seconds.
+func GraphQLStressHandler(c *gin.Context) {
+	var payload GraphQLStressPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.TargetURL == "" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "target_url is required")
+		return
+	}
+	if err := checkTargetAllowed(payload.TargetURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	requestPerInterval := int(payload.RequestPerInterval)
+	intervalSec := int(payload.IntervalSecond)
+	if maxDepth := viper.GetInt("GRAPHQL_MAX_DEPTH"); int(payload.Depth) > maxDepth {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("depth must not exceed %d", maxDepth))
+		return
+	}
+	if maxAliases := viper.GetInt("GRAPHQL_MAX_ALIASES"); int(payload.Aliases) > maxAliases {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("aliases must not exceed %d", maxAliases))
+		return
+	}
+	query := payload.Query
+	if query == "" {
+		query = generateGraphQLQuery(payload.RootField, payload.NestField, payload.LeafFields, int(payload.Depth), int(payload.Aliases))
+	}
+	stats := &trafficStats{}
+	var graphqlErrors int64
+	var counter int64
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		client := &http.Client{Timeout: 30 * time.Second}
+		for time.Now().Before(endTime) && ctx.Err() == nil {
+			var wg sync.WaitGroup
+			for i := 0; i < requestPerInterval; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n := atomic.AddInt64(&counter, 1)
+					body, err := json.Marshal(gin.H{
+						"query":         query,
+						"operationName": payload.OperationName,
+						"variables":     renderGraphQLVariables(payload.Variables, n),
+					})
+					if err != nil {
+						stats.recordFailure()
+						return
+					}
+					if hasErrors := sendGraphQLRequest(client, payload.TargetURL, payload.Headers, body, stats); hasErrors {
+						atomic.AddInt64(&graphqlErrors, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
+		}
+		logInfo("GraphQL stress completed",
+			zap.String("target_url", payload.TargetURL),
+			zap.Int("duration_sec", maintainSec))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":              "graphql stress started",
+			"target_url":           payload.TargetURL,
+			"query":                query,
+			"maintain_second":      maintainSec,
+			"request_per_interval": requestPerInterval,
+			"interval_second":      intervalSec,
+		})
+	} else {
+		job.run(stressFunc)
+		results := stats.toMap()
+		results["graphql_errors"] = atomic.LoadInt64(&graphqlErrors)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":              "graphql stress completed",
+			"target_url":           payload.TargetURL,
+			"query":                query,
+			"maintain_second":      maintainSec,
+			"request_per_interval": requestPerInterval,
+			"interval_second":      intervalSec,
+			"results":              results,
+		})
+	}
+}
+
+// sendGraphQLRequest posts a single GraphQL operation and reports whether the
+// response carried a non-empty "errors" array (GraphQL errors usually come with HTTP 200).
+func sendGraphQLRequest(client *http.Client, targetURL string, headers map[string]string, body []byte, stats *trafficStats) bool {
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		stats.recordFailure()
+		logWarn("graphql request creation failed", zap.Error(err))
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	stats.recordSent()
+	resp, err := client.Do(req)
+	if err != nil {
+		stats.recordFailure()
+		logWarn("graphql request failed", zap.Error(err))
+		return false
+	}
+	defer resp.Body.Close()
+	stats.recordStatus(resp.StatusCode)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false
+	}
+	var result struct {
+		Errors []interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return false
+	}
+	return len(result.Errors) > 0
+}
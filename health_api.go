@@ -5,12 +5,15 @@ import (
 	"context"
 	"crypto/tls"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +24,12 @@ import (
 )
 
 // HealthCheckHandler handles GET /healthcheck and returns "ok" as fast as possible.
+// While the instance is draining after a simulated reclaim it returns 503 so the target is deregistered.
 func HealthCheckHandler(c *gin.Context) {
+	if isDraining() {
+		ErrorJSON(c, http.StatusServiceUnavailable, "DRAINING", "instance is draining before shutdown")
+		return
+	}
 	ResponseJSON(c, http.StatusOK, gin.H{"message": "ok"})
 }
 
@@ -108,12 +116,27 @@ func ExternalHealthHandler(c *gin.Context) {
 	ResponseJSON(c, http.StatusOK, statuses)
 }
 
+// relayHopHeader carries the position of a relayed request in a chain of biggie instances.
+const relayHopHeader = "X-Biggie-Relay-Hop"
+
+// maxRelayHops bounds the hops of a relay chain.
+const maxRelayHops = 32
+
+// relayTraceHeaders are propagated from hop to hop, so a chain shows up as one trace.
+var relayTraceHeaders = []string{"traceparent", "tracestate", "X-Amzn-Trace-Id", "X-Request-Id", "X-B3-TraceId", "X-B3-SpanId", "X-B3-Sampled"}
+
 // RelayRequest defines the expected JSON payload for the relay API.
 type RelayRequest struct {
 	URL     string            `json:"url"`
 	Method  string            `json:"method"`
 	Headers map[string]string `json:"headers"`
 	Body    string            `json:"body"`
+	// ConnectionMode is "reuse" (default) or "churn".
+	ConnectionMode string `json:"connection_mode"`
+	// ProxyURL overrides HTTP(S)_PROXY for this call; "direct" bypasses any proxy.
+	ProxyURL string `json:"proxy_url"`
+	// Hops are the base URLs of biggie instances to relay through, in order, before url.
+	Hops []string `json:"hops"`
 }
 
 // RelayResponse defines the structure of the relay response.
@@ -122,36 +145,117 @@ type RelayResponse struct {
 	Headers     http.Header `json:"headers"`
 	Body        string      `json:"body"`
 	RequestedAt string      `json:"requested_at"`
+	Hops        []relayHop  `json:"hops,omitempty"`
+	Error       string      `json:"error,omitempty"`
 }
 
-// RelayHandler handles POST /healthcheck/hops.
+// relayHop is one hop of a relay chain: the instance that sent the request, where to, and
+// the round trip it measured, which includes the rest of the chain.
+type relayHop struct {
+	Hop        int     `json:"hop"`
+	Instance   string  `json:"instance"`
+	To         string  `json:"to,omitempty"`
+	StatusCode int     `json:"status_code,omitempty"`
+	LatencyMs  float64 `json:"latency_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// RelayHandler handles POST /healthcheck/relay and POST /healthcheck/hops.
 // It sends an HTTP request to the specified URL with given method, headers, and body,
-// then returns the response details.
+// then returns the response details. With hops, the request is first forwarded through
+// each biggie instance listed, and the response lists the status and latency of every hop.
 func RelayHandler(c *gin.Context) {
 	var reqPayload RelayRequest
-	if err := c.ShouldBindJSON(&reqPayload); err != nil {
+	if err := bindPayload(c, &reqPayload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
+	if len(reqPayload.Hops) > maxRelayHops {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("at most %d hops are allowed", maxRelayHops))
+		return
+	}
+	hopIndex, _ := strconv.Atoi(c.GetHeader(relayHopHeader))
+	chained := len(reqPayload.Hops) > 0 || c.GetHeader(relayHopHeader) != ""
+	instance, _ := os.Hostname()
+
+	// The last instance of a chain without a url just answers.
+	if chained && len(reqPayload.Hops) == 0 && reqPayload.URL == "" {
+		ResponseJSON(c, http.StatusOK, RelayResponse{
+			StatusCode:  http.StatusOK,
+			RequestedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			Hops:        []relayHop{{Hop: hopIndex, Instance: instance}},
+		})
+		return
+	}
 
 	// Create the new request with provided body.
+	target, method, body := reqPayload.URL, reqPayload.Method, reqPayload.Body
+	if len(reqPayload.Hops) > 0 {
+		next := reqPayload
+		next.Hops = reqPayload.Hops[1:]
+		forwarded, err := json.Marshal(next)
+		if err != nil {
+			ErrorJSON(c, http.StatusInternalServerError, "REQUEST_CREATION_FAILED", err.Error())
+			return
+		}
+		target = strings.TrimSuffix(reqPayload.Hops[0], "/") + "/healthcheck/hops"
+		method, body = http.MethodPost, string(forwarded)
+	}
+	if err := checkTargetAllowed(target); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
 	var bodyReader io.Reader
-	if reqPayload.Body != "" {
-		bodyReader = bytes.NewBufferString(reqPayload.Body)
+	if body != "" {
+		bodyReader = bytes.NewBufferString(body)
 	}
-	req, err := http.NewRequest(reqPayload.Method, reqPayload.URL, bodyReader)
+	req, err := http.NewRequest(method, target, bodyReader)
 	if err != nil {
 		ErrorJSON(c, http.StatusInternalServerError, "REQUEST_CREATION_FAILED", err.Error())
 		return
 	}
-	// Set provided headers.
-	for key, value := range reqPayload.Headers {
-		req.Header.Set(key, value)
+	if len(reqPayload.Hops) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(relayHopHeader, strconv.Itoa(hopIndex+1))
+		for _, key := range relayTraceHeaders {
+			if value := c.GetHeader(key); value != "" {
+				req.Header.Set(key, value)
+			}
+		}
+	} else {
+		// Set provided headers.
+		for key, value := range reqPayload.Headers {
+			req.Header.Set(key, value)
+		}
 	}
 
-	// Create a client with a timeout.
-	client := &http.Client{Timeout: 10 * time.Second}
+	if err := checkProxyAllowed(reqPayload.ProxyURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	client, err := newOutboundClient(10*time.Second, reqPayload.ConnectionMode, reqPayload.ProxyURL)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	start := time.Now()
 	resp, err := client.Do(req)
+	hop := relayHop{Hop: hopIndex, Instance: instance, To: target}
+	if err != nil && chained {
+		// Report the hops reached so far instead of failing the whole chain.
+		hop.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		hop.Error = err.Error()
+		ResponseJSON(c, http.StatusBadGateway, RelayResponse{
+			RequestedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			Hops:        []relayHop{hop},
+			Error:       fmt.Sprintf("hop %d (%s) failed: %v", hopIndex, instance, err),
+		})
+		return
+	}
+	if isProxyError(err) {
+		ErrorJSON(c, http.StatusBadGateway, "PROXY_FAILED", err.Error())
+		return
+	}
 	if err != nil {
 		ErrorJSON(c, http.StatusInternalServerError, "REQUEST_FAILED", err.Error())
 		return
@@ -163,6 +267,8 @@ func RelayHandler(c *gin.Context) {
 		ErrorJSON(c, http.StatusInternalServerError, "READ_RESPONSE_FAILED", err.Error())
 		return
 	}
+	hop.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	hop.StatusCode = resp.StatusCode
 
 	// Build the relay response.
 	relayResp := RelayResponse{
@@ -171,7 +277,28 @@ func RelayHandler(c *gin.Context) {
 		Body:        string(respBody),
 		RequestedAt: time.Now().UTC().Format(time.RFC3339Nano),
 	}
-	ResponseJSON(c, http.StatusOK, relayResp)
+	if !chained {
+		ResponseJSON(c, http.StatusOK, relayResp)
+		return
+	}
+	relayResp.Hops = []relayHop{hop}
+	if len(reqPayload.Hops) > 0 {
+		// The next instance answered with the rest of the chain; a target that is not biggie
+		// ends it.
+		var downstream struct {
+			Data RelayResponse `json:"data"`
+		}
+		if json.Unmarshal(respBody, &downstream) == nil && len(downstream.Data.Hops) > 0 {
+			relayResp = downstream.Data
+			relayResp.Hops = append([]relayHop{hop}, downstream.Data.Hops...)
+			relayResp.RequestedAt = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+	}
+	status := http.StatusOK
+	if relayResp.Error != "" {
+		status = http.StatusBadGateway
+	}
+	ResponseJSON(c, status, relayResp)
 }
 
 // checkMySQL connects to MySQL using the provided configuration and pings the server.
@@ -188,7 +315,7 @@ func checkMySQL(cfg *MySQLConfig) error {
 // checkPostgres connects to PostgreSQL using the provided configuration and pings the server.
 func checkPostgres(cfg *PostgresConfig) error {
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	db, err := sql.Open("pgx", dsn)
+	db, err := sql.Open(pgxEgressDriver, dsn)
 	if err != nil {
 		return err
 	}
@@ -200,7 +327,7 @@ func checkPostgres(cfg *PostgresConfig) error {
 func checkRedshift(cfg *RedshiftConfig) error {
 	// Use the same DSN format as PostgreSQL.
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	db, err := sql.Open("pgx", dsn)
+	db, err := sql.Open(pgxEgressDriver, dsn)
 	if err != nil {
 		return err
 	}
@@ -219,6 +346,7 @@ func checkRedis(cfg *RedisConfig) error {
 			InsecureSkipVerify: true,
 		}
 	}
+	options.Dialer = egressRedisDialer(options.TLSConfig)
 	client := redis.NewClient(options)
 	defer client.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -231,7 +359,8 @@ func checkKafka(cfg *KafkaConfig) error {
 	if len(cfg.Servers) == 0 {
 		return fmt.Errorf("no Kafka servers provided")
 	}
-	conn, err := kafka.Dial("tcp", cfg.Servers[0])
+	dialer := &kafka.Dialer{DialFunc: egressDialer(egressKafka)}
+	conn, err := dialer.Dial("tcp", cfg.Servers[0])
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Connection modes for outbound HTTP calls.
+const (
+	// connectionModeReuse keeps connections alive in the shared pool.
+	connectionModeReuse = "reuse"
+	// connectionModeChurn opens a new connection for every request.
+	connectionModeChurn = "churn"
+)
+
+// HTTPClientConfig holds configuration for the shared outbound HTTP transport.
+type HTTPClientConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	InsecureSkipVerify  bool
+	HTTP2Enabled        bool
+}
+
+// GetHTTPClientConfig retrieves outbound HTTP client configuration using individual variables:
+// HTTP_CLIENT_MAX_IDLE_CONNS, HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST, HTTP_CLIENT_MAX_CONNS_PER_HOST,
+// HTTP_CLIENT_IDLE_CONN_TIMEOUT_SECOND, HTTP_CLIENT_TLS_INSECURE_SKIP_VERIFY, HTTP_CLIENT_HTTP2_ENABLED.
+func GetHTTPClientConfig() *HTTPClientConfig {
+	return &HTTPClientConfig{
+		MaxIdleConns:        viper.GetInt("HTTP_CLIENT_MAX_IDLE_CONNS"),
+		MaxIdleConnsPerHost: viper.GetInt("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST"),
+		MaxConnsPerHost:     viper.GetInt("HTTP_CLIENT_MAX_CONNS_PER_HOST"),
+		IdleConnTimeout:     time.Duration(viper.GetInt("HTTP_CLIENT_IDLE_CONN_TIMEOUT_SECOND")) * time.Second,
+		InsecureSkipVerify:  viper.GetBool("HTTP_CLIENT_TLS_INSECURE_SKIP_VERIFY"),
+		HTTP2Enabled:        viper.GetBool("HTTP_CLIENT_HTTP2_ENABLED"),
+	}
+}
+
+var (
+	sharedTransport     *http.Transport
+	sharedTransportOnce sync.Once
+	// localTransport carries the calls of this instance to itself, outside egress faults and
+	// proxies, so that faults injected for experiments cannot break its own orchestration.
+	localTransport = &http.Transport{MaxIdleConnsPerHost: 16, IdleConnTimeout: 90 * time.Second}
+	// proxyTransports caches one pooled transport per proxy_url so that
+	// repeated relay calls through the same proxy reuse connections.
+	proxyTransportsMutex sync.Mutex
+	proxyTransports      = map[string]*http.Transport{}
+	// proxyTransportOrder lists the keys of proxyTransports, oldest first.
+	proxyTransportOrder []string
+)
+
+// maxProxyTransports bounds proxyTransports; the oldest transport is closed and dropped
+// when another proxy_url is used.
+const maxProxyTransports = 16
+
+// getSharedTransport returns the process-wide outbound transport, building it from
+// GetHTTPClientConfig on first use so that connections are pooled across handlers.
+func getSharedTransport() *http.Transport {
+	sharedTransportOnce.Do(func() {
+		cfg := GetHTTPClientConfig()
+		sharedTransport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           egressDialer(egressHTTP),
+			MaxIdleConns:          cfg.MaxIdleConns,
+			MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       cfg.MaxConnsPerHost,
+			IdleConnTimeout:       cfg.IdleConnTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			ForceAttemptHTTP2:     cfg.HTTP2Enabled,
+		}
+		if !cfg.HTTP2Enabled {
+			// A non-nil, empty map disables the automatic HTTP/2 upgrade.
+			sharedTransport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	})
+	return sharedTransport
+}
+
+// newOutboundClient returns an HTTP client for outbound calls using the given connection mode.
+// In reuse mode (the default) the shared transport is used; in churn mode keep-alives are
+// disabled so every request pays for a new TCP (and TLS) handshake.
+// proxyURL overrides the HTTP(S)_PROXY environment variables for this client; "direct"
+// bypasses any proxy.
+func newOutboundClient(timeout time.Duration, connectionMode, proxyURL string) (*http.Client, error) {
+	if connectionMode != "" && connectionMode != connectionModeReuse && connectionMode != connectionModeChurn {
+		return nil, fmt.Errorf("connection_mode must be %q or %q", connectionModeReuse, connectionModeChurn)
+	}
+	transport := getSharedTransport()
+	if proxyURL != "" {
+		t, err := getProxyTransport(transport, proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+	if connectionMode == connectionModeChurn {
+		transport = transport.Clone()
+		transport.DisableKeepAlives = true
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// parseProxyURL parses a proxy_url other than "direct".
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy_url: %s", proxyURL)
+	}
+	return u, nil
+}
+
+// checkProxyAllowed returns an error unless proxyURL is empty, "direct" or a proxy whose host
+// is in TARGET_ALLOWLIST, so requests cannot be sent through arbitrary proxies.
+func checkProxyAllowed(proxyURL string) error {
+	if proxyURL == "" || proxyURL == "direct" {
+		return nil
+	}
+	u, err := parseProxyURL(proxyURL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return checkTargetHostAllowed(net.JoinHostPort(u.Hostname(), port))
+}
+
+// getProxyTransport returns the cached transport for proxyURL, cloning base for it on first use.
+func getProxyTransport(base *http.Transport, proxyURL string) (*http.Transport, error) {
+	proxyTransportsMutex.Lock()
+	defer proxyTransportsMutex.Unlock()
+	if t, ok := proxyTransports[proxyURL]; ok {
+		return t, nil
+	}
+	t := base.Clone()
+	if proxyURL == "direct" {
+		t.Proxy = nil
+	} else {
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if len(proxyTransportOrder) >= maxProxyTransports {
+		oldest := proxyTransportOrder[0]
+		proxyTransportOrder = proxyTransportOrder[1:]
+		proxyTransports[oldest].CloseIdleConnections()
+		delete(proxyTransports, oldest)
+	}
+	proxyTransports[proxyURL] = t
+	proxyTransportOrder = append(proxyTransportOrder, proxyURL)
+	return t, nil
+}
+
+// localURL returns the URL of path on this instance.
+func localURL(path string) string {
+	return fmt.Sprintf("http://127.0.0.1:%d%s", listenPort, path)
+}
+
+// isLocalURL reports whether rawURL was returned by localURL.
+func isLocalURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, localURL("/"))
+}
+
+// newLocalClient returns an HTTP client for calls of this instance to itself, which are not
+// subject to egress faults.
+func newLocalClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: localTransport}
+}
+
+// isProxyError reports whether err happened while connecting to a proxy rather than the target.
+func isProxyError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "proxyconnect"
+}
+
+// discardResponse drains and closes a response body so its connection can be reused.
+func discardResponse(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
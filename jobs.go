@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxJobs bounds the jobs kept in memory; the oldest finished ones are dropped first, and
+// requests that would start more running jobs are rejected.
+const maxJobs = 100
+
+// maxJobRequestBytes bounds the request body kept with a job.
+const maxJobRequestBytes = 4096
+
+// Job states.
+const (
+	jobPending    = "pending" // Tracked, but the work has not started.
+	jobRunning    = "running"
+	jobCancelling = "cancelling" // Aborted, the work has not noticed yet.
+	jobCompleted  = "completed"
+	jobCancelled  = "cancelled"
+	jobFailed     = "failed" // The work panicked.
+)
+
+// stressJob is one stress request tracked under an id, together with the profiles
+// captured and the steady-state checks evaluated while it ran.
+type stressJob struct {
+	ID        string
+	Path      string
+	Method    string
+	Namespace string
+	Request   string // Body of the request, truncated to maxJobRequestBytes.
+	StartedAt time.Time
+	ctx       context.Context // Cancelled when the job is aborted or dropped.
+	cancel    context.CancelFunc
+	abortOnce sync.Once
+
+	mu          sync.Mutex
+	duration    time.Duration // Planned duration of the work, 0 if unknown.
+	status      string
+	cause       string // Why the job was aborted.
+	finishedAt  time.Time
+	profiles    []*jobProfile
+	steadyState *steadyStateCheck
+	report      any // Result of the work, kept for async runs.
+	abortHooks  []func(cause string)
+	finishHooks []func(status string)
+}
+
+// Global variables for the job registry.
+var (
+	jobsMutex sync.Mutex
+	jobs      = map[string]*stressJob{}
+	nextJobID uint64
+)
+
+// newJobID returns a new job id. The counter keeps ids unique when two jobs start within
+// the same clock tick.
+func newJobID() string {
+	return fmt.Sprintf("%x-%d", time.Now().UnixNano(), atomic.AddUint64(&nextJobID, 1))
+}
+
+// registerJob starts tracking a job for the request in c and stores its id in the Gin
+// context, so ResponseJSON returns it as "job_id". A request has at most one job.
+func registerJob(c *gin.Context) *stressJob {
+	if id, ok := c.Get("job_id"); ok {
+		if job := getJob(id.(string)); job != nil {
+			return job
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	raw, _ := c.Get("rawBody")
+	request, _ := raw.(string)
+	if len(request) > maxJobRequestBytes {
+		request = request[:maxJobRequestBytes]
+	}
+	job := &stressJob{
+		ID:        newJobID(),
+		Path:      c.FullPath(),
+		Method:    c.Request.Method,
+		Namespace: getNamespace(c),
+		Request:   request,
+		StartedAt: time.Now(),
+		ctx:       ctx,
+		cancel:    cancel,
+		status:    jobPending,
+	}
+	jobsMutex.Lock()
+	jobs[job.ID] = job
+	if len(jobs) > maxJobs {
+		// Drop the oldest finished job. Jobs still running are never dropped, so they can
+		// still be cancelled; JobLimitMiddleware stops new ones when all of them run.
+		var oldest *stressJob
+		for _, j := range jobs {
+			if j.finished() && (oldest == nil || j.StartedAt.Before(oldest.StartedAt)) {
+				oldest = j
+			}
+		}
+		if oldest != nil {
+			oldest.cancel()
+			delete(jobs, oldest.ID)
+			publishEvent(eventJobEvicted, gin.H{"job_id": oldest.ID, "path": oldest.Path})
+		}
+	}
+	jobsMutex.Unlock()
+	publishEvent(eventJobStarted, gin.H{"job_id": job.ID, "path": job.Path, "namespace": getNamespace(c)})
+	c.Set("job_id", job.ID)
+	return job
+}
+
+// startJob tracks the stress request in c as a job whose work lasts about duration (0 if
+// unknown), for its progress. Its response carries the job id.
+func startJob(c *gin.Context, duration time.Duration) *stressJob {
+	job := registerJob(c)
+	job.mu.Lock()
+	job.duration = duration
+	if job.status == jobPending {
+		job.status = jobRunning
+	}
+	job.mu.Unlock()
+	return job
+}
+
+// plannedDuration returns the duration of the work given to startJob, 0 if unknown.
+func (j *stressJob) plannedDuration() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.duration
+}
+
+// run runs work with the job's context, which is cancelled when the job is aborted, and
+// records when it ends. Call it in a goroutine for async requests. A panic of the work fails
+// the job and aborts it, so its rollback runs, instead of crashing the process.
+func (j *stressJob) run(work func(ctx context.Context)) {
+	defer func() {
+		r := recover()
+		switch {
+		case r != nil:
+			j.finish(jobFailed)
+		case j.ctx.Err() != nil:
+			j.finish(jobCancelled)
+		default:
+			j.finish(jobCompleted)
+		}
+		if r != nil {
+			logError("Job panicked", zap.String("job_id", j.ID), zap.String("path", j.Path), zap.Any("panic", r))
+			j.abort(fmt.Sprintf("panic: %v", r))
+		}
+	}()
+	work(j.ctx)
+}
+
+// finish records that the work of the job ended with status and runs its finish hooks.
+func (j *stressJob) finish(status string) {
+	j.mu.Lock()
+	j.status, j.finishedAt = status, time.Now()
+	hooks := j.finishHooks
+	j.finishHooks = nil
+	j.mu.Unlock()
+	for _, hook := range hooks {
+		hook(status)
+	}
+}
+
+// onFinish registers hook to run with the final status when the work of the job ends, or
+// runs it right away if it has ended already.
+func (j *stressJob) onFinish(hook func(status string)) {
+	j.mu.Lock()
+	done := j.isFinished()
+	if !done {
+		j.finishHooks = append(j.finishHooks, hook)
+	}
+	status := j.status
+	j.mu.Unlock()
+	if done {
+		hook(status)
+	}
+}
+
+// isFinished is finished with j.mu held.
+func (j *stressJob) isFinished() bool {
+	return j.status == jobCompleted || j.status == jobCancelled || j.status == jobFailed
+}
+
+// finished reports whether the work of the job has ended.
+func (j *stressJob) finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.isFinished()
+}
+
+// sleepContext waits for d or until ctx is done, and reports whether the full d elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// setReport keeps the result of the work, returned by GET /jobs/:id.
+func (j *stressJob) setReport(report any) {
+	j.mu.Lock()
+	j.report = report
+	j.mu.Unlock()
+}
+
+// toMap returns the state and progress of the job at now.
+func (j *stressJob) toMap(now time.Time) gin.H {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	end := now
+	if !j.finishedAt.IsZero() {
+		end = j.finishedAt
+	}
+	elapsed := end.Sub(j.StartedAt)
+	result := gin.H{
+		"job_id":         j.ID,
+		"method":         j.Method,
+		"path":           j.Path,
+		"namespace":      j.Namespace,
+		"status":         j.status,
+		"started_at":     j.StartedAt.UTC().Format(time.RFC3339Nano),
+		"elapsed_second": elapsed.Seconds(),
+	}
+	if j.duration > 0 {
+		progress := elapsed.Seconds() / j.duration.Seconds()
+		if progress > 1 || j.status == jobCompleted {
+			progress = 1
+		}
+		result["duration_second"] = j.duration.Seconds()
+		result["progress"] = progress
+	}
+	if !j.finishedAt.IsZero() {
+		result["finished_at"] = j.finishedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if j.cause != "" {
+		result["cause"] = j.cause
+	}
+	return result
+}
+
+// runningJobs returns the number of tracked jobs that have not finished.
+func runningJobs() int {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	n := 0
+	for _, job := range jobs {
+		if !job.finished() {
+			n++
+		}
+	}
+	return n
+}
+
+// JobLimitMiddleware rejects fault and load requests with 429 while maxJobs jobs are
+// running, since none of them can be dropped to track a new one.
+func JobLimitMiddleware(c *gin.Context) {
+	if isChaosRoute(c) && runningJobs() >= maxJobs {
+		ErrorJSON(c, http.StatusTooManyRequests, "TOO_MANY_JOBS", fmt.Sprintf("%d jobs are running, cancel some or wait for them to finish", maxJobs))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// JobMiddleware completes the jobs of requests whose handler tracks no work of its own (a job
+// registered for notifications, say), when the request ends.
+func JobMiddleware(c *gin.Context) {
+	c.Next()
+	id, ok := c.Get("job_id")
+	if !ok {
+		return
+	}
+	if job := getJob(id.(string)); job != nil {
+		job.mu.Lock()
+		pending := job.status == jobPending
+		job.mu.Unlock()
+		if pending {
+			job.finish(jobCompleted)
+		}
+	}
+}
+
+// onAbort registers hook to run when the job is aborted.
+func (j *stressJob) onAbort(hook func(cause string)) {
+	j.mu.Lock()
+	j.abortHooks = append(j.abortHooks, hook)
+	j.mu.Unlock()
+}
+
+// abort cancels the job and runs its abort hooks, once.
+func (j *stressJob) abort(cause string) {
+	j.abortOnce.Do(func() {
+		j.mu.Lock()
+		j.cause = cause
+		pending := j.status == jobPending
+		if j.status == jobRunning {
+			j.status = jobCancelling
+		}
+		j.mu.Unlock()
+		if pending {
+			j.finish(jobCancelled)
+		}
+		j.cancel()
+		publishEvent(eventJobAborted, gin.H{"job_id": j.ID, "path": j.Path, "cause": cause})
+		j.mu.Lock()
+		hooks := j.abortHooks
+		j.mu.Unlock()
+		for _, hook := range hooks {
+			hook(cause)
+		}
+	})
+}
+
+// discardRejectedJob aborts and forgets the job of a request that was rejected with an
+// error status.
+func discardRejectedJob(c *gin.Context, job *stressJob) {
+	if c.Writer.Status() < 400 {
+		return
+	}
+	job.abort(fmt.Sprintf("request failed with status %d", c.Writer.Status()))
+	jobsMutex.Lock()
+	delete(jobs, job.ID)
+	jobsMutex.Unlock()
+}
+
+// getJob returns the job with id, or nil.
+func getJob(id string) *stressJob {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return jobs[id]
+}
+
+// getRequestJob returns the job with the id in the path, if the namespace of the request
+// may see it, or responds 404 and returns nil.
+func getRequestJob(c *gin.Context) *stressJob {
+	job := getJob(c.Param("id"))
+	if job == nil || (getNamespace(c) != "" && job.Namespace != getNamespace(c)) {
+		ErrorJSON(c, http.StatusNotFound, "JOB_NOT_FOUND", "no job with id "+c.Param("id"))
+		return nil
+	}
+	return job
+}
+
+// JobsHandler handles GET /jobs?status=running.
+// It lists the tracked jobs, newest first, optionally only those with a status. A request
+// with a namespace only sees the jobs of that namespace.
+func JobsHandler(c *gin.Context) {
+	ns := getNamespace(c)
+	status := c.Query("status")
+	jobsMutex.Lock()
+	list := make([]*stressJob, 0, len(jobs))
+	for _, job := range jobs {
+		if ns == "" || job.Namespace == ns {
+			list = append(list, job)
+		}
+	}
+	jobsMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+
+	now := time.Now()
+	result := make([]gin.H, 0, len(list))
+	for _, job := range list {
+		m := job.toMap(now)
+		if status == "" || m["status"] == status {
+			result = append(result, m)
+		}
+	}
+	ResponseNegotiated(c, http.StatusOK, gin.H{"count": len(result), "jobs": result})
+}
+
+// JobHandler handles GET /jobs/:id.
+// It returns the status and progress of a job, with the request that started it and, once
+// the work ends, its report if it produces one.
+func JobHandler(c *gin.Context) {
+	job := getRequestJob(c)
+	if job == nil {
+		return
+	}
+	result := job.toMap(time.Now())
+	result["request"] = job.Request
+	job.mu.Lock()
+	if job.report != nil {
+		result["report"] = job.report
+	}
+	job.mu.Unlock()
+	ResponseNegotiated(c, http.StatusOK, result)
+}
+
+// JobCancelHandler handles DELETE /jobs/:id.
+// It cancels a job: its work stops at the next check of its context, and the faults it
+// holds are ended early. The abort actions of the job (rollback, notifications) run as well.
+func JobCancelHandler(c *gin.Context) {
+	job := getRequestJob(c)
+	if job == nil {
+		return
+	}
+	if job.finished() {
+		ErrorJSON(c, http.StatusConflict, "JOB_FINISHED", "job "+job.ID+" has already finished")
+		return
+	}
+	job.abort("cancelled by request")
+	logInfo("Job cancelled", zap.String("job_id", job.ID), zap.String("path", job.Path))
+	ResponseNegotiated(c, http.StatusOK, job.toMap(time.Now()))
+}
+
+// JobProfilesHandler handles GET /jobs/:id/profiles.
+// It lists the profiles captured for a job started with pprof: true.
+func JobProfilesHandler(c *gin.Context) {
+	job := getRequestJob(c)
+	if job == nil {
+		return
+	}
+	job.mu.Lock()
+	profiles := make([]gin.H, 0, len(job.profiles))
+	for _, p := range job.profiles {
+		profiles = append(profiles, p.toMap(job.ID))
+	}
+	job.mu.Unlock()
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i]["captured_at"].(string) < profiles[j]["captured_at"].(string)
+	})
+	ResponseNegotiated(c, http.StatusOK, gin.H{
+		"job_id":     job.ID,
+		"path":       job.Path,
+		"started_at": job.StartedAt.UTC().Format(time.RFC3339Nano),
+		"profiles":   profiles,
+	})
+}
+
+// JobProfileDownloadHandler handles GET /jobs/:id/profiles/:name.
+// It returns one profile in the pprof format, for `go tool pprof`.
+func JobProfileDownloadHandler(c *gin.Context) {
+	job := getRequestJob(c)
+	if job == nil {
+		return
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	for _, p := range job.profiles {
+		if p.name() == c.Param("name") && p.data != nil {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s", job.ID, p.name()))
+			c.Data(http.StatusOK, "application/octet-stream", p.data)
+			return
+		}
+	}
+	ErrorJSON(c, http.StatusNotFound, "PROFILE_NOT_FOUND", "no profile "+c.Param("name"))
+}
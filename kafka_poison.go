@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+)
+
+// poisonHeader names the kind of a poison message, so consumers under test and DLQ checks can
+// tell injected poison messages from real failures.
+const poisonHeader = "biggie-poison"
+
+// Kinds of poison messages.
+const (
+	poisonMalformedJSON   = "malformed_json"
+	poisonSchemaViolation = "schema_violation"
+	poisonEmpty           = "empty"
+	poisonInvalidUTF8     = "invalid_utf8"
+)
+
+var poisonKinds = []string{poisonMalformedJSON, poisonSchemaViolation, poisonEmpty, poisonInvalidUTF8}
+
+// poisonGenerator replaces a share of the produced messages with poison messages.
+type poisonGenerator struct {
+	percent float64
+	kinds   []string
+	counts  map[string]*int64
+}
+
+// newPoisonGenerator returns a generator poisoning percent of the messages with the given
+// kinds (default all), or nil when percent is 0.
+func newPoisonGenerator(percent DuckFloat, kinds []string) (*poisonGenerator, error) {
+	if percent == 0 {
+		return nil, nil
+	}
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("poison_percent must be between 0 and 100")
+	}
+	if len(kinds) == 0 {
+		kinds = poisonKinds
+	}
+	g := &poisonGenerator{percent: float64(percent), kinds: kinds, counts: map[string]*int64{}}
+	for _, kind := range kinds {
+		known := false
+		for _, k := range poisonKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown poison kind %q, use %v", kind, poisonKinds)
+		}
+		g.counts[kind] = new(int64)
+	}
+	return g, nil
+}
+
+// apply turns msg into a poison message with a probability of percent, keeping its key so
+// that it lands on the same partition as the message it replaces. It reports whether msg
+// was poisoned.
+func (g *poisonGenerator) apply(msg *kafka.Message) bool {
+	if g == nil || rand.Float64()*100 >= g.percent {
+		return false
+	}
+	kind := g.kinds[rand.Intn(len(g.kinds))]
+	msg.Value = poisonValue(kind, msg.Value)
+	msg.Headers = append(msg.Headers, kafka.Header{Key: poisonHeader, Value: []byte(kind)})
+	atomic.AddInt64(g.counts[kind], 1)
+	return true
+}
+
+// poisonValue returns a poison message of kind derived from the valid value.
+func poisonValue(kind string, valid []byte) []byte {
+	switch kind {
+	case poisonMalformedJSON:
+		// JSON cut off in the middle, like a truncated write.
+		if len(valid) > 0 && valid[0] == '{' {
+			return valid[:len(valid)/2]
+		}
+		return append([]byte(`{"message":"`), valid...)
+	case poisonSchemaViolation:
+		// Valid JSON of the wrong shape: wrong types, a missing message and an unexpected field.
+		return []byte(`{"run_id":12345,"producer":"zero","seq":"not-a-number","produced_at":"yesterday","message":null,"unexpected":[1,2,3]}`)
+	case poisonInvalidUTF8:
+		value := []byte{0xff, 0xfe, 0xc3, 0x28, 0x00}
+		for i := 0; i < 59; i++ {
+			value = append(value, byte(rand.Intn(256)))
+		}
+		return value
+	default:
+		return []byte{}
+	}
+}
+
+// toMap reports the poison messages produced per kind.
+func (g *poisonGenerator) toMap() gin.H {
+	if g == nil {
+		return gin.H{"percent": 0}
+	}
+	produced := gin.H{}
+	for kind, count := range g.counts {
+		produced[kind] = atomic.LoadInt64(count)
+	}
+	return gin.H{"percent": g.percent, "produced": produced}
+}
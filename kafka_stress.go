@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	lorem "github.com/drhodes/golorem"
@@ -14,21 +16,45 @@ import (
 
 // KafkaHeavyPayload defines the payload for the heavy Kafka produce using a single producer.
 type KafkaHeavyPayload struct {
-	Messages           string  `json:"messages"` // If empty, a lorem ipsum message is generated automatically.
-	MaintainSecond     DuckInt `json:"maintain_second"`
-	Async              bool    `json:"async"`
-	ProducePerInterval DuckInt `json:"produce_per_interval"`
-	IntervalSecond     DuckInt `json:"interval_second"`
+	Messages           string           `json:"messages"` // If empty, a lorem ipsum message is generated automatically.
+	MaintainSecond     DuckInt          `json:"maintain_second"`
+	Async              bool             `json:"async"`
+	ProducePerInterval DuckInt          `json:"produce_per_interval"`
+	IntervalSecond     DuckInt          `json:"interval_second"`
+	AsyncProduce       bool             `json:"async_produce"`     // Produce without waiting for each batch to be acknowledged.
+	MaxInFlight        DuckInt          `json:"max_in_flight"`     // Unacknowledged batches before producing blocks, default 10.
+	BatchSize          DuckInt          `json:"batch_size"`        // Messages per batch, default 100.
+	KeyDistribution    string           `json:"key_distribution"`  // "uniform", "zipfian" or "hot_key" over key_count keys, partitioned by key hash.
+	KeyCount           DuckInt          `json:"key_count"`         // Distinct keys, default 1000.
+	ZipfS              DuckFloat        `json:"zipf_s"`            // Zipfian skew (> 1), default 1.1.
+	HotKeyPercent      DuckInt          `json:"hot_key_percent"`   // Share of messages with the hot key, default 80.
+	Markers            bool             `json:"markers"`           // Embed run id, sequence number and produce time for /kafka/verify.
+	PoisonPercent      DuckFloat        `json:"poison_percent"`    // Share of messages replaced by poison messages.
+	PoisonKinds        []string         `json:"poison_kinds"`      // Default all: malformed_json, schema_violation, empty, invalid_utf8.
+	MessageSize        *MessageSizeSpec `json:"message_size"`      // Size distribution of generated messages, replacing messages.
+	CompressionRatio   DuckFloat        `json:"compression_ratio"` // Target compressibility: 1 (default) random, higher is more repetitive.
 }
 
 // KafkaMultiHeavyPayload defines the payload for heavy Kafka produce using multiple producers.
 type KafkaMultiHeavyPayload struct {
-	Messages           string  `json:"messages"` // If empty, a lorem ipsum message is generated automatically.
-	MaintainSecond     DuckInt `json:"maintain_second"`
-	Async              bool    `json:"async"`
-	ConnectionCounts   DuckInt `json:"connection_counts"`
-	ProducePerInterval DuckInt `json:"produce_per_interval"`
-	IntervalSecond     DuckInt `json:"interval_second"`
+	Messages           string           `json:"messages"` // If empty, a lorem ipsum message is generated automatically.
+	MaintainSecond     DuckInt          `json:"maintain_second"`
+	Async              bool             `json:"async"`
+	ConnectionCounts   DuckInt          `json:"connection_counts"`
+	ProducePerInterval DuckInt          `json:"produce_per_interval"`
+	IntervalSecond     DuckInt          `json:"interval_second"`
+	AsyncProduce       bool             `json:"async_produce"` // See KafkaHeavyPayload.
+	MaxInFlight        DuckInt          `json:"max_in_flight"` // Per producer.
+	BatchSize          DuckInt          `json:"batch_size"`
+	KeyDistribution    string           `json:"key_distribution"` // See KafkaHeavyPayload.
+	KeyCount           DuckInt          `json:"key_count"`
+	ZipfS              DuckFloat        `json:"zipf_s"`
+	HotKeyPercent      DuckInt          `json:"hot_key_percent"`
+	Markers            bool             `json:"markers"` // Sequence numbers are counted per producer.
+	PoisonPercent      DuckFloat        `json:"poison_percent"`
+	PoisonKinds        []string         `json:"poison_kinds"`
+	MessageSize        *MessageSizeSpec `json:"message_size"`
+	CompressionRatio   DuckFloat        `json:"compression_ratio"`
 }
 
 // KafkaConnectionPayload defines the payload for simulating heavy Kafka connections.
@@ -63,7 +89,118 @@ func getKafkaWriter() (*kafka.Writer, error) {
 			},
 		}
 	}
-	return kafka.NewWriter(writerConfig), nil
+	writer := kafka.NewWriter(writerConfig)
+	// NewWriter builds its own transport from the Dialer; route its dials through
+	// egressDialer so outbound faults apply to Kafka too.
+	if transport, ok := writer.Transport.(*kafka.Transport); ok {
+		transport.Dial = egressDialer(egressKafka)
+	}
+	return writer, nil
+}
+
+// kafkaProduceStats counts the delivery reports of a produce stress.
+type kafkaProduceStats struct {
+	produced       int64
+	failed         int64
+	batches        int64
+	backpressureNs int64 // Time spent waiting for in-flight batches to be acknowledged.
+}
+
+func (s *kafkaProduceStats) toMap() gin.H {
+	return gin.H{
+		"produced":        atomic.LoadInt64(&s.produced),
+		"failed":          atomic.LoadInt64(&s.failed),
+		"batches":         atomic.LoadInt64(&s.batches),
+		"backpressure_ms": atomic.LoadInt64(&s.backpressureNs) / int64(time.Millisecond),
+	}
+}
+
+// kafkaProducer wraps a writer in sync or async (batched, backpressured) mode and records
+// delivery reports in stats.
+type kafkaProducer struct {
+	writer   *kafka.Writer
+	stats    *kafkaProduceStats
+	async    bool
+	inFlight chan struct{} // One slot per unacknowledged message in async mode.
+}
+
+// newKafkaProducer configures writer for the given mode. In async mode WriteMessages only
+// enqueues; delivery reports arrive through the writer's Completion callback, and producing
+// blocks once maxInFlight batches of batchSize messages are unacknowledged.
+func newKafkaProducer(writer *kafka.Writer, stats *kafkaProduceStats, async bool, maxInFlight, batchSize int) *kafkaProducer {
+	p := &kafkaProducer{writer: writer, stats: stats, async: async}
+	if !async {
+		return p
+	}
+	p.inFlight = make(chan struct{}, maxInFlight*batchSize)
+	writer.Async = true
+	writer.BatchSize = batchSize
+	writer.BatchTimeout = 10 * time.Millisecond
+	writer.Completion = func(messages []kafka.Message, err error) {
+		atomic.AddInt64(&stats.batches, 1)
+		if err != nil {
+			atomic.AddInt64(&stats.failed, int64(len(messages)))
+			logWarn("Kafka async produce batch failed", zap.Int("messages", len(messages)), zap.Error(err))
+		} else {
+			atomic.AddInt64(&stats.produced, int64(len(messages)))
+		}
+		for range messages {
+			<-p.inFlight
+		}
+	}
+	return p
+}
+
+// produce writes messages, recording the result of synchronous writes directly.
+func (p *kafkaProducer) produce(ctx context.Context, messages []kafka.Message) error {
+	if !p.async {
+		err := p.writer.WriteMessages(ctx, messages...)
+		if err != nil {
+			atomic.AddInt64(&p.stats.failed, int64(len(messages)))
+		} else {
+			atomic.AddInt64(&p.stats.produced, int64(len(messages)))
+		}
+		atomic.AddInt64(&p.stats.batches, 1)
+		return err
+	}
+	// Enqueue at most one batch at a time so a large produce_per_interval cannot wait for
+	// slots that only its own, not yet enqueued, messages would free.
+	batchSize := p.writer.BatchSize
+	for len(messages) > 0 {
+		chunk := messages[:min(batchSize, len(messages))]
+		messages = messages[len(chunk):]
+		start := time.Now()
+		for range chunk {
+			p.inFlight <- struct{}{}
+		}
+		atomic.AddInt64(&p.stats.backpressureNs, int64(time.Since(start)))
+		if err := p.writer.WriteMessages(ctx, chunk...); err != nil {
+			// Rejected before being enqueued, so no delivery report will follow.
+			atomic.AddInt64(&p.stats.failed, int64(len(chunk)+len(messages)))
+			for range chunk {
+				<-p.inFlight
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// close flushes pending batches and waits for their delivery reports.
+func (p *kafkaProducer) close() {
+	p.writer.Close()
+}
+
+// kafkaProduceOptions returns max_in_flight and batch_size with their defaults applied.
+func kafkaProduceOptions(maxInFlight, batchSize DuckInt) (int, int) {
+	inFlight, size := int(maxInFlight), int(batchSize)
+	if inFlight <= 0 {
+		inFlight = 10
+	}
+	if size <= 0 {
+		size = 100
+	}
+	return inFlight, size
 }
 
 // generateLoremIpsum uses the golorem library to generate a lorem ipsum text.
@@ -77,7 +214,7 @@ func generateLoremIpsum() string {
 // It uses a single producer to send messages at a controlled rate for maintain_second seconds.
 func KafkaHeavyHandler(c *gin.Context) {
 	var payload KafkaHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -90,48 +227,110 @@ func KafkaHeavyHandler(c *gin.Context) {
 		messageContent = generateLoremIpsum()
 	}
 
+	maxInFlight, batchSize := kafkaProduceOptions(payload.MaxInFlight, payload.BatchSize)
+	keys, err := newKeyPicker(payload.KeyDistribution, payload.KeyCount, payload.ZipfS, payload.HotKeyPercent)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.Markers && keys != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "markers cannot be combined with key_distribution")
+		return
+	}
+	runID := ""
+	if payload.Markers {
+		runID = newKafkaRunID()
+	}
+	poison, err := newPoisonGenerator(payload.PoisonPercent, payload.PoisonKinds)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	shaper, err := newMessageShaper(payload.MessageSize, payload.CompressionRatio)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+
 	writer, err := getKafkaWriter()
 	if err != nil {
 		ErrorJSON(c, 500, "KAFKA_ERROR", err.Error())
 		return
 	}
+	if keys != nil || payload.Markers {
+		writer.Balancer = &kafka.Hash{}
+	}
+	var stats kafkaProduceStats
+	producer := newKafkaProducer(writer, &stats, payload.AsyncProduce, maxInFlight, batchSize)
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		var seq int64
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			messages := make([]kafka.Message, 0, producePerInterval)
 			for i := 0; i < producePerInterval; i++ {
-				messages = append(messages, kafka.Message{
-					Key:   []byte(fmt.Sprintf("key-%d", i)),
-					Value: []byte(messageContent),
-				})
+				content := messageContent
+				if shaper != nil {
+					content = shaper.next()
+				}
+				var msg kafka.Message
+				if payload.Markers {
+					msg = markedKafkaMessage(runID, 0, seq, content)
+				} else {
+					key := fmt.Sprintf("key-%d", i)
+					if keys != nil {
+						key = keys.key("key-")
+					}
+					msg = kafka.Message{Key: []byte(key), Value: []byte(content)}
+				}
+				// Poison messages take no sequence number, so /kafka/verify counts them as foreign.
+				if !poison.apply(&msg) {
+					seq++
+				}
+				messages = append(messages, msg)
 			}
-			if err := writer.WriteMessages(c, messages...); err != nil {
-				fmt.Println("Kafka heavy produce failed", zap.Error(err))
+			if err := producer.produce(c, messages); err != nil {
+				logWarn("Kafka heavy produce failed", zap.Error(err))
 			}
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
-		writer.Close()
-		fmt.Println("Kafka heavy produce (single producer) completed", zap.Int("duration_sec", maintainSec))
+		producer.close()
+		logInfo("Kafka heavy produce (single producer) completed",
+			zap.Int("duration_sec", maintainSec),
+			zap.Int64("produced", atomic.LoadInt64(&stats.produced)),
+			zap.Int64("failed", atomic.LoadInt64(&stats.failed)))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":              "Kafka heavy produce started",
 			"maintain_second":      maintainSec,
 			"produce_per_interval": producePerInterval,
 			"interval_second":      intervalSec,
+			"async_produce":        payload.AsyncProduce,
+			"max_in_flight":        maxInFlight,
+			"batch_size":           batchSize,
 			"messages":             messageContent,
+			"run_id":               runID,
 		})
 	} else {
-		stressFunc()
+		job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":              "Kafka heavy produce completed",
 			"maintain_second":      maintainSec,
 			"produce_per_interval": producePerInterval,
 			"interval_second":      intervalSec,
+			"async_produce":        payload.AsyncProduce,
+			"max_in_flight":        maxInFlight,
+			"batch_size":           batchSize,
 			"messages":             messageContent,
+			"run_id":               runID,
+			"keys":                 keys.toMap(),
+			"poison":               poison.toMap(),
+			"message_size":         shaper.toMap(),
+			"results":              stats.toMap(),
 		})
 	}
 }
@@ -141,7 +340,7 @@ func KafkaHeavyHandler(c *gin.Context) {
 // with each producer sending messages at the given rate concurrently.
 func KafkaMultiHeavyHandler(c *gin.Context) {
 	var payload KafkaMultiHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -155,7 +354,34 @@ func KafkaMultiHeavyHandler(c *gin.Context) {
 		messageContent = generateLoremIpsum()
 	}
 
-	stressFunc := func() {
+	maxInFlight, batchSize := kafkaProduceOptions(payload.MaxInFlight, payload.BatchSize)
+	keys, err := newKeyPicker(payload.KeyDistribution, payload.KeyCount, payload.ZipfS, payload.HotKeyPercent)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.Markers && keys != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "markers cannot be combined with key_distribution")
+		return
+	}
+	runID := ""
+	if payload.Markers {
+		runID = newKafkaRunID()
+	}
+	poison, err := newPoisonGenerator(payload.PoisonPercent, payload.PoisonKinds)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	shaper, err := newMessageShaper(payload.MessageSize, payload.CompressionRatio)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+
+	var stats kafkaProduceStats
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var wg sync.WaitGroup
 		for i := 0; i < connectionCounts; i++ {
 			wg.Add(1)
@@ -163,49 +389,84 @@ func KafkaMultiHeavyHandler(c *gin.Context) {
 				defer wg.Done()
 				writer, err := getKafkaWriter()
 				if err != nil {
-					fmt.Println("Kafka multi heavy writer creation failed", zap.Int("conn", connNum), zap.Error(err))
+					logWarn("Kafka multi heavy writer creation failed", zap.Int("conn", connNum), zap.Error(err))
 					return
 				}
+				if keys != nil || payload.Markers {
+					writer.Balancer = &kafka.Hash{}
+				}
+				producer := newKafkaProducer(writer, &stats, payload.AsyncProduce, maxInFlight, batchSize)
+				var seq int64
 				endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-				for time.Now().Before(endTime) {
+				for time.Now().Before(endTime) && ctx.Err() == nil {
 					messages := make([]kafka.Message, 0, producePerInterval)
 					for j := 0; j < producePerInterval; j++ {
-						messages = append(messages, kafka.Message{
-							Key:   []byte(fmt.Sprintf("conn-%d-key-%d", connNum, j)),
-							Value: []byte(messageContent),
-						})
+						content := messageContent
+						if shaper != nil {
+							content = shaper.next()
+						}
+						var msg kafka.Message
+						if payload.Markers {
+							msg = markedKafkaMessage(runID, connNum, seq, content)
+						} else {
+							key := fmt.Sprintf("conn-%d-key-%d", connNum, j)
+							if keys != nil {
+								// Producers share the keys, so a hot key is hot across all of them.
+								key = keys.key("key-")
+							}
+							msg = kafka.Message{Key: []byte(key), Value: []byte(content)}
+						}
+						if !poison.apply(&msg) {
+							seq++
+						}
+						messages = append(messages, msg)
 					}
-					if err := writer.WriteMessages(c, messages...); err != nil {
-						fmt.Println("Kafka multi heavy produce failed", zap.Int("conn", connNum), zap.Error(err))
+					if err := producer.produce(c, messages); err != nil {
+						logWarn("Kafka multi heavy produce failed", zap.Int("conn", connNum), zap.Error(err))
 					}
-					time.Sleep(time.Duration(intervalSec) * time.Second)
+					sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 				}
-				writer.Close()
+				producer.close()
 			}(i)
 		}
 		wg.Wait()
-		fmt.Println("Kafka multi heavy produce completed", zap.Int("producers", connectionCounts))
+		logInfo("Kafka multi heavy produce completed",
+			zap.Int("producers", connectionCounts),
+			zap.Int64("produced", atomic.LoadInt64(&stats.produced)),
+			zap.Int64("failed", atomic.LoadInt64(&stats.failed)))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":              "Kafka multi heavy produce started",
 			"maintain_second":      maintainSec,
 			"produce_per_interval": producePerInterval,
 			"interval_second":      intervalSec,
 			"connection_counts":    connectionCounts,
+			"async_produce":        payload.AsyncProduce,
+			"max_in_flight":        maxInFlight,
+			"batch_size":           batchSize,
 			"messages":             messageContent,
+			"run_id":               runID,
 		})
 	} else {
-		stressFunc()
+		job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":              "Kafka multi heavy produce completed",
 			"maintain_second":      maintainSec,
 			"produce_per_interval": producePerInterval,
 			"interval_second":      intervalSec,
 			"connection_counts":    connectionCounts,
+			"async_produce":        payload.AsyncProduce,
+			"max_in_flight":        maxInFlight,
+			"batch_size":           batchSize,
 			"messages":             messageContent,
+			"run_id":               runID,
+			"keys":                 keys.toMap(),
+			"poison":               poison.toMap(),
+			"message_size":         shaper.toMap(),
+			"results":              stats.toMap(),
 		})
 	}
 }
@@ -215,7 +476,7 @@ func KafkaMultiHeavyHandler(c *gin.Context) {
 // maintains them open for the specified duration, and then closes them.
 func KafkaConnectionHandler(c *gin.Context) {
 	var payload KafkaConnectionPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -224,7 +485,8 @@ func KafkaConnectionHandler(c *gin.Context) {
 	increasePerInterval := int(payload.IncreasePerInterval)
 	intervalSec := int(payload.IntervalSecond)
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var writers []*kafka.Writer
 		var mu sync.Mutex
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
@@ -239,7 +501,7 @@ func KafkaConnectionHandler(c *gin.Context) {
 				for i := 0; i < increasePerInterval && currentCount < connectionCounts; i++ {
 					writer, err := getKafkaWriter()
 					if err != nil {
-						fmt.Println("Kafka connection stress writer creation failed", zap.Error(err))
+						logWarn("Kafka connection stress writer creation failed", zap.Error(err))
 						continue
 					}
 					mu.Lock()
@@ -254,26 +516,26 @@ func KafkaConnectionHandler(c *gin.Context) {
 					break Loop
 				}
 			default:
-				if time.Now().After(endTime) {
+				if time.Now().After(endTime) || ctx.Err() != nil {
 					break Loop
 				}
-				time.Sleep(100 * time.Millisecond)
+				sleepContext(ctx, 100*time.Millisecond)
 			}
 		}
 		remaining := time.Until(endTime)
 		if remaining > 0 {
-			time.Sleep(remaining)
+			sleepContext(ctx, remaining)
 		}
 		mu.Lock()
 		for _, writer := range writers {
 			writer.Close()
 		}
 		mu.Unlock()
-		fmt.Println("Kafka connection stress completed", zap.Int("producers", currentCount))
+		logInfo("Kafka connection stress completed", zap.Int("producers", currentCount))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":               "Kafka connection stress started",
 			"maintain_second":       maintainSec,
@@ -282,7 +544,7 @@ func KafkaConnectionHandler(c *gin.Context) {
 			"interval_second":       intervalSec,
 		})
 	} else {
-		stressFunc()
+		job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":               "Kafka connection stress completed",
 			"maintain_second":       maintainSec,
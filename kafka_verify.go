@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// kafkaMarker is embedded as JSON in every message of a produce run with markers, so that
+// /kafka/verify can check ordering and delivery and measure the end-to-end latency.
+type kafkaMarker struct {
+	RunID      string    `json:"run_id"`
+	Producer   int       `json:"producer"`
+	Seq        int64     `json:"seq"`
+	ProducedAt time.Time `json:"produced_at"`
+	Message    string    `json:"message"`
+}
+
+// newKafkaRunID returns the id that tells the messages of a produce run apart.
+func newKafkaRunID() string {
+	return fmt.Sprintf("%x", time.Now().UnixNano())
+}
+
+// markedKafkaMessage returns message seq of producer in run runID. All messages of a
+// producer share a key, so Kafka keeps them in order on a single partition.
+func markedKafkaMessage(runID string, producer int, seq int64, content string) kafka.Message {
+	value, _ := json.Marshal(kafkaMarker{
+		RunID:      runID,
+		Producer:   producer,
+		Seq:        seq,
+		ProducedAt: time.Now().UTC(),
+		Message:    content,
+	})
+	return kafka.Message{Key: []byte(fmt.Sprintf("%s-%d", runID, producer)), Value: value}
+}
+
+// KafkaVerifyPayload defines the payload for verifying messages produced with markers.
+type KafkaVerifyPayload struct {
+	Topic          string  `json:"topic"`           // Default KAFKA_TOPIC, e.g. the output topic of a pipeline.
+	RunID          string  `json:"run_id"`          // Only check this produce run; other messages count as foreign.
+	GroupID        string  `json:"group_id"`        // Consumer group, default a new group per verification.
+	FromBeginning  bool    `json:"from_beginning"`  // Start a new group at the earliest offset instead of the latest.
+	MaintainSecond DuckInt `json:"maintain_second"` // How long to consume, default 30.
+	MaxMessages    DuckInt `json:"max_messages"`    // Stop after this many messages; 0 for no limit.
+	Async          bool    `json:"async"`
+}
+
+// Bounds of the sequence tracking, so that a message with a huge seq or producer cannot grow
+// the bitsets without limit: 512 KiB per producer, at most 128 MiB per verification.
+const (
+	maxKafkaVerifySeq     = 1 << 22
+	maxKafkaVerifyStreams = 256
+)
+
+// kafkaStream tracks the sequence numbers received from one producer of a run.
+type kafkaStream struct {
+	seen     []uint64 // Bitset of received sequence numbers.
+	min, max int64
+	unique   int64
+}
+
+// kafkaVerification accumulates what a verification consumer received.
+type kafkaVerification struct {
+	mu         sync.Mutex
+	topic      string
+	runID      string
+	startedAt  time.Time
+	finishedAt time.Time
+	err        string
+
+	consumed   int64
+	foreign    int64 // Messages without markers or of another run.
+	inOrder    int64
+	outOfOrder int64 // Received after a higher sequence number of the same producer.
+	duplicates int64
+	outOfRange int64 // Marked messages beyond maxKafkaVerifySeq or maxKafkaVerifyStreams, not tracked.
+	streams    map[string]*kafkaStream
+
+	latencyBuckets []int64
+	latencySumNs   int64
+	latencyMaxNs   int64
+}
+
+// observe checks one consumed message.
+func (v *kafkaVerification) observe(msg kafka.Message, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.consumed++
+	var marker kafkaMarker
+	if err := json.Unmarshal(msg.Value, &marker); err != nil || marker.RunID == "" ||
+		(v.runID != "" && marker.RunID != v.runID) || marker.Seq < 0 {
+		v.foreign++
+		return
+	}
+
+	latency := now.Sub(marker.ProducedAt)
+	i := 0
+	for i < len(latencyBucketsMs) && latency > time.Duration(latencyBucketsMs[i])*time.Millisecond {
+		i++
+	}
+	v.latencyBuckets[i]++
+	v.latencySumNs += int64(latency)
+	v.latencyMaxNs = max(v.latencyMaxNs, int64(latency))
+
+	id := fmt.Sprintf("%s/%d", marker.RunID, marker.Producer)
+	stream, ok := v.streams[id]
+	if marker.Seq >= maxKafkaVerifySeq || (!ok && len(v.streams) >= maxKafkaVerifyStreams) {
+		v.outOfRange++
+		return
+	}
+	if !ok {
+		stream = &kafkaStream{min: marker.Seq, max: marker.Seq - 1}
+		v.streams[id] = stream
+	}
+	word, bit := marker.Seq/64, uint64(1)<<(marker.Seq%64)
+	for int64(len(stream.seen)) <= word {
+		stream.seen = append(stream.seen, 0)
+	}
+	switch {
+	case stream.seen[word]&bit != 0:
+		v.duplicates++
+		return
+	case marker.Seq < stream.max:
+		v.outOfOrder++
+	default:
+		v.inOrder++
+	}
+	stream.seen[word] |= bit
+	stream.unique++
+	stream.min = min(stream.min, marker.Seq)
+	stream.max = max(stream.max, marker.Seq)
+}
+
+func (v *kafkaVerification) toMap() gin.H {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// Sequence numbers between the lowest and highest received of a producer that never arrived.
+	var missing int64
+	for _, stream := range v.streams {
+		missing += stream.max - stream.min + 1 - stream.unique
+	}
+	buckets := make([]gin.H, 0, len(v.latencyBuckets))
+	var cumulative int64
+	for i, n := range v.latencyBuckets {
+		cumulative += n
+		le := "+Inf"
+		if i < len(latencyBucketsMs) {
+			le = intToString(int(latencyBucketsMs[i]))
+		}
+		buckets = append(buckets, gin.H{"le_ms": le, "count": cumulative})
+	}
+	meanMs := 0.0
+	if marked := v.consumed - v.foreign; marked > 0 {
+		meanMs = float64(v.latencySumNs) / float64(marked) / 1e6
+	}
+	result := gin.H{
+		"topic":        v.topic,
+		"run_id":       v.runID,
+		"started_at":   v.startedAt.Format(time.RFC3339Nano),
+		"consumed":     v.consumed,
+		"foreign":      v.foreign,
+		"producers":    len(v.streams),
+		"in_order":     v.inOrder,
+		"out_of_order": v.outOfOrder,
+		"duplicates":   v.duplicates,
+		"out_of_range": v.outOfRange,
+		"missing":      missing,
+		"end_to_end_latency": gin.H{
+			"mean_ms": meanMs,
+			"max_ms":  float64(v.latencyMaxNs) / 1e6,
+			"buckets": buckets,
+		},
+	}
+	if !v.finishedAt.IsZero() {
+		result["finished_at"] = v.finishedAt.Format(time.RFC3339Nano)
+	}
+	if v.err != "" {
+		result["error"] = v.err
+	}
+	return result
+}
+
+// Global variables for Kafka verification. The last verification is kept for GET /kafka/verify.
+var (
+	kafkaVerifyMutex sync.Mutex
+	lastKafkaVerify  *kafkaVerification
+)
+
+// getKafkaReader creates a consumer group reader on topic using configuration from GetKafkaConfig.
+func getKafkaReader(topic, groupID string, startOffset int64) (*kafka.Reader, error) {
+	cfg, err := GetKafkaConfig()
+	if err != nil {
+		return nil, err
+	}
+	if topic == "" {
+		topic = cfg.Topic
+	}
+	dialer := &kafka.Dialer{Timeout: 10 * time.Second, DialFunc: egressDialer(egressKafka)}
+	if cfg.TLSEnabled {
+		dialer.TLS = &tls.Config{InsecureSkipVerify: true}
+	}
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Servers,
+		GroupID:     groupID,
+		Topic:       topic,
+		StartOffset: startOffset,
+		Dialer:      dialer,
+		MaxWait:     500 * time.Millisecond,
+	}), nil
+}
+
+// KafkaVerifyHandler handles POST /kafka/verify.
+// It consumes topic for maintain_second seconds and checks the markers embedded by the
+// produce APIs with markers enabled: every producer's sequence numbers must arrive in order,
+// exactly once and without gaps. The end-to-end latency is measured from the produce time in
+// the marker, so the verification can also run on the output topic of a pipeline.
+func KafkaVerifyHandler(c *gin.Context) {
+	var payload KafkaVerifyPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	if maintainSec <= 0 {
+		maintainSec = 30
+	}
+	maxMessages := int64(payload.MaxMessages)
+	groupID := payload.GroupID
+	if groupID == "" {
+		groupID = "biggie-verify-" + newKafkaRunID()
+	}
+	startOffset := kafka.LastOffset
+	if payload.FromBeginning {
+		startOffset = kafka.FirstOffset
+	}
+	reader, err := getKafkaReader(payload.Topic, groupID, startOffset)
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "KAFKA_ERROR", err.Error())
+		return
+	}
+	v := &kafkaVerification{
+		topic:          reader.Config().Topic,
+		runID:          payload.RunID,
+		startedAt:      time.Now(),
+		streams:        map[string]*kafkaStream{},
+		latencyBuckets: make([]int64, len(latencyBucketsMs)+1),
+	}
+	kafkaVerifyMutex.Lock()
+	lastKafkaVerify = v
+	kafkaVerifyMutex.Unlock()
+	logInfo("Kafka verification started", zap.String("topic", v.topic), zap.String("group_id", groupID), zap.String("run_id", v.runID))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	verifyFunc := func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(maintainSec)*time.Second)
+		defer cancel()
+		for maxMessages <= 0 || v.consumed < maxMessages {
+			msg, err := reader.ReadMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					v.mu.Lock()
+					v.err = err.Error()
+					v.mu.Unlock()
+					logWarn("Kafka verification read failed", zap.Error(err))
+				}
+				break
+			}
+			v.observe(msg, time.Now())
+		}
+		reader.Close()
+		v.mu.Lock()
+		v.finishedAt = time.Now()
+		v.mu.Unlock()
+		logInfo("Kafka verification completed", zap.Any("results", v.toMap()))
+	}
+
+	if payload.Async {
+		go job.run(verifyFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "Kafka verification started",
+			"topic":           v.topic,
+			"group_id":        groupID,
+			"run_id":          v.runID,
+			"maintain_second": maintainSec,
+		})
+	} else {
+		job.run(verifyFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "Kafka verification completed",
+			"topic":           v.topic,
+			"group_id":        groupID,
+			"run_id":          v.runID,
+			"maintain_second": maintainSec,
+			"results":         v.toMap(),
+		})
+	}
+}
+
+// KafkaVerifyStatusHandler handles GET /kafka/verify.
+// It returns the results of the current or last verification.
+func KafkaVerifyStatusHandler(c *gin.Context) {
+	kafkaVerifyMutex.Lock()
+	v := lastKafkaVerify
+	kafkaVerifyMutex.Unlock()
+	if v == nil {
+		ErrorJSON(c, http.StatusNotFound, "VERIFICATION_NOT_FOUND", "no Kafka verification has run")
+		return
+	}
+	ResponseJSON(c, http.StatusOK, v.toMap())
+}
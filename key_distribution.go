@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Key distributions of the Redis and Kafka stress payloads.
+const (
+	keyDistributionUniform = "uniform"
+	keyDistributionZipfian = "zipfian"
+	keyDistributionHotKey  = "hot_key"
+)
+
+// keyPicker draws the keys of a stress workload from a skewed (or uniform) distribution and
+// counts how often each key was used, so the skew can be verified in the results.
+type keyPicker struct {
+	distribution string
+	hotPercent   int
+	counts       []int64
+
+	zipfMutex sync.Mutex // rand.Zipf is not safe for concurrent use.
+	zipf      *rand.Zipf
+}
+
+// newKeyPicker returns a picker over keyCount keys (default 1000), or nil when distribution
+// is empty so the workload keeps its fixed keys. zipfS is the Zipfian exponent (default 1.1)
+// and hotPercent the share of operations on key 0 in hot_key mode (default 80).
+func newKeyPicker(distribution string, keyCount DuckInt, zipfS DuckFloat, hotPercent DuckInt) (*keyPicker, error) {
+	if distribution == "" {
+		return nil, nil
+	}
+	count := int(keyCount)
+	if count <= 0 {
+		count = 1000
+	}
+	if count > 1000000 {
+		return nil, fmt.Errorf("key_count must be at most 1000000")
+	}
+	p := &keyPicker{distribution: distribution, counts: make([]int64, count)}
+	switch distribution {
+	case keyDistributionUniform:
+	case keyDistributionZipfian:
+		s := float64(zipfS)
+		if s == 0 {
+			s = 1.1
+		}
+		if s <= 1 {
+			return nil, fmt.Errorf("zipf_s must be greater than 1")
+		}
+		p.zipf = rand.NewZipf(rand.New(rand.NewSource(time.Now().UnixNano())), s, 1, uint64(count-1))
+	case keyDistributionHotKey:
+		p.hotPercent = int(hotPercent)
+		if p.hotPercent <= 0 {
+			p.hotPercent = 80
+		}
+		if p.hotPercent > 100 {
+			return nil, fmt.Errorf("hot_key_percent must be between 1 and 100")
+		}
+	default:
+		return nil, fmt.Errorf("key_distribution must be uniform, zipfian or hot_key")
+	}
+	return p, nil
+}
+
+// next returns the index of the next key.
+func (p *keyPicker) next() int {
+	var i int
+	switch {
+	case p.zipf != nil:
+		p.zipfMutex.Lock()
+		i = int(p.zipf.Uint64())
+		p.zipfMutex.Unlock()
+	case p.hotPercent > 0 && (len(p.counts) == 1 || rand.Intn(100) < p.hotPercent):
+		i = 0
+	case p.hotPercent > 0:
+		i = 1 + rand.Intn(len(p.counts)-1)
+	default:
+		i = rand.Intn(len(p.counts))
+	}
+	atomic.AddInt64(&p.counts[i], 1)
+	return i
+}
+
+// key returns the next key as prefix followed by its index.
+func (p *keyPicker) key(prefix string) string {
+	return fmt.Sprintf("%s%d", prefix, p.next())
+}
+
+// toMap reports the distribution and the share of the hottest key. A nil picker reports the
+// fixed keys of the workload.
+func (p *keyPicker) toMap() gin.H {
+	if p == nil {
+		return gin.H{"distribution": "fixed"}
+	}
+	var total, hottest int64
+	hottestKey, used := 0, 0
+	for i := range p.counts {
+		n := atomic.LoadInt64(&p.counts[i])
+		total += n
+		if n > 0 {
+			used++
+		}
+		if n > hottest {
+			hottest, hottestKey = n, i
+		}
+	}
+	hottestPercent := 0.0
+	if total > 0 {
+		hottestPercent = float64(hottest) * 100 / float64(total)
+	}
+	return gin.H{
+		"distribution":        p.distribution,
+		"key_count":           len(p.counts),
+		"keys_used":           used,
+		"operations":          total,
+		"hottest_key_index":   hottestKey,
+		"hottest_key_percent": hottestPercent,
+	}
+}
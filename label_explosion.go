@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Metrics that carry the exploded label.
+const (
+	explosionMetricCounter   = "counter"   // One biggie_http_requests_by_id_total series per request.
+	explosionMetricHistogram = "histogram" // One biggie_http_request_duration_seconds histogram per request.
+)
+
+// labelNameRegex matches a valid Prometheus label name that does not clash with ours.
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LabelExplosionPayload defines the payload for the label cardinality explosion.
+type LabelExplosionPayload struct {
+	LabelName      string  `json:"label_name"`      // Label holding the unique id, default request_id.
+	Metric         string  `json:"metric"`          // counter (default) or histogram.
+	IDsPerRequest  DuckInt `json:"ids_per_request"` // Unique ids recorded for each request, default 1.
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+}
+
+// explodedRequest is one request recorded under a unique id.
+type explodedRequest struct {
+	id      string
+	fault   string
+	path    string
+	seconds float64
+}
+
+// labelExplosion records every request under a unique label value until it expires. The
+// series are only exposed while it is active, so they all go stale at once when it ends.
+type labelExplosion struct {
+	labelName     string
+	metric        string
+	idsPerRequest int
+	maxSeries     int
+	expiry        time.Time
+
+	mutex    sync.Mutex
+	requests []explodedRequest
+	nextID   uint64
+	dropped  int64 // Ids not recorded because the series limit was reached.
+	scrapes  int64
+}
+
+// Global variables for the label cardinality explosion.
+var (
+	labelExplosionMutex  sync.Mutex
+	activeLabelExplosion *labelExplosion
+)
+
+// seriesPerID returns the series each unique id adds to the exposition.
+func (e *labelExplosion) seriesPerID() int {
+	if e.metric == explosionMetricHistogram {
+		// Every bucket, +Inf, _sum and _count.
+		return len(requestDurationBuckets) + 3
+	}
+	return 1
+}
+
+// observe records a request under ids_per_request new ids, up to the series limit.
+func (e *labelExplosion) observe(c *gin.Context, faults []string, duration time.Duration) {
+	fault := "none"
+	if len(faults) > 0 {
+		fault = strings.Join(faults, ",")
+	}
+	path := c.FullPath()
+	if path == "" {
+		path = "unmatched"
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for i := 0; i < e.idsPerRequest; i++ {
+		if (len(e.requests)+1)*e.seriesPerID() > e.maxSeries {
+			e.dropped += int64(e.idsPerRequest - i)
+			return
+		}
+		e.nextID++
+		e.requests = append(e.requests, explodedRequest{
+			id:      fmt.Sprintf("%x-%d", time.Now().UnixNano(), e.nextID),
+			fault:   fault,
+			path:    path,
+			seconds: duration.Seconds(),
+		})
+	}
+}
+
+// writeHistograms appends a request duration histogram per id, for the
+// biggie_http_request_duration_seconds family.
+func (e *labelExplosion) writeHistograms(b *strings.Builder) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, r := range e.requests {
+		labels := fmt.Sprintf("fault=%q,path=%q,%s=%q", r.fault, r.path, e.labelName, r.id)
+		var cumulative int
+		for _, bound := range requestDurationBuckets {
+			if r.seconds <= bound {
+				cumulative = 1
+			}
+			fmt.Fprintf(b, "biggie_http_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, formatMetricValue(bound), cumulative)
+		}
+		fmt.Fprintf(b, "biggie_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} 1\n", labels)
+		fmt.Fprintf(b, "biggie_http_request_duration_seconds_sum{%s} %s\n", labels, formatMetricValue(r.seconds))
+		fmt.Fprintf(b, "biggie_http_request_duration_seconds_count{%s} 1\n", labels)
+	}
+}
+
+// writeCounters appends the biggie_http_requests_by_id_total family.
+func (e *labelExplosion) writeCounters(b *strings.Builder, openMetrics bool) {
+	name := "biggie_http_requests_by_id_total"
+	if openMetrics {
+		name = "biggie_http_requests_by_id"
+	}
+	b.WriteString("# HELP " + name + " Requests by unique id, from /stress/label_explosion.\n")
+	b.WriteString("# TYPE " + name + " counter\n")
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, r := range e.requests {
+		fmt.Fprintf(b, "biggie_http_requests_by_id_total{fault=%q,path=%q,%s=%q} 1\n", r.fault, r.path, e.labelName, r.id)
+	}
+}
+
+// toMap returns the settings and counters of the explosion.
+func (e *labelExplosion) toMap() gin.H {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return gin.H{
+		"label_name":      e.labelName,
+		"metric":          e.metric,
+		"ids_per_request": e.idsPerRequest,
+		"max_series":      e.maxSeries,
+		"ids":             len(e.requests),
+		"series":          len(e.requests) * e.seriesPerID(),
+		"dropped_ids":     e.dropped,
+		"scrapes":         atomic.LoadInt64(&e.scrapes),
+	}
+}
+
+// currentLabelExplosion returns the active explosion, or nil.
+func currentLabelExplosion() *labelExplosion {
+	labelExplosionMutex.Lock()
+	e := activeLabelExplosion
+	labelExplosionMutex.Unlock()
+	if e == nil || !time.Now().Before(e.expiry) {
+		return nil
+	}
+	return e
+}
+
+// observeLabelExplosion records the request in c under unique ids while an explosion is active.
+func observeLabelExplosion(c *gin.Context, faults []string, duration time.Duration) {
+	if e := currentLabelExplosion(); e != nil {
+		e.observe(c, faults, duration)
+	}
+}
+
+// writeLabelExplosionHistograms appends the per-id request duration histograms, if any.
+func writeLabelExplosionHistograms(b *strings.Builder) {
+	if e := currentLabelExplosion(); e != nil && e.metric == explosionMetricHistogram {
+		atomic.AddInt64(&e.scrapes, 1)
+		e.writeHistograms(b)
+	}
+}
+
+// writeLabelExplosionCounters appends the per-id request counters, if any.
+func writeLabelExplosionCounters(b *strings.Builder, openMetrics bool) {
+	if e := currentLabelExplosion(); e != nil && e.metric == explosionMetricCounter {
+		atomic.AddInt64(&e.scrapes, 1)
+		e.writeCounters(b, openMetrics)
+	}
+}
+
+// labelExplosionStatus returns the state of the current (or last) explosion.
+func labelExplosionStatus() gin.H {
+	labelExplosionMutex.Lock()
+	e := activeLabelExplosion
+	labelExplosionMutex.Unlock()
+	if e == nil {
+		return gin.H{"active": false}
+	}
+	status := e.toMap()
+	status["active"] = time.Now().Before(e.expiry)
+	status["remaining_second"] = remainingSecond(time.Now(), e.expiry)
+	return status
+}
+
+// LabelExplosionStatusHandler handles GET /stress/label_explosion.
+func LabelExplosionStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, labelExplosionStatus())
+}
+
+// LabelExplosionHandler handles POST /stress/label_explosion.
+// For maintain_second, every request served is also recorded in GET /metrics/prometheus under
+// ids_per_request unique values of label_name, so the number of series grows with the traffic,
+// the failure mode of a request id put in a metric label. The series are capped at
+// LABEL_EXPLOSION_MAX_SERIES and disappear together when the explosion ends.
+func LabelExplosionHandler(c *gin.Context) {
+	var payload LabelExplosionPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.LabelName == "" {
+		payload.LabelName = "request_id"
+	}
+	if !labelNameRegex.MatchString(payload.LabelName) || strings.HasPrefix(payload.LabelName, "__") ||
+		payload.LabelName == "fault" || payload.LabelName == "path" || payload.LabelName == "le" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "label_name must be a label name other than fault, path and le")
+		return
+	}
+	if payload.Metric == "" {
+		payload.Metric = explosionMetricCounter
+	}
+	if payload.Metric != explosionMetricCounter && payload.Metric != explosionMetricHistogram {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "metric must be counter or histogram")
+		return
+	}
+	if payload.IDsPerRequest <= 0 {
+		payload.IDsPerRequest = 1
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	e := &labelExplosion{
+		labelName:     payload.LabelName,
+		metric:        payload.Metric,
+		idsPerRequest: int(payload.IDsPerRequest),
+		maxSeries:     viper.GetInt("LABEL_EXPLOSION_MAX_SERIES"),
+		expiry:        time.Now().Add(time.Duration(maintainSec) * time.Second),
+	}
+	labelExplosionMutex.Lock()
+	activeLabelExplosion = e
+	labelExplosionMutex.Unlock()
+	recordFaultActivated("label_explosion", "", gin.H{
+		"label_name":      e.labelName,
+		"metric":          e.metric,
+		"ids_per_request": e.idsPerRequest,
+	}, e.expiry)
+	logInfo("Label explosion started",
+		zap.String("label_name", e.labelName),
+		zap.String("metric", e.metric),
+		zap.Int("ids_per_request", e.idsPerRequest),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the explosion unless a later request replaced it.
+			labelExplosionMutex.Lock()
+			ours := activeLabelExplosion == e
+			if ours {
+				activeLabelExplosion = nil
+			}
+			labelExplosionMutex.Unlock()
+			if ours {
+				recordFaultDeactivated("label_explosion", "", "cancelled")
+			}
+		}
+		logInfo("Label explosion ended", zap.Any("results", e.toMap()))
+	}
+
+	result := e.toMap()
+	result["maintain_second"] = maintainSec
+	if payload.Async {
+		go job.run(waitFunc)
+		result["message"] = "label explosion started"
+	} else {
+		job.run(waitFunc)
+		result = e.toMap()
+		result["maintain_second"] = maintainSec
+		result["message"] = "label explosion completed"
+	}
+	ResponseJSON(c, http.StatusOK, result)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// latencyBucketsMs are the upper bounds of the injected latency histogram, in milliseconds.
+var latencyBucketsMs = []int64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// latencyHistogram records the delay actually added per request by latency injection,
+// next to the configured one, to verify the injected distribution under load.
+type latencyHistogram struct {
+	buckets        []int64 // Non-cumulative; the last one counts delays above every bound.
+	count          int64
+	sumNs          int64
+	maxNs          int64
+	overshootSumNs int64 // Actual minus configured delay.
+	maxOvershootNs int64
+	configuredMs   int64 // Configured delay of the last observation.
+	skipped        int64 // Requests rejected because LATENCY_MAX_DELAYED_REQUESTS was reached.
+}
+
+// injectedLatencyHistogram is reset whenever a latency injection starts.
+var injectedLatencyHistogram = &latencyHistogram{buckets: make([]int64, len(latencyBucketsMs)+1)}
+
+// atomicMax raises *addr to v if v is larger.
+func atomicMax(addr *int64, v int64) {
+	for {
+		prev := atomic.LoadInt64(addr)
+		if v <= prev || atomic.CompareAndSwapInt64(addr, prev, v) {
+			return
+		}
+	}
+}
+
+// observe records one injected delay.
+func (h *latencyHistogram) observe(configured, actual time.Duration) {
+	i := 0
+	for i < len(latencyBucketsMs) && actual > time.Duration(latencyBucketsMs[i])*time.Millisecond {
+		i++
+	}
+	atomic.AddInt64(&h.buckets[i], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sumNs, int64(actual))
+	atomicMax(&h.maxNs, int64(actual))
+	overshoot := int64(actual - configured)
+	atomic.AddInt64(&h.overshootSumNs, overshoot)
+	atomicMax(&h.maxOvershootNs, overshoot)
+	atomic.StoreInt64(&h.configuredMs, configured.Milliseconds())
+}
+
+// skip records a request that was rejected because every delay slot was taken.
+func (h *latencyHistogram) skip() {
+	atomic.AddInt64(&h.skipped, 1)
+}
+
+// reset clears every observation.
+func (h *latencyHistogram) reset() {
+	for i := range h.buckets {
+		atomic.StoreInt64(&h.buckets[i], 0)
+	}
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sumNs, 0)
+	atomic.StoreInt64(&h.maxNs, 0)
+	atomic.StoreInt64(&h.overshootSumNs, 0)
+	atomic.StoreInt64(&h.maxOvershootNs, 0)
+	atomic.StoreInt64(&h.configuredMs, 0)
+	atomic.StoreInt64(&h.skipped, 0)
+}
+
+// toMap returns the histogram with cumulative buckets, like a Prometheus histogram.
+func (h *latencyHistogram) toMap() gin.H {
+	count := atomic.LoadInt64(&h.count)
+	buckets := make([]gin.H, 0, len(h.buckets))
+	var cumulative int64
+	for i := range h.buckets {
+		cumulative += atomic.LoadInt64(&h.buckets[i])
+		le := "+Inf"
+		if i < len(latencyBucketsMs) {
+			le = intToString(int(latencyBucketsMs[i]))
+		}
+		buckets = append(buckets, gin.H{"le_ms": le, "count": cumulative})
+	}
+	meanMs, meanOvershootMs := 0.0, 0.0
+	if count > 0 {
+		meanMs = float64(atomic.LoadInt64(&h.sumNs)) / float64(count) / 1e6
+		meanOvershootMs = float64(atomic.LoadInt64(&h.overshootSumNs)) / float64(count) / 1e6
+	}
+	return gin.H{
+		"configured_ms":     atomic.LoadInt64(&h.configuredMs),
+		"count":             count,
+		"mean_ms":           meanMs,
+		"max_ms":            float64(atomic.LoadInt64(&h.maxNs)) / 1e6,
+		"mean_overshoot_ms": meanOvershootMs,
+		"max_overshoot_ms":  float64(atomic.LoadInt64(&h.maxOvershootNs)) / 1e6,
+		"skipped":           atomic.LoadInt64(&h.skipped),
+		"buckets":           buckets,
+	}
+}
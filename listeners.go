@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// serveUnixSocket also serves the API on UNIX_SOCKET_PATH, when set, so sidecar proxies with
+// Unix domain socket upstreams (e.g. Envoy) can be tested against Biggie. A stale socket
+// file left by a previous run is removed first.
+func serveUnixSocket(server *http.Server) {
+	path := viper.GetString("UNIX_SOCKET_PATH")
+	if path == "" {
+		return
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		logError("failed to listen on unix socket", zap.String("path", path), zap.Error(err))
+		return
+	}
+	mode, err := strconv.ParseUint(viper.GetString("UNIX_SOCKET_MODE"), 8, 32)
+	if err != nil {
+		logWarn("invalid UNIX_SOCKET_MODE, defaulting to 0666", zap.String("mode", viper.GetString("UNIX_SOCKET_MODE")))
+		mode = 0o666
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		logWarn("failed to set unix socket mode", zap.String("path", path), zap.Error(err))
+	}
+	logInfo("serving on unix socket", zap.String("path", path))
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError("unix socket server stopped", zap.String("path", path), zap.Error(err))
+		}
+	}()
+}
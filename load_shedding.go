@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LoadSheddingPayload defines the payload for the load shedding simulation.
+type LoadSheddingPayload struct {
+	ConcurrencyThreshold DuckInt `json:"concurrency_threshold"` // In-flight requests above which shedding starts; 0 disables.
+	CPUPercentThreshold  DuckInt `json:"cpu_percent_threshold"` // Process CPU usage (percent of all cores) above which shedding starts; 0 disables.
+	ShedPercent          DuckInt `json:"shed_percent"`          // Percentage of requests rejected while over a threshold.
+	RetryAfterSecond     DuckInt `json:"retry_after_second"`    // Value of the Retry-After header.
+	MaintainSecond       DuckInt `json:"maintain_second"`
+	Async                bool    `json:"async"`
+}
+
+// Global variables for load shedding simulation.
+var (
+	loadSheddingMutex       sync.Mutex
+	loadSheddingExpiry      time.Time = time.Now()
+	loadSheddingConcurrency int
+	loadSheddingCPUPercent  int
+	loadSheddingPercent     int
+	loadSheddingRetryAfter  int
+
+	inFlightRequests  int64
+	processCPUPercent int64 // Sampled while load shedding is active.
+	shedRequests      int64
+)
+
+// processCPUTime returns the user and system CPU time used by this process so far.
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// sampleProcessCPU updates processCPUPercent once per second until the given time.
+func sampleProcessCPU(until time.Time) {
+	prevCPU, prevWall := processCPUTime(), time.Now()
+	for time.Now().Before(until) {
+		time.Sleep(time.Second)
+		curCPU, curWall := processCPUTime(), time.Now()
+		percent := float64(curCPU-prevCPU) / float64(curWall.Sub(prevWall)) / float64(runtime.NumCPU()) * 100
+		atomic.StoreInt64(&processCPUPercent, int64(percent))
+		prevCPU, prevWall = curCPU, curWall
+	}
+	atomic.StoreInt64(&processCPUPercent, 0)
+}
+
+// LoadSheddingHandler handles POST /stress/load_shedding.
+// While active, LoadSheddingMiddleware rejects shed_percent of requests with 429 and a
+// Retry-After header whenever in-flight requests or process CPU usage exceed their thresholds.
+func LoadSheddingHandler(c *gin.Context) {
+	var payload LoadSheddingPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	concurrency := int(payload.ConcurrencyThreshold)
+	cpuPercent := int(payload.CPUPercentThreshold)
+	if concurrency <= 0 && cpuPercent <= 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "concurrency_threshold or cpu_percent_threshold is required")
+		return
+	}
+	shedPercent := int(payload.ShedPercent)
+	if shedPercent <= 0 || shedPercent > 100 {
+		shedPercent = 100
+	}
+	retryAfter := int(payload.RetryAfterSecond)
+	if retryAfter <= 0 {
+		retryAfter = 1
+	}
+	maintainSec := int(payload.MaintainSecond)
+	expiry := time.Now().Add(time.Duration(maintainSec) * time.Second)
+
+	loadSheddingMutex.Lock()
+	loadSheddingConcurrency = concurrency
+	loadSheddingCPUPercent = cpuPercent
+	loadSheddingPercent = shedPercent
+	loadSheddingRetryAfter = retryAfter
+	loadSheddingExpiry = expiry
+	loadSheddingMutex.Unlock()
+	recordFaultActivated("load_shedding", "", gin.H{
+		"concurrency_threshold": concurrency,
+		"cpu_percent_threshold": cpuPercent,
+		"shed_percent":          shedPercent,
+	}, expiry)
+	atomic.StoreInt64(&shedRequests, 0)
+	if cpuPercent > 0 {
+		go sampleProcessCPU(expiry)
+	}
+	logInfo("Load shedding simulation started",
+		zap.Int("concurrency_threshold", concurrency),
+		zap.Int("cpu_percent_threshold", cpuPercent),
+		zap.Int("shed_percent", shedPercent),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the load shedding unless a later request replaced it.
+			loadSheddingMutex.Lock()
+			ours := loadSheddingExpiry.Equal(expiry)
+			if ours {
+				loadSheddingExpiry = time.Now()
+			}
+			loadSheddingMutex.Unlock()
+			if ours {
+				recordFaultDeactivated("load_shedding", "", "cancelled")
+			}
+		}
+		logInfo("Load shedding simulation ended", zap.Int64("shed_requests", atomic.LoadInt64(&shedRequests)))
+	}
+
+	if payload.Async {
+		go job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":               "load shedding simulation started",
+			"concurrency_threshold": concurrency,
+			"cpu_percent_threshold": cpuPercent,
+			"shed_percent":          shedPercent,
+			"retry_after_second":    retryAfter,
+			"maintain_second":       maintainSec,
+		})
+	} else {
+		job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":               "load shedding simulation completed",
+			"concurrency_threshold": concurrency,
+			"cpu_percent_threshold": cpuPercent,
+			"shed_percent":          shedPercent,
+			"retry_after_second":    retryAfter,
+			"maintain_second":       maintainSec,
+			"shed_requests":         atomic.LoadInt64(&shedRequests),
+		})
+	}
+}
+
+// LoadSheddingMiddleware tracks in-flight requests and, while load shedding is active,
+// rejects a share of requests once a concurrency or CPU threshold is crossed.
+func LoadSheddingMiddleware(c *gin.Context) {
+	inFlight := atomic.AddInt64(&inFlightRequests, 1)
+	defer atomic.AddInt64(&inFlightRequests, -1)
+
+	loadSheddingMutex.Lock()
+	active := time.Now().Before(loadSheddingExpiry)
+	concurrency := loadSheddingConcurrency
+	cpuPercent := loadSheddingCPUPercent
+	shedPercent := loadSheddingPercent
+	retryAfter := loadSheddingRetryAfter
+	loadSheddingMutex.Unlock()
+
+	if active {
+		overloaded := (concurrency > 0 && inFlight > int64(concurrency)) ||
+			(cpuPercent > 0 && atomic.LoadInt64(&processCPUPercent) >= int64(cpuPercent))
+		if overloaded && rand.Intn(100) < shedPercent {
+			atomic.AddInt64(&shedRequests, 1)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":        "LOAD_SHED",
+				"message":      "server overloaded, request shed",
+				"in_flight":    inFlight,
+				"requested_at": time.Now().UTC().Format(time.RFC3339Nano),
+			})
+			return
+		}
+	}
+	c.Next()
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Log templates of the logs generator.
+const (
+	logTemplateAccess         = "access"          // LOG_FORMAT access logs (default).
+	logTemplateJavaStackTrace = "java_stacktrace" // Spring Boot errors with multi-line stack traces.
+	logTemplateGoPanic        = "go_panic"        // Go panics with goroutine traces.
+	logTemplateJSONApp        = "json_app"        // JSON application logs with nested fields.
+	logTemplateSQL            = "sql"             // Multi-line PostgreSQL slow query logs.
+	logTemplateMixed          = "mixed"           // A random template for every log.
+)
+
+// logTemplates generates one log entry, possibly multi-line, of each template.
+var logTemplates = map[string]func(now time.Time) string{
+	logTemplateAccess:         func(time.Time) string { return generateAccessLog(nil) },
+	logTemplateJavaStackTrace: javaExceptionLog,
+	logTemplateGoPanic:        goRuntimePanicLog,
+	logTemplateJSONApp:        jsonAppLog,
+	logTemplateSQL:            sqlSlowQueryLog,
+}
+
+// logErrorPatterns generates one entry of each named error pattern, in the exact shape alert
+// rules usually match on.
+var logErrorPatterns = map[string]func(now time.Time) string{
+	// java.lang.OutOfMemoryError with its stack trace.
+	"java_oom": func(now time.Time) string {
+		return javaStackTrace(now, "ERROR", "java.lang.OutOfMemoryError", "Java heap space", "")
+	},
+	// NullPointerException with the helpful message of Java 14+.
+	"java_npe": func(now time.Time) string {
+		return javaStackTrace(now, "ERROR", "java.lang.NullPointerException",
+			`Cannot invoke "String.length()" because "customer.getName()" is null`, "")
+	},
+	// Nil pointer dereference panic of a Go service.
+	"go_nil_panic": func(now time.Time) string {
+		return goPanic("runtime error: invalid memory address or nil pointer dereference\n" +
+			fmt.Sprintf("[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x%x]", 0x6a0000+rand.Intn(0xffff)))
+	},
+	// Database connection refused, in a JSON application log.
+	"db_connection_refused": func(now time.Time) string {
+		return jsonLog(now, "error", "orders.repository", "failed to connect to database", map[string]interface{}{
+			"error": fmt.Sprintf("dial tcp 10.0.%d.%d:5432: connect: connection refused", rand.Intn(4), rand.Intn(250)+2),
+			"db":    map[string]interface{}{"system": "postgresql", "name": "orders", "pool": map[string]interface{}{"open": 0, "idle": 0, "wait_count": rand.Intn(500)}},
+		})
+	},
+	// PostgreSQL deadlock with its detail and statement.
+	"sql_deadlock": func(now time.Time) string {
+		pid, other := 1000+rand.Intn(9000), 1000+rand.Intn(9000)
+		tx, otherTx := 100000+rand.Intn(900000), 100000+rand.Intn(900000)
+		prefix := postgresLogPrefix(now, pid)
+		return strings.Join([]string{
+			prefix + "ERROR:  deadlock detected",
+			prefix + fmt.Sprintf("DETAIL:  Process %d waits for ShareLock on transaction %d; blocked by process %d.", pid, otherTx, other),
+			"\t" + fmt.Sprintf("Process %d waits for ShareLock on transaction %d; blocked by process %d.", other, tx, pid),
+			prefix + "HINT:  See server log for query details.",
+			prefix + fmt.Sprintf("CONTEXT:  while updating tuple (%d,%d) in relation \"orders\"", rand.Intn(5000), rand.Intn(60)),
+			prefix + "STATEMENT:  UPDATE orders",
+			"\tSET status = 'PAID', updated_at = now()",
+			fmt.Sprintf("\tWHERE id = %d;", rand.Intn(1000000)),
+		}, "\n")
+	},
+	// Upstream call timing out, in a JSON application log.
+	"upstream_timeout": func(now time.Time) string {
+		return jsonLog(now, "error", "checkout.client", "upstream request failed", map[string]interface{}{
+			"error": "context deadline exceeded",
+			"http": map[string]interface{}{
+				"method":      "POST",
+				"url":         "http://payments.internal/v1/charges",
+				"status":      504,
+				"duration_ms": 30000 + rand.Intn(50),
+			},
+			"retry": map[string]interface{}{"attempt": rand.Intn(3) + 1, "max": 3},
+		})
+	},
+	// Access logs with a 5xx status.
+	"http_5xx": func(time.Time) string {
+		return generateAccessLog(map[string]string{
+			"status_code": strconv.Itoa([]int{500, 502, 503, 504}[rand.Intn(4)]),
+		})
+	},
+}
+
+// logTemplateNames returns the names in a template or pattern map, in order.
+func logTemplateNames(m map[string]func(time.Time) string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// generateTemplateLog returns an entry of template, picking one at random for mixed.
+func generateTemplateLog(template string, now time.Time) string {
+	if template == logTemplateMixed {
+		names := logTemplateNames(logTemplates)
+		template = names[rand.Intn(len(names))]
+	}
+	return logTemplates[template](now)
+}
+
+var (
+	javaLoggers = []string{"c.e.orders.OrderController", "c.e.payments.PaymentService", "c.e.inventory.StockRepository"}
+	javaFrames  = []string{
+		"com.example.orders.OrderService.placeOrder(OrderService.java:%d)",
+		"com.example.orders.OrderController.create(OrderController.java:%d)",
+		"com.example.payments.PaymentService.charge(PaymentService.java:%d)",
+		"com.example.inventory.StockRepository.reserve(StockRepository.java:%d)",
+	}
+	javaExceptions = [][2]string{
+		{"java.lang.IllegalStateException", "Order is not in a payable state"},
+		{"java.lang.IllegalArgumentException", "Quantity must be positive"},
+		{"org.springframework.dao.DataIntegrityViolationException", "could not execute statement; SQL [n/a]; constraint [orders_pkey]"},
+		{"java.util.concurrent.TimeoutException", "Timed out after 5000 ms waiting for inventory"},
+	}
+)
+
+// javaStackTrace returns a Spring Boot log of level with the stack trace of exception, and of
+// cause when given.
+func javaStackTrace(now time.Time, level, exception, message, cause string) string {
+	lines := []string{
+		fmt.Sprintf("%s %5s 1 --- [nio-8080-exec-%d] %-40s : Request processing failed",
+			now.UTC().Format("2006-01-02 15:04:05.000"), level, rand.Intn(10)+1, javaLoggers[rand.Intn(len(javaLoggers))]),
+		exception + ": " + message,
+	}
+	for _, i := range rand.Perm(len(javaFrames))[:2] {
+		lines = append(lines, "\tat "+fmt.Sprintf(javaFrames[i], rand.Intn(300)+20))
+	}
+	lines = append(lines,
+		"\tat java.base/jdk.internal.reflect.DirectMethodHandleAccessor.invoke(DirectMethodHandleAccessor.java:103)",
+		"\tat org.springframework.web.servlet.FrameworkServlet.service(FrameworkServlet.java:883)",
+		"\tat org.apache.catalina.core.ApplicationFilterChain.doFilter(ApplicationFilterChain.java:166)",
+		"\tat org.apache.tomcat.util.threads.TaskThread$WrappingRunnable.run(TaskThread.java:61)",
+		"\tat java.base/java.lang.Thread.run(Thread.java:1583)",
+	)
+	if cause != "" {
+		lines = append(lines,
+			"Caused by: "+cause,
+			"\tat org.postgresql.core.v3.QueryExecutorImpl.receiveErrorResponse(QueryExecutorImpl.java:2725)",
+			"\tat org.postgresql.jdbc.PgPreparedStatement.executeUpdate(PgPreparedStatement.java:152)",
+			fmt.Sprintf("\t... %d common frames omitted", rand.Intn(80)+20),
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// javaExceptionLog returns a random Java exception, with a cause one time in three.
+func javaExceptionLog(now time.Time) string {
+	e := javaExceptions[rand.Intn(len(javaExceptions))]
+	cause := ""
+	if rand.Intn(3) == 0 {
+		cause = "org.postgresql.util.PSQLException: ERROR: canceling statement due to statement timeout"
+	}
+	return javaStackTrace(now, "ERROR", e[0], e[1], cause)
+}
+
+// goPanic returns a Go panic with the trace of the HTTP handler goroutine that raised it.
+func goPanic(message string) string {
+	goroutine := rand.Intn(5000) + 1
+	return strings.Join([]string{
+		"panic: " + message,
+		"",
+		fmt.Sprintf("goroutine %d [running]:", goroutine),
+		fmt.Sprintf("main.(*OrderHandler).ServeHTTP(0xc%09x, {0x9f8a2c, 0xc%09x}, 0xc%09x)", rand.Int63n(1<<36), rand.Int63n(1<<36), rand.Int63n(1<<36)),
+		fmt.Sprintf("\t/app/handlers/order.go:%d +0x%x", rand.Intn(200)+20, rand.Intn(0x400)),
+		"net/http.serverHandler.ServeHTTP({0xc000126000?}, {0x9f8a2c?, 0xc0001a2000?}, 0x6?)",
+		"\t/usr/local/go/src/net/http/server.go:3210 +0x8e",
+		"net/http.(*conn).serve(0xc0000a6000, {0x9f9b40, 0xc000096060})",
+		"\t/usr/local/go/src/net/http/server.go:2092 +0x5d0",
+		"created by net/http.(*Server).Serve in goroutine 1",
+		"\t/usr/local/go/src/net/http/server.go:3360 +0x485",
+	}, "\n")
+}
+
+// goRuntimePanicLog returns a random Go runtime panic.
+func goRuntimePanicLog(time.Time) string {
+	n := rand.Intn(8) + 1
+	return goPanic([]string{
+		fmt.Sprintf("runtime error: index out of range [%d] with length %d", n, rand.Intn(n)),
+		"assignment to entry in nil map",
+		"runtime error: slice bounds out of range [:12] with capacity 8",
+		"interface conversion: interface {} is nil, not string",
+	}[rand.Intn(4)])
+}
+
+// jsonLog returns a JSON application log with fields merged at the top level.
+func jsonLog(now time.Time, level, logger, message string, fields map[string]interface{}) string {
+	entry := map[string]interface{}{
+		"timestamp": now.UTC().Format(time.RFC3339Nano),
+		"level":     level,
+		"logger":    logger,
+		"message":   message,
+		"trace_id":  randomHex(16),
+		"span_id":   randomHex(8),
+		"service":   map[string]interface{}{"name": "orders", "version": "1.4.2", "instance": fmt.Sprintf("orders-%x", rand.Intn(1<<20))},
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	b, _ := json.Marshal(entry)
+	return string(b)
+}
+
+// jsonAppLog returns a JSON application log of a request, mostly info.
+func jsonAppLog(now time.Time) string {
+	level, status, message := "info", 200, "order created"
+	switch r := rand.Intn(20); {
+	case r == 0:
+		level, status, message = "error", 500, "order creation failed"
+	case r < 3:
+		level, status, message = "warn", 409, "order already exists"
+	}
+	return jsonLog(now, level, "orders.service", message, map[string]interface{}{
+		"http": map[string]interface{}{
+			"method":      "POST",
+			"path":        "/api/orders",
+			"status":      status,
+			"duration_ms": rand.Intn(500) + 5,
+		},
+		"user": map[string]interface{}{"id": fmt.Sprintf("u-%d", rand.Intn(100000)), "tier": []string{"free", "pro", "enterprise"}[rand.Intn(3)]},
+		"order": map[string]interface{}{
+			"id":    rand.Intn(1000000),
+			"items": rand.Intn(9) + 1,
+			"total": map[string]interface{}{"amount": float64(rand.Intn(100000)) / 100, "currency": "USD"},
+		},
+	})
+}
+
+// postgresLogPrefix returns the PostgreSQL log_line_prefix '%m [%p] '.
+func postgresLogPrefix(now time.Time, pid int) string {
+	return fmt.Sprintf("%s UTC [%d] ", now.UTC().Format("2006-01-02 15:04:05.000"), pid)
+}
+
+// sqlSlowQueryLog returns a PostgreSQL slow query log with a multi-line statement.
+func sqlSlowQueryLog(now time.Time) string {
+	statements := [][]string{
+		{
+			"SELECT o.id, o.total, c.email",
+			"\tFROM orders o",
+			"\tJOIN customers c ON c.id = o.customer_id",
+			"\tWHERE o.created_at > now() - interval '1 day'",
+			"\tORDER BY o.total DESC",
+			"\tLIMIT 50;",
+		},
+		{
+			"UPDATE inventory",
+			"\tSET reserved = reserved + $1",
+			"\tWHERE sku = $2",
+			"\t  AND stock - reserved >= $1;",
+		},
+		{
+			"WITH recent AS (",
+			"\t  SELECT customer_id, count(*) AS orders",
+			"\t  FROM orders",
+			"\t  WHERE created_at > now() - interval '30 days'",
+			"\t  GROUP BY customer_id",
+			"\t)",
+			"\tSELECT * FROM recent WHERE orders > 10;",
+		},
+	}
+	statement := statements[rand.Intn(len(statements))]
+	first := postgresLogPrefix(now, 1000+rand.Intn(9000)) +
+		fmt.Sprintf("LOG:  duration: %.3f ms  statement: %s", 500+rand.Float64()*5000, statement[0])
+	return strings.Join(append([]string{first}, statement[1:]...), "\n")
+}
+
+// correlatedFaultLogs returns the ERROR lines, JSON or text, correlating count logs written at
+// now with the faults of ns active then: downtime fails every request and error injection
+// error_rate of them.
+func correlatedFaultLogs(jsonLines bool, ns string, count int, now time.Time) []string {
+	f := faultState.Effective(ns, now)
+	down, errorRate := f.down(now), f.errorRate(now)
+	if !down && errorRate == 0 {
+		return nil
+	}
+	fault, status, message, expiry := "error_injection", 500, "simulated random error injection", f.ErrorExpiry
+	if down {
+		fault, status, message, expiry = "downtime", 503, "service unavailable due to injected downtime", f.DowntimeExpiry
+	}
+	namespace := ns
+	if namespace == "" {
+		namespace = "global"
+	}
+	var lines []string
+	for i := 0; i < count; i++ {
+		if !down && rand.Float64() >= errorRate {
+			continue
+		}
+		if jsonLines {
+			lines = append(lines, jsonLog(now, "error", "orders.service", "request failed", map[string]interface{}{
+				"error": message,
+				"http":  map[string]interface{}{"method": "POST", "path": "/api/orders", "status": status},
+				"fault": map[string]interface{}{
+					"name":             fault,
+					"namespace":        namespace,
+					"error_rate":       errorRate,
+					"remaining_second": remainingSecond(now, expiry),
+				},
+			}))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s ERROR [biggie] request failed with %d: %s fault=%s namespace=%s error_rate=%g remaining_second=%d",
+			now.UTC().Format(time.RFC3339Nano), status, message, fault, namespace, errorRate, remainingSecond(now, expiry)))
+	}
+	return lines
+}
+
+// Output formats of the access template.
+const (
+	logFormatDefault   = "log_format" // LOG_FORMAT (default).
+	logFormatJSON      = "json"
+	logFormatLogfmt    = "logfmt"
+	logFormatCLF       = "clf"       // Apache Common Log Format.
+	logFormatMultiline = "multiline" // Spring Boot logs, with a stack trace for warn and error.
+)
+
+// logFormats lists the output formats of the access template.
+var logFormats = []string{logFormatDefault, logFormatJSON, logFormatLogfmt, logFormatCLF, logFormatMultiline}
+
+// Severities of the access template and the statuses of their requests.
+var logSeverityStatuses = map[string][]int{
+	"info":  {200, 201, 204, 304},
+	"warn":  {400, 401, 404, 429},
+	"error": {500, 502, 503, 504},
+}
+
+// severityOfStatus returns the severity of an access log with status.
+func severityOfStatus(status int) string {
+	switch {
+	case status >= 500:
+		return "error"
+	case status >= 400:
+		return "warn"
+	}
+	return "info"
+}
+
+// pickSeverity draws a severity from weights, or returns "" without weights.
+func pickSeverity(weights map[string]int) string {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return ""
+	}
+	r := rand.Intn(total)
+	for _, severity := range []string{"info", "warn", "error"} {
+		if r < weights[severity] {
+			return severity
+		}
+		r -= weights[severity]
+	}
+	return "info"
+}
+
+// formatAccessLog returns an access log of severity in format. Without a severity, the status
+// is drawn from the mix of GenerateRandomLogMessage.
+func formatAccessLog(format, severity string, now time.Time) string {
+	var status int
+	if severity == "" {
+		status = []int{200, 201, 400, 401, 404, 500}[rand.Intn(6)]
+		severity = severityOfStatus(status)
+	} else {
+		statuses := logSeverityStatuses[severity]
+		status = statuses[rand.Intn(len(statuses))]
+	}
+	method := []string{"GET", "POST", "PUT", "DELETE"}[rand.Intn(4)]
+	path := []string{"/dummy", "/test", "/stress", "/metrics", "/api/data"}[rand.Intn(5)]
+	clientIP := fmt.Sprintf("%d.%d.%d.%d", rand.Intn(256), rand.Intn(256), rand.Intn(256), rand.Intn(256))
+	userAgent := []string{"Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "curl/7.68.0", "PostmanRuntime/7.26.8"}[rand.Intn(3)]
+	latencyMs, size := rand.Intn(500)+10, rand.Intn(9900)+100
+	message := "request completed"
+	if severity != "info" {
+		message = "request failed"
+	}
+
+	switch format {
+	case logFormatJSON:
+		b, _ := json.Marshal(map[string]interface{}{
+			"time":       now.UTC().Format(time.RFC3339Nano),
+			"level":      severity,
+			"msg":        message,
+			"method":     method,
+			"path":       path,
+			"status":     status,
+			"latency_ms": latencyMs,
+			"bytes":      size,
+			"client_ip":  clientIP,
+			"user_agent": userAgent,
+			"request_id": randomHex(8),
+		})
+		return string(b)
+	case logFormatLogfmt:
+		return fmt.Sprintf("time=%s level=%s msg=%q method=%s path=%s status=%d latency_ms=%d bytes=%d client_ip=%s user_agent=%q request_id=%s",
+			now.UTC().Format(time.RFC3339Nano), severity, message, method, path, status, latencyMs, size, clientIP, userAgent, randomHex(8))
+	case logFormatCLF:
+		return fmt.Sprintf(`%s - - [%s] "%s %s HTTP/1.1" %d %d`, clientIP, now.Format("02/Jan/2006:15:04:05 -0700"), method, path, status, size)
+	case logFormatMultiline:
+		if severity == "info" {
+			return fmt.Sprintf("%s  INFO 1 --- [nio-8080-exec-%d] %-40s : %s %s completed with %d in %dms",
+				now.UTC().Format("2006-01-02 15:04:05.000"), rand.Intn(10)+1, "c.e.web.RequestLoggingFilter", method, path, status, latencyMs)
+		}
+		e := javaExceptions[rand.Intn(len(javaExceptions))]
+		return javaStackTrace(now, strings.ToUpper(severity), e[0], e[1], "")
+	}
+	return generateAccessLog(map[string]string{"status_code": strconv.Itoa(status)})
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // placeholderRegex matches substrings like {<placeholder>} or {<placeholder>:<unit>}
@@ -171,10 +172,13 @@ func LoggerMiddleware() gin.HandlerFunc {
 		// Force flush headers.
 		c.Writer.WriteHeaderNow()
 		latency := time.Since(start)
-		msg := FormatLogMessage(c, latency)
-		fmt.Println(msg)
+		if shouldLogAccess(c.Writer.Status()) {
+			msg := FormatLogMessage(c, latency)
+			// Access logs keep the LOG_FORMAT layout so log parsers can be tested against it.
+			fmt.Println(msg)
+		}
 		if len(c.Errors) > 0 {
-			fmt.Println("api error:", c.Errors.String())
+			logWarn("api error", zap.String("path", c.Request.URL.Path), zap.String("errors", c.Errors.String()))
 		}
 	}
 }
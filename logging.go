@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// appLogger writes the application logs (everything except access logs and the output of
+// /stress/logs, which keep their configured format). It is replaced by initLogger once the
+// configuration is read.
+var appLogger = newAppLogger("json", zapcore.InfoLevel)
+
+// newAppLogger returns a logger writing one entry per line to stdout, as JSON or in zap's
+// console format.
+func newAppLogger(encoding string, level zapcore.Level) *zap.Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.MessageKey = "message"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	if encoding == "console" {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), level)
+	return zap.New(core)
+}
+
+// initLogger configures the application logger from APP_LOG_ENCODING and APP_LOG_LEVEL.
+func initLogger(encoding, level string) {
+	lvl, err := zapcore.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		lvl = zapcore.InfoLevel
+	}
+	appLogger = newAppLogger(strings.ToLower(encoding), lvl)
+	if err != nil {
+		logWarn("invalid APP_LOG_LEVEL, defaulting to info", zap.String("level", level))
+	}
+}
+
+// logInfo logs an informational message with structured fields.
+func logInfo(msg string, fields ...zap.Field) {
+	appLogger.Info(msg, fields...)
+}
+
+// logWarn logs a warning with structured fields.
+func logWarn(msg string, fields ...zap.Field) {
+	appLogger.Warn(msg, fields...)
+}
+
+// logError logs an error with structured fields.
+func logError(msg string, fields ...zap.Field) {
+	appLogger.Error(msg, fields...)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -14,16 +15,30 @@ import (
 
 // LogsGeneratorPayload defines the payload for generating fake log messages.
 type LogsGeneratorPayload struct {
-	MaintainSecond      DuckInt `json:"maintain_second"`
-	LogCountPerInterval DuckInt `json:"log_count_per_interval"`
-	LinePerLog          DuckInt `json:"line_per_log"`
-	IntervalSeconds     DuckInt `json:"interval_seconds"`
-	Async               bool    `json:"async"`
+	MaintainSecond      DuckInt            `json:"maintain_second"`
+	LogCountPerInterval DuckInt            `json:"log_count_per_interval"`
+	LinePerLog          DuckInt            `json:"line_per_log"`
+	IntervalSeconds     DuckInt            `json:"interval_seconds"`
+	Template            string             `json:"template"`                    // See logTemplates, or mixed. Default access.
+	ErrorPattern        string             `json:"error_pattern"`               // See logErrorPatterns. Optional.
+	ErrorBurstSize      DuckInt            `json:"error_burst_size"`            // Entries of each burst, default 20.
+	ErrorBurstInterval  DuckInt            `json:"error_burst_interval_second"` // Default 60.
+	CorrelateFaults     bool               `json:"correlate_faults"`            // Log errors of the injected faults.
+	Format              string             `json:"format"`                      // access template: log_format (default), json, logfmt, clf or multiline.
+	Severity            map[string]DuckInt `json:"severity"`                    // access template: weights of info, warn and error.
+	BytesPerInterval    DuckInt            `json:"bytes_per_interval"`          // Bytes written each interval, instead of log_count_per_interval.
+	Async               bool               `json:"async"`
 }
 
 // GenerateRandomLogMessage creates a random log message using globalLogFormat
 // and random values for each placeholder.
 func GenerateRandomLogMessage() string {
+	return generateAccessLog(nil)
+}
+
+// generateAccessLog creates a log message using globalLogFormat, with the placeholders in
+// overrides set and random values for the others.
+func generateAccessLog(overrides map[string]string) string {
 	now := time.Now().UTC()
 	// Generate random values for each placeholder.
 	randomValues := map[string]string{
@@ -39,6 +54,9 @@ func GenerateRandomLogMessage() string {
 		"response_size": strconv.Itoa(rand.Intn(9900) + 100),
 		"cookies":       fmt.Sprintf("cookie1=value%d; cookie2=value%d", rand.Intn(1000), rand.Intn(1000)),
 	}
+	for key, val := range overrides {
+		randomValues[key] = val
+	}
 
 	// Use globalLogFormat.
 	format := globalLogFormat
@@ -96,50 +114,144 @@ func GenerateRandomLogMessage() string {
 // It generates random log messages using GenerateRandomLogMessage over time.
 func LogsGeneratorHandler(c *gin.Context) {
 	var payload LogsGeneratorPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
+	if payload.Template == "" {
+		payload.Template = logTemplateAccess
+	}
+	if _, ok := logTemplates[payload.Template]; !ok && payload.Template != logTemplateMixed {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD",
+			fmt.Sprintf("template must be one of %s or %s", strings.Join(logTemplateNames(logTemplates), ", "), logTemplateMixed))
+		return
+	}
+	if payload.Format == "" {
+		payload.Format = logFormatDefault
+	}
+	formatValid := false
+	for _, format := range logFormats {
+		formatValid = formatValid || payload.Format == format
+	}
+	if !formatValid {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "format must be one of "+strings.Join(logFormats, ", "))
+		return
+	}
+	if payload.Template != logTemplateAccess && (payload.Format != logFormatDefault || len(payload.Severity) > 0) {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "format and severity only apply to the access template")
+		return
+	}
+	weights := map[string]int{}
+	for severity, weight := range payload.Severity {
+		if _, ok := logSeverityStatuses[severity]; !ok || weight < 0 {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "severity must map info, warn and error to non-negative weights")
+			return
+		}
+		weights[severity] = int(weight)
+	}
+	errorPattern := logErrorPatterns[payload.ErrorPattern]
+	if payload.ErrorPattern != "" && errorPattern == nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD",
+			fmt.Sprintf("error_pattern must be one of %s", strings.Join(logTemplateNames(logErrorPatterns), ", ")))
+		return
+	}
+	if payload.ErrorBurstSize <= 0 {
+		payload.ErrorBurstSize = 20
+	}
+	if payload.ErrorBurstInterval <= 0 {
+		payload.ErrorBurstInterval = 60
+	}
 	maintainSec := int(payload.MaintainSecond)
 	logCountPerInterval := int(payload.LogCountPerInterval)
 	linePerLog := int(payload.LinePerLog)
 	intervalSec := int(payload.IntervalSeconds)
+	burstSize := int(payload.ErrorBurstSize)
+	burstInterval := time.Duration(payload.ErrorBurstInterval) * time.Second
+	bytesPerInterval := int64(payload.BytesPerInterval)
+	namespace := getNamespace(c)
+	var logCount, errorCount, byteCount int64
+
+	generate := func(now time.Time) string { return generateTemplateLog(payload.Template, now) }
+	if payload.Template == logTemplateAccess {
+		generate = func(now time.Time) string { return formatAccessLog(payload.Format, pickSeverity(weights), now) }
+	}
+	emit := func(line string) {
+		fmt.Println(line)
+		byteCount += int64(len(line)) + 1
+	}
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
 		interval := time.Duration(intervalSec) * time.Second
-		for time.Now().Before(endTime) {
-			for i := 0; i < logCountPerInterval; i++ {
+		nextBurst := time.Now()
+		for time.Now().Before(endTime) && ctx.Err() == nil {
+			// With bytes_per_interval, logs are written until the interval's bytes are reached.
+			intervalStart := byteCount
+			logs := 0
+			for ; bytesPerInterval > 0 && byteCount-intervalStart < bytesPerInterval ||
+				bytesPerInterval <= 0 && logs < logCountPerInterval; logs++ {
 				var lines []string
 				for j := 0; j < linePerLog; j++ {
-					lines = append(lines, GenerateRandomLogMessage())
+					lines = append(lines, generate(time.Now()))
 				}
 				combined := strings.Join(lines, "\n")
 				// Print the log message.
-				fmt.Println(combined)
+				emit(combined)
+				logCount++
+			}
+			// While error injection or downtime is active, the requests it fails are logged too.
+			if payload.CorrelateFaults {
+				jsonLines := payload.Template == logTemplateJSONApp || payload.Format == logFormatJSON
+				for _, line := range correlatedFaultLogs(jsonLines, namespace, logs, time.Now()) {
+					emit(line)
+					errorCount++
+				}
 			}
-			time.Sleep(interval)
+			// Error bursts start right away and repeat every error_burst_interval_second.
+			if errorPattern != nil && !time.Now().Before(nextBurst) {
+				for i := 0; i < burstSize; i++ {
+					emit(errorPattern(time.Now()))
+				}
+				errorCount += int64(burstSize)
+				nextBurst = nextBurst.Add(burstInterval)
+			}
+			sleepContext(ctx, interval)
 		}
-		fmt.Println("Logs generation completed")
+		logInfo("Logs generation completed")
 	}
 
+	result := map[string]interface{}{
+		"maintain_second":        maintainSec,
+		"log_count_per_interval": logCountPerInterval,
+		"line_per_log":           linePerLog,
+		"interval_seconds":       intervalSec,
+		"template":               payload.Template,
+		"correlate_faults":       payload.CorrelateFaults,
+	}
+	if payload.Template == logTemplateAccess {
+		result["format"] = payload.Format
+		if len(weights) > 0 {
+			result["severity"] = weights
+		}
+	}
+	if bytesPerInterval > 0 {
+		result["bytes_per_interval"] = bytesPerInterval
+	}
+	if errorPattern != nil {
+		result["error_pattern"] = payload.ErrorPattern
+		result["error_burst_size"] = burstSize
+		result["error_burst_interval_second"] = int(payload.ErrorBurstInterval)
+	}
 	if payload.Async {
-		go stressFunc()
-		ResponseJSON(c, http.StatusOK, map[string]interface{}{
-			"message":                "Logs generation started",
-			"maintain_second":        maintainSec,
-			"log_count_per_interval": logCountPerInterval,
-			"line_per_log":           linePerLog,
-			"interval_seconds":       intervalSec,
-		})
+		go job.run(stressFunc)
+		result["message"] = "Logs generation started"
 	} else {
-		stressFunc()
-		ResponseJSON(c, http.StatusOK, map[string]interface{}{
-			"message":                "Logs generation completed",
-			"maintain_second":        maintainSec,
-			"log_count_per_interval": logCountPerInterval,
-			"line_per_log":           linePerLog,
-			"interval_seconds":       intervalSec,
-		})
+		job.run(stressFunc)
+		result["message"] = "Logs generation completed"
+		result["logs"] = logCount
+		result["error_logs"] = errorCount
+		result["bytes"] = byteCount
 	}
+	ResponseJSON(c, http.StatusOK, result)
 }
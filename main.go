@@ -12,29 +12,68 @@ import (
 )
 
 func main() {
+	// Child processes spawned by /stress/processes re-execute this binary.
+	if runChildProcess() {
+		return
+	}
 	initConfig()
 
 	// Simulate startup delay based on STARTUP_DELAY_SECOND env variable.
 	startupDelay, err := processRandomInt(viper.GetString("STARTUP_DELAY_SECOND"), 1, 5) // default delay range 1-5 seconds
 	if err != nil {
-		fmt.Println("invalid STARTUP_DELAY_SECOND, defaulting to no delay", zap.Error(err))
+		logWarn("invalid STARTUP_DELAY_SECOND, defaulting to no delay", zap.Error(err))
 	} else {
-		fmt.Println("startup delay", zap.Int("delay", startupDelay))
+		logInfo("startup delay", zap.Int("delay", startupDelay))
 		time.Sleep(time.Duration(startupDelay) * time.Second)
 	}
 
+	// Fail startup when a required dependency is unreachable (STARTUP_DEPENDENCIES).
+	checkStartupDependencies()
+
+	// Measure this node to normalize stress parameters (CALIBRATION_ON_STARTUP).
+	calibrateOnStartup()
+
 	gin.SetMode(gin.ReleaseMode)
 
 	// Create a Gin router with custom middleware.
 	router := gin.New()
+	// Accept cleartext HTTP/2 (h2c) next to HTTP/1.x.
+	router.UseH2C = viper.GetBool("H2C_ENABLED")
 	router.Use(gin.Recovery())
+	router.Use(ServerTimingMiddleware())
 	router.Use(LoggerMiddleware())
+	router.Use(RequestMetricsMiddleware)
+	router.Use(EmergencyStopMiddleware)
+	router.Use(ConnectionChaosMiddleware)
+	router.Use(ResponseHeadersMiddleware)
+	router.Use(RequestDecompressionMiddleware)
 	router.Use(RequestBodyMiddleware())
+	router.Use(FormPayloadMiddleware)
+	router.Use(MirrorMiddleware)
+	router.Use(ChaosWindowMiddleware)
+	router.Use(NamespaceMiddleware)
+	router.Use(ConfigEventMiddleware)
+	router.Use(MaintenanceMiddleware)
+	router.Use(RequestTimeoutMiddleware)
+	router.Use(PortPersonaMiddleware)
 	router.Use(DowntimeMiddleware)
+	router.Use(AZFailureMiddleware)
+	router.Use(LoadSheddingMiddleware)
+	router.Use(QueueSimulationMiddleware)
 	router.Use(NetworkStressMiddleware)
 	router.Use(ErrorInjectionMiddleware)
+	router.Use(JobLimitMiddleware)
+	router.Use(JobMiddleware)
+	router.Use(NotificationMiddleware)
+	router.Use(StatePersistenceMiddleware)
+	router.Use(RollbackMiddleware)
+	router.Use(ProfilingMiddleware)
+	router.Use(SteadyStateMiddleware)
+	router.Use(ServerTimingHandlerStart)
+	router.Use(ProxyPassMiddleware)
 
-	router.StaticFS("/static", http.FS(staticContent))
+	router.GET("/static/*filepath", StaticHandler)
+	router.HEAD("/static/*filepath", StaticHandler)
 	router.GET("/", func(c *gin.Context) {
 		data, err := staticContent.ReadFile("static/index.html")
 		if err != nil {
@@ -49,59 +88,199 @@ func main() {
 	router.POST("/simple/bar", BarHandler)
 	router.GET("/simple/color", ColorHandler)
 	router.GET("/simple/large", LargeHandler)
+	router.GET("/simple/headers", HeadersHandler)
+	router.GET("/simple/large_headers", LargeHeadersHandler)
+	router.POST("/simple/slow_read", SlowReadHandler)
+	router.POST("/simple/upload", UploadHandler)
+	router.GET("/simple/render", RenderHandler)
+	router.GET("/simple/xml", XMLHandler)
+	router.POST("/simple/xml", XMLHandler)
+	router.GET("/simple/multipart", MultipartHandler)
+	router.GET("/work", WorkHandler)
+
+	router.GET("/protocol/http1_only", HTTP1OnlyHandler)
+	router.GET("/protocol/http10", HTTP10Handler)
+	router.GET("/protocol/upgrade", UpgradeHandler)
+	router.GET("/protocol/h2_streams", H2StreamsHandler)
 
 	router.GET("/healthcheck", HealthCheckHandler)
 	router.GET("/healthcheck/slow", SlowHealthCheckHandler)
+	router.GET("/healthcheck/live", LivenessHandler)
+	router.POST("/healthcheck/live/toggle", LivenessToggleHandler)
+	router.GET("/healthcheck/ready", ReadinessHandler)
+	router.POST("/healthcheck/ready/toggle", ReadinessToggleHandler)
 	router.GET("/healthcheck/external", ExternalHealthHandler)
 	router.POST("/healthcheck/relay", RelayHandler)
+	router.POST("/healthcheck/hops", RelayHandler)
 
 	router.GET("/metadata/all", MetadataAllHandler)
 	router.GET("/metadata/revision_color", RevisionColorHandler)
+	router.GET("/metadata/spot", SpotMetadataHandler)
 
 	router.POST("/stress/cpu", CPUStressHandler)
 	router.POST("/stress/memory", MemoryStressHandler)
 	router.POST("/stress/memory_leak", MemoryLeakHandler)
+	router.POST("/stress/stop_all", StopAllHandler)
+	router.POST("/stress/processes", ProcessStressHandler)
+	router.POST("/stress/entropy", EntropyStressHandler)
+	router.GET("/stress/tool", StressToolListHandler)
+	router.POST("/stress/tool", StressToolHandler)
 
 	router.POST("/stress/filesystem/write", FileWriteHandler)
 	router.POST("/stress/filesystem/read", FileReadHandler)
 	router.POST("/stress/network/latency", NetworkLatencyHandler)
 	router.POST("/stress/network/packet_loss", PacketLossHandler)
+	router.POST("/stress/egress_faults", EgressFaultsHandler)
+	router.GET("/stress/connections", ConnectionChaosStatusHandler)
+	router.POST("/stress/connections", ConnectionChaosHandler)
+	router.GET("/stress/mirror", MirrorStatusHandler)
+	router.POST("/stress/mirror", MirrorHandler)
+	router.GET("/stress/metrics_noise", MetricsNoiseStatusHandler)
+	router.POST("/stress/metrics_noise", MetricsNoiseHandler)
+	router.GET("/stress/label_explosion", LabelExplosionStatusHandler)
+	router.POST("/stress/label_explosion", LabelExplosionHandler)
+	router.POST("/stress/traces", TraceGeneratorHandler)
 
 	router.POST("/mysql/heavy", MySQLHeavyHandler)
 	router.POST("/mysql/multi_heavy", MySQLMultiHeavyHandler)
 	router.POST("/mysql/connection", MySQLConnectionHandler)
+	router.POST("/mysql/failover_probe", MySQLFailoverProbeHandler)
+	router.GET("/mysql/replication_lag", MySQLReplicationLagHandler)
 
 	router.POST("/postgres/heavy", PostgresHeavyHandler)
 	router.POST("/postgres/multi_heavy", PostgresMultiHeavyHandler)
 	router.POST("/postgres/connection", PostgresConnectionHandler)
+	router.POST("/postgres/failover_probe", PostgresFailoverProbeHandler)
+	router.GET("/postgres/replication_lag", PostgresReplicationLagHandler)
+	router.POST("/postgres/pinning", PostgresPinningHandler)
 
 	router.POST("/redshift/heavy", RedshiftHeavyHandler)
 	router.POST("/redshift/multi_heavy", RedshiftMultiHeavyHandler)
 	router.POST("/redshift/connection", RedshiftConnectionHandler)
+	router.POST("/redshift/workload", RedshiftWorkloadHandler)
 
 	router.POST("/redis/heavy", RedisHeavyHandler)
 	router.POST("/redis/multi_heavy", RedisMultiHeavyHandler)
 	router.POST("/redis/connection", RedisConnectionHandler)
+	router.POST("/redis/expiration_storm", RedisExpirationStormHandler)
 
 	router.POST("/kafka/heavy", KafkaHeavyHandler)
 	router.POST("/kafka/multi_heavy", KafkaMultiHeavyHandler)
 	router.POST("/kafka/connection", KafkaConnectionHandler)
+	router.GET("/kafka/verify", KafkaVerifyStatusHandler)
+	router.POST("/kafka/verify", KafkaVerifyHandler)
+
+	router.GET("/events", EventsHandler)
+	router.GET("/events/history", EventsHistoryHandler)
+
+	router.GET("/jobs", JobsHandler)
+	router.GET("/jobs/:id", JobHandler)
+	router.DELETE("/jobs/:id", JobCancelHandler)
+	router.GET("/jobs/:id/profiles", JobProfilesHandler)
+	router.GET("/jobs/:id/profiles/:name", JobProfileDownloadHandler)
+	router.GET("/jobs/:id/steady_state", JobSteadyStateHandler)
+
+	router.GET("/integrations/actions", OrchestratorActionListHandler)
+	router.GET("/integrations/actions/:id", OrchestratorActionStatusHandler)
+	router.PUT("/integrations/actions/:id", OrchestratorActionStartHandler)
+	router.DELETE("/integrations/actions/:id", OrchestratorActionStopHandler)
+	router.POST("/integrations/actions/:id/start", OrchestratorActionStartHandler)
+	router.POST("/integrations/actions/:id/stop", OrchestratorActionStopHandler)
+	router.POST("/integrations/webhook", ChaosWebhookHandler)
+
+	router.POST("/scenario/run", ScenarioRunHandler)
+	router.GET("/scenario/runs", ScenarioRunsHandler)
+	router.GET("/scenario/runs/:id", ScenarioStatusHandler)
+
+	router.POST("/smtp/heavy", SMTPHeavyHandler)
+	router.POST("/sftp/heavy", SFTPHeavyHandler)
 
 	router.POST("/stress/error_injection", ErrorInjectionHandler)
+	router.POST("/stress/slo_burn", SLOBurnHandler)
 	router.POST("/stress/crash", CrashSimulationHandler)
+	router.POST("/stress/spot_interruption", SpotInterruptionHandler)
+	router.GET("/stress/az_failure", AZFailureStatusHandler)
+	router.POST("/stress/az_failure", AZFailureHandler)
 
 	router.POST("/stress/concurrent_flood", ConcurrentFloodHandler)
 	router.POST("/stress/downtime", DowntimeHandler)
+	router.POST("/stress/load_shedding", LoadSheddingHandler)
+	router.POST("/stress/queue", QueueSimulationHandler)
 	router.POST("/stress/third_party", ThirdPartyHandler)
+	router.POST("/stress/retry_storm", RetryStormHandler)
+	router.POST("/stress/thundering_herd", ThunderingHerdHandler)
 	router.POST("/stress/ddos", DDoSHandler)
+	router.POST("/stress/graphql", GraphQLStressHandler)
 
 	router.GET("/metrics/system", SystemMetricsHandler)
+	router.GET("/metrics/prometheus", PrometheusMetricsHandler)
+	router.GET("/stress/state", FaultStateHandler)
 	router.POST("/stress/logs", LogsGeneratorHandler)
 
+	router.POST("/traffic/baseline", BaselineTrafficHandler)
+	router.POST("/traffic/journey", JourneyHandler)
+	router.POST("/traffic/replay", TrafficReplayHandler)
+
+	router.POST("/simulate/fanout", FanoutHandler)
+
+	router.GET("/mock/behavior", MockStatusHandler)
+	router.POST("/mock/behavior", MockBehaviorHandler)
+
+	router.GET("/proxy", ProxyListHandler)
+	router.POST("/proxy", ProxyCreateHandler)
+	router.POST("/proxy/:name/toxics", ProxyToxicsHandler)
+	router.DELETE("/proxy/:name", ProxyDeleteHandler)
+
+	router.GET("/admin/window", ChaosWindowStatusHandler)
+	router.POST("/admin/window", ChaosWindowOpenHandler)
+	router.DELETE("/admin/window", ChaosWindowCloseHandler)
+	router.GET("/admin/maintenance", MaintenanceStatusHandler)
+	router.POST("/admin/maintenance", MaintenanceHandler)
+	router.DELETE("/admin/maintenance", MaintenanceDisableHandler)
+	router.GET("/admin/namespaces", NamespaceListHandler)
+	router.GET("/admin/timeouts", RequestTimeoutStatusHandler)
+	router.POST("/admin/timeouts", RequestTimeoutHandler)
+	router.DELETE("/admin/timeouts", RequestTimeoutResetHandler)
+	router.GET("/admin/ports", PortPersonaStatusHandler)
+	router.POST("/admin/ports", PortPersonaHandler)
+	router.GET("/admin/access_log", AccessLogStatusHandler)
+	router.POST("/admin/access_log", AccessLogHandler)
+	router.DELETE("/admin/access_log", AccessLogResetHandler)
+	router.GET("/admin/response_headers", ResponseHeadersStatusHandler)
+	router.POST("/admin/response_headers", ResponseHeadersHandler)
+	router.DELETE("/admin/response_headers", ResponseHeadersDeleteHandler)
+	router.GET("/admin/proxy_pass", ProxyPassStatusHandler)
+	router.POST("/admin/proxy_pass", ProxyPassHandler)
+	router.DELETE("/admin/proxy_pass", ProxyPassDeleteHandler)
+	router.POST("/admin/selftest", SelfTestHandler)
+	router.GET("/admin/config", ConfigHandler)
+	router.GET("/admin/state/export", StateExportHandler)
+	router.POST("/admin/state/import", StateImportHandler)
+	router.GET("/admin/calibrate", CalibrationStatusHandler)
+	router.POST("/admin/calibrate", CalibrateHandler)
+	router.DELETE("/admin/calibrate", CalibrationResetHandler)
+
+	startMockServers()
+	applyAZFailureLabels()
+	startReadinessChecker()
+	initRequestTimeouts()
+
 	// Determine port using environment variable (with RANDOM support).
 	port := processPort()
-	fmt.Println("starting server", zap.Int("port", port))
-	router.Run(":" + intToString(port))
+	listenPort = port
+	logInfo("starting server", zap.Int("port", port))
+	startSmokeTest(port)
+	restoreState(port)
+	server := &http.Server{
+		Addr:      ":" + intToString(port),
+		Handler:   router.Handler(),
+		ConnState: trackConnState,
+	}
+	serveUnixSocket(server)
+	servePersonaPorts(port, server.Handler)
+	if err := server.ListenAndServe(); err != nil {
+		logError("server stopped", zap.Error(err))
+	}
 }
 
 // intToString converts an int to a string.
@@ -110,23 +289,31 @@ func intToString(i int) string {
 }
 
 // NetworkStressMiddleware applies active network latency and packet loss simulation.
+// Requests of a namespace use the namespace's settings while they are active.
 func NetworkStressMiddleware(c *gin.Context) {
-	// Check if network latency is active.
-	networkStressMutex.Lock()
-	latency := activeLatencyMs
-	latencyExpires := latencyExpiry
-	loss := activePacketLoss
-	lossExpires := packetLossExpiry
-	networkStressMutex.Unlock()
-
 	now := time.Now()
-	if now.Before(latencyExpires) && latency > 0 {
-		// Delay the request processing.
-		time.Sleep(time.Duration(latency) * time.Millisecond)
+	faults := faultState.Effective(getNamespace(c), now)
+	latency := faults.latency(now)
+	loss := faults.packetLoss(now)
+	if latency > 0 {
+		// Delay the request (or only its response) and record the delay actually added.
+		markInjectedFault(c, "latency")
+		done, ok := injectLatency(c, time.Duration(latency)*time.Millisecond, faults.LatencyMode)
+		defer done()
+		if !ok {
+			c.Abort()
+			return
+		}
+		if c.Request.Context().Err() != nil {
+			// The client went away while the request was delayed.
+			c.Abort()
+			return
+		}
 	}
-	if now.Before(lossExpires) && loss > 0 {
+	if loss > 0 {
 		// Simulate packet loss: drop the request with the given probability.
 		if rand.Intn(100) < loss {
+			markInjectedFault(c, "packet_loss")
 			c.AbortWithStatusJSON(503, gin.H{
 				"error":        "SERVICE_UNAVAILABLE",
 				"message":      "simulated packet loss, request dropped",
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MaintenancePayload defines the payload for enabling maintenance mode.
+type MaintenancePayload struct {
+	Format           string  `json:"format"`      // auto (default, by Accept header), html or json.
+	StatusCode       DuckInt `json:"status_code"` // Default 503.
+	RetryAfterSecond DuckInt `json:"retry_after_second"`
+	Message          string  `json:"message"`
+	Label            string  `json:"label"` // Who/why, e.g. a change ticket.
+	HTML             string  `json:"html"`  // Custom page; {{message}} is replaced by the escaped message.
+}
+
+// Global variables for maintenance mode.
+var (
+	maintenanceMutex   sync.Mutex
+	maintenanceActive  bool
+	maintenanceConfig  MaintenancePayload
+	maintenanceStarted time.Time
+)
+
+// maintenanceStatus returns the current maintenance mode state.
+func maintenanceStatus() gin.H {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	status := gin.H{"enabled": maintenanceActive}
+	if maintenanceActive {
+		status["format"] = maintenanceConfig.Format
+		status["status_code"] = int(maintenanceConfig.StatusCode)
+		status["retry_after_second"] = int(maintenanceConfig.RetryAfterSecond)
+		status["maintenance_message"] = maintenanceConfig.Message
+		status["label"] = maintenanceConfig.Label
+		status["custom_html"] = maintenanceConfig.HTML != ""
+		status["enabled_at"] = maintenanceStarted.UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+// MaintenanceStatusHandler handles GET /admin/maintenance.
+func MaintenanceStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, maintenanceStatus())
+}
+
+// MaintenanceHandler handles POST /admin/maintenance.
+// It puts every non-health route into maintenance until DELETE /admin/maintenance is called.
+// Unlike the downtime simulation it has no duration and is labeled as deliberate.
+func MaintenanceHandler(c *gin.Context) {
+	var payload MaintenancePayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.Format == "" {
+		payload.Format = "auto"
+	}
+	if payload.Format != "auto" && payload.Format != "html" && payload.Format != "json" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "format must be auto, html or json")
+		return
+	}
+	if payload.StatusCode == 0 {
+		payload.StatusCode = http.StatusServiceUnavailable
+	}
+	if payload.StatusCode < 100 || payload.StatusCode > 599 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "status_code must be between 100 and 599")
+		return
+	}
+	if payload.RetryAfterSecond <= 0 {
+		payload.RetryAfterSecond = 300
+	}
+	if payload.Message == "" {
+		payload.Message = "The service is under scheduled maintenance. Please try again later."
+	}
+
+	maintenanceMutex.Lock()
+	maintenanceActive = true
+	maintenanceConfig = payload
+	maintenanceStarted = time.Now()
+	maintenanceMutex.Unlock()
+	logInfo("Maintenance mode enabled",
+		zap.String("label", payload.Label),
+		zap.Int("status_code", int(payload.StatusCode)))
+
+	status := maintenanceStatus()
+	status["message"] = "maintenance mode enabled"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// MaintenanceDisableHandler handles DELETE /admin/maintenance.
+func MaintenanceDisableHandler(c *gin.Context) {
+	maintenanceMutex.Lock()
+	wasActive := maintenanceActive
+	maintenanceActive = false
+	started := maintenanceStarted
+	maintenanceMutex.Unlock()
+	if wasActive {
+		logInfo("Maintenance mode disabled", zap.Duration("enabled_for", time.Since(started)))
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message": "maintenance mode disabled",
+		"enabled": false,
+	})
+}
+
+// MaintenanceMiddleware serves the maintenance response while maintenance mode is enabled.
+// Health checks and /admin/ stay reachable so the instance is not replaced and the mode can be turned off.
+func MaintenanceMiddleware(c *gin.Context) {
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/healthcheck") || strings.HasPrefix(path, "/admin/") {
+		c.Next()
+		return
+	}
+	maintenanceMutex.Lock()
+	active := maintenanceActive
+	config := maintenanceConfig
+	maintenanceMutex.Unlock()
+	if !active {
+		c.Next()
+		return
+	}
+
+	c.Header("Retry-After", intToString(int(config.RetryAfterSecond)))
+	c.Header("X-Maintenance", "true")
+	format := config.Format
+	if format == "auto" {
+		format = "json"
+		if strings.Contains(c.GetHeader("Accept"), "text/html") {
+			format = "html"
+		}
+	}
+	if format == "html" {
+		page := config.HTML
+		if page == "" {
+			data, _ := staticContent.ReadFile("static/maintenance.html")
+			page = string(data)
+		}
+		page = strings.ReplaceAll(page, "{{message}}", html.EscapeString(config.Message))
+		c.Data(int(config.StatusCode), "text/html; charset=utf-8", []byte(page))
+		c.Abort()
+		return
+	}
+	c.AbortWithStatusJSON(int(config.StatusCode), gin.H{
+		"error":              "MAINTENANCE",
+		"message":            config.Message,
+		"label":              config.Label,
+		"retry_after_second": int(config.RetryAfterSecond),
+		"requested_at":       time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
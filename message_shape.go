@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MessageSizeSpec defines the size distribution of generated messages in bytes. Sizes are
+// interpolated linearly between the given percentiles; omitted percentiles are skipped.
+type MessageSizeSpec struct {
+	Min DuckInt `json:"min"`
+	P50 DuckInt `json:"p50"`
+	P90 DuckInt `json:"p90"`
+	P99 DuckInt `json:"p99"`
+	Max DuckInt `json:"max"`
+}
+
+// maxShapedMessageSize bounds generated messages, well above the default broker limit of 1 MiB.
+const maxShapedMessageSize = 10 << 20
+
+// randomAlphabet holds the characters of random content: printable, so the content survives
+// JSON envelopes, with 6 bits of entropy per byte.
+const randomAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// messageShaper generates message contents following a size distribution and a target
+// compression ratio, and counts what it generated.
+type messageShaper struct {
+	quantiles      []float64
+	sizes          []int
+	ratio          float64
+	randomFraction float64 // Share of random content per message.
+	random         []byte  // Random content; messages start at random offsets of it.
+	filler         []byte  // Repetitive content.
+	estimate       float64 // Measured gzip compression ratio.
+
+	count    int64
+	bytes    int64
+	minBytes int64
+	maxBytes int64
+}
+
+// newMessageShaper returns a shaper for spec and compression ratio (default 1, random
+// content), or nil when neither is set so the workload keeps its message.
+func newMessageShaper(spec *MessageSizeSpec, ratio DuckFloat) (*messageShaper, error) {
+	if spec == nil && ratio == 0 {
+		return nil, nil
+	}
+	if spec == nil {
+		spec = &MessageSizeSpec{Min: 1024, Max: 1024}
+	}
+	if ratio == 0 {
+		ratio = 1
+	}
+	if ratio < 1 {
+		return nil, fmt.Errorf("compression_ratio must be at least 1")
+	}
+	if spec.Max <= 0 || spec.Max > maxShapedMessageSize || spec.Min < 0 || spec.Min > spec.Max {
+		return nil, fmt.Errorf("message_size needs 0 <= min <= max <= %d", maxShapedMessageSize)
+	}
+	s := &messageShaper{ratio: float64(ratio), minBytes: -1}
+	for _, p := range []struct {
+		q    float64
+		size DuckInt
+	}{{0, spec.Min}, {0.5, spec.P50}, {0.9, spec.P90}, {0.99, spec.P99}, {1, spec.Max}} {
+		if p.size == 0 && p.q != 0 {
+			continue
+		}
+		if n := len(s.sizes); n > 0 && int(p.size) < s.sizes[n-1] {
+			return nil, fmt.Errorf("message_size percentiles must not decrease")
+		}
+		s.quantiles = append(s.quantiles, p.q)
+		s.sizes = append(s.sizes, int(p.size))
+	}
+
+	// Twice the largest message, so that random offsets still give distinct contents.
+	poolSize := 2 * max(int(spec.Max), calibrationSize)
+	s.random = make([]byte, poolSize)
+	for i := range s.random {
+		s.random[i] = randomAlphabet[rand.Intn(len(randomAlphabet))]
+	}
+	phrase := "Lorem ipsum dolor sit amet, consectetur adipiscing elit. "
+	s.filler = []byte(strings.Repeat(phrase, poolSize/2/len(phrase)+1))
+	s.calibrate()
+	return s, nil
+}
+
+// calibrationSize is the sample size the compression ratio is calibrated on, about the size
+// of a producer batch.
+const calibrationSize = 64 << 10
+
+// calibrate searches the share of random content whose gzip compression ratio matches the
+// target, since it depends on the codec rather than on the share alone. A ratio of 1 keeps
+// the content fully random.
+func (s *messageShaper) calibrate() {
+	s.randomFraction = 1
+	s.estimate = s.measureRatio()
+	if s.ratio == 1 || s.estimate >= s.ratio {
+		return
+	}
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 12; i++ {
+		s.randomFraction = (lo + hi) / 2
+		if s.estimate = s.measureRatio(); s.estimate > s.ratio {
+			lo = s.randomFraction
+		} else {
+			hi = s.randomFraction
+		}
+	}
+}
+
+// measureRatio returns the gzip compression ratio of a calibration sample.
+func (s *messageShaper) measureRatio() float64 {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(s.content(calibrationSize))
+	w.Close()
+	return float64(calibrationSize) / float64(buf.Len())
+}
+
+// size returns the message size at quantile q.
+func (s *messageShaper) size(q float64) int {
+	for i := 1; i < len(s.quantiles); i++ {
+		if q <= s.quantiles[i] {
+			lo, hi := s.quantiles[i-1], s.quantiles[i]
+			return s.sizes[i-1] + int((q-lo)/(hi-lo)*float64(s.sizes[i]-s.sizes[i-1]))
+		}
+	}
+	return s.sizes[len(s.sizes)-1]
+}
+
+// content returns a message of n bytes: random characters followed by repetitive filler.
+func (s *messageShaper) content(n int) []byte {
+	randomLen := int(float64(n) * s.randomFraction)
+	msg := make([]byte, 0, n)
+	offset := rand.Intn(len(s.random) - randomLen + 1)
+	msg = append(msg, s.random[offset:offset+randomLen]...)
+	return append(msg, s.filler[:n-randomLen]...)
+}
+
+// next returns the content of the next message.
+func (s *messageShaper) next() string {
+	n := s.size(rand.Float64())
+	atomic.AddInt64(&s.count, 1)
+	atomic.AddInt64(&s.bytes, int64(n))
+	atomicMax(&s.maxBytes, int64(n))
+	for {
+		prev := atomic.LoadInt64(&s.minBytes)
+		if (prev >= 0 && int64(n) >= prev) || atomic.CompareAndSwapInt64(&s.minBytes, prev, int64(n)) {
+			break
+		}
+	}
+	return string(s.content(n))
+}
+
+// toMap reports the generated message sizes and the estimated compression ratio.
+func (s *messageShaper) toMap() gin.H {
+	if s == nil {
+		return gin.H{"shaped": false}
+	}
+	count := atomic.LoadInt64(&s.count)
+	avg := 0.0
+	if count > 0 {
+		avg = float64(atomic.LoadInt64(&s.bytes)) / float64(count)
+	}
+	return gin.H{
+		"shaped":                      true,
+		"messages":                    count,
+		"bytes":                       atomic.LoadInt64(&s.bytes),
+		"min_bytes":                   max(0, atomic.LoadInt64(&s.minBytes)),
+		"max_bytes":                   atomic.LoadInt64(&s.maxBytes),
+		"avg_bytes":                   avg,
+		"target_compression_ratio":    s.ratio,
+		"estimated_compression_ratio": s.estimate,
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Value distributions of the synthetic metrics.
+const (
+	noiseDistributionUniform     = "uniform"
+	noiseDistributionNormal      = "normal"
+	noiseDistributionExponential = "exponential"
+	noiseDistributionSine        = "sine"
+)
+
+// MetricsNoisePayload defines the payload for the synthetic metrics generator.
+type MetricsNoisePayload struct {
+	MetricCount         DuckInt   `json:"metric_count"`          // Metric names, default 10.
+	SeriesPerMetric     DuckInt   `json:"series_per_metric"`     // Series of each metric, default 100.
+	LabelCount          DuckInt   `json:"label_count"`           // Labels of each series, default 3.
+	ChurnPercent        DuckInt   `json:"churn_percent"`         // Series replaced with new label values each interval.
+	ChurnIntervalSecond DuckInt   `json:"churn_interval_second"` // Default 60.
+	Type                string    `json:"type"`                  // gauge (default) or counter.
+	Distribution        string    `json:"distribution"`          // uniform (default), normal, exponential or sine.
+	Min                 DuckFloat `json:"min"`                   // uniform and sine, default 0.
+	Max                 DuckFloat `json:"max"`                   // uniform and sine, default 100.
+	Mean                DuckFloat `json:"mean"`                  // normal and exponential, default 50.
+	StdDev              DuckFloat `json:"stddev"`                // normal, default 10.
+	MaintainSecond      DuckInt   `json:"maintain_second"`
+	Async               bool      `json:"async"`
+}
+
+// maxMetricsNoiseLabels bounds label_count, which is rendered for every series on every scrape.
+const maxMetricsNoiseLabels = 32
+
+// metricsNoise is an active set of synthetic metrics. Every series is identified by a unique
+// id that gives its label values; churning a series gives it a new id, hence a new series.
+type metricsNoise struct {
+	payload     MetricsNoisePayload
+	metricCount int
+	seriesCount int
+	labelCount  int
+	startedAt   time.Time
+	expiry      time.Time
+
+	mutex    sync.Mutex
+	ids      [][]uint64  // Per metric, the id of each series.
+	counters [][]float64 // Per metric, the value of each counter series.
+	nextID   uint64
+	churned  int64
+	scrapes  int64
+}
+
+// Global variables for the synthetic metrics.
+var (
+	metricsNoiseMutex  sync.Mutex
+	activeMetricsNoise *metricsNoise
+)
+
+// sample draws a value from the configured distribution.
+func (n *metricsNoise) sample(now time.Time) float64 {
+	p := n.payload
+	switch p.Distribution {
+	case noiseDistributionNormal:
+		return float64(p.Mean) + rand.NormFloat64()*float64(p.StdDev)
+	case noiseDistributionExponential:
+		return rand.ExpFloat64() * float64(p.Mean)
+	case noiseDistributionSine:
+		// One period per churn interval, so recording rules see a regular wave.
+		phase := 2 * math.Pi * now.Sub(n.startedAt).Seconds() / float64(p.ChurnIntervalSecond)
+		return float64(p.Min) + (float64(p.Max)-float64(p.Min))*(1+math.Sin(phase))/2
+	}
+	return float64(p.Min) + rand.Float64()*(float64(p.Max)-float64(p.Min))
+}
+
+// churn replaces churn_percent of the series of every metric with new ones, in rotation.
+func (n *metricsNoise) churn(round int) {
+	k := n.seriesCount * int(n.payload.ChurnPercent) / 100
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for m := range n.ids {
+		for j := 0; j < k; j++ {
+			i := (round*k + j) % n.seriesCount
+			n.ids[m][i] = n.nextID
+			n.counters[m][i] = 0
+			n.nextID++
+		}
+	}
+	n.churned += int64(k * n.metricCount)
+}
+
+// labels returns the label set of the series with id.
+func (n *metricsNoise) labels(id uint64) string {
+	parts := make([]string, n.labelCount)
+	parts[0] = fmt.Sprintf(`series="s%d"`, id)
+	for j := 1; j < n.labelCount; j++ {
+		parts[j] = fmt.Sprintf(`label_%d="v%d"`, j, id%uint64(j*10))
+	}
+	return strings.Join(parts, ",")
+}
+
+// write appends the synthetic metrics to a Prometheus exposition.
+func (n *metricsNoise) write(b *strings.Builder, openMetrics bool) {
+	now := time.Now()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.scrapes++
+	for m := 0; m < n.metricCount; m++ {
+		name := fmt.Sprintf("biggie_noise_metric_%d", m)
+		family, sampleName := name, name
+		if n.payload.Type == "counter" {
+			sampleName = name + "_total"
+			if !openMetrics {
+				family = sampleName
+			}
+		}
+		fmt.Fprintf(b, "# HELP %s Synthetic metric from /stress/metrics_noise.\n", family)
+		fmt.Fprintf(b, "# TYPE %s %s\n", family, n.payload.Type)
+		for i, id := range n.ids[m] {
+			value := n.sample(now)
+			if n.payload.Type == "counter" {
+				n.counters[m][i] += math.Abs(value)
+				value = n.counters[m][i]
+			}
+			fmt.Fprintf(b, "%s{%s} %s\n", sampleName, n.labels(id), formatMetricValue(value))
+		}
+	}
+}
+
+// toMap returns the settings and counters of the generator.
+func (n *metricsNoise) toMap() gin.H {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return gin.H{
+		"metric_count":          n.metricCount,
+		"series_per_metric":     n.seriesCount,
+		"series":                n.metricCount * n.seriesCount,
+		"label_count":           n.labelCount,
+		"type":                  n.payload.Type,
+		"distribution":          n.payload.Distribution,
+		"churn_percent":         int(n.payload.ChurnPercent),
+		"churn_interval_second": int(n.payload.ChurnIntervalSecond),
+		"churned_series":        n.churned,
+		"scrapes":               n.scrapes,
+	}
+}
+
+// writeMetricsNoise appends the active synthetic metrics, if any, to a Prometheus exposition.
+func writeMetricsNoise(b *strings.Builder, openMetrics bool) {
+	metricsNoiseMutex.Lock()
+	n := activeMetricsNoise
+	metricsNoiseMutex.Unlock()
+	if n != nil && time.Now().Before(n.expiry) {
+		n.write(b, openMetrics)
+	}
+}
+
+// metricsNoiseStatus returns the state of the current (or last) generator.
+func metricsNoiseStatus() gin.H {
+	metricsNoiseMutex.Lock()
+	n := activeMetricsNoise
+	metricsNoiseMutex.Unlock()
+	if n == nil {
+		return gin.H{"active": false}
+	}
+	status := n.toMap()
+	status["active"] = time.Now().Before(n.expiry)
+	status["remaining_second"] = remainingSecond(time.Now(), n.expiry)
+	return status
+}
+
+// MetricsNoiseStatusHandler handles GET /stress/metrics_noise.
+func MetricsNoiseStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, metricsNoiseStatus())
+}
+
+// MetricsNoiseHandler handles POST /stress/metrics_noise.
+// For maintain_second, GET /metrics/prometheus also exposes metric_count synthetic metrics of
+// series_per_metric series each, whose values follow the given distribution and of which
+// churn_percent get new label values every churn_interval_second, so cardinality limits and
+// recording rules of the monitoring system can be stress tested. A new request replaces the
+// current generator.
+func MetricsNoiseHandler(c *gin.Context) {
+	var payload MetricsNoisePayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.MetricCount <= 0 {
+		payload.MetricCount = 10
+	}
+	if payload.SeriesPerMetric <= 0 {
+		payload.SeriesPerMetric = 100
+	}
+	if payload.LabelCount <= 0 {
+		payload.LabelCount = 3
+	}
+	if payload.ChurnIntervalSecond <= 0 {
+		payload.ChurnIntervalSecond = 60
+	}
+	if payload.ChurnPercent < 0 || payload.ChurnPercent > 100 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "churn_percent must be between 0 and 100")
+		return
+	}
+	if payload.Type == "" {
+		payload.Type = "gauge"
+	}
+	if payload.Type != "gauge" && payload.Type != "counter" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "type must be gauge or counter")
+		return
+	}
+	switch payload.Distribution {
+	case "":
+		payload.Distribution = noiseDistributionUniform
+	case noiseDistributionUniform, noiseDistributionNormal, noiseDistributionExponential, noiseDistributionSine:
+	default:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "distribution must be uniform, normal, exponential or sine")
+		return
+	}
+	if payload.Min == 0 && payload.Max == 0 {
+		payload.Max = 100
+	}
+	if payload.Mean == 0 {
+		payload.Mean = 50
+	}
+	if payload.StdDev == 0 {
+		payload.StdDev = 10
+	}
+	if payload.LabelCount > maxMetricsNoiseLabels {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("label_count must not exceed %d", maxMetricsNoiseLabels))
+		return
+	}
+	metricCount, seriesCount := int(payload.MetricCount), int(payload.SeriesPerMetric)
+	// Each factor is checked on its own first, so the product cannot overflow.
+	if maxSeries := viper.GetInt("METRICS_NOISE_MAX_SERIES"); metricCount > maxSeries || seriesCount > maxSeries ||
+		metricCount*seriesCount > maxSeries {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD",
+			fmt.Sprintf("metric_count x series_per_metric must not exceed %d (METRICS_NOISE_MAX_SERIES)", maxSeries))
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	n := &metricsNoise{
+		payload:     payload,
+		metricCount: metricCount,
+		seriesCount: seriesCount,
+		labelCount:  int(payload.LabelCount),
+		startedAt:   time.Now(),
+		expiry:      time.Now().Add(time.Duration(maintainSec) * time.Second),
+		ids:         make([][]uint64, metricCount),
+		counters:    make([][]float64, metricCount),
+	}
+	for m := range n.ids {
+		n.ids[m] = make([]uint64, seriesCount)
+		n.counters[m] = make([]float64, seriesCount)
+		for i := range n.ids[m] {
+			n.ids[m][i] = n.nextID
+			n.nextID++
+		}
+	}
+	metricsNoiseMutex.Lock()
+	activeMetricsNoise = n
+	metricsNoiseMutex.Unlock()
+	recordFaultActivated("metrics_noise", "", gin.H{
+		"series":        metricCount * seriesCount,
+		"churn_percent": int(payload.ChurnPercent),
+	}, n.expiry)
+	logInfo("Metrics noise started",
+		zap.Int("metric_count", metricCount),
+		zap.Int("series_per_metric", seriesCount),
+		zap.Int("churn_percent", int(payload.ChurnPercent)),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	runFunc := func(ctx context.Context) {
+		ticker := time.NewTicker(time.Duration(payload.ChurnIntervalSecond) * time.Second)
+		defer ticker.Stop()
+		done := time.After(time.Until(n.expiry))
+		for round := 0; ; round++ {
+			select {
+			case <-ticker.C:
+				metricsNoiseMutex.Lock()
+				replaced := activeMetricsNoise != n
+				metricsNoiseMutex.Unlock()
+				if replaced {
+					return
+				}
+				if payload.ChurnPercent > 0 {
+					n.churn(round)
+				}
+			case <-done:
+				logInfo("Metrics noise ended", zap.Any("results", n.toMap()))
+				return
+			case <-ctx.Done():
+				metricsNoiseMutex.Lock()
+				ours := activeMetricsNoise == n
+				if ours {
+					activeMetricsNoise = nil
+				}
+				metricsNoiseMutex.Unlock()
+				if ours {
+					recordFaultDeactivated("metrics_noise", "", "cancelled")
+				}
+				return
+			}
+		}
+	}
+
+	result := n.toMap()
+	result["maintain_second"] = maintainSec
+	if payload.Async {
+		go job.run(runFunc)
+		result["message"] = "metrics noise started"
+	} else {
+		job.run(runFunc)
+		result = n.toMap()
+		result["maintain_second"] = maintainSec
+		result["message"] = "metrics noise completed"
+	}
+	ResponseJSON(c, http.StatusOK, result)
+}
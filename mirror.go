@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// mirrorHeader marks mirrored requests, so a mirror pointing back at Biggie does not loop.
+const mirrorHeader = "X-Biggie-Mirror"
+
+// MirrorPayload defines the payload for request mirroring.
+type MirrorPayload struct {
+	TargetURL      string  `json:"target_url"`    // Base URL; the original path and query are appended.
+	Percent        DuckInt `json:"percent"`       // Percentage of incoming requests mirrored, default 100.
+	TimeoutMs      DuckInt `json:"timeout_ms"`    // Per mirrored request, default 5000.
+	MaxInFlight    DuckInt `json:"max_in_flight"` // Mirrored requests in flight; more are dropped. Default 100.
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+}
+
+// requestMirror is an active mirroring configuration with its counters.
+type requestMirror struct {
+	target   *url.URL
+	percent  int
+	client   *http.Client
+	inFlight chan struct{}
+	expiry   time.Time
+
+	mirrored   int64
+	succeeded  int64 // Answered with a status < 500.
+	failed     int64 // Transport errors and 5xx answers.
+	dropped    int64 // Skipped because max_in_flight was reached.
+	durationNs int64
+}
+
+func (m *requestMirror) toMap() gin.H {
+	mirrored := atomic.LoadInt64(&m.mirrored)
+	avgMs := 0.0
+	if done := atomic.LoadInt64(&m.succeeded) + atomic.LoadInt64(&m.failed); done > 0 {
+		avgMs = float64(atomic.LoadInt64(&m.durationNs)) / float64(done) / 1e6
+	}
+	return gin.H{
+		"mirrored":        mirrored,
+		"succeeded":       atomic.LoadInt64(&m.succeeded),
+		"failed":          atomic.LoadInt64(&m.failed),
+		"dropped":         atomic.LoadInt64(&m.dropped),
+		"avg_duration_ms": avgMs,
+	}
+}
+
+// Global variables for request mirroring.
+var (
+	mirrorMutex  sync.Mutex
+	activeMirror *requestMirror
+)
+
+// MirrorHandler handles POST /stress/mirror.
+// For maintain_second it copies percent of the incoming requests to target_url in the
+// background. The responses of the mirror are discarded; only their outcome is counted,
+// so traffic shadowing and its overhead can be demonstrated.
+func MirrorHandler(c *gin.Context) {
+	var payload MirrorPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	target, err := url.Parse(payload.TargetURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "target_url must be an http or https url")
+		return
+	}
+	if err := checkTargetAllowed(payload.TargetURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	percent := int(payload.Percent)
+	if percent <= 0 || percent > 100 {
+		percent = 100
+	}
+	timeoutMs := int(payload.TimeoutMs)
+	if timeoutMs <= 0 {
+		timeoutMs = 5000
+	}
+	maxInFlight := int(payload.MaxInFlight)
+	if maxInFlight <= 0 {
+		maxInFlight = 100
+	}
+	client, err := newOutboundClient(time.Duration(timeoutMs)*time.Millisecond, connectionModeReuse, "")
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	m := &requestMirror{
+		target:   target,
+		percent:  percent,
+		client:   client,
+		inFlight: make(chan struct{}, maxInFlight),
+		expiry:   time.Now().Add(time.Duration(maintainSec) * time.Second),
+	}
+	mirrorMutex.Lock()
+	activeMirror = m
+	mirrorMutex.Unlock()
+	recordFaultActivated("mirror", "", gin.H{"target_url": payload.TargetURL, "percent": percent}, m.expiry)
+	logInfo("Request mirroring started",
+		zap.String("target_url", payload.TargetURL),
+		zap.Int("percent", percent),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the mirroring unless a later request replaced it.
+			mirrorMutex.Lock()
+			ours := activeMirror == m
+			if ours {
+				activeMirror = nil
+			}
+			mirrorMutex.Unlock()
+			if ours {
+				recordFaultDeactivated("mirror", "", "cancelled")
+			}
+		}
+		logInfo("Request mirroring ended", zap.Any("results", m.toMap()))
+	}
+
+	if payload.Async {
+		go job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "request mirroring started",
+			"target_url":      payload.TargetURL,
+			"percent":         percent,
+			"max_in_flight":   maxInFlight,
+			"maintain_second": maintainSec,
+		})
+	} else {
+		job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "request mirroring completed",
+			"target_url":      payload.TargetURL,
+			"percent":         percent,
+			"max_in_flight":   maxInFlight,
+			"maintain_second": maintainSec,
+			"results":         m.toMap(),
+		})
+	}
+}
+
+// mirrorStatus returns the state of the current (or last) mirroring run.
+func mirrorStatus() gin.H {
+	mirrorMutex.Lock()
+	m := activeMirror
+	mirrorMutex.Unlock()
+	if m == nil {
+		return gin.H{"active": false}
+	}
+	return gin.H{
+		"active":           time.Now().Before(m.expiry),
+		"target_url":       m.target.String(),
+		"percent":          m.percent,
+		"remaining_second": remainingSecond(time.Now(), m.expiry),
+		"results":          m.toMap(),
+	}
+}
+
+// MirrorStatusHandler handles GET /stress/mirror.
+func MirrorStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, mirrorStatus())
+}
+
+// send replays one request against the mirror target.
+func (m *requestMirror) send(method, path, rawQuery string, header http.Header, body []byte) {
+	defer func() { <-m.inFlight }()
+	u := *m.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = rawQuery
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		atomic.AddInt64(&m.failed, 1)
+		return
+	}
+	req.Header = header
+	req.Header.Set(mirrorHeader, "1")
+	start := time.Now()
+	resp, err := m.client.Do(req)
+	atomic.AddInt64(&m.durationNs, int64(time.Since(start)))
+	if err != nil {
+		atomic.AddInt64(&m.failed, 1)
+		return
+	}
+	discardResponse(resp)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		atomic.AddInt64(&m.failed, 1)
+		return
+	}
+	atomic.AddInt64(&m.succeeded, 1)
+}
+
+// MirrorMiddleware copies a share of the incoming requests to the active mirror target
+// without waiting for it. Requests already mirrored and /stress/mirror itself are skipped.
+func MirrorMiddleware(c *gin.Context) {
+	mirrorMutex.Lock()
+	m := activeMirror
+	mirrorMutex.Unlock()
+	if m == nil || !time.Now().Before(m.expiry) || c.GetHeader(mirrorHeader) != "" ||
+		c.Request.URL.Path == "/stress/mirror" || rand.Intn(100) >= m.percent {
+		c.Next()
+		return
+	}
+	select {
+	case m.inFlight <- struct{}{}:
+		atomic.AddInt64(&m.mirrored, 1)
+		var body []byte
+		if raw, ok := c.Get("rawBody"); ok {
+			body = []byte(raw.(string))
+		}
+		header := c.Request.Header.Clone()
+		header.Del("Content-Length")
+		go m.send(c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, header, body)
+	default:
+		atomic.AddInt64(&m.dropped, 1)
+	}
+	c.Next()
+}
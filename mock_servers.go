@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Mock server kinds.
+const (
+	mockHTTP  = "http"
+	mockRedis = "redis"
+	mockTCP   = "tcp"
+)
+
+// mockBehavior controls the latency and errors of one mock server.
+type mockBehavior struct {
+	LatencyMs    int `json:"latency_ms"`
+	ErrorPercent int `json:"error_percent"`
+	ErrorStatus  int `json:"error_status"` // HTTP only.
+}
+
+// MockBehaviorPayload defines the payload for changing mock server behavior.
+type MockBehaviorPayload struct {
+	Target       string  `json:"target"` // http, redis, tcp or all (default).
+	LatencyMs    DuckInt `json:"latency_ms"`
+	ErrorPercent DuckInt `json:"error_percent"`
+	ErrorStatus  DuckInt `json:"error_status"`
+}
+
+// Global variables for mock servers.
+var (
+	mockMutex     sync.Mutex
+	mockBehaviors = map[string]mockBehavior{
+		mockHTTP:  {ErrorStatus: http.StatusInternalServerError},
+		mockRedis: {},
+		mockTCP:   {},
+	}
+	mockPorts = map[string]int{}
+)
+
+// applyMockBehavior sleeps for the configured latency of kind and reports whether the
+// request should fail.
+func applyMockBehavior(kind string) (mockBehavior, bool) {
+	mockMutex.Lock()
+	b := mockBehaviors[kind]
+	mockMutex.Unlock()
+	if b.LatencyMs > 0 {
+		time.Sleep(time.Duration(b.LatencyMs) * time.Millisecond)
+	}
+	return b, b.ErrorPercent > 0 && rand.Intn(100) < b.ErrorPercent
+}
+
+// startMockServers starts the mock HTTP, Redis-protocol and TCP "database" servers on
+// MOCK_HTTP_PORT, MOCK_REDIS_PORT and MOCK_TCP_PORT when MOCK_SERVERS_ENABLED is true.
+func startMockServers() {
+	if !viper.GetBool("MOCK_SERVERS_ENABLED") {
+		return
+	}
+	servers := []struct {
+		kind  string
+		port  int
+		serve func(net.Listener)
+	}{
+		{mockHTTP, viper.GetInt("MOCK_HTTP_PORT"), serveMockHTTP},
+		{mockRedis, viper.GetInt("MOCK_REDIS_PORT"), func(l net.Listener) { serveMockConns(l, handleMockRedisConn) }},
+		{mockTCP, viper.GetInt("MOCK_TCP_PORT"), func(l net.Listener) { serveMockConns(l, handleMockTCPConn) }},
+	}
+	for _, s := range servers {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(s.port))
+		if err != nil {
+			logError("mock server failed to start", zap.String("kind", s.kind), zap.Int("port", s.port), zap.Error(err))
+			continue
+		}
+		mockMutex.Lock()
+		mockPorts[s.kind] = s.port
+		mockMutex.Unlock()
+		logInfo("mock server started", zap.String("kind", s.kind), zap.Int("port", s.port))
+		go s.serve(listener)
+	}
+}
+
+// serveMockHTTP answers every request with a small JSON document, or the configured error status.
+func serveMockHTTP(listener net.Listener) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		b, fail := applyMockBehavior(mockHTTP)
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.WriteHeader(b.ErrorStatus)
+			fmt.Fprintf(w, `{"mock":"http","error":"injected error","status":%d}`, b.ErrorStatus)
+			return
+		}
+		fmt.Fprintf(w, `{"mock":"http","method":%q,"path":%q}`, r.Method, r.URL.Path)
+	})
+	if err := http.Serve(listener, handler); err != nil {
+		logInfo("mock HTTP server stopped", zap.Error(err))
+	}
+}
+
+// serveMockConns accepts connections and handles each one in its own goroutine.
+func serveMockConns(listener net.Listener, handle func(net.Conn)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logInfo("mock server stopped", zap.Error(err))
+			return
+		}
+		go handle(conn)
+	}
+}
+
+// Limits of the commands read by the mock Redis server, so a malformed or hostile client
+// cannot make it allocate without bound.
+const (
+	maxRESPArgs      = 1024
+	maxRESPBulkBytes = 16 << 20
+)
+
+// readRESPLength parses the length of a RESP header line such as "*3" or "$5", between 0
+// and limit.
+func readRESPLength(line string, prefix byte, limit int) (int, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 || line[0] != prefix {
+		return 0, fmt.Errorf("expected %q header, got %q", prefix, line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > limit {
+		return 0, fmt.Errorf("length %d out of range 0-%d", n, limit)
+	}
+	return n, nil
+}
+
+// readRESPCommand reads one command in RESP array or inline format.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := readRESPLength(line, '*', maxRESPArgs)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := readRESPLength(header, '$', maxRESPBulkBytes)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// Global variables for the keys of the mock Redis server, shared by all its connections
+// like a real server, so a pooled client reads what it wrote on another connection.
+var (
+	mockRedisMutex sync.Mutex
+	mockRedisStore = map[string]string{}
+)
+
+// handleMockRedisConn implements enough of the Redis protocol (PING, ECHO, GET, SET, DEL, INCR)
+// for the Redis stress endpoints; other commands are acknowledged with +OK. A malformed
+// command gets an error and closes the connection.
+func handleMockRedisConn(conn net.Conn) {
+	defer conn.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			logWarn("mock Redis connection panicked", zap.Any("panic", r))
+		}
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				io.WriteString(conn, "-ERR Protocol error: "+err.Error()+"\r\n")
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if _, fail := applyMockBehavior(mockRedis); fail {
+			io.WriteString(conn, "-ERR mock injected error\r\n")
+			continue
+		}
+		var reply string
+		mockRedisMutex.Lock()
+		store := mockRedisStore
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "ECHO":
+			reply = bulkString(args[1:])
+		case "GET":
+			if v, ok := store[argAt(args, 1)]; ok {
+				reply = bulkString([]string{v})
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			store[argAt(args, 1)] = argAt(args, 2)
+			reply = "+OK\r\n"
+		case "DEL":
+			deleted := 0
+			for _, key := range args[1:] {
+				if _, ok := store[key]; ok {
+					delete(store, key)
+					deleted++
+				}
+			}
+			reply = fmt.Sprintf(":%d\r\n", deleted)
+		case "INCR":
+			v, _ := strconv.Atoi(store[argAt(args, 1)])
+			v++
+			store[argAt(args, 1)] = strconv.Itoa(v)
+			reply = fmt.Sprintf(":%d\r\n", v)
+		default:
+			reply = "+OK\r\n"
+		}
+		mockRedisMutex.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil || strings.EqualFold(args[0], "QUIT") {
+			return
+		}
+	}
+}
+
+func argAt(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+func bulkString(args []string) string {
+	v := strings.Join(args, " ")
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+}
+
+// handleMockTCPConn is a dummy line-based "database": it greets the client and answers every
+// line with "OK <line>". An injected error drops the connection, like a crashed backend.
+func handleMockTCPConn(conn net.Conn) {
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "BIGGIE MOCK DB READY\n"); err != nil {
+		return
+	}
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if _, fail := applyMockBehavior(mockTCP); fail {
+			return
+		}
+		if _, err := io.WriteString(conn, "OK "+line); err != nil {
+			return
+		}
+	}
+}
+
+// mockStatus returns the ports and behavior of every mock server.
+func mockStatus() gin.H {
+	mockMutex.Lock()
+	defer mockMutex.Unlock()
+	servers := gin.H{}
+	for kind, b := range mockBehaviors {
+		port, running := mockPorts[kind]
+		servers[kind] = gin.H{
+			"running":       running,
+			"port":          port,
+			"latency_ms":    b.LatencyMs,
+			"error_percent": b.ErrorPercent,
+			"error_status":  b.ErrorStatus,
+		}
+	}
+	return servers
+}
+
+// MockStatusHandler handles GET /mock/behavior.
+func MockStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, gin.H{"servers": mockStatus()})
+}
+
+// MockBehaviorHandler handles POST /mock/behavior.
+// It changes the latency and error rate of one or all mock servers.
+func MockBehaviorHandler(c *gin.Context) {
+	var payload MockBehaviorPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	targets := []string{mockHTTP, mockRedis, mockTCP}
+	switch payload.Target {
+	case "", "all":
+	case mockHTTP, mockRedis, mockTCP:
+		targets = []string{payload.Target}
+	default:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "target must be http, redis, tcp or all")
+		return
+	}
+	errorStatus := int(payload.ErrorStatus)
+	if errorStatus < 100 || errorStatus > 599 {
+		errorStatus = http.StatusInternalServerError
+	}
+
+	mockMutex.Lock()
+	for _, target := range targets {
+		mockBehaviors[target] = mockBehavior{
+			LatencyMs:    int(payload.LatencyMs),
+			ErrorPercent: int(payload.ErrorPercent),
+			ErrorStatus:  errorStatus,
+		}
+	}
+	mockMutex.Unlock()
+	logInfo("mock behavior updated",
+		zap.Strings("targets", targets),
+		zap.Int("latency_ms", int(payload.LatencyMs)),
+		zap.Int("error_percent", int(payload.ErrorPercent)))
+
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message": "mock behavior updated",
+		"servers": mockStatus(),
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// multipartSubtypes are the multipart subtypes /simple/multipart can answer with.
+// x-mixed-replace is the streaming subtype of MJPEG cameras and server push.
+var multipartSubtypes = []string{"mixed", "related", "alternative", "x-mixed-replace"}
+
+// multipartPartTypes maps the part_content_type parameter of /simple/multipart to a MIME type.
+var multipartPartTypes = map[string]string{
+	"text":   "text/plain; charset=utf-8",
+	"json":   "application/json",
+	"binary": "application/octet-stream",
+}
+
+// maxMultipartParts bounds the parts of a multipart response.
+const maxMultipartParts = 10000
+
+// queryDuckInts parses a comma-separated list of integers or RANDOM values, each evaluated
+// count times, and returns count values cycling through the list.
+func queryDuckInts(s string, count int) ([]int, error) {
+	list := strings.Split(s, ",")
+	values := make([]int, count)
+	for i := range values {
+		var d DuckInt
+		if err := d.UnmarshalJSON([]byte(strconv.Quote(strings.TrimSpace(list[i%len(list)])))); err != nil {
+			return nil, err
+		}
+		values[i] = int(d)
+	}
+	return values, nil
+}
+
+// writeMultipartBody writes size bytes of a part of type partType: generated text (see
+// generatedContent) or, for json, an object padded to size when it fits.
+func writeMultipartBody(w io.Writer, partType string, index, size int) error {
+	if partType == "json" {
+		head := fmt.Sprintf(`{"part":%d,"padding":"`, index)
+		if size >= len(head)+2 {
+			_, err := io.WriteString(w, head+strings.Repeat("x", size-len(head)-2)+`"}`)
+			return err
+		}
+	}
+	_, err := io.Copy(w, &generatedContent{size: int64(size)})
+	return err
+}
+
+// MultipartHandler handles GET /simple/multipart?parts=[number]&part_size_bytes=[list]&delay_ms=[list]&subtype=[string]&part_content_type=[list].
+// It streams a multipart response of parts parts, flushing each one and waiting delay_ms
+// between them, to test clients and proxies handling streamed multipart payloads. Sizes and
+// delays may be lists, cycled through, and RANDOM values.
+func MultipartHandler(c *gin.Context) {
+	partsValues, err := queryDuckInts(c.DefaultQuery("parts", "3"), 1)
+	if err != nil || partsValues[0] <= 0 || partsValues[0] > maxMultipartParts {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("parts must be an integer between 1 and %d", maxMultipartParts))
+		return
+	}
+	parts := partsValues[0]
+	sizes, err := queryDuckInts(c.DefaultQuery("part_size_bytes", "1024"), parts)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "part_size_bytes: "+err.Error())
+		return
+	}
+	delays, err := queryDuckInts(c.DefaultQuery("delay_ms", "0"), parts)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "delay_ms: "+err.Error())
+		return
+	}
+	subtype := c.DefaultQuery("subtype", "mixed")
+	if !slices.Contains(multipartSubtypes, subtype) {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "subtype must be one of "+strings.Join(multipartSubtypes, ", "))
+		return
+	}
+	partTypes := strings.Split(c.DefaultQuery("part_content_type", "text"), ",")
+	for _, t := range partTypes {
+		if _, ok := multipartPartTypes[t]; !ok {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "part_content_type must be text, json or binary")
+			return
+		}
+	}
+	var total int64
+	for i := range sizes {
+		if sizes[i] < 0 || delays[i] < 0 {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "part_size_bytes and delay_ms must not be negative")
+			return
+		}
+		total += int64(sizes[i])
+	}
+	if maxBytes := viper.GetInt64("SIMPLE_LARGE_MAX_BYTES"); total > maxBytes {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("parts would be %d bytes, above SIMPLE_LARGE_MAX_BYTES (%d)", total, maxBytes))
+		return
+	}
+
+	mw := multipart.NewWriter(c.Writer)
+	c.Header("Content-Type", fmt.Sprintf("multipart/%s; boundary=%s", subtype, mw.Boundary()))
+	c.Header("X-Biggie-Parts", strconv.Itoa(parts))
+	c.Status(http.StatusOK)
+	for i := 0; i < parts; i++ {
+		if i > 0 && !sleepContext(c.Request.Context(), time.Duration(delays[i])*time.Millisecond) {
+			return
+		}
+		partType := partTypes[i%len(partTypes)]
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", multipartPartTypes[partType])
+		header.Set("Content-Length", strconv.Itoa(sizes[i]))
+		header.Set("Content-ID", fmt.Sprintf("<part-%d@the-biggie>", i+1))
+		header.Set("X-Biggie-Part", fmt.Sprintf("%d/%d", i+1, parts))
+		w, err := mw.CreatePart(header)
+		if err == nil {
+			err = writeMultipartBody(w, partType, i+1, sizes[i])
+		}
+		if err != nil {
+			logWarn("Multipart response aborted", zap.Int("part", i+1), zap.Error(err))
+			return
+		}
+		c.Writer.Flush()
+	}
+	mw.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// namespaceHeader scopes fault injection to the requests of one namespace.
+const namespaceHeader = "X-Biggie-Namespace"
+
+var namespaceRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// getNamespace returns the namespace of the request, or "" for the global scope.
+func getNamespace(c *gin.Context) string {
+	ns, _ := c.Get("namespace")
+	s, _ := ns.(string)
+	return s
+}
+
+// NamespaceMiddleware reads the namespace from the X-Biggie-Namespace header or, failing
+// that, the "namespace" field of a JSON body, and stores it in the Gin context.
+func NamespaceMiddleware(c *gin.Context) {
+	ns := c.GetHeader(namespaceHeader)
+	if ns == "" {
+		if raw, ok := c.Get("rawBody"); ok {
+			var body struct {
+				Namespace string `json:"namespace"`
+			}
+			if json.Unmarshal([]byte(raw.(string)), &body) == nil {
+				ns = body.Namespace
+			}
+		}
+	}
+	if ns != "" {
+		if !namespaceRegex.MatchString(ns) {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_NAMESPACE", "namespace must be 1-64 letters, digits, '_', '.' or '-'")
+			c.Abort()
+			return
+		}
+		c.Set("namespace", ns)
+	}
+	c.Next()
+}
+
+// NamespaceListHandler handles GET /admin/namespaces.
+// It lists the namespaces with active faults.
+func NamespaceListHandler(c *gin.Context) {
+	now := time.Now()
+	names := []string{}
+	faults := gin.H{}
+	for name, f := range faultState.Namespaces() {
+		if f.active(now) {
+			names = append(names, name)
+			faults[name] = f.toMap(now)
+		}
+	}
+	sort.Strings(names)
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"namespaces": names,
+		"faults":     faults,
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// negotiatedFormats are the response content types offered by ResponseNegotiated, the first
+// being the default for requests without an Accept header or accepting anything.
+var negotiatedFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+	"application/vnd.msgpack",
+	binding.MIMEPROTOBUF,
+	"application/protobuf",
+	"application/vnd.google.protobuf",
+}
+
+// ResponseNegotiated sends the same response as ResponseJSON, encoded in the format chosen
+// from the Accept header: JSON, MessagePack or protobuf.
+func ResponseNegotiated(c *gin.Context, status int, payload interface{}) {
+	renderNegotiated(c, status, responseEnvelope(c, payload))
+}
+
+// renderNegotiated writes obj in the format chosen from the Accept header. MessagePack is the
+// JSON document as a map; protobuf is a google.protobuf.Struct, named in the X-Protobuf-Message
+// header so clients can decode it without a schema of their own.
+func renderNegotiated(c *gin.Context, status int, obj interface{}) {
+	format := binding.MIMEJSON
+	if c.GetHeader("Accept") != "" {
+		format = c.NegotiateFormat(negotiatedFormats...)
+	}
+	c.Header("Vary", "Accept")
+	switch format {
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2, "application/vnd.msgpack":
+		data, err := normalizeForEncoding(obj)
+		if err != nil {
+			ErrorJSON(c, http.StatusInternalServerError, "ENCODING_FAILED", err.Error())
+			return
+		}
+		c.Render(status, render.MsgPack{Data: data})
+	case binding.MIMEPROTOBUF, "application/protobuf", "application/vnd.google.protobuf":
+		data, err := normalizeForEncoding(obj)
+		if err != nil {
+			ErrorJSON(c, http.StatusInternalServerError, "ENCODING_FAILED", err.Error())
+			return
+		}
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{"data": data}
+		}
+		message, err := structpb.NewStruct(object)
+		if err != nil {
+			ErrorJSON(c, http.StatusInternalServerError, "ENCODING_FAILED", err.Error())
+			return
+		}
+		c.Header("X-Protobuf-Message", "google.protobuf.Struct")
+		c.Header("X-Protobuf-Schema", "google/protobuf/struct.proto")
+		c.ProtoBuf(status, message)
+	default:
+		c.JSON(status, obj)
+	}
+}
+
+// normalizeForEncoding returns obj as its JSON document would decode, so the binary formats
+// carry the same field names and values as JSON. Integral numbers stay integers.
+func normalizeForEncoding(obj interface{}) (interface{}, error) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	return convertJSONNumbers(data), nil
+}
+
+// convertJSONNumbers replaces the json.Number values in v with int64 or float64.
+func convertJSONNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = convertJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = convertJSONNumbers(item)
+		}
+	}
+	return v
+}
@@ -1,66 +1,194 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
-// Global variables for network stress simulation.
-var (
-	networkStressMutex sync.Mutex
-	activeLatencyMs    int       = 0
-	latencyExpiry      time.Time = time.Now()
-	activePacketLoss   int       = 0 // Percentage (0-100)
-	packetLossExpiry   time.Time = time.Now()
+// Latency injection modes.
+const (
+	latencyModeRequest  = "request"  // Delay before the handler runs.
+	latencyModeResponse = "response" // Run the handler at once and delay only the response write.
 )
 
 // NetworkLatencyPayload defines the payload for network latency simulation.
 type NetworkLatencyPayload struct {
 	LatencyMs      DuckInt `json:"latency_ms"`      // Delay in milliseconds.
+	Mode           string  `json:"mode"`            // request (default) or response.
 	MaintainSecond DuckInt `json:"maintain_second"` // Duration.
 	Async          bool    `json:"async"`
 }
 
+// latencySlots bounds the number of requests being delayed at once (LATENCY_MAX_DELAYED_REQUESTS).
+var (
+	latencySlots     chan struct{}
+	latencySlotsOnce sync.Once
+)
+
+// acquireLatencySlot takes one of the bounded delay slots, so delayed requests cannot pile up
+// without limit. It reports false if every slot is taken.
+func acquireLatencySlot() bool {
+	latencySlotsOnce.Do(func() {
+		latencySlots = make(chan struct{}, max(1, viper.GetInt("LATENCY_MAX_DELAYED_REQUESTS")))
+	})
+	select {
+	case latencySlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseLatencySlot frees a slot taken by acquireLatencySlot.
+func releaseLatencySlot() {
+	<-latencySlots
+}
+
+// waitInjectedLatency waits for d on a timer. It returns early if the client goes away.
+func waitInjectedLatency(c *gin.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+}
+
+// delayedResponseWriter holds back the response until releaseAt, so the handler runs
+// without delay and only the client sees the injected latency.
+type delayedResponseWriter struct {
+	gin.ResponseWriter
+	c         *gin.Context
+	start     time.Time
+	latency   time.Duration
+	releaseAt time.Time
+	once      sync.Once
+}
+
+func (w *delayedResponseWriter) wait() {
+	w.once.Do(func() {
+		defer releaseLatencySlot()
+		if d := time.Until(w.releaseAt); d > 0 {
+			waitInjectedLatency(w.c, d)
+			addServerTiming(w.c, "injected-latency", d)
+		}
+		injectedLatencyHistogram.observe(w.latency, time.Since(w.start))
+	})
+}
+
+func (w *delayedResponseWriter) WriteHeaderNow() {
+	w.wait()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *delayedResponseWriter) Write(data []byte) (int, error) {
+	w.wait()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *delayedResponseWriter) WriteString(s string) (int, error) {
+	w.wait()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *delayedResponseWriter) Flush() {
+	w.wait()
+	w.ResponseWriter.Flush()
+}
+
+// injectLatency applies the injected latency to the request in the given mode. If
+// LATENCY_MAX_DELAYED_REQUESTS requests are delayed already, it answers 503 instead, so the
+// client never gets an undelayed response while latency is injected, and reports false.
+// done must be called once the request is handled; it holds back responses without a body.
+func injectLatency(c *gin.Context, latency time.Duration, mode string) (done func(), ok bool) {
+	if !acquireLatencySlot() {
+		injectedLatencyHistogram.skip()
+		ErrorJSON(c, http.StatusServiceUnavailable, "LATENCY_SLOTS_EXHAUSTED",
+			"too many requests are delayed already (LATENCY_MAX_DELAYED_REQUESTS)")
+		return func() {}, false
+	}
+	start := time.Now()
+	if mode == latencyModeResponse {
+		w := &delayedResponseWriter{
+			ResponseWriter: c.Writer,
+			c:              c,
+			start:          start,
+			latency:        latency,
+			releaseAt:      start.Add(latency),
+		}
+		c.Writer = w
+		return w.wait, true
+	}
+	defer releaseLatencySlot()
+	waitInjectedLatency(c, latency)
+	injectedLatencyHistogram.observe(latency, time.Since(start))
+	addServerTiming(c, "injected-latency", time.Since(start))
+	return func() {}, true
+}
+
 // NetworkLatencyHandler handles POST /stress/network/latency.
 func NetworkLatencyHandler(c *gin.Context) {
 	var payload NetworkLatencyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	latencyMs := int(payload.LatencyMs)
+	mode := payload.Mode
+	if mode == "" {
+		mode = latencyModeRequest
+	}
+	if mode != latencyModeRequest && mode != latencyModeResponse {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "mode must be request or response")
+		return
+	}
 	maintainSec := int(payload.MaintainSecond)
 
+	ns := getNamespace(c)
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
 	// Function to set latency for the specified duration.
-	setLatency := func() {
-		networkStressMutex.Lock()
-		activeLatencyMs = latencyMs
-		latencyExpiry = time.Now().Add(time.Duration(maintainSec) * time.Second)
-		networkStressMutex.Unlock()
-		time.Sleep(time.Duration(maintainSec) * time.Second)
-		networkStressMutex.Lock()
-		activeLatencyMs = 0
-		networkStressMutex.Unlock()
-		fmt.Println("Network latency simulation ended", zap.Int("latency_ms", latencyMs))
+	setLatency := func(ctx context.Context) {
+		expiry := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		injectedLatencyHistogram.reset()
+		faultState.Update(ns, func(f *faultSnapshot) {
+			f.LatencyMs = latencyMs
+			f.LatencyMode = mode
+			f.LatencyExpiry = expiry
+		})
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the latency unless a later request replaced it.
+			faultState.Update(ns, func(f *faultSnapshot) {
+				if f.LatencyExpiry.Equal(expiry) {
+					f.LatencyExpiry = time.Now()
+				}
+			})
+		}
+		logInfo("Network latency simulation ended", zap.String("namespace", ns), zap.Int("latency_ms", latencyMs))
 	}
 
 	if payload.Async {
-		go setLatency()
+		go job.run(setLatency)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "network latency simulation started",
+			"namespace":       ns,
 			"latency_ms":      latencyMs,
+			"mode":            mode,
 			"maintain_second": maintainSec,
 		})
 	} else {
-		setLatency()
+		job.run(setLatency)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "network latency simulation completed",
+			"namespace":       ns,
 			"latency_ms":      latencyMs,
+			"mode":            mode,
 			"maintain_second": maintainSec,
 		})
 	}
@@ -76,37 +204,46 @@ type PacketLossPayload struct {
 // PacketLossHandler handles POST /stress/network/packet_loss.
 func PacketLossHandler(c *gin.Context) {
 	var payload PacketLossPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	lossPercentage := int(payload.LossPercentage)
 	maintainSec := int(payload.MaintainSecond)
 
+	ns := getNamespace(c)
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
 	// Function to set packet loss for the specified duration.
-	setPacketLoss := func() {
-		networkStressMutex.Lock()
-		activePacketLoss = lossPercentage
-		packetLossExpiry = time.Now().Add(time.Duration(maintainSec) * time.Second)
-		networkStressMutex.Unlock()
-		time.Sleep(time.Duration(maintainSec) * time.Second)
-		networkStressMutex.Lock()
-		activePacketLoss = 0
-		networkStressMutex.Unlock()
-		fmt.Println("Packet loss simulation ended", zap.Int("loss_percentage", lossPercentage))
+	setPacketLoss := func(ctx context.Context) {
+		expiry := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		faultState.Update(ns, func(f *faultSnapshot) {
+			f.PacketLoss = lossPercentage
+			f.PacketLossExpiry = expiry
+		})
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			faultState.Update(ns, func(f *faultSnapshot) {
+				if f.PacketLossExpiry.Equal(expiry) {
+					f.PacketLossExpiry = time.Now()
+				}
+			})
+		}
+		logInfo("Packet loss simulation ended", zap.String("namespace", ns), zap.Int("loss_percentage", lossPercentage))
 	}
 
 	if payload.Async {
-		go setPacketLoss()
+		go job.run(setPacketLoss)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "packet loss simulation started",
+			"namespace":       ns,
 			"loss_percentage": lossPercentage,
 			"maintain_second": maintainSec,
 		})
 	} else {
-		setPacketLoss()
+		job.run(setPacketLoss)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":         "packet loss simulation completed",
+			"namespace":       ns,
 			"loss_percentage": lossPercentage,
 			"maintain_second": maintainSec,
 		})
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Lifecycle events announced to the notifiers.
+const (
+	notifyStarted  = "started"
+	notifyFinished = "finished"
+	notifyFailed   = "failed"
+)
+
+// jobNotification describes a lifecycle event of a destructive job.
+type jobNotification struct {
+	event     string
+	job       *stressJob
+	method    string
+	namespace string
+	cause     string
+}
+
+// summary returns a one-line description of the event for humans.
+func (n jobNotification) summary() string {
+	hostname, _ := os.Hostname()
+	var b strings.Builder
+	fmt.Fprintf(&b, "[biggie@%s] job %s %s: %s %s", hostname, n.job.ID, n.event, n.method, n.job.Path)
+	if n.namespace != "" {
+		fmt.Fprintf(&b, " (namespace %s)", n.namespace)
+	}
+	if d := n.job.plannedDuration(); n.event == notifyStarted && d > 0 {
+		fmt.Fprintf(&b, " for %s", d)
+	}
+	if n.event != notifyStarted {
+		fmt.Fprintf(&b, " after %s", time.Since(n.job.StartedAt).Round(time.Second))
+	}
+	if n.cause != "" {
+		fmt.Fprintf(&b, ": %s", n.cause)
+	}
+	return b.String()
+}
+
+// notificationsEnabled reports whether a Slack webhook or a PagerDuty routing key is configured.
+func notificationsEnabled() bool {
+	return viper.GetString("NOTIFY_SLACK_WEBHOOK_URL") != "" || viper.GetString("NOTIFY_PAGERDUTY_ROUTING_KEY") != ""
+}
+
+// notify sends n to every configured notifier in the background.
+func notify(n jobNotification) {
+	logInfo("Job notification", zap.String("job_id", n.job.ID), zap.String("event", n.event), zap.String("path", n.job.Path))
+	if url := viper.GetString("NOTIFY_SLACK_WEBHOOK_URL"); url != "" {
+		go postNotification("slack", url, gin.H{"text": n.summary()})
+	}
+	if key := viper.GetString("NOTIFY_PAGERDUTY_ROUTING_KEY"); key != "" {
+		go postNotification("pagerduty", viper.GetString("NOTIFY_PAGERDUTY_URL"), pagerDutyEvent(key, n))
+	}
+}
+
+// pagerDutyEvent builds an Events API v2 event. A job opens an alert when it starts and
+// resolves it when it finishes; a failure raises a separate alert with error severity.
+func pagerDutyEvent(routingKey string, n jobNotification) gin.H {
+	hostname, _ := os.Hostname()
+	event := gin.H{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    "biggie-" + n.job.ID,
+	}
+	switch n.event {
+	case notifyFinished:
+		event["event_action"] = "resolve"
+		return event
+	case notifyFailed:
+		event["dedup_key"] = "biggie-" + n.job.ID + "-failed"
+	}
+	severity := viper.GetString("NOTIFY_PAGERDUTY_SEVERITY")
+	if n.event == notifyFailed {
+		severity = "error"
+	}
+	event["payload"] = gin.H{
+		"summary":   n.summary(),
+		"source":    hostname,
+		"severity":  severity,
+		"component": n.job.Path,
+		"group":     n.namespace,
+		"class":     "chaos-experiment",
+		"custom_details": gin.H{
+			"job_id":     n.job.ID,
+			"event":      n.event,
+			"method":     n.method,
+			"path":       n.job.Path,
+			"namespace":  n.namespace,
+			"started_at": n.job.StartedAt.UTC().Format(time.RFC3339Nano),
+			"cause":      n.cause,
+		},
+	}
+	return event
+}
+
+// postNotification POSTs body as JSON to a notifier, logging failures.
+func postNotification(notifier, url string, body interface{}) {
+	raw, _ := json.Marshal(body)
+	client, err := newOutboundClient(10*time.Second, connectionModeReuse, "")
+	if err != nil {
+		logWarn("Notification failed", zap.String("notifier", notifier), zap.Error(err))
+		return
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(raw))
+	if err != nil {
+		logWarn("Notification failed", zap.String("notifier", notifier), zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		logWarn("Notification failed", zap.String("notifier", notifier), zap.Int("status", resp.StatusCode))
+	}
+}
+
+// notificationOptions are the fields of a stress payload that tell how the job runs.
+type notificationOptions struct {
+	Async bool `json:"async"`
+}
+
+// NotificationMiddleware announces destructive jobs to Slack (NOTIFY_SLACK_WEBHOOK_URL) and
+// PagerDuty (NOTIFY_PAGERDUTY_ROUTING_KEY) when they start, finish or fail, so that nobody
+// sharing the environment is surprised by injected faults. Synchronous requests are announced
+// before they run; asynchronous ones once accepted, with their end announced when their work
+// completes. Jobs that are aborted once started are announced as failed.
+func NotificationMiddleware(c *gin.Context) {
+	if !isChaosRoute(c) || !notificationsEnabled() {
+		c.Next()
+		return
+	}
+	var opts notificationOptions
+	if raw, ok := c.Get("rawBody"); ok {
+		json.Unmarshal([]byte(raw.(string)), &opts)
+	}
+	job := registerJob(c)
+	n := jobNotification{job: job, method: c.Request.Method, namespace: getNamespace(c)}
+	announce := func(event, cause string) {
+		e := n
+		e.event, e.cause = event, cause
+		notify(e)
+	}
+	// Requests rejected before the job started are not announced.
+	start := func() {
+		announce(notifyStarted, "")
+		job.onAbort(func(cause string) {
+			announce(notifyFailed, cause)
+		})
+	}
+	if !opts.Async {
+		start()
+	}
+	c.Next()
+	if c.Writer.Status() >= 400 {
+		discardRejectedJob(c, job)
+		return
+	}
+	if !opts.Async {
+		announce(notifyFinished, "")
+		return
+	}
+	start()
+	// Aborted jobs are announced as failed by their abort hook.
+	job.onFinish(func(status string) {
+		if status == jobCompleted {
+			announce(notifyFinished, "")
+		}
+	})
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OrchestratorActionPayload defines the payload for starting a biggie action from an
+// external chaos orchestrator such as AWS FIS (through an SSM document) or Chaos Mesh.
+type OrchestratorActionPayload struct {
+	Action         string                 `json:"action"`          // Route of the action, e.g. "/stress/error_injection".
+	Parameters     map[string]interface{} `json:"parameters"`      // JSON body of the action.
+	DurationSecond DuckInt                `json:"duration_second"` // How long the action runs.
+	Duration       string                 `json:"duration"`        // Same as an ISO 8601 duration, e.g. "PT5M" from FIS.
+}
+
+// States of an orchestrator action.
+const (
+	actionRunning   = "running"
+	actionCompleted = "completed"
+	actionStopped   = "stopped"
+	actionFailed    = "failed"
+)
+
+// defaultStopActions are the rollback actions run when an orchestrator stops an action whose
+// parameters declare no rollback of their own.
+var defaultStopActions = []string{rollbackClearFaults, rollbackReleaseMemory, rollbackCloseConnections}
+
+// orchestratorAction is an action started under an id chosen by the orchestrator, e.g. the
+// FIS experiment id, so that retried start and stop calls are idempotent.
+type orchestratorAction struct {
+	id         string
+	action     string
+	parameters map[string]interface{}
+	duration   time.Duration
+	namespace  string
+	startedAt  time.Time
+
+	mu        sync.Mutex
+	stoppedAt time.Time
+	jobID     string
+	err       string
+	result    gin.H
+}
+
+// state returns the state of the action, from the status of its job once it is started.
+// A job no longer tracked has finished.
+func (a *orchestratorAction) state() string {
+	switch {
+	case a.err != "":
+		return actionFailed
+	case !a.stoppedAt.IsZero():
+		return actionStopped
+	case a.jobID == "":
+		if a.result != nil {
+			// Started without a job: the action completed with its request.
+			return actionCompleted
+		}
+		return actionRunning
+	}
+	job := getJob(a.jobID)
+	if job == nil {
+		return actionCompleted
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	switch job.status {
+	case jobCompleted:
+		return actionCompleted
+	case jobFailed:
+		return actionFailed
+	case jobCancelled, jobCancelling:
+		return actionStopped
+	}
+	return actionRunning
+}
+
+func (a *orchestratorAction) toMap() gin.H {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := gin.H{
+		"id":              a.id,
+		"action":          a.action,
+		"parameters":      a.parameters,
+		"state":           a.state(),
+		"namespace":       a.namespace,
+		"started_at":      a.startedAt.UTC().Format(time.RFC3339Nano),
+		"duration_second": int(a.duration / time.Second),
+		"job_id":          a.jobID,
+		"result":          a.result,
+	}
+	if a.duration > 0 {
+		m["ends_at"] = a.startedAt.Add(a.duration).UTC().Format(time.RFC3339Nano)
+	}
+	if !a.stoppedAt.IsZero() {
+		m["stopped_at"] = a.stoppedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if a.err != "" {
+		m["error"] = a.err
+	}
+	return m
+}
+
+// maxOrchestratorActions bounds the actions kept in memory; the oldest ended ones are dropped.
+const maxOrchestratorActions = 100
+
+// Global variables for orchestrator actions.
+var (
+	orchestratorMutex   sync.Mutex
+	orchestratorActions = map[string]*orchestratorAction{}
+)
+
+var (
+	actionIDRegex      = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+	isoDurationRegex   = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+	isoDurationFactors = []time.Duration{time.Hour, time.Minute, time.Second}
+)
+
+// parseISODuration parses the ISO 8601 durations used by FIS, such as "PT1H30M".
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDurationRegex.FindStringSubmatch(s)
+	if m == nil || s == "PT" {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+	var d time.Duration
+	for i, factor := range isoDurationFactors {
+		if m[i+1] != "" {
+			n, _ := strconv.Atoi(m[i+1])
+			d += time.Duration(n) * factor
+		}
+	}
+	return d, nil
+}
+
+// orchestrationPrefixes are chaos routes that run other actions, so they are not actions
+// themselves.
+var orchestrationPrefixes = []string{"/integrations/", "/scenario/"}
+
+// isChaosAction reports whether path is a route that injects faults or load.
+func isChaosAction(path string) bool {
+	for _, prefix := range orchestrationPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	for _, prefix := range chaosRoutePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// launchOrchestratorAction starts action under id and reports true, or returns the action
+// that already exists under id, which may be a different one, and reports false.
+func launchOrchestratorAction(id, action string, parameters map[string]interface{}, duration time.Duration, namespace string) (*orchestratorAction, bool) {
+	orchestratorMutex.Lock()
+	if existing, ok := orchestratorActions[id]; ok {
+		orchestratorMutex.Unlock()
+		return existing, false
+	}
+	a := &orchestratorAction{
+		id:         id,
+		action:     action,
+		parameters: parameters,
+		duration:   duration,
+		namespace:  namespace,
+		startedAt:  time.Now(),
+	}
+	orchestratorActions[id] = a
+	pruneOrchestratorActions()
+	orchestratorMutex.Unlock()
+	startOrchestratorAction(a)
+	return a, true
+}
+
+// pruneOrchestratorActions drops the oldest ended actions beyond maxOrchestratorActions, with
+// orchestratorMutex held. Running actions are kept so they can still be stopped.
+func pruneOrchestratorActions() {
+	if len(orchestratorActions) <= maxOrchestratorActions {
+		return
+	}
+	ended := make([]*orchestratorAction, 0, len(orchestratorActions))
+	for _, a := range orchestratorActions {
+		a.mu.Lock()
+		running := a.state() == actionRunning
+		a.mu.Unlock()
+		if !running {
+			ended = append(ended, a)
+		}
+	}
+	sort.Slice(ended, func(i, j int) bool { return ended[i].startedAt.Before(ended[j].startedAt) })
+	for _, a := range ended[:min(len(ended), len(orchestratorActions)-maxOrchestratorActions)] {
+		delete(orchestratorActions, a.id)
+	}
+}
+
+// startOrchestratorAction invokes the action on this instance, through every middleware like
+// any other request, asynchronously and with rollback actions so that it can be stopped.
+func startOrchestratorAction(a *orchestratorAction) {
+	body := map[string]interface{}{}
+	for k, v := range a.parameters {
+		body[k] = v
+	}
+	body["async"] = true
+	if a.duration > 0 {
+		for _, field := range chaosDurationFields {
+			if _, ok := body[field]; !ok {
+				body[field] = int(a.duration / time.Second)
+			}
+		}
+	}
+	if _, ok := body["rollback"]; !ok {
+		body["rollback"] = gin.H{"actions": defaultStopActions}
+	}
+	fail := func(err string) {
+		a.mu.Lock()
+		a.err = err
+		a.mu.Unlock()
+		logWarn("Orchestrator action failed to start", zap.String("id", a.id), zap.String("action", a.action), zap.String("error", err))
+	}
+	status, result, err := invokeLocalAction(http.MethodPost, a.action, body, a.namespace)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	a.mu.Lock()
+	a.result = result
+	if jobID, ok := result["job_id"].(string); ok {
+		a.jobID = jobID
+	}
+	stopped := !a.stoppedAt.IsZero()
+	a.mu.Unlock()
+	if stopped {
+		// Stopped while it was starting, before its job was known.
+		if job := getJob(a.jobID); job != nil {
+			job.abort("stopped by orchestrator")
+		}
+		return
+	}
+	if status >= 400 {
+		fail(fmt.Sprintf("action returned status %d", status))
+		return
+	}
+	logInfo("Orchestrator action started", zap.String("id", a.id), zap.String("action", a.action), zap.Duration("duration", a.duration))
+}
+
+// invokeLocalAction calls path on this instance with body as JSON, through every middleware
+// like any other request but outside egress faults, and returns the status and the decoded
+// response.
+func invokeLocalAction(method, path string, body map[string]interface{}, namespace string) (int, gin.H, error) {
+	raw, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, localURL(path), bytes.NewReader(raw))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if namespace != "" {
+		req.Header.Set(namespaceHeader, namespace)
+	}
+	resp, err := newLocalClient(30 * time.Second).Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	var result gin.H
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result, nil
+}
+
+// actionDuration returns the duration declared in the parameters of an action, by its
+// maintain_second or downtime_second, or 0.
+func actionDuration(parameters map[string]interface{}) time.Duration {
+	for _, field := range chaosDurationFields {
+		raw, _ := json.Marshal(parameters[field])
+		var d DuckInt
+		if json.Unmarshal(raw, &d) == nil && d > 0 {
+			return time.Duration(d) * time.Second
+		}
+	}
+	return 0
+}
+
+// OrchestratorActionStartHandler handles PUT /integrations/actions/:id and
+// POST /integrations/actions/:id/start.
+// It starts the action once: calls for an id that already exists return its current state
+// without starting it again, so orchestrators can retry safely.
+func OrchestratorActionStartHandler(c *gin.Context) {
+	id := c.Param("id")
+	if !actionIDRegex.MatchString(id) {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "id must be 1-128 letters, digits, '_', '.', ':' or '-'")
+		return
+	}
+	var payload OrchestratorActionPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if !isChaosAction(payload.Action) {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "action must be a stress route such as /stress/error_injection")
+		return
+	}
+	duration := time.Duration(payload.DurationSecond) * time.Second
+	if payload.Duration != "" {
+		d, err := parseISODuration(payload.Duration)
+		if err != nil {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+			return
+		}
+		duration = d
+	}
+	if duration == 0 {
+		// Fall back on the duration of the action itself.
+		duration = actionDuration(payload.Parameters)
+	}
+
+	a, created := launchOrchestratorAction(id, payload.Action, payload.Parameters, duration, getNamespace(c))
+	if a.action != payload.Action {
+		ErrorJSON(c, http.StatusConflict, "ACTION_CONFLICT", fmt.Sprintf("id %s already runs %s", id, a.action))
+		return
+	}
+	result := a.toMap()
+	result["created"] = created
+	status := http.StatusOK
+	switch {
+	case result["state"] == actionFailed && created:
+		status = http.StatusBadGateway
+	case created:
+		status = http.StatusCreated
+	}
+	ResponseJSON(c, status, result)
+}
+
+// OrchestratorActionStopHandler handles DELETE /integrations/actions/:id and
+// POST /integrations/actions/:id/stop.
+// It aborts the job of the action, running its rollback actions. Stopping an action that
+// already ended, or an unknown id, succeeds as well.
+func OrchestratorActionStopHandler(c *gin.Context) {
+	orchestratorMutex.Lock()
+	a, ok := orchestratorActions[c.Param("id")]
+	orchestratorMutex.Unlock()
+	if !ok {
+		ResponseJSON(c, http.StatusOK, gin.H{"id": c.Param("id"), "state": actionStopped, "message": "no such action"})
+		return
+	}
+	a.mu.Lock()
+	stop := a.state() == actionRunning
+	if stop {
+		a.stoppedAt = time.Now()
+	}
+	jobID := a.jobID
+	a.mu.Unlock()
+	if stop {
+		if job := getJob(jobID); job != nil {
+			job.abort("stopped by orchestrator")
+		}
+		logInfo("Orchestrator action stopped", zap.String("id", a.id), zap.String("action", a.action))
+	}
+	ResponseJSON(c, http.StatusOK, a.toMap())
+}
+
+// OrchestratorActionStatusHandler handles GET /integrations/actions/:id.
+func OrchestratorActionStatusHandler(c *gin.Context) {
+	orchestratorMutex.Lock()
+	a, ok := orchestratorActions[c.Param("id")]
+	orchestratorMutex.Unlock()
+	if !ok {
+		ErrorJSON(c, http.StatusNotFound, "ACTION_NOT_FOUND", "no action with id "+c.Param("id"))
+		return
+	}
+	ResponseJSON(c, http.StatusOK, a.toMap())
+}
+
+// OrchestratorActionListHandler handles GET /integrations/actions.
+func OrchestratorActionListHandler(c *gin.Context) {
+	orchestratorMutex.Lock()
+	list := make([]*orchestratorAction, 0, len(orchestratorActions))
+	for _, a := range orchestratorActions {
+		list = append(list, a)
+	}
+	orchestratorMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].startedAt.Before(list[j].startedAt) })
+	actions := make([]gin.H, 0, len(list))
+	for _, a := range list {
+		actions = append(actions, a.toMap())
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{"actions": actions})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Port personas: the default behavior of every request received on a port.
+const (
+	personaHealthy   = "healthy"   // No change.
+	personaSlow      = "slow"      // Every request is delayed by the parameter in milliseconds (default 1000).
+	personaError     = "error"     // The parameter percentage of requests (default 100) fails with 500; health checks pass.
+	personaUnhealthy = "unhealthy" // Health checks fail with 503; other requests are served.
+	personaDown      = "down"      // Every request fails with 503.
+)
+
+// PortPersonaPayload defines the payload for changing the persona of a port.
+type PortPersonaPayload struct {
+	Port    DuckInt `json:"port"`
+	Persona string  `json:"persona"` // healthy, slow[:ms], error[:percent], unhealthy or down.
+}
+
+// portPersona is the behavior profile of one listening port.
+type portPersona struct {
+	name     string
+	param    int
+	requests int64
+	affected int64 // Requests delayed or failed by the persona.
+}
+
+func (p *portPersona) spec() string {
+	if p.name == personaSlow || p.name == personaError {
+		return p.name + ":" + strconv.Itoa(p.param)
+	}
+	return p.name
+}
+
+// Global variables for port personas.
+var (
+	portPersonasMutex sync.Mutex
+	portPersonas      = map[int]*portPersona{}
+)
+
+// parsePersona parses a persona spec such as "slow:500".
+func parsePersona(spec string) (*portPersona, error) {
+	name, paramStr, hasParam := strings.Cut(strings.TrimSpace(spec), ":")
+	p := &portPersona{name: name}
+	switch name {
+	case personaSlow:
+		p.param = 1000
+	case personaError:
+		p.param = 100
+	case personaHealthy, personaUnhealthy, personaDown:
+		if hasParam {
+			return nil, errors.New(name + " takes no parameter")
+		}
+		return p, nil
+	default:
+		return nil, errors.New("persona must be healthy, slow[:ms], error[:percent], unhealthy or down")
+	}
+	if hasParam {
+		param, err := strconv.Atoi(paramStr)
+		if err != nil || param < 0 || (name == personaError && param > 100) {
+			return nil, errors.New("invalid " + name + " parameter: " + paramStr)
+		}
+		p.param = param
+	}
+	return p, nil
+}
+
+// initPortPersonas reads PORT_PERSONAS, comma separated port=persona entries such as
+// "8081=slow:500,8082=error:50,8083=unhealthy". It returns the configured ports.
+func initPortPersonas() []int {
+	ports := []int{}
+	for _, entry := range strings.Split(viper.GetString("PORT_PERSONAS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		portStr, spec, _ := strings.Cut(entry, "=")
+		port, err := strconv.Atoi(strings.TrimSpace(portStr))
+		if err != nil || port <= 0 || port > 65535 {
+			logWarn("invalid PORT_PERSONAS port, ignoring", zap.String("entry", entry))
+			continue
+		}
+		persona, err := parsePersona(spec)
+		if err != nil {
+			logWarn("invalid PORT_PERSONAS persona, ignoring", zap.String("entry", entry), zap.Error(err))
+			continue
+		}
+		portPersonasMutex.Lock()
+		portPersonas[port] = persona
+		portPersonasMutex.Unlock()
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// servePersonaPorts listens on every PORT_PERSONAS port other than mainPort, serving the
+// same handler as the main server.
+func servePersonaPorts(mainPort int, handler http.Handler) {
+	for _, port := range initPortPersonas() {
+		if port == mainPort {
+			continue
+		}
+		server := &http.Server{
+			Addr:      ":" + intToString(port),
+			Handler:   handler,
+			ConnState: trackConnState,
+		}
+		logInfo("starting persona server", zap.Int("port", port), zap.String("persona", getPortPersona(port).spec()))
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logError("persona server stopped", zap.Int("port", port), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// getPortPersona returns the persona of port, or nil.
+func getPortPersona(port int) *portPersona {
+	portPersonasMutex.Lock()
+	defer portPersonasMutex.Unlock()
+	return portPersonas[port]
+}
+
+// localPort returns the port the request was received on, or 0.
+func localPort(c *gin.Context) int {
+	addr, ok := c.Request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return 0
+	}
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.Port
+	}
+	return 0
+}
+
+// portPersonaStatus returns the persona and request counters of every configured port.
+func portPersonaStatus() []gin.H {
+	portPersonasMutex.Lock()
+	defer portPersonasMutex.Unlock()
+	ports := make([]int, 0, len(portPersonas))
+	for port := range portPersonas {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	status := make([]gin.H, 0, len(ports))
+	for _, port := range ports {
+		p := portPersonas[port]
+		status = append(status, gin.H{
+			"port":     port,
+			"persona":  p.spec(),
+			"requests": atomic.LoadInt64(&p.requests),
+			"affected": atomic.LoadInt64(&p.affected),
+		})
+	}
+	return status
+}
+
+// PortPersonaStatusHandler handles GET /admin/ports.
+func PortPersonaStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, gin.H{"ports": portPersonaStatus()})
+}
+
+// PortPersonaHandler handles POST /admin/ports.
+// It changes the persona of a port configured by PORT_PERSONAS, e.g. to fail one target
+// group over at runtime. New ports cannot be opened.
+func PortPersonaHandler(c *gin.Context) {
+	var payload PortPersonaPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	persona, err := parsePersona(payload.Persona)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	port := int(payload.Port)
+	portPersonasMutex.Lock()
+	_, ok := portPersonas[port]
+	if ok {
+		portPersonas[port] = persona
+	}
+	portPersonasMutex.Unlock()
+	if !ok {
+		ErrorJSON(c, http.StatusNotFound, "PORT_NOT_FOUND", "port "+strconv.Itoa(port)+" is not configured in PORT_PERSONAS")
+		return
+	}
+	logInfo("Port persona changed", zap.Int("port", port), zap.String("persona", persona.spec()))
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message": "port persona changed",
+		"port":    port,
+		"persona": persona.spec(),
+	})
+}
+
+// PortPersonaMiddleware applies the persona of the port the request was received on.
+// /admin/ is exempt so personas can always be changed.
+func PortPersonaMiddleware(c *gin.Context) {
+	persona := getPortPersona(localPort(c))
+	if persona == nil || strings.HasPrefix(c.Request.URL.Path, "/admin/") {
+		c.Next()
+		return
+	}
+	atomic.AddInt64(&persona.requests, 1)
+	c.Header("X-Port-Persona", persona.spec())
+	healthCheck := strings.HasPrefix(c.Request.URL.Path, "/healthcheck")
+
+	switch persona.name {
+	case personaSlow:
+		atomic.AddInt64(&persona.affected, 1)
+		waitInjectedLatency(c, time.Duration(persona.param)*time.Millisecond)
+	case personaError:
+		if !healthCheck && rand.Intn(100) < persona.param {
+			atomic.AddInt64(&persona.affected, 1)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":        "PERSONA_ERROR",
+				"message":      "port persona error",
+				"port":         localPort(c),
+				"requested_at": time.Now().UTC().Format(time.RFC3339Nano),
+			})
+			return
+		}
+	case personaUnhealthy, personaDown:
+		if healthCheck || persona.name == personaDown {
+			atomic.AddInt64(&persona.affected, 1)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":        "PERSONA_UNAVAILABLE",
+				"message":      "port persona " + persona.name,
+				"port":         localPort(c),
+				"requested_at": time.Now().UTC().Format(time.RFC3339Nano),
+			})
+			return
+		}
+	}
+	c.Next()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Session-level features that pin a client connection to a server connection in
+// RDS Proxy and break transaction pooling in pgbouncer.
+const (
+	pinFeatureSet                 = "set"
+	pinFeatureAdvisoryLock        = "advisory_lock"
+	pinFeaturePreparedStatement   = "prepared_statement"
+	pinFeaturePreparedTransaction = "prepared_transaction"
+	pinFeatureTempTable           = "temp_table"
+)
+
+// PostgresPinningPayload defines the payload for the Postgres connection pinning stress.
+type PostgresPinningPayload struct {
+	MaintainSecond   DuckInt  `json:"maintain_second"`
+	Async            bool     `json:"async"`
+	ConnectionCounts DuckInt  `json:"connection_counts"`
+	QueryPerInterval DuckInt  `json:"query_per_interval"`
+	IntervalSecond   DuckInt  `json:"interval_second"`
+	PinPercent       DuckInt  `json:"pin_percent"` // Share of operations using a session-level feature.
+	Features         []string `json:"features"`    // Default: set, advisory_lock, prepared_statement.
+}
+
+// pinningStats counts operations of the pinning stress.
+type pinningStats struct {
+	operations int64
+	pinning    int64
+	failed     int64
+	pinned     int64 // Sessions that used at least one pinning feature.
+}
+
+func (s *pinningStats) toMap() gin.H {
+	return gin.H{
+		"operations":         atomic.LoadInt64(&s.operations),
+		"pinning_operations": atomic.LoadInt64(&s.pinning),
+		"failed":             atomic.LoadInt64(&s.failed),
+		"pinned_sessions":    atomic.LoadInt64(&s.pinned),
+	}
+}
+
+// runPinningFeature executes one session-level feature on conn. seq makes names unique per session.
+// Prepared transaction IDs are appended to gids so they can be rolled back at the end.
+func runPinningFeature(ctx context.Context, conn *sql.Conn, feature string, session, seq int, gids *[]string) error {
+	var err error
+	switch feature {
+	case pinFeatureSet:
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("SET application_name = 'biggie_pin_%d_%d'", session, seq))
+	case pinFeatureAdvisoryLock:
+		// Session-level advisory locks stay held until pg_advisory_unlock_all or disconnect.
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", int64(session)<<32|int64(seq))
+	case pinFeaturePreparedStatement:
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("PREPARE biggie_pin_%d AS SELECT %d", seq, seq))
+	case pinFeaturePreparedTransaction:
+		// Requires max_prepared_transactions > 0 on the server.
+		gid := fmt.Sprintf("biggie_pin_%d_%d_%d", time.Now().UnixNano(), session, seq)
+		if _, err = conn.ExecContext(ctx, "BEGIN"); err != nil {
+			return err
+		}
+		if _, err = conn.ExecContext(ctx, "INSERT INTO "+testTableName("postgres")+"(value) VALUES('pinning')"); err == nil {
+			_, err = conn.ExecContext(ctx, fmt.Sprintf("PREPARE TRANSACTION '%s'", gid))
+		}
+		if err != nil {
+			conn.ExecContext(ctx, "ROLLBACK")
+			return err
+		}
+		*gids = append(*gids, gid)
+	case pinFeatureTempTable:
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TABLE IF NOT EXISTS biggie_pin_%d (id INT)", seq))
+	default:
+		err = fmt.Errorf("unknown feature: %s", feature)
+	}
+	return err
+}
+
+// PostgresPinningHandler handles POST /postgres/pinning.
+// Each of connection_counts sessions runs queries, and pin_percent of them use a session-level
+// feature (SET, advisory locks, prepared statements or transactions, temp tables). Through
+// RDS Proxy or pgbouncer this pins client connections to server connections until the pool is exhausted.
+func PostgresPinningHandler(c *gin.Context) {
+	var payload PostgresPinningPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	connectionCounts := int(payload.ConnectionCounts)
+	queryPerInterval := int(payload.QueryPerInterval)
+	intervalSec := int(payload.IntervalSecond)
+	pinPercent := int(payload.PinPercent)
+	features := payload.Features
+	if len(features) == 0 {
+		features = []string{pinFeatureSet, pinFeatureAdvisoryLock, pinFeaturePreparedStatement}
+	}
+	for _, feature := range features {
+		switch feature {
+		case pinFeatureSet, pinFeatureAdvisoryLock, pinFeaturePreparedStatement, pinFeaturePreparedTransaction, pinFeatureTempTable:
+		default:
+			ErrorJSON(c, 400, "INVALID_PAYLOAD", "unknown feature: "+feature)
+			return
+		}
+	}
+
+	cfg, err := GetPostgresConfig()
+	if err != nil {
+		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
+		return
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	db, err := sql.Open(pgxEgressDriver, dsn)
+	if err != nil {
+		ErrorJSON(c, 500, "DB_ERROR", err.Error())
+		return
+	}
+	if err := SetupTestDatabase("postgres", db); err != nil {
+		db.Close()
+		ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
+		return
+	}
+
+	var stats pinningStats
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(jobCtx context.Context) {
+		defer db.Close()
+		// Queries do not use jobCtx: prepared transactions must be rolled back after a cancel.
+		ctx := context.Background()
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		var wg sync.WaitGroup
+		for i := 0; i < connectionCounts; i++ {
+			wg.Add(1)
+			go func(session int) {
+				defer wg.Done()
+				// A dedicated connection is one client session as seen by the proxy.
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					atomic.AddInt64(&stats.failed, 1)
+					logWarn("Postgres pinning connection failed", zap.Int("conn", session), zap.Error(err))
+					return
+				}
+				defer conn.Close()
+				var gids []string
+				pinned := false
+				seq := 0
+				for time.Now().Before(endTime) && jobCtx.Err() == nil {
+					for j := 0; j < queryPerInterval; j++ {
+						atomic.AddInt64(&stats.operations, 1)
+						if rand.Intn(100) < pinPercent {
+							seq++
+							feature := features[rand.Intn(len(features))]
+							if err := runPinningFeature(ctx, conn, feature, session, seq, &gids); err != nil {
+								atomic.AddInt64(&stats.failed, 1)
+								logWarn("Postgres pinning feature failed", zap.Int("conn", session), zap.String("feature", feature), zap.Error(err))
+								continue
+							}
+							atomic.AddInt64(&stats.pinning, 1)
+							if !pinned {
+								pinned = true
+								atomic.AddInt64(&stats.pinned, 1)
+							}
+						} else if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+							atomic.AddInt64(&stats.failed, 1)
+							logWarn("Postgres pinning query failed", zap.Int("conn", session), zap.Error(err))
+						}
+					}
+					sleepContext(jobCtx, time.Duration(intervalSec)*time.Second)
+				}
+				// Prepared transactions outlive the session, so they must be resolved explicitly.
+				for _, gid := range gids {
+					if _, err := conn.ExecContext(ctx, fmt.Sprintf("ROLLBACK PREPARED '%s'", gid)); err != nil {
+						logWarn("Postgres pinning rollback prepared failed", zap.String("gid", gid), zap.Error(err))
+					}
+				}
+				conn.ExecContext(ctx, "SELECT pg_advisory_unlock_all()")
+			}(i)
+		}
+		wg.Wait()
+		logInfo("Postgres pinning stress completed",
+			zap.Int("connections", connectionCounts),
+			zap.Int64("pinned_sessions", atomic.LoadInt64(&stats.pinned)),
+			zap.Int64("failed", atomic.LoadInt64(&stats.failed)))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, 200, gin.H{
+			"message":            "Postgres pinning stress started",
+			"maintain_second":    maintainSec,
+			"connection_counts":  connectionCounts,
+			"query_per_interval": queryPerInterval,
+			"interval_second":    intervalSec,
+			"pin_percent":        pinPercent,
+			"features":           features,
+		})
+	} else {
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
+		ResponseJSON(c, 200, gin.H{
+			"message":            "Postgres pinning stress completed",
+			"maintain_second":    maintainSec,
+			"connection_counts":  connectionCounts,
+			"query_per_interval": queryPerInterval,
+			"interval_second":    intervalSec,
+			"pin_percent":        pinPercent,
+			"features":           features,
+			"results":            stats.toMap(),
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
@@ -14,23 +15,33 @@ import (
 
 // PostgresHeavyPayload defines the payload for heavy PostgreSQL query using a single connection.
 type PostgresHeavyPayload struct {
-	Reads            bool    `json:"reads"`
-	Writes           bool    `json:"writes"`
-	MaintainSecond   DuckInt `json:"maintain_second"`
-	Async            bool    `json:"async"`
-	QueryPerInterval DuckInt `json:"query_per_interval"`
-	IntervalSecond   DuckInt `json:"interval_second"`
+	Reads                    bool    `json:"reads"`
+	Writes                   bool    `json:"writes"`
+	MaintainSecond           DuckInt `json:"maintain_second"`
+	Async                    bool    `json:"async"`
+	QueryPerInterval         DuckInt `json:"query_per_interval"`
+	IntervalSecond           DuckInt `json:"interval_second"`
+	UseReader                bool    `json:"use_reader"`                 // Send reads to the reader endpoint.
+	PreparedStatements       DuckInt `json:"prepared_statements"`        // Distinct statements prepared per connection; reads execute them.
+	Transactions             bool    `json:"transactions"`               // Replace autocommit writes with multi-statement transactions.
+	StatementsPerTransaction DuckInt `json:"statements_per_transaction"` // Default 4.
+	RollbackPercent          DuckInt `json:"rollback_percent"`           // Share of transactions ending in ROLLBACK.
 }
 
 // PostgresMultiHeavyPayload defines the payload for heavy PostgreSQL queries using multiple connections.
 type PostgresMultiHeavyPayload struct {
-	Reads            bool    `json:"reads"`
-	Writes           bool    `json:"writes"`
-	MaintainSecond   DuckInt `json:"maintain_second"`
-	Async            bool    `json:"async"`
-	ConnectionCounts DuckInt `json:"connection_counts"`
-	QueryPerInterval DuckInt `json:"query_per_interval"`
-	IntervalSecond   DuckInt `json:"interval_second"`
+	Reads                    bool    `json:"reads"`
+	Writes                   bool    `json:"writes"`
+	MaintainSecond           DuckInt `json:"maintain_second"`
+	Async                    bool    `json:"async"`
+	ConnectionCounts         DuckInt `json:"connection_counts"`
+	QueryPerInterval         DuckInt `json:"query_per_interval"`
+	IntervalSecond           DuckInt `json:"interval_second"`
+	UseReader                bool    `json:"use_reader"`                 // Send reads to the reader endpoint.
+	PreparedStatements       DuckInt `json:"prepared_statements"`        // Distinct statements prepared per connection; reads execute them.
+	Transactions             bool    `json:"transactions"`               // Replace autocommit writes with multi-statement transactions.
+	StatementsPerTransaction DuckInt `json:"statements_per_transaction"` // Default 4.
+	RollbackPercent          DuckInt `json:"rollback_percent"`           // Share of transactions ending in ROLLBACK.
 }
 
 // PostgresConnectionPayload defines the payload for simulating heavy PostgreSQL connection load.
@@ -40,28 +51,44 @@ type PostgresConnectionPayload struct {
 	ConnectionCounts    DuckInt `json:"connection_counts"`
 	IncreasePerInterval DuckInt `json:"increase_per_interval"`
 	IntervalSecond      DuckInt `json:"interval_second"`
+	Leak                bool    `json:"leak"` // Hold an open transaction on every connection and never close it.
 }
 
 // PostgresHeavyHandler handles POST /postgres/heavy.
 // It opens a single connection and repeatedly executes read/write queries for the specified duration.
 func PostgresHeavyHandler(c *gin.Context) {
 	var payload PostgresHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	maintainSec := int(payload.MaintainSecond)
 	queryPerInterval := int(payload.QueryPerInterval)
 	intervalSec := int(payload.IntervalSecond)
+	preparedCount := int(payload.PreparedStatements)
+	txStatements := int(payload.StatementsPerTransaction)
+	if txStatements <= 0 {
+		txStatements = 4
+	}
+	rollbackPercent := int(payload.RollbackPercent)
+	var txStats stressTransactionStats
 
-	cfg, err := GetPostgresConfig()
+	engine, driver, dsn, err := stressDBTarget("postgres")
 	if err != nil {
 		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
 		return
 	}
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	db, err := sql.Open("pgx", dsn)
+	readerDSN := dsn
+	if payload.UseReader && engine != dbEngineSQLite {
+		readerCfg, err := GetPostgresReaderConfig()
+		if err != nil {
+			ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
+			return
+		}
+		readerDSN = fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+			readerCfg.Username, readerCfg.Password, readerCfg.Host, readerCfg.Port, readerCfg.DBName)
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		ErrorJSON(c, 500, "DB_ERROR", err.Error())
 		return
@@ -71,47 +98,89 @@ func PostgresHeavyHandler(c *gin.Context) {
 		return
 	}
 
-	if err := SetupTestDatabase("postgres", db); err != nil {
+	if err := SetupTestDatabase(engine, db); err != nil {
 		ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
 		return
 	}
+	// Reads go to a separate connection on the reader endpoint when use_reader is set.
+	readDB := db
+	if payload.UseReader {
+		if readDB, err = sql.Open(driver, readerDSN); err == nil {
+			err = readDB.Ping()
+		}
+		if err != nil {
+			db.Close()
+			ErrorJSON(c, 500, "DB_ERROR", err.Error())
+			return
+		}
+	}
+	var stmts []*sql.Stmt
+	if preparedCount > 0 {
+		if stmts, err = prepareStressStatements(engine, readDB, preparedCount); err != nil {
+			logWarn("Postgres heavy prepare failed", zap.Int("prepared", len(stmts)), zap.Error(err))
+		}
+	}
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		stmtIndex := 0
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			for i := 0; i < queryPerInterval; i++ {
-				if payload.Reads {
-					if _, err := db.Query("SELECT 1"); err != nil {
-						fmt.Println("Postgres heavy read query failed", zap.Error(err))
+				if payload.Reads && len(stmts) > 0 {
+					if _, err := stmts[stmtIndex%len(stmts)].Exec(stmtIndex); err != nil {
+						logWarn("Postgres heavy prepared read failed", zap.Error(err))
+					}
+					stmtIndex++
+				} else if payload.Reads {
+					if _, err := readDB.Query("SELECT 1"); err != nil {
+						logWarn("Postgres heavy read query failed", zap.Error(err))
 					}
 				}
-				if payload.Writes {
+				if payload.Transactions {
+					if err := runStressTransaction(engine, db, txStatements, rollbackPercent, &txStats); err != nil {
+						logWarn("Postgres heavy transaction failed", zap.Error(err))
+					}
+				} else if payload.Writes {
 					if _, err := db.Exec("INSERT INTO biggie_test_table(value) VALUES('stress')"); err != nil {
-						fmt.Println("Postgres heavy write query failed", zap.Error(err))
+						logWarn("Postgres heavy write query failed", zap.Error(err))
 					}
 				}
 			}
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
+		closeStatements(stmts)
 		db.Close()
-		fmt.Println("Postgres heavy query (single connection) completed", zap.Int("duration_sec", maintainSec))
+		if readDB != db {
+			readDB.Close()
+		}
+		logInfo("Postgres heavy query (single connection) completed", zap.Int("duration_sec", maintainSec))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
-			"message":            "Postgres heavy query (single connection) started",
-			"maintain_second":    maintainSec,
-			"query_per_interval": queryPerInterval,
-			"interval_second":    intervalSec,
+			"message":             "Postgres heavy query (single connection) started",
+			"maintain_second":     maintainSec,
+			"query_per_interval":  queryPerInterval,
+			"interval_second":     intervalSec,
+			"use_reader":          payload.UseReader,
+			"prepared_statements": preparedCount,
+			"transactions":        payload.Transactions,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
-			"message":            "Postgres heavy query (single connection) completed",
-			"maintain_second":    maintainSec,
-			"query_per_interval": queryPerInterval,
-			"interval_second":    intervalSec,
+			"message":             "Postgres heavy query (single connection) completed",
+			"maintain_second":     maintainSec,
+			"query_per_interval":  queryPerInterval,
+			"interval_second":     intervalSec,
+			"use_reader":          payload.UseReader,
+			"prepared_statements": preparedCount,
+			"transactions":        payload.Transactions,
+			"transaction_stats":   txStats.toMap(),
 		})
 	}
 }
@@ -121,7 +190,7 @@ func PostgresHeavyHandler(c *gin.Context) {
 // with each connection executing queries for the specified duration.
 func PostgresMultiHeavyHandler(c *gin.Context) {
 	var payload PostgresMultiHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -129,76 +198,127 @@ func PostgresMultiHeavyHandler(c *gin.Context) {
 	queryPerInterval := int(payload.QueryPerInterval)
 	intervalSec := int(payload.IntervalSecond)
 	connectionCounts := int(payload.ConnectionCounts)
+	preparedCount := int(payload.PreparedStatements)
+	txStatements := int(payload.StatementsPerTransaction)
+	if txStatements <= 0 {
+		txStatements = 4
+	}
+	rollbackPercent := int(payload.RollbackPercent)
+	var txStats stressTransactionStats
 
-	cfg, err := GetPostgresConfig()
+	engine, driver, dsn, err := stressDBTarget("postgres")
 	if err != nil {
 		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
 		return
 	}
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	readerDSN := dsn
+	if payload.UseReader && engine != dbEngineSQLite {
+		readerCfg, err := GetPostgresReaderConfig()
+		if err != nil {
+			ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
+			return
+		}
+		readerDSN = fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+			readerCfg.Username, readerCfg.Password, readerCfg.Host, readerCfg.Port, readerCfg.DBName)
+	}
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var wg sync.WaitGroup
 		for i := 0; i < connectionCounts; i++ {
 			wg.Add(1)
 			go func(connNum int) {
 				defer wg.Done()
-				db, err := sql.Open("pgx", dsn)
+				db, err := sql.Open(driver, dsn)
 				if err != nil {
-					fmt.Println("Postgres multi heavy connection open failed", zap.Int("conn", connNum), zap.Error(err))
+					logWarn("Postgres multi heavy connection open failed", zap.Int("conn", connNum), zap.Error(err))
 					return
 				}
 				defer db.Close()
 				if err = db.Ping(); err != nil {
-					fmt.Println("Postgres multi heavy ping failed", zap.Int("conn", connNum), zap.Error(err))
+					logWarn("Postgres multi heavy ping failed", zap.Int("conn", connNum), zap.Error(err))
 					return
 				}
 
-				if err := SetupTestDatabase("postgres", db); err != nil {
+				if err := SetupTestDatabase(engine, db); err != nil {
 					ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
 					return
 				}
+				readDB := db
+				if payload.UseReader {
+					if readDB, err = sql.Open(driver, readerDSN); err == nil {
+						err = readDB.Ping()
+					}
+					if err != nil {
+						logWarn("Postgres multi heavy reader connection failed", zap.Int("conn", connNum), zap.Error(err))
+						return
+					}
+					defer readDB.Close()
+				}
+				stmts, err := prepareStressStatements(engine, readDB, preparedCount)
+				if err != nil {
+					logWarn("Postgres multi heavy prepare failed", zap.Int("conn", connNum), zap.Int("prepared", len(stmts)), zap.Error(err))
+				}
+				defer closeStatements(stmts)
+				stmtIndex := 0
 
 				endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-				for time.Now().Before(endTime) {
+				for time.Now().Before(endTime) && ctx.Err() == nil {
 					for j := 0; j < queryPerInterval; j++ {
-						if payload.Reads {
-							if _, err := db.Query("SELECT 1"); err != nil {
-								fmt.Println("Postgres multi heavy read query failed", zap.Int("conn", connNum), zap.Error(err))
+						if payload.Reads && len(stmts) > 0 {
+							if _, err := stmts[stmtIndex%len(stmts)].Exec(stmtIndex); err != nil {
+								logWarn("Postgres multi heavy prepared read failed", zap.Int("conn", connNum), zap.Error(err))
+							}
+							stmtIndex++
+						} else if payload.Reads {
+							if _, err := readDB.Query("SELECT 1"); err != nil {
+								logWarn("Postgres multi heavy read query failed", zap.Int("conn", connNum), zap.Error(err))
 							}
 						}
-						if payload.Writes {
+						if payload.Transactions {
+							if err := runStressTransaction(engine, db, txStatements, rollbackPercent, &txStats); err != nil {
+								logWarn("Postgres multi heavy transaction failed", zap.Int("conn", connNum), zap.Error(err))
+							}
+						} else if payload.Writes {
 							if _, err := db.Exec("INSERT INTO biggie_test_table(value) VALUES('stress')"); err != nil {
-								fmt.Println("Postgres multi heavy write query failed", zap.Int("conn", connNum), zap.Error(err))
+								logWarn("Postgres multi heavy write query failed", zap.Int("conn", connNum), zap.Error(err))
 							}
 						}
 					}
-					time.Sleep(time.Duration(intervalSec) * time.Second)
+					sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 				}
 			}(i)
 		}
 		wg.Wait()
-		fmt.Println("Postgres multi heavy query completed", zap.Int("connections", connectionCounts))
+		logInfo("Postgres multi heavy query completed", zap.Int("connections", connectionCounts))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
-			"message":            "Postgres multi heavy query started",
-			"maintain_second":    maintainSec,
-			"query_per_interval": queryPerInterval,
-			"interval_second":    intervalSec,
-			"connection_counts":  connectionCounts,
+			"message":             "Postgres multi heavy query started",
+			"maintain_second":     maintainSec,
+			"query_per_interval":  queryPerInterval,
+			"interval_second":     intervalSec,
+			"connection_counts":   connectionCounts,
+			"use_reader":          payload.UseReader,
+			"prepared_statements": preparedCount,
+			"transactions":        payload.Transactions,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
-			"message":            "Postgres multi heavy query completed",
-			"maintain_second":    maintainSec,
-			"query_per_interval": queryPerInterval,
-			"interval_second":    intervalSec,
-			"connection_counts":  connectionCounts,
+			"message":             "Postgres multi heavy query completed",
+			"maintain_second":     maintainSec,
+			"query_per_interval":  queryPerInterval,
+			"interval_second":     intervalSec,
+			"connection_counts":   connectionCounts,
+			"use_reader":          payload.UseReader,
+			"prepared_statements": preparedCount,
+			"transactions":        payload.Transactions,
+			"transaction_stats":   txStats.toMap(),
 		})
 	}
 }
@@ -207,7 +327,7 @@ func PostgresMultiHeavyHandler(c *gin.Context) {
 // It simulates heavy connection load by gradually establishing multiple connections.
 func PostgresConnectionHandler(c *gin.Context) {
 	var payload PostgresConnectionPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -215,17 +335,19 @@ func PostgresConnectionHandler(c *gin.Context) {
 	connectionCounts := int(payload.ConnectionCounts)
 	increasePerInterval := int(payload.IncreasePerInterval)
 	intervalSec := int(payload.IntervalSecond)
+	leak := payload.Leak
+	serverConnections, maxConnections, leakedTotal := -1, -1, 0
 
-	cfg, err := GetPostgresConfig()
+	engine, driver, dsn, err := stressDBTarget("postgres")
 	if err != nil {
 		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
 		return
 	}
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var connections []*sql.DB
+		var sessions []*sql.Tx
 		var mu sync.Mutex
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
 		currentCount := 0
@@ -237,24 +359,35 @@ func PostgresConnectionHandler(c *gin.Context) {
 			select {
 			case <-ticker.C:
 				for i := 0; i < increasePerInterval && currentCount < connectionCounts; i++ {
-					db, err := sql.Open("pgx", dsn)
+					db, err := sql.Open(driver, dsn)
 					if err != nil {
-						fmt.Println("Postgres connection stress open failed", zap.Error(err))
+						logWarn("Postgres connection stress open failed", zap.Error(err))
 						continue
 					}
 					if err = db.Ping(); err != nil {
-						fmt.Println("Postgres connection stress ping failed", zap.Error(err))
+						logWarn("Postgres connection stress ping failed", zap.Error(err))
 						db.Close()
 						continue
 					}
 
-					if err := SetupTestDatabase("postgres", db); err != nil {
+					if err := SetupTestDatabase(engine, db); err != nil {
 						ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
 						return
 					}
+					var tx *sql.Tx
+					if leak {
+						if tx, err = beginLeakSession(db); err != nil {
+							logWarn("Postgres connection stress begin failed", zap.Error(err))
+							db.Close()
+							continue
+						}
+					}
 
 					mu.Lock()
 					connections = append(connections, db)
+					if tx != nil {
+						sessions = append(sessions, tx)
+					}
 					currentCount++
 					mu.Unlock()
 				}
@@ -265,41 +398,70 @@ func PostgresConnectionHandler(c *gin.Context) {
 					break Loop
 				}
 			default:
-				if time.Now().After(endTime) {
+				if time.Now().After(endTime) || ctx.Err() != nil {
 					break Loop
 				}
-				time.Sleep(100 * time.Millisecond)
+				sleepContext(ctx, 100*time.Millisecond)
 			}
 		}
 		remaining := time.Until(endTime)
 		if remaining > 0 {
-			time.Sleep(remaining)
+			sleepContext(ctx, remaining)
 		}
 		mu.Lock()
-		for _, db := range connections {
-			db.Close()
+		// Measure on a held session: a new connection may be refused once max_connections is reached.
+		var q dbQuerier
+		if len(sessions) > 0 {
+			q = sessions[0]
+		} else if len(connections) > 0 {
+			q = connections[0]
+		}
+		if q != nil {
+			if current, maxConns, err := serverConnectionCount(engine, q); err != nil {
+				logWarn("Postgres server connection count failed", zap.Error(err))
+			} else {
+				serverConnections, maxConnections = current, maxConns
+			}
+		}
+		if leak {
+			leakedTotal = leakDBSessions(sessions)
+		} else {
+			for _, db := range connections {
+				db.Close()
+			}
 		}
 		mu.Unlock()
-		fmt.Println("Postgres connection stress completed", zap.Int("connections", currentCount))
+		logInfo("Postgres connection stress completed",
+			zap.Int("connections", currentCount),
+			zap.Int("server_connections", serverConnections),
+			zap.Int("max_connections", maxConnections),
+			zap.Bool("leaked", leak))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":               "Postgres connection stress started",
 			"maintain_second":       maintainSec,
 			"connection_counts":     connectionCounts,
 			"increase_per_interval": increasePerInterval,
 			"interval_second":       intervalSec,
+			"leak":                  leak,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
 			"message":               "Postgres connection stress completed",
 			"maintain_second":       maintainSec,
 			"connection_counts":     connectionCounts,
 			"increase_per_interval": increasePerInterval,
 			"interval_second":       intervalSec,
+			"leak":                  leak,
+			"server_connections":    serverConnections,
+			"max_connections":       maxConnections,
+			"leaked_sessions_total": leakedTotal,
 		})
 	}
 }
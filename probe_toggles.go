@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ProbeTogglePayload defines the payload for flipping the result of a health probe.
+type ProbeTogglePayload struct {
+	Mode           string  `json:"mode"`            // fail, fail_after, flap or reset.
+	AfterRequests  DuckInt `json:"after_requests"`  // fail_after: probes that pass before it fails.
+	DurationSecond DuckInt `json:"duration_second"` // How long the probe misbehaves, 0 until reset.
+	PeriodSecond   DuckInt `json:"period_second"`   // flap: a full pass and fail cycle.
+	StatusCode     DuckInt `json:"status_code"`     // Status of the failures, 503 by default.
+}
+
+// Modes of a probe toggle.
+const (
+	probeFail      = "fail"
+	probeFailAfter = "fail_after"
+	probeFlap      = "flap"
+	probeReset     = "reset"
+)
+
+// probeToggle overrides the result of a probe until it expires or is reset.
+type probeToggle struct {
+	mode          string
+	afterRequests int
+	period        time.Duration
+	statusCode    int
+	setAt         time.Time
+	expiry        time.Time // Zero until reset.
+	probes        int       // Probes answered since it was set.
+	failures      int
+}
+
+// Global variables for the probe toggles, by probe name (liveness, readiness).
+var (
+	probeToggleMutex sync.Mutex
+	probeToggles     = map[string]*probeToggle{}
+)
+
+// active reports whether the toggle still applies at now.
+func (t *probeToggle) active(now time.Time) bool {
+	return t.expiry.IsZero() || now.Before(t.expiry)
+}
+
+// failing reports whether the probe fails at now, counting the probe.
+func (t *probeToggle) failing(now time.Time) bool {
+	t.probes++
+	fail := true
+	switch t.mode {
+	case probeFailAfter:
+		fail = t.probes > t.afterRequests
+	case probeFlap:
+		// Pass for the first half of every period, fail for the second.
+		fail = now.Sub(t.setAt)%t.period >= t.period/2
+	}
+	if fail {
+		t.failures++
+	}
+	return fail
+}
+
+func (t *probeToggle) toMap(now time.Time) gin.H {
+	m := gin.H{
+		"mode":        t.mode,
+		"status_code": t.statusCode,
+		"set_at":      t.setAt.UTC().Format(time.RFC3339Nano),
+		"probes":      t.probes,
+		"failures":    t.failures,
+		"active":      t.active(now),
+	}
+	switch t.mode {
+	case probeFailAfter:
+		m["after_requests"] = t.afterRequests
+	case probeFlap:
+		m["period_second"] = t.period.Seconds()
+	}
+	if !t.expiry.IsZero() {
+		m["expires_at"] = t.expiry.UTC().Format(time.RFC3339Nano)
+	}
+	return m
+}
+
+// probeToggleFailure checks the toggle of probe and, if it fails the probe, answers with its
+// status and reports true.
+func probeToggleFailure(c *gin.Context, probe, errorType string) bool {
+	now := time.Now()
+	probeToggleMutex.Lock()
+	t, ok := probeToggles[probe]
+	if !ok || !t.active(now) {
+		probeToggleMutex.Unlock()
+		return false
+	}
+	fail := t.failing(now)
+	state := t.toMap(now)
+	probeToggleMutex.Unlock()
+	if !fail {
+		return false
+	}
+	ResponseJSON(c, t.statusCode, gin.H{
+		"error":   errorType,
+		"message": probe + " probe failed by toggle",
+		"toggle":  state,
+	})
+	return true
+}
+
+// resetProbeToggles ends every probe toggle.
+func resetProbeToggles() {
+	probeToggleMutex.Lock()
+	probeToggles = map[string]*probeToggle{}
+	probeToggleMutex.Unlock()
+}
+
+// toggleProbe sets or resets the toggle of probe from the payload of c.
+func toggleProbe(c *gin.Context, probe string) {
+	var payload ProbeTogglePayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	now := time.Now()
+	if payload.Mode == probeReset {
+		probeToggleMutex.Lock()
+		delete(probeToggles, probe)
+		probeToggleMutex.Unlock()
+		logInfo("Probe toggle reset", zap.String("probe", probe))
+		publishEvent(eventConfigChanged, gin.H{"probe": probe, "toggle": probeReset})
+		ResponseJSON(c, http.StatusOK, gin.H{"message": probe + " probe reset", "probe": probe})
+		return
+	}
+
+	t := &probeToggle{
+		mode:          payload.Mode,
+		afterRequests: int(payload.AfterRequests),
+		period:        time.Duration(payload.PeriodSecond) * time.Second,
+		statusCode:    int(payload.StatusCode),
+		setAt:         now,
+	}
+	switch {
+	case t.mode != probeFail && t.mode != probeFailAfter && t.mode != probeFlap:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "mode must be fail, fail_after, flap or reset")
+		return
+	case t.mode == probeFailAfter && t.afterRequests < 0:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "after_requests must not be negative")
+		return
+	case t.mode == probeFlap && t.period < 2*time.Second:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "period_second must be at least 2 to flap")
+		return
+	case payload.DurationSecond < 0:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "duration_second must not be negative")
+		return
+	}
+	if t.statusCode == 0 {
+		t.statusCode = http.StatusServiceUnavailable
+	}
+	if t.statusCode < 200 || t.statusCode > 599 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "status_code must be between 200 and 599")
+		return
+	}
+	if payload.DurationSecond > 0 {
+		t.expiry = now.Add(time.Duration(payload.DurationSecond) * time.Second)
+	}
+
+	probeToggleMutex.Lock()
+	probeToggles[probe] = t
+	state := t.toMap(now)
+	probeToggleMutex.Unlock()
+	logInfo("Probe toggled", zap.String("probe", probe), zap.Any("toggle", state))
+	publishEvent(eventConfigChanged, gin.H{"probe": probe, "toggle": state})
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message": probe + " probe toggled",
+		"probe":   probe,
+		"toggle":  state,
+	})
+}
+
+// LivenessToggleHandler handles POST /healthcheck/live/toggle.
+func LivenessToggleHandler(c *gin.Context) {
+	toggleProbe(c, "liveness")
+}
+
+// ReadinessToggleHandler handles POST /healthcheck/ready/toggle.
+func ReadinessToggleHandler(c *gin.Context) {
+	toggleProbe(c, "readiness")
+}
+
+// LivenessHandler handles GET /healthcheck/live.
+// It answers 200 while the process runs, even while draining, unless its toggle fails it.
+func LivenessHandler(c *gin.Context) {
+	if probeToggleFailure(c, "liveness", "NOT_LIVE") {
+		return
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{"message": "alive"})
+}
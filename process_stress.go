@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Child process kinds spawned by the process stress.
+const (
+	processSleeper = "sleeper" // Sleeps until the end of the stress.
+	processCPU     = "cpu"     // Burns one core until the end of the stress.
+	processZombie  = "zombie"  // Exits immediately and is not reaped until the end of the stress.
+	processOrphan  = "orphan"  // Starts a sleeper and exits, leaving it to be reparented to PID 1.
+)
+
+// Environment variables that turn the biggie binary into a child process.
+const (
+	childModeEnv   = "BIGGIE_CHILD_MODE"
+	childSecondEnv = "BIGGIE_CHILD_SECOND"
+	childExit      = "exit" // Child mode used for zombies.
+)
+
+// ProcessStressPayload defines the payload for the process spawner.
+type ProcessStressPayload struct {
+	Kind           string  `json:"kind"`             // sleeper (default), cpu, zombie or orphan.
+	Count          DuckInt `json:"count"`            // Number of processes to spawn.
+	SpawnPerSecond DuckInt `json:"spawn_per_second"` // 0 spawns all at once.
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+}
+
+// processStats counts spawned child processes.
+type processStats struct {
+	spawned int64
+	failed  int64
+	reaped  int64
+}
+
+func (s *processStats) toMap() gin.H {
+	return gin.H{
+		"spawned": atomic.LoadInt64(&s.spawned),
+		"failed":  atomic.LoadInt64(&s.failed),
+		"reaped":  atomic.LoadInt64(&s.reaped),
+	}
+}
+
+// runChildProcess runs the child side of the process stress and reports whether the
+// binary was started as a child.
+func runChildProcess() bool {
+	mode := os.Getenv(childModeEnv)
+	if mode == "" {
+		return false
+	}
+	seconds, _ := strconv.Atoi(os.Getenv(childSecondEnv))
+	switch mode {
+	case childExit:
+	case processSleeper:
+		time.Sleep(time.Duration(seconds) * time.Second)
+	case processCPU:
+		runCPUStress(context.Background(), 100, seconds, 1, cpuWorkloadBusyLoop)
+	case processOrphan:
+		// Start a sleeper and exit without waiting for it.
+		cmd, err := childCommand(processSleeper, seconds)
+		if err == nil {
+			cmd.Start()
+		}
+	}
+	return true
+}
+
+// childCommand returns a command re-executing the biggie binary as a child of the given kind.
+func childCommand(kind string, seconds int) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self)
+	cmd.Env = append(os.Environ(), childModeEnv+"="+kind, childSecondEnv+"="+strconv.Itoa(seconds))
+	return cmd, nil
+}
+
+// ProcessStressHandler handles POST /stress/processes.
+// It spawns count child processes at spawn_per_second. Sleepers and CPU burners run until
+// maintain_second ends; zombies exit at once but are only reaped at the end; orphans leave a
+// sleeper behind that must be reaped by the container's init process.
+func ProcessStressHandler(c *gin.Context) {
+	var payload ProcessStressPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	kind := payload.Kind
+	if kind == "" {
+		kind = processSleeper
+	}
+	switch kind {
+	case processSleeper, processCPU, processZombie, processOrphan:
+	default:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "kind must be sleeper, cpu, zombie or orphan")
+		return
+	}
+	count := int(payload.Count)
+	spawnPerSecond := int(payload.SpawnPerSecond)
+	maintainSec := int(payload.MaintainSecond)
+
+	var stats processStats
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		var zombies, children []*exec.Cmd
+		var wg sync.WaitGroup
+		for i := 0; i < count && ctx.Err() == nil; i++ {
+			if spawnPerSecond > 0 && i > 0 && !sleepContext(ctx, time.Second/time.Duration(spawnPerSecond)) {
+				break
+			}
+			remaining := int(time.Until(endTime).Seconds())
+			if remaining < 0 {
+				remaining = 0
+			}
+			childKind := kind
+			if kind == processZombie {
+				// The child exits at once; not waiting for it leaves a <defunct> entry.
+				childKind = childExit
+			}
+			cmd, err := childCommand(childKind, remaining)
+			if err == nil {
+				err = cmd.Start()
+			}
+			if err != nil {
+				// Typically EAGAIN once the PID limit of the container is reached.
+				atomic.AddInt64(&stats.failed, 1)
+				logError("Failed to spawn process", zap.String("kind", kind), zap.Error(err))
+				continue
+			}
+			atomic.AddInt64(&stats.spawned, 1)
+			if kind == processZombie {
+				zombies = append(zombies, cmd)
+				continue
+			}
+			children = append(children, cmd)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cmd.Wait()
+				atomic.AddInt64(&stats.reaped, 1)
+			}()
+		}
+		if !sleepContext(ctx, time.Until(endTime)) {
+			// Cancelled: end the children now rather than at maintain_second.
+			for _, cmd := range children {
+				cmd.Process.Kill()
+			}
+		}
+		for _, cmd := range zombies {
+			cmd.Wait()
+			atomic.AddInt64(&stats.reaped, 1)
+		}
+		wg.Wait()
+		logInfo("Process stress completed",
+			zap.String("kind", kind),
+			zap.Int64("spawned", atomic.LoadInt64(&stats.spawned)),
+			zap.Int64("failed", atomic.LoadInt64(&stats.failed)))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":          "process stress started",
+			"kind":             kind,
+			"count":            count,
+			"spawn_per_second": spawnPerSecond,
+			"maintain_second":  maintainSec,
+		})
+	} else {
+		job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":          "process stress completed",
+			"kind":             kind,
+			"count":            count,
+			"spawn_per_second": spawnPerSecond,
+			"maintain_second":  maintainSec,
+			"results":          stats.toMap(),
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Phases of a job at which profiles are captured.
+const (
+	profilePhaseStart  = "start"
+	profilePhaseMiddle = "middle"
+	profilePhaseEnd    = "end"
+)
+
+// jobProfile is one CPU or heap profile of a job.
+type jobProfile struct {
+	phase      string
+	kind       string // "cpu" or "heap".
+	capturedAt time.Time
+	duration   time.Duration // Sampling time of CPU profiles.
+	data       []byte
+	err        string
+}
+
+// name returns the file name of the profile, e.g. "middle-cpu.pb.gz".
+func (p *jobProfile) name() string {
+	return fmt.Sprintf("%s-%s.pb.gz", p.phase, p.kind)
+}
+
+func (p *jobProfile) toMap(jobID string) gin.H {
+	m := gin.H{
+		"name":        p.name(),
+		"phase":       p.phase,
+		"type":        p.kind,
+		"captured_at": p.capturedAt.UTC().Format(time.RFC3339Nano),
+		"bytes":       len(p.data),
+	}
+	if p.kind == "cpu" {
+		m["duration_second"] = p.duration.Seconds()
+	}
+	if p.err != "" {
+		m["error"] = p.err
+	} else {
+		m["url"] = fmt.Sprintf("/jobs/%s/profiles/%s", jobID, p.name())
+	}
+	return m
+}
+
+// profileOptions are the fields of a stress payload that control self-profiling.
+type profileOptions struct {
+	Pprof          bool    `json:"pprof"`           // Capture CPU and heap profiles of the job.
+	PprofSecond    DuckInt `json:"pprof_second"`    // CPU sampling time per phase, default 10.
+	MaintainSecond DuckInt `json:"maintain_second"` // Duration of the job, used to place the phases.
+}
+
+// ProfilingMiddleware registers a job for every stress request whose JSON body has
+// "pprof": true, and captures CPU and heap profiles of the process at the start, middle
+// and end of its maintain_second. Without maintain_second only the start is profiled.
+// Rejected requests do not keep their job.
+func ProfilingMiddleware(c *gin.Context) {
+	raw, ok := c.Get("rawBody")
+	if !ok {
+		c.Next()
+		return
+	}
+	var opts profileOptions
+	if json.Unmarshal([]byte(raw.(string)), &opts) != nil || !opts.Pprof {
+		c.Next()
+		return
+	}
+	job := registerJob(c)
+	go profileJob(job.ctx, job, time.Duration(opts.MaintainSecond)*time.Second, time.Duration(opts.PprofSecond)*time.Second)
+	c.Next()
+	discardRejectedJob(c, job)
+}
+
+// profileJob captures the profiles of job over maintain, sampling the CPU for window per
+// phase.
+func profileJob(ctx context.Context, job *stressJob, maintain, window time.Duration) {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	offsets := map[string]time.Duration{profilePhaseStart: 0}
+	if maintain > 0 {
+		// The three CPU samples must fit into the job without overlapping.
+		window = max(time.Second, min(window, maintain/3))
+		offsets[profilePhaseMiddle] = maintain/2 - window/2
+		offsets[profilePhaseEnd] = maintain - window
+	}
+	for _, phase := range []string{profilePhaseStart, profilePhaseMiddle, profilePhaseEnd} {
+		offset, ok := offsets[phase]
+		if !ok {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(job.StartedAt.Add(offset))):
+		}
+		job.addProfile(captureHeapProfile(phase))
+		job.addProfile(captureCPUProfile(ctx, phase, window))
+	}
+}
+
+// addProfile stores p in the job.
+func (j *stressJob) addProfile(p *jobProfile) {
+	if p == nil {
+		return
+	}
+	j.mu.Lock()
+	j.profiles = append(j.profiles, p)
+	j.mu.Unlock()
+	if p.err != "" {
+		logWarn("Job profile failed", zap.String("job_id", j.ID), zap.String("profile", p.name()), zap.String("error", p.err))
+	}
+}
+
+// captureHeapProfile returns a heap profile of the process.
+func captureHeapProfile(phase string) *jobProfile {
+	p := &jobProfile{phase: phase, kind: "heap", capturedAt: time.Now()}
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		p.err = err.Error()
+		return p
+	}
+	p.data = buf.Bytes()
+	return p
+}
+
+// captureCPUProfile samples the CPU for window. Only one CPU profile can run in the process
+// at a time, so it fails while another job is profiling. It returns nil when ctx is
+// cancelled.
+func captureCPUProfile(ctx context.Context, phase string, window time.Duration) *jobProfile {
+	p := &jobProfile{phase: phase, kind: "cpu", capturedAt: time.Now()}
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		p.err = err.Error()
+		return p
+	}
+	select {
+	case <-ctx.Done():
+		pprof.StopCPUProfile()
+		return nil
+	case <-time.After(window):
+	}
+	pprof.StopCPUProfile()
+	p.duration = time.Since(p.capturedAt)
+	p.data = buf.Bytes()
+	return p
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTP1OnlyHandler handles GET /protocol/http1_only.
+// It rejects HTTP/2 requests with 505 HTTP Version Not Supported, like a backend that only
+// speaks HTTP/1.1. HTTP/2 reaches the server as h2c when H2C_ENABLED is true.
+func HTTP1OnlyHandler(c *gin.Context) {
+	if c.Request.ProtoMajor >= 2 {
+		ErrorJSON(c, http.StatusHTTPVersionNotSupported, "HTTP_VERSION_NOT_SUPPORTED", "this endpoint only supports http/1.x")
+		return
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":  "http/1.x ok",
+		"protocol": c.Request.Proto,
+	})
+}
+
+// HTTP10Handler handles GET /protocol/http10?size=<bytes>.
+// It answers with a raw HTTP/1.0 response: no Content-Length, no chunked encoding, and the
+// body ends when the connection closes, whatever the client asked for.
+func HTTP10Handler(c *gin.Context) {
+	size, err := strconv.Atoi(c.Query("size"))
+	if err != nil || size < 0 {
+		size = 1024
+	}
+	if size > 64*1024*1024 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "size must not exceed 64mib")
+		return
+	}
+	conn, buf, err := c.Writer.Hijack()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "HIJACK_FAILED", err.Error())
+		return
+	}
+	defer conn.Close()
+	buf.WriteString("HTTP/1.0 200 OK\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(buf, "Date: %s\r\n\r\n", time.Now().UTC().Format(http.TimeFormat))
+	buf.WriteString(strings.Repeat("x", size))
+	buf.Flush()
+}
+
+// upgradeModes are the Upgrade behaviors of UpgradeHandler.
+var upgradeModes = map[string]string{
+	"ignore":     "answer 200 as if no upgrade was requested",
+	"reject":     "answer 426 Upgrade Required while asking for the requested protocol",
+	"close":      "answer 101 Switching Protocols and close the connection at once",
+	"garbage":    "answer 101 Switching Protocols and send random bytes that are not the new protocol",
+	"bad_accept": "answer 101 with a wrong Sec-WebSocket-Accept header",
+	"hang":       "accept the connection and never answer until hang_second passes",
+}
+
+// UpgradeHandler handles GET /protocol/upgrade?mode=<mode>.
+// It mishandles Upgrade requests (e.g. WebSocket) on purpose, to test how proxies and
+// clients cope with a backend that gets the protocol switch wrong.
+func UpgradeHandler(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "close")
+	if _, ok := upgradeModes[mode]; !ok {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "mode must be ignore, reject, close, garbage, bad_accept or hang")
+		return
+	}
+	protocol := c.GetHeader("Upgrade")
+	if protocol == "" {
+		protocol = "websocket"
+	}
+
+	switch mode {
+	case "ignore":
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":  "upgrade ignored",
+			"upgrade":  c.GetHeader("Upgrade"),
+			"mode":     mode,
+			"behavior": upgradeModes[mode],
+			"protocol": c.Request.Proto,
+		})
+		return
+	case "reject":
+		c.Header("Upgrade", protocol)
+		c.Header("Connection", "Upgrade")
+		ErrorJSON(c, http.StatusUpgradeRequired, "UPGRADE_REQUIRED", "upgrade to "+protocol+" required")
+		return
+	}
+
+	conn, buf, err := c.Writer.Hijack()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "HIJACK_FAILED", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	switch mode {
+	case "hang":
+		hangSec, err := strconv.Atoi(c.Query("hang_second"))
+		if err != nil || hangSec <= 0 {
+			hangSec = 30
+		}
+		time.Sleep(time.Duration(hangSec) * time.Second)
+		return
+	case "bad_accept":
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		fmt.Fprintf(buf, "Upgrade: %s\r\nConnection: Upgrade\r\n", protocol)
+		buf.WriteString("Sec-WebSocket-Accept: aW52YWxpZC1hY2NlcHQta2V5\r\n\r\n")
+		buf.Flush()
+		// Keep the connection open briefly so the client sees the handshake before the close.
+		time.Sleep(time.Second)
+		return
+	}
+
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	fmt.Fprintf(buf, "Upgrade: %s\r\nConnection: Upgrade\r\n\r\n", protocol)
+	if mode == "garbage" {
+		garbage := make([]byte, 4096)
+		rand.Read(garbage)
+		buf.Write(garbage)
+	}
+	buf.Flush()
+}
+
+// Limits of H2StreamsHandler.
+const (
+	maxH2Streams    = 100
+	maxH2Frames     = 100000
+	maxH2FrameBytes = 1024 * 1024
+)
+
+// H2StreamsHandler handles GET /protocol/h2_streams?streams=[number]&frames=[number]&frame_bytes=[number]&interval_ms=[list]&push=[bool].
+// It writes frames small chunks, each flushed as its own DATA frame, waiting interval_ms
+// between them. With push over HTTP/2, it first pushes streams-1 copies of itself, which the
+// server writes concurrently, so the DATA frames of the streams interleave on the connection.
+// Each chunk names its stream and frame, to observe how load balancers and clients multiplex.
+func H2StreamsHandler(c *gin.Context) {
+	streams, err := strconv.Atoi(c.DefaultQuery("streams", "10"))
+	if err != nil || streams <= 0 || streams > maxH2Streams {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("streams must be an integer between 1 and %d", maxH2Streams))
+		return
+	}
+	frames, err := strconv.Atoi(c.DefaultQuery("frames", "20"))
+	if err != nil || frames <= 0 || frames > maxH2Frames {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("frames must be an integer between 1 and %d", maxH2Frames))
+		return
+	}
+	frameBytes, err := strconv.Atoi(c.DefaultQuery("frame_bytes", "64"))
+	if err != nil || frameBytes < 64 || frameBytes > maxH2FrameBytes {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("frame_bytes must be an integer between 64 and %d", maxH2FrameBytes))
+		return
+	}
+	intervals, err := queryDuckInts(c.DefaultQuery("interval_ms", "10"), frames)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "interval_ms: "+err.Error())
+		return
+	}
+	stream := c.DefaultQuery("stream", "0")
+
+	// Only the stream requested by the client pushes the others.
+	pushed := 0
+	if pusher := c.Writer.Pusher(); pusher != nil && stream == "0" && c.Query("push") == "true" {
+		for i := 1; i < streams; i++ {
+			query := c.Request.URL.Query()
+			query.Set("stream", strconv.Itoa(i))
+			query.Del("push")
+			if err := pusher.Push(c.Request.URL.Path+"?"+query.Encode(), nil); err != nil {
+				c.Header("X-Biggie-Push-Error", err.Error())
+				break
+			}
+			pushed++
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("X-Biggie-Protocol", c.Request.Proto)
+	c.Header("X-Biggie-Stream", stream)
+	if stream == "0" {
+		c.Header("X-Biggie-Pushed", strconv.Itoa(pushed))
+	}
+	c.Status(http.StatusOK)
+	start := time.Now()
+	for i := 0; i < frames; i++ {
+		if i > 0 && !sleepContext(c.Request.Context(), time.Duration(intervals[i])*time.Millisecond) {
+			return
+		}
+		chunk := fmt.Sprintf("stream=%s frame=%d elapsed_ms=%d ", stream, i+1, time.Since(start).Milliseconds())
+		if len(chunk) < frameBytes {
+			chunk += strings.Repeat(".", frameBytes-len(chunk)-1)
+		}
+		if _, err := c.Writer.WriteString(chunk[:frameBytes-1] + "\n"); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
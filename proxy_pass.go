@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ProxyPassPayload defines a reverse proxy rule.
+type ProxyPassPayload struct {
+	PathPrefix  string `json:"path_prefix"`  // Requests whose path starts with it are forwarded.
+	UpstreamURL string `json:"upstream_url"` // Real service, e.g. http://orders.internal:8080.
+	StripPrefix bool   `json:"strip_prefix"` // Remove path_prefix from the forwarded path.
+}
+
+// proxyPassRule forwards the requests of one path prefix to an upstream.
+type proxyPassRule struct {
+	pathPrefix  string
+	upstream    *url.URL
+	stripPrefix bool
+	proxy       *httputil.ReverseProxy
+
+	requests       int64
+	upstreamErrors int64
+}
+
+func (r *proxyPassRule) toMap() gin.H {
+	return gin.H{
+		"path_prefix":     r.pathPrefix,
+		"upstream_url":    r.upstream.String(),
+		"strip_prefix":    r.stripPrefix,
+		"requests":        atomic.LoadInt64(&r.requests),
+		"upstream_errors": atomic.LoadInt64(&r.upstreamErrors),
+	}
+}
+
+// Global variables for the reverse proxy mode. Rules are sorted by descending prefix length
+// and replaced copy-on-write, so the middleware reads them without locking.
+var (
+	proxyPassMutex sync.Mutex
+	proxyPassRules atomic.Pointer[[]*proxyPassRule]
+)
+
+func init() {
+	proxyPassRules.Store(&[]*proxyPassRule{})
+}
+
+// newProxyPassRule builds the reverse proxy of a rule on the shared outbound transport,
+// so egress faults apply to the upstream calls too.
+func newProxyPassRule(pathPrefix string, upstream *url.URL, stripPrefix bool) *proxyPassRule {
+	rule := &proxyPassRule{pathPrefix: pathPrefix, upstream: upstream, stripPrefix: stripPrefix}
+	rule.proxy = &httputil.ReverseProxy{
+		Transport: getSharedTransport(),
+		Rewrite: func(r *httputil.ProxyRequest) {
+			if stripPrefix {
+				r.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.In.URL.Path, pathPrefix), "/")
+				r.Out.URL.RawPath = ""
+			}
+			r.SetURL(upstream)
+			r.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			atomic.AddInt64(&rule.upstreamErrors, 1)
+			logWarn("proxy pass upstream failed", zap.String("upstream_url", upstream.String()), zap.Error(err))
+			status := http.StatusBadGateway
+			if r.Context().Err() != nil {
+				status = http.StatusGatewayTimeout
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"UPSTREAM_FAILED","message":"upstream request failed","requested_at":"` +
+				time.Now().UTC().Format(time.RFC3339Nano) + `"}`))
+		},
+	}
+	return rule
+}
+
+// proxyPassStatus returns every rule with its counters.
+func proxyPassStatus() gin.H {
+	rules := []gin.H{}
+	for _, rule := range *proxyPassRules.Load() {
+		rules = append(rules, rule.toMap())
+	}
+	return gin.H{"rules": rules}
+}
+
+// ProxyPassStatusHandler handles GET /admin/proxy_pass.
+func ProxyPassStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, proxyPassStatus())
+}
+
+// ProxyPassHandler handles POST /admin/proxy_pass.
+// It forwards the requests of path_prefix to upstream_url, replacing the previous rule of
+// that prefix. The forwarded requests go through every fault middleware first, which turns
+// Biggie into a chaos proxy in front of an existing service.
+func ProxyPassHandler(c *gin.Context) {
+	var payload ProxyPassPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if !strings.HasPrefix(payload.PathPrefix, "/") || strings.HasPrefix(payload.PathPrefix, "/admin/") {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "path_prefix must start with / and must not be under /admin/")
+		return
+	}
+	upstream, err := url.Parse(payload.UpstreamURL)
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "upstream_url must be an http or https url")
+		return
+	}
+	if err := checkTargetAllowed(payload.UpstreamURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+
+	rule := newProxyPassRule(payload.PathPrefix, upstream, payload.StripPrefix)
+	proxyPassMutex.Lock()
+	rules := []*proxyPassRule{rule}
+	for _, r := range *proxyPassRules.Load() {
+		if r.pathPrefix != rule.pathPrefix {
+			rules = append(rules, r)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return len(rules[i].pathPrefix) > len(rules[j].pathPrefix) })
+	proxyPassRules.Store(&rules)
+	proxyPassMutex.Unlock()
+	logInfo("Proxy pass rule set",
+		zap.String("path_prefix", payload.PathPrefix),
+		zap.String("upstream_url", payload.UpstreamURL),
+		zap.Bool("strip_prefix", payload.StripPrefix))
+
+	status := proxyPassStatus()
+	status["message"] = "proxy pass rule set"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// ProxyPassDeleteHandler handles DELETE /admin/proxy_pass?path_prefix=<prefix>.
+// It removes the rule of path_prefix, or every rule without it.
+func ProxyPassDeleteHandler(c *gin.Context) {
+	prefix := c.Query("path_prefix")
+	proxyPassMutex.Lock()
+	rules := []*proxyPassRule{}
+	if prefix != "" {
+		for _, r := range *proxyPassRules.Load() {
+			if r.pathPrefix != prefix {
+				rules = append(rules, r)
+			}
+		}
+	}
+	proxyPassRules.Store(&rules)
+	proxyPassMutex.Unlock()
+
+	status := proxyPassStatus()
+	status["message"] = "proxy pass rules removed"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// ProxyPassMiddleware forwards requests matching a proxy pass rule to its upstream instead
+// of Biggie's own handlers. It is the last middleware, so every fault has been applied by
+// then. /admin/ is never forwarded.
+func ProxyPassMiddleware(c *gin.Context) {
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/admin/") {
+		c.Next()
+		return
+	}
+	for _, rule := range *proxyPassRules.Load() {
+		if strings.HasPrefix(path, rule.pathPrefix) {
+			atomic.AddInt64(&rule.requests, 1)
+			rule.proxy.ServeHTTP(c.Writer, c.Request)
+			c.Abort()
+			return
+		}
+	}
+	c.Next()
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// QueueSimulationPayload defines the payload for the queue-depth simulation.
+type QueueSimulationPayload struct {
+	ServiceRate    DuckInt `json:"service_rate"` // Requests per second the simulated server can process.
+	Workers        DuckInt `json:"workers"`      // Requests processed in parallel, default 1.
+	QueueSize      DuckInt `json:"queue_size"`   // Requests allowed to wait; further ones get 503.
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+}
+
+// queueSimulation is a bounded queue in front of a fixed number of workers.
+type queueSimulation struct {
+	slots       chan struct{}
+	serviceTime time.Duration
+	queueSize   int64
+	expiry      time.Time
+
+	waiting   int64
+	served    int64
+	rejected  int64
+	totalWait int64 // Nanoseconds.
+}
+
+func (q *queueSimulation) toMap() gin.H {
+	served := atomic.LoadInt64(&q.served)
+	avgWaitMs := 0.0
+	if served > 0 {
+		avgWaitMs = float64(atomic.LoadInt64(&q.totalWait)) / float64(served) / 1e6
+	}
+	return gin.H{
+		"served":      served,
+		"rejected":    atomic.LoadInt64(&q.rejected),
+		"avg_wait_ms": avgWaitMs,
+	}
+}
+
+// maxQueueWorkers bounds workers, the capacity of the worker slot channel.
+const maxQueueWorkers = 10000
+
+// Global variables for queue simulation.
+var (
+	queueSimMutex  sync.Mutex
+	activeQueueSim *queueSimulation
+)
+
+// QueueSimulationHandler handles POST /stress/queue.
+// While active, every request has to pass through a simulated server with the given service
+// rate: requests wait for a free worker, so latency grows as the arrival rate approaches the
+// service rate (Little's law), and requests beyond queue_size are rejected with 503.
+func QueueSimulationHandler(c *gin.Context) {
+	var payload QueueSimulationPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	serviceRate := int(payload.ServiceRate)
+	if serviceRate <= 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "service_rate must be positive")
+		return
+	}
+	workers := int(payload.Workers)
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > maxQueueWorkers {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("workers must not exceed %d", maxQueueWorkers))
+		return
+	}
+	queueSize := int(payload.QueueSize)
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	maintainSec := int(payload.MaintainSecond)
+	// Each worker takes workers/service_rate seconds per request, so together they serve service_rate per second.
+	serviceTime := time.Duration(float64(workers) / float64(serviceRate) * float64(time.Second))
+
+	sim := &queueSimulation{
+		slots:       make(chan struct{}, workers),
+		serviceTime: serviceTime,
+		queueSize:   int64(queueSize),
+		expiry:      time.Now().Add(time.Duration(maintainSec) * time.Second),
+	}
+	queueSimMutex.Lock()
+	activeQueueSim = sim
+	queueSimMutex.Unlock()
+	recordFaultActivated("queue", "", gin.H{
+		"service_rate": serviceRate,
+		"workers":      workers,
+		"queue_size":   queueSize,
+	}, sim.expiry)
+	logInfo("Queue simulation started",
+		zap.Int("service_rate", serviceRate),
+		zap.Int("workers", workers),
+		zap.Int("queue_size", queueSize),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	waitFunc := func(ctx context.Context) {
+		if !sleepContext(ctx, time.Duration(maintainSec)*time.Second) {
+			// Cancelled: end the queue simulation unless a later request replaced it.
+			queueSimMutex.Lock()
+			ours := activeQueueSim == sim
+			if ours {
+				activeQueueSim = nil
+			}
+			queueSimMutex.Unlock()
+			if ours {
+				recordFaultDeactivated("queue", "", "cancelled")
+			}
+		}
+		logInfo("Queue simulation ended",
+			zap.Int64("served", atomic.LoadInt64(&sim.served)),
+			zap.Int64("rejected", atomic.LoadInt64(&sim.rejected)))
+	}
+
+	if payload.Async {
+		go job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "queue simulation started",
+			"service_rate":    serviceRate,
+			"workers":         workers,
+			"queue_size":      queueSize,
+			"service_time_ms": float64(serviceTime.Microseconds()) / 1000,
+			"maintain_second": maintainSec,
+		})
+	} else {
+		job.run(waitFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "queue simulation completed",
+			"service_rate":    serviceRate,
+			"workers":         workers,
+			"queue_size":      queueSize,
+			"service_time_ms": float64(serviceTime.Microseconds()) / 1000,
+			"maintain_second": maintainSec,
+			"results":         sim.toMap(),
+		})
+	}
+}
+
+// queueExempt reports whether path bypasses the queue simulation. The request that starts it
+// must not queue behind itself, and health checks, jobs, /stress/stop_all and /admin/ stay
+// reachable so the instance is not replaced and the simulation can be stopped.
+func queueExempt(path string) bool {
+	return path == "/stress/queue" || path == "/stress/stop_all" ||
+		strings.HasPrefix(path, "/healthcheck") || path == "/jobs" ||
+		strings.HasPrefix(path, "/jobs/") || strings.HasPrefix(path, "/admin/")
+}
+
+// QueueSimulationMiddleware routes requests through the active queue simulation, if any.
+func QueueSimulationMiddleware(c *gin.Context) {
+	queueSimMutex.Lock()
+	sim := activeQueueSim
+	queueSimMutex.Unlock()
+	if sim == nil || !time.Now().Before(sim.expiry) || queueExempt(c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+
+	start := time.Now()
+	select {
+	case sim.slots <- struct{}{}:
+		// A worker was free; no waiting.
+	default:
+		if atomic.AddInt64(&sim.waiting, 1) > sim.queueSize {
+			atomic.AddInt64(&sim.waiting, -1)
+			atomic.AddInt64(&sim.rejected, 1)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":        "QUEUE_FULL",
+				"message":      "simulated server queue is full",
+				"requested_at": time.Now().UTC().Format(time.RFC3339Nano),
+			})
+			return
+		}
+		sim.slots <- struct{}{}
+		atomic.AddInt64(&sim.waiting, -1)
+	}
+	wait := time.Since(start)
+	time.Sleep(sim.serviceTime)
+	<-sim.slots
+
+	atomic.AddInt64(&sim.served, 1)
+	atomic.AddInt64(&sim.totalWait, int64(wait))
+	addServerTiming(c, "injected-latency", wait+sim.serviceTime)
+	c.Header("X-Queue-Wait-Ms", strconv.FormatFloat(float64(wait.Microseconds())/1000, 'f', 3, 64))
+	c.Next()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Global variables for the dependency-aware readiness gate.
+var (
+	readinessMutex        sync.Mutex
+	readinessDependencies []string
+	readinessStatuses     = map[string]string{}
+	readinessCheckedAt    time.Time
+)
+
+// startReadinessChecker checks the dependencies listed in READINESS_DEPENDENCIES (same entries as
+// STARTUP_DEPENDENCIES) every READINESS_CHECK_INTERVAL_SECOND in the background and caches the
+// result for /healthcheck/ready.
+func startReadinessChecker() {
+	list := viper.GetString("READINESS_DEPENDENCIES")
+	if list == "" {
+		return
+	}
+	for _, dependency := range strings.Split(list, ",") {
+		if dependency = strings.TrimSpace(dependency); dependency != "" {
+			readinessDependencies = append(readinessDependencies, dependency)
+		}
+	}
+	interval := time.Duration(viper.GetInt("READINESS_CHECK_INTERVAL_SECOND")) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	logInfo("readiness gate enabled", zap.Strings("dependencies", readinessDependencies), zap.Duration("interval", interval))
+
+	go func() {
+		for {
+			statuses := map[string]string{}
+			for _, dependency := range readinessDependencies {
+				if err := checkDependency(dependency); err != nil {
+					statuses[dependency] = fmt.Sprintf("failed: %v", err)
+				} else {
+					statuses[dependency] = "ok"
+				}
+			}
+			readinessMutex.Lock()
+			for dependency, status := range statuses {
+				if readinessStatuses[dependency] != status {
+					logInfo("readiness dependency changed", zap.String("dependency", dependency), zap.String("status", status))
+				}
+			}
+			readinessStatuses = statuses
+			readinessCheckedAt = time.Now()
+			readinessMutex.Unlock()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ReadinessHandler handles GET /healthcheck/ready.
+// It fails while its toggle fails it, while the instance is draining, while the startup smoke
+// test has not passed (STARTUP_SMOKE_TEST) and, when READINESS_DEPENDENCIES is set, while any
+// of those dependencies was unhealthy at the last background check (or before the first one).
+func ReadinessHandler(c *gin.Context) {
+	if probeToggleFailure(c, "readiness", "NOT_READY") {
+		return
+	}
+	if isDraining() {
+		ErrorJSON(c, http.StatusServiceUnavailable, "DRAINING", "instance is draining before shutdown")
+		return
+	}
+	if passed, smokeTest := smokeTestStatus(); !passed {
+		ResponseJSON(c, http.StatusServiceUnavailable, gin.H{
+			"error":      "NOT_READY",
+			"message":    "startup smoke test " + smokeTest["state"].(string),
+			"smoke_test": smokeTest,
+		})
+		return
+	}
+	readinessMutex.Lock()
+	statuses := gin.H{}
+	ready := true
+	for _, dependency := range readinessDependencies {
+		status, checked := readinessStatuses[dependency]
+		if !checked {
+			status = "pending"
+		}
+		if status != "ok" {
+			ready = false
+		}
+		statuses[dependency] = status
+	}
+	checkedAt := ""
+	if !readinessCheckedAt.IsZero() {
+		checkedAt = readinessCheckedAt.UTC().Format(time.RFC3339Nano)
+	}
+	readinessMutex.Unlock()
+
+	if !ready {
+		ResponseJSON(c, http.StatusServiceUnavailable, gin.H{
+			"error":        "NOT_READY",
+			"message":      "dependencies unhealthy",
+			"dependencies": statuses,
+			"checked_at":   checkedAt,
+		})
+		return
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":      "ready",
+		"dependencies": statuses,
+		"checked_at":   checkedAt,
+	})
+}
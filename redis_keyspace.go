@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// RedisExpirationStormPayload defines the payload for the Redis keyspace and expiration storm.
+type RedisExpirationStormPayload struct {
+	KeyCount         DuckInt `json:"key_count"`         // Keys to create, default 1000000.
+	ValueSize        DuckInt `json:"value_size"`        // Bytes per value, default 32.
+	TTLSecond        DuckInt `json:"ttl_second"`        // The keys expire this long after the start, default 60.
+	TTLJitterSecond  DuckInt `json:"ttl_jitter_second"` // Spread of the expirations; 0 expires every key at the same moment.
+	ConnectionCounts DuckInt `json:"connection_counts"` // Connections creating the keys, default 10.
+	BatchSize        DuckInt `json:"batch_size"`        // Keys per pipeline, default 1000.
+	ScanMode         string  `json:"scan_mode"`         // "scan" (default), "keys" or "none".
+	ScanCount        DuckInt `json:"scan_count"`        // COUNT hint of SCAN, default 1000.
+	ScanConnections  DuckInt `json:"scan_connections"`  // Connections scanning concurrently, default 1.
+	ProbeIntervalMs  DuckInt `json:"probe_interval_ms"` // Pause between latency probes, default 100.
+	MaintainSecond   DuckInt `json:"maintain_second"`   // Duration of the whole run, default ttl_second + ttl_jitter_second + 30.
+	Async            bool    `json:"async"`
+}
+
+// Scan modes for /redis/expiration_storm.
+const (
+	redisScanModeScan = "scan"
+	redisScanModeKeys = "keys"
+	redisScanModeNone = "none"
+)
+
+// expirationStormStats counts what an expiration storm did and samples the latency seen by
+// an ordinary client, per second, next to the size of the keyspace.
+type expirationStormStats struct {
+	created      int64
+	createErrors int64
+	createNs     int64
+
+	scans      int64 // SCAN or KEYS commands.
+	scanCycles int64 // Complete iterations of the keyspace.
+	scanned    int64 // Keys returned.
+	scanErrors int64
+	scanMaxNs  int64
+
+	probes      int64
+	probeErrors int64
+	probeSumNs  int64
+	probeMaxNs  int64
+
+	mu       sync.Mutex
+	timeline []gin.H
+}
+
+func (s *expirationStormStats) toMap() gin.H {
+	probes := atomic.LoadInt64(&s.probes)
+	meanMs := 0.0
+	if probes > 0 {
+		meanMs = float64(atomic.LoadInt64(&s.probeSumNs)) / float64(probes) / 1e6
+	}
+	s.mu.Lock()
+	timeline := append([]gin.H(nil), s.timeline...)
+	s.mu.Unlock()
+	return gin.H{
+		"created":         atomic.LoadInt64(&s.created),
+		"create_errors":   atomic.LoadInt64(&s.createErrors),
+		"create_duration": time.Duration(atomic.LoadInt64(&s.createNs)).String(),
+		"scans":           atomic.LoadInt64(&s.scans),
+		"scan_cycles":     atomic.LoadInt64(&s.scanCycles),
+		"scanned_keys":    atomic.LoadInt64(&s.scanned),
+		"scan_errors":     atomic.LoadInt64(&s.scanErrors),
+		"max_scan_ms":     float64(atomic.LoadInt64(&s.scanMaxNs)) / 1e6,
+		"probes":          probes,
+		"probe_errors":    atomic.LoadInt64(&s.probeErrors),
+		"mean_probe_ms":   meanMs,
+		"max_probe_ms":    float64(atomic.LoadInt64(&s.probeMaxNs)) / 1e6,
+		"timeline":        timeline,
+	}
+}
+
+// RedisExpirationStormHandler handles POST /redis/expiration_storm.
+// It creates key_count keys whose TTLs all end at the same moment and then iterates the
+// keyspace with SCAN or KEYS until maintain_second elapses. When the keys expire, the active
+// expire cycle of Redis competes with every client for its single thread; a probe connection
+// measures the resulting latency cliff next to the shrinking keyspace.
+func RedisExpirationStormHandler(c *gin.Context) {
+	var payload RedisExpirationStormPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	keyCount := int(payload.KeyCount)
+	if keyCount <= 0 {
+		keyCount = 1000000
+	}
+	if keyCount > 50000000 {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "key_count must be at most 50000000")
+		return
+	}
+	valueSize := int(payload.ValueSize)
+	if valueSize <= 0 {
+		valueSize = 32
+	}
+	if valueSize > 1<<20 {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "value_size must be at most 1048576")
+		return
+	}
+	ttlSec := int(payload.TTLSecond)
+	if ttlSec <= 0 {
+		ttlSec = 60
+	}
+	jitterSec := int(payload.TTLJitterSecond)
+	if jitterSec < 0 {
+		jitterSec = 0
+	}
+	connectionCounts := int(payload.ConnectionCounts)
+	if connectionCounts <= 0 {
+		connectionCounts = 10
+	}
+	batchSize := int(payload.BatchSize)
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	scanMode := payload.ScanMode
+	if scanMode == "" {
+		scanMode = redisScanModeScan
+	}
+	if scanMode != redisScanModeScan && scanMode != redisScanModeKeys && scanMode != redisScanModeNone {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "scan_mode must be scan, keys or none")
+		return
+	}
+	scanCount := int64(payload.ScanCount)
+	if scanCount <= 0 {
+		scanCount = 1000
+	}
+	scanConnections := int(payload.ScanConnections)
+	if scanConnections <= 0 {
+		scanConnections = 1
+	}
+	probeInterval := time.Duration(payload.ProbeIntervalMs) * time.Millisecond
+	if probeInterval <= 0 {
+		probeInterval = 100 * time.Millisecond
+	}
+	maintainSec := int(payload.MaintainSecond)
+	if maintainSec <= 0 {
+		maintainSec = ttlSec + jitterSec + 30
+	}
+
+	client, err := getRedisClientWith(func(o *redis.Options) {
+		o.PoolSize = connectionCounts + scanConnections + 1
+	})
+	if err != nil {
+		ErrorJSON(c, 500, "REDIS_ERROR", err.Error())
+		return
+	}
+	prefix := fmt.Sprintf("expire_storm:%x:", time.Now().UnixNano())
+	value := strings.Repeat("x", valueSize)
+	stats := &expirationStormStats{}
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		defer client.Close()
+		startedAt := time.Now()
+		expireAt := startedAt.Add(time.Duration(ttlSec) * time.Second)
+		ctx, cancel := context.WithDeadline(ctx, startedAt.Add(time.Duration(maintainSec)*time.Second))
+		defer cancel()
+
+		// The probe runs for the whole storm, recording the worst latency and the keyspace size
+		// of every second.
+		probeDone := make(chan struct{})
+		go func() {
+			defer close(probeDone)
+			ticker := time.NewTicker(probeInterval)
+			defer ticker.Stop()
+			second := startedAt.Add(time.Second)
+			var windowMaxNs, windowProbes int64
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				begin := time.Now()
+				err := client.Ping(ctx).Err()
+				elapsed := time.Since(begin)
+				if ctx.Err() != nil {
+					return
+				}
+				atomic.AddInt64(&stats.probes, 1)
+				if err != nil {
+					atomic.AddInt64(&stats.probeErrors, 1)
+				}
+				atomic.AddInt64(&stats.probeSumNs, int64(elapsed))
+				atomicMax(&stats.probeMaxNs, int64(elapsed))
+				windowProbes++
+				windowMaxNs = max(windowMaxNs, int64(elapsed))
+				if time.Now().Before(second) {
+					continue
+				}
+				entry := gin.H{
+					"elapsed_second": int(second.Sub(startedAt) / time.Second),
+					"probes":         windowProbes,
+					"max_probe_ms":   float64(windowMaxNs) / 1e6,
+				}
+				if size, err := client.DBSize(ctx).Result(); err == nil {
+					entry["keys"] = size
+				}
+				stats.mu.Lock()
+				stats.timeline = append(stats.timeline, entry)
+				stats.mu.Unlock()
+				second = second.Add(time.Second)
+				windowMaxNs, windowProbes = 0, 0
+			}
+		}()
+
+		// Creation: every worker takes the next batch and writes it in one pipeline.
+		var nextBatch int64
+		var wg sync.WaitGroup
+		for w := 0; w < connectionCounts; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					start := int(atomic.AddInt64(&nextBatch, 1)-1) * batchSize
+					if start >= keyCount {
+						return
+					}
+					end := min(start+batchSize, keyCount)
+					pipe := client.Pipeline()
+					for i := start; i < end; i++ {
+						at := expireAt
+						if jitterSec > 0 {
+							at = at.Add(time.Duration(rand.Int63n(int64(jitterSec) * int64(time.Second))))
+						}
+						key := prefix + intToString(i)
+						pipe.Set(ctx, key, value, 0)
+						pipe.PExpireAt(ctx, key, at)
+					}
+					if _, err := pipe.Exec(ctx); err != nil {
+						if ctx.Err() == nil {
+							atomic.AddInt64(&stats.createErrors, int64(end-start))
+							logWarn("Redis expiration storm create failed", zap.Error(err))
+						}
+						continue
+					}
+					atomic.AddInt64(&stats.created, int64(end-start))
+				}
+			}()
+		}
+		wg.Wait()
+		atomic.StoreInt64(&stats.createNs, int64(time.Since(startedAt)))
+		if time.Now().After(expireAt) {
+			logWarn("Redis expiration storm keys expired during creation, raise ttl_second",
+				zap.Duration("create_duration", time.Since(startedAt)))
+		}
+
+		// Keyspace iteration until the deadline. SCAN and KEYS visit every key, expired or not,
+		// so they also trigger lazy expiration on top of the active expire cycle.
+		if scanMode != redisScanModeNone {
+			pattern := prefix + "*"
+			for w := 0; w < scanConnections; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var cursor uint64
+					for ctx.Err() == nil {
+						begin := time.Now()
+						var keys []string
+						var err error
+						if scanMode == redisScanModeKeys {
+							keys, err = client.Keys(ctx, pattern).Result()
+							cursor = 0
+						} else {
+							keys, cursor, err = client.Scan(ctx, cursor, pattern, scanCount).Result()
+						}
+						if ctx.Err() != nil {
+							return
+						}
+						atomic.AddInt64(&stats.scans, 1)
+						atomicMax(&stats.scanMaxNs, int64(time.Since(begin)))
+						if err != nil {
+							atomic.AddInt64(&stats.scanErrors, 1)
+							logWarn("Redis expiration storm scan failed", zap.Error(err))
+							sleepContext(ctx, 100*time.Millisecond)
+							continue
+						}
+						atomic.AddInt64(&stats.scanned, int64(len(keys)))
+						if cursor == 0 {
+							atomic.AddInt64(&stats.scanCycles, 1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		}
+		<-ctx.Done()
+		<-probeDone
+		logInfo("Redis expiration storm completed", zap.Any("results", stats.toMap()))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, 200, gin.H{
+			"message":           "Redis expiration storm started",
+			"key_prefix":        prefix,
+			"key_count":         keyCount,
+			"ttl_second":        ttlSec,
+			"ttl_jitter_second": jitterSec,
+			"scan_mode":         scanMode,
+			"maintain_second":   maintainSec,
+		})
+	} else {
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
+		ResponseJSON(c, 200, gin.H{
+			"message":           "Redis expiration storm completed",
+			"key_prefix":        prefix,
+			"key_count":         keyCount,
+			"ttl_second":        ttlSec,
+			"ttl_jitter_second": jitterSec,
+			"scan_mode":         scanMode,
+			"maintain_second":   maintainSec,
+			"results":           stats.toMap(),
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Script cache modes of the Redis heavy APIs.
+const (
+	redisScriptCached = "cached" // EVALSHA, loading the script once.
+	redisScriptEval   = "eval"   // EVAL with the full source every time.
+	redisScriptUnique = "unique" // EVAL of a new script every time, growing the script cache.
+)
+
+// redisBuiltinScript is a CPU-bound script that blocks Redis' single command thread for
+// ARGV[1] INCRs of the key.
+const redisBuiltinScript = `for i = 1, tonumber(ARGV[1]) do redis.call('INCR', KEYS[1]) end
+return redis.call('GET', KEYS[1])`
+
+// maxRedisScriptIterations bounds script_iterations; a million INCRs already block Redis for
+// about a second per script run.
+const maxRedisScriptIterations = 1000000
+
+// redisWorkload runs the Lua script and MULTI/EXEC transaction of every Redis heavy
+// iteration, next to the plain GET/SET.
+type redisWorkload struct {
+	script      *redis.Script
+	source      string
+	cache       string
+	iterations  int
+	txCommands  int
+	watch       bool
+	uniqueCount int64
+
+	scripts      int64
+	scriptErrors int64
+	transactions int64
+	aborted      int64 // Transactions discarded because a watched key changed.
+	txErrors     int64
+}
+
+// newRedisWorkload validates the script and transaction options. Without any of them the
+// workload does nothing.
+func newRedisWorkload(script string, iterations DuckInt, cache string, txCommands DuckInt, watch bool) (*redisWorkload, error) {
+	w := &redisWorkload{source: script, cache: cache, iterations: int(iterations), txCommands: int(txCommands), watch: watch}
+	if w.iterations < 0 || w.iterations > maxRedisScriptIterations {
+		return nil, fmt.Errorf("script_iterations must be between 0 and %d", maxRedisScriptIterations)
+	}
+	if w.source == "" && w.iterations > 0 {
+		w.source = redisBuiltinScript
+	}
+	if w.iterations <= 0 {
+		w.iterations = 1000
+	}
+	if w.cache == "" {
+		w.cache = redisScriptCached
+	}
+	if w.cache != redisScriptCached && w.cache != redisScriptEval && w.cache != redisScriptUnique {
+		return nil, fmt.Errorf("script_cache must be cached, eval or unique")
+	}
+	if w.txCommands < 0 || w.txCommands > 10000 {
+		return nil, fmt.Errorf("transaction_commands must be between 0 and 10000")
+	}
+	if w.watch && w.txCommands == 0 {
+		return nil, fmt.Errorf("watch requires transaction_commands")
+	}
+	if w.source != "" {
+		w.script = redis.NewScript(w.source)
+	}
+	return w, nil
+}
+
+// run executes the script and the transaction of one iteration on key.
+func (w *redisWorkload) run(ctx context.Context, client *redis.Client, key string) {
+	if w.script != nil {
+		var err error
+		keys, args := []string{key}, []interface{}{w.iterations}
+		switch w.cache {
+		case redisScriptCached:
+			err = w.script.Run(ctx, client, keys, args...).Err()
+		case redisScriptEval:
+			err = client.Eval(ctx, w.source, keys, args...).Err()
+		case redisScriptUnique:
+			n := atomic.AddInt64(&w.uniqueCount, 1)
+			err = client.Eval(ctx, fmt.Sprintf("%s\n-- %d", w.source, n), keys, args...).Err()
+		}
+		atomic.AddInt64(&w.scripts, 1)
+		if err != nil && err != redis.Nil {
+			atomic.AddInt64(&w.scriptErrors, 1)
+			logWarn("Redis heavy script failed", zap.Error(err))
+		}
+	}
+	if w.txCommands > 0 {
+		queue := func(pipe redis.Pipeliner) error {
+			for i := 0; i < w.txCommands; i++ {
+				if i%2 == 0 {
+					pipe.Incr(ctx, key+":tx")
+				} else {
+					pipe.Set(ctx, key, "stress", 0)
+				}
+			}
+			return nil
+		}
+		var err error
+		if w.watch {
+			// Another connection changing the key between WATCH and EXEC aborts the transaction.
+			err = client.Watch(ctx, func(tx *redis.Tx) error {
+				if err := tx.Get(ctx, key).Err(); err != nil && err != redis.Nil {
+					return err
+				}
+				_, err := tx.TxPipelined(ctx, queue)
+				return err
+			}, key)
+		} else {
+			_, err = client.TxPipelined(ctx, queue)
+		}
+		atomic.AddInt64(&w.transactions, 1)
+		switch {
+		case err == redis.TxFailedErr:
+			atomic.AddInt64(&w.aborted, 1)
+		case err != nil:
+			atomic.AddInt64(&w.txErrors, 1)
+			logWarn("Redis heavy transaction failed", zap.Error(err))
+		}
+	}
+}
+
+func (w *redisWorkload) toMap() gin.H {
+	return gin.H{
+		"scripts":              atomic.LoadInt64(&w.scripts),
+		"script_errors":        atomic.LoadInt64(&w.scriptErrors),
+		"transactions":         atomic.LoadInt64(&w.transactions),
+		"aborted_transactions": atomic.LoadInt64(&w.aborted),
+		"transaction_errors":   atomic.LoadInt64(&w.txErrors),
+	}
+}
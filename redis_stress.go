@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,36 +15,75 @@ import (
 
 // RedisHeavyPayload defines the payload for heavy Redis queries using a single connection.
 type RedisHeavyPayload struct {
-	Reads            bool    `json:"reads"`
-	Writes           bool    `json:"writes"`
-	MaintainSecond   DuckInt `json:"maintain_second"`
-	Async            bool    `json:"async"`
-	QueryPerInterval DuckInt `json:"query_per_interval"`
-	IntervalSecond   DuckInt `json:"interval_second"`
+	Reads               bool      `json:"reads"`
+	Writes              bool      `json:"writes"`
+	MaintainSecond      DuckInt   `json:"maintain_second"`
+	Async               bool      `json:"async"`
+	QueryPerInterval    DuckInt   `json:"query_per_interval"`
+	IntervalSecond      DuckInt   `json:"interval_second"`
+	KeyDistribution     string    `json:"key_distribution"`     // "uniform", "zipfian" or "hot_key" over key_count keys; empty uses one key.
+	KeyCount            DuckInt   `json:"key_count"`            // Distinct keys, default 1000.
+	ZipfS               DuckFloat `json:"zipf_s"`               // Zipfian skew (> 1), default 1.1.
+	HotKeyPercent       DuckInt   `json:"hot_key_percent"`      // Share of commands on the hot key, default 80.
+	Script              string    `json:"script"`               // Lua script run per iteration with KEYS[1] = the key and ARGV[1] = script_iterations.
+	ScriptIterations    DuckInt   `json:"script_iterations"`    // Without script, runs a builtin script doing this many INCRs. Default 1000.
+	ScriptCache         string    `json:"script_cache"`         // "cached" (default, EVALSHA), "eval" or "unique" (a new script every time).
+	TransactionCommands DuckInt   `json:"transaction_commands"` // Commands per MULTI/EXEC transaction per iteration; 0 disables.
+	Watch               bool      `json:"watch"`                // WATCH the key before each transaction.
 }
 
 // RedisMultiHeavyPayload defines the payload for heavy Redis queries using multiple connections.
 type RedisMultiHeavyPayload struct {
-	Reads            bool    `json:"reads"`
-	Writes           bool    `json:"writes"`
-	MaintainSecond   DuckInt `json:"maintain_second"`
-	Async            bool    `json:"async"`
-	ConnectionCounts DuckInt `json:"connection_counts"`
-	QueryPerInterval DuckInt `json:"query_per_interval"`
-	IntervalSecond   DuckInt `json:"interval_second"`
+	Reads               bool      `json:"reads"`
+	Writes              bool      `json:"writes"`
+	MaintainSecond      DuckInt   `json:"maintain_second"`
+	Async               bool      `json:"async"`
+	ConnectionCounts    DuckInt   `json:"connection_counts"`
+	QueryPerInterval    DuckInt   `json:"query_per_interval"`
+	IntervalSecond      DuckInt   `json:"interval_second"`
+	KeyDistribution     string    `json:"key_distribution"`     // "uniform", "zipfian" or "hot_key" over key_count keys; empty uses one key.
+	KeyCount            DuckInt   `json:"key_count"`            // Distinct keys, default 1000.
+	ZipfS               DuckFloat `json:"zipf_s"`               // Zipfian skew (> 1), default 1.1.
+	HotKeyPercent       DuckInt   `json:"hot_key_percent"`      // Share of commands on the hot key, default 80.
+	Script              string    `json:"script"`               // Lua script run per iteration with KEYS[1] = the key and ARGV[1] = script_iterations.
+	ScriptIterations    DuckInt   `json:"script_iterations"`    // Without script, runs a builtin script doing this many INCRs. Default 1000.
+	ScriptCache         string    `json:"script_cache"`         // "cached" (default, EVALSHA), "eval" or "unique" (a new script every time).
+	TransactionCommands DuckInt   `json:"transaction_commands"` // Commands per MULTI/EXEC transaction per iteration; 0 disables.
+	Watch               bool      `json:"watch"`                // WATCH the key before each transaction.
 }
 
 // RedisConnectionPayload defines the payload for simulating heavy Redis connection load.
 type RedisConnectionPayload struct {
-	MaintainSecond      DuckInt `json:"maintain_second"`
-	Async               bool    `json:"async"`
-	ConnectionCounts    DuckInt `json:"connection_counts"`
-	IncreasePerInterval DuckInt `json:"increase_per_interval"`
-	IntervalSecond      DuckInt `json:"interval_second"`
+	MaintainSecond          DuckInt `json:"maintain_second"`
+	Async                   bool    `json:"async"`
+	ConnectionCounts        DuckInt `json:"connection_counts"`
+	IncreasePerInterval     DuckInt `json:"increase_per_interval"`
+	IntervalSecond          DuckInt `json:"interval_second"`
+	HoldMode                string  `json:"hold_mode"`                 // "idle" (default, no traffic) or "keepalive".
+	KeepaliveIntervalSecond DuckInt `json:"keepalive_interval_second"` // PING interval in keepalive mode.
+	Leak                    bool    `json:"leak"`                      // Keep connections open after maintain_second.
 }
 
+// Hold modes for /redis/connection.
+const (
+	redisHoldIdle      = "idle"
+	redisHoldKeepalive = "keepalive"
+)
+
+// Global variables for leaked Redis connections. The clients are referenced here so that
+// the garbage collector does not close their sockets.
+var (
+	leakedRedisMutex   sync.Mutex
+	leakedRedisClients []*redis.Client
+)
+
 // getRedisClient creates and returns a new Redis client using configuration from GetRedisConfig.
 func getRedisClient() (*redis.Client, error) {
+	return getRedisClientWith(nil)
+}
+
+// getRedisClientWith is getRedisClient with a hook to adjust the client options.
+func getRedisClientWith(configure func(*redis.Options)) (*redis.Client, error) {
 	cfg, err := GetRedisConfig()
 	if err != nil {
 		return nil, err
@@ -55,6 +95,10 @@ func getRedisClient() (*redis.Client, error) {
 	if cfg.TLSEnabled {
 		options.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	options.Dialer = egressRedisDialer(options.TLSConfig)
+	if configure != nil {
+		configure(options)
+	}
 	client := redis.NewClient(options)
 	// Use a background context for simplicity.
 	if err := client.Ping(context.Background()).Err(); err != nil {
@@ -67,45 +111,60 @@ func getRedisClient() (*redis.Client, error) {
 // It performs read/write commands on a single Redis connection for the specified duration.
 func RedisHeavyHandler(c *gin.Context) {
 	var payload RedisHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	maintainSec := int(payload.MaintainSecond)
 	queryPerInterval := int(payload.QueryPerInterval)
 	intervalSec := int(payload.IntervalSecond)
+	keys, err := newKeyPicker(payload.KeyDistribution, payload.KeyCount, payload.ZipfS, payload.HotKeyPercent)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	workload, err := newRedisWorkload(payload.Script, payload.ScriptIterations, payload.ScriptCache, payload.TransactionCommands, payload.Watch)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
 
 	client, err := getRedisClient()
 	if err != nil {
 		ErrorJSON(c, 500, "REDIS_ERROR", err.Error())
 		return
 	}
-	ctx := context.Background()
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			for i := 0; i < queryPerInterval; i++ {
+				key := "stress_key"
+				if keys != nil {
+					key = keys.key("stress_key:")
+				}
 				if payload.Reads {
-					_, err := client.Get(ctx, "stress_key").Result()
+					_, err := client.Get(ctx, key).Result()
 					if err != nil && err != redis.Nil {
-						fmt.Println("Redis heavy read failed", zap.Error(err))
+						logWarn("Redis heavy read failed", zap.Error(err))
 					}
 				}
 				if payload.Writes {
-					if err := client.Set(ctx, "stress_key", "stress", 0).Err(); err != nil {
-						fmt.Println("Redis heavy write failed", zap.Error(err))
+					if err := client.Set(ctx, key, "stress", 0).Err(); err != nil {
+						logWarn("Redis heavy write failed", zap.Error(err))
 					}
 				}
+				workload.run(ctx, client, key)
 			}
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
 		client.Close()
-		fmt.Println("Redis heavy query (single connection) completed", zap.Int("duration_sec", maintainSec))
+		logInfo("Redis heavy query (single connection) completed", zap.Int("duration_sec", maintainSec))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redis heavy query (single connection) started",
 			"maintain_second":    maintainSec,
@@ -113,12 +172,16 @@ func RedisHeavyHandler(c *gin.Context) {
 			"interval_second":    intervalSec,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redis heavy query (single connection) completed",
 			"maintain_second":    maintainSec,
 			"query_per_interval": queryPerInterval,
 			"interval_second":    intervalSec,
+			"keys":               keys.toMap(),
+			"results":            workload.toMap(),
 		})
 	}
 }
@@ -127,7 +190,7 @@ func RedisHeavyHandler(c *gin.Context) {
 // It spawns multiple concurrent connections, each performing queries for the specified duration.
 func RedisMultiHeavyHandler(c *gin.Context) {
 	var payload RedisMultiHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -135,8 +198,19 @@ func RedisMultiHeavyHandler(c *gin.Context) {
 	queryPerInterval := int(payload.QueryPerInterval)
 	intervalSec := int(payload.IntervalSecond)
 	connectionCounts := int(payload.ConnectionCounts)
+	keys, err := newKeyPicker(payload.KeyDistribution, payload.KeyCount, payload.ZipfS, payload.HotKeyPercent)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	workload, err := newRedisWorkload(payload.Script, payload.ScriptIterations, payload.ScriptCache, payload.TransactionCommands, payload.Watch)
+	if err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var wg sync.WaitGroup
 		for i := 0; i < connectionCounts; i++ {
 			wg.Add(1)
@@ -144,36 +218,40 @@ func RedisMultiHeavyHandler(c *gin.Context) {
 				defer wg.Done()
 				client, err := getRedisClient()
 				if err != nil {
-					fmt.Println("Redis multi heavy connection failed", zap.Int("conn", connNum), zap.Error(err))
+					logWarn("Redis multi heavy connection failed", zap.Int("conn", connNum), zap.Error(err))
 					return
 				}
-				ctx := context.Background()
 				endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-				for time.Now().Before(endTime) {
+				for time.Now().Before(endTime) && ctx.Err() == nil {
 					for j := 0; j < queryPerInterval; j++ {
+						key := "stress_key"
+						if keys != nil {
+							key = keys.key("stress_key:")
+						}
 						if payload.Reads {
-							_, err := client.Get(ctx, "stress_key").Result()
+							_, err := client.Get(ctx, key).Result()
 							if err != nil && err != redis.Nil {
-								fmt.Println("Redis multi heavy read failed", zap.Int("conn", connNum), zap.Error(err))
+								logWarn("Redis multi heavy read failed", zap.Int("conn", connNum), zap.Error(err))
 							}
 						}
 						if payload.Writes {
-							if err := client.Set(ctx, "stress_key", "stress", 0).Err(); err != nil {
-								fmt.Println("Redis multi heavy write failed", zap.Int("conn", connNum), zap.Error(err))
+							if err := client.Set(ctx, key, "stress", 0).Err(); err != nil {
+								logWarn("Redis multi heavy write failed", zap.Int("conn", connNum), zap.Error(err))
 							}
 						}
+						workload.run(ctx, client, key)
 					}
-					time.Sleep(time.Duration(intervalSec) * time.Second)
+					sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 				}
 				client.Close()
 			}(i)
 		}
 		wg.Wait()
-		fmt.Println("Redis multi heavy query completed", zap.Int("connections", connectionCounts))
+		logInfo("Redis multi heavy query completed", zap.Int("connections", connectionCounts))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redis multi heavy query started",
 			"maintain_second":    maintainSec,
@@ -182,23 +260,28 @@ func RedisMultiHeavyHandler(c *gin.Context) {
 			"connection_counts":  connectionCounts,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redis multi heavy query completed",
 			"maintain_second":    maintainSec,
 			"query_per_interval": queryPerInterval,
 			"interval_second":    intervalSec,
 			"connection_counts":  connectionCounts,
+			"keys":               keys.toMap(),
+			"results":            workload.toMap(),
 		})
 	}
 }
 
 // RedisConnectionHandler handles POST /redis/connection.
 // It gradually opens multiple Redis connections until reaching the target connection_counts
-// and maintains them open for the specified duration.
+// and maintains them open for the specified duration, either idle or with PING keepalives.
+// With leak enabled the connections are never closed, as a leaking client would do.
 func RedisConnectionHandler(c *gin.Context) {
 	var payload RedisConnectionPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -206,10 +289,53 @@ func RedisConnectionHandler(c *gin.Context) {
 	connectionCounts := int(payload.ConnectionCounts)
 	increasePerInterval := int(payload.IncreasePerInterval)
 	intervalSec := int(payload.IntervalSecond)
+	holdMode := payload.HoldMode
+	if holdMode == "" {
+		holdMode = redisHoldIdle
+	}
+	if holdMode != redisHoldIdle && holdMode != redisHoldKeepalive {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "hold_mode must be idle or keepalive")
+		return
+	}
+	keepaliveSec := int(payload.KeepaliveIntervalSecond)
+	if keepaliveSec <= 0 {
+		keepaliveSec = 10
+	}
+	leak := payload.Leak
+	var reaped int64
+
+	// Each client holds exactly one connection, and the client-side idle reaper is disabled
+	// so that only the server (e.g. the ElastiCache timeout parameter) can close it.
+	configure := func(o *redis.Options) {
+		o.PoolSize = 1
+		o.MaxRetries = -1
+		o.IdleTimeout = -1
+		o.IdleCheckFrequency = -1
+	}
+
+	// keepalive pings the connection until done is closed, counting connections the server dropped.
+	keepalive := func(client *redis.Client, done <-chan struct{}) {
+		ticker := time.NewTicker(time.Duration(keepaliveSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := client.Ping(context.Background()).Err(); err != nil {
+					atomic.AddInt64(&reaped, 1)
+					logWarn("Redis keepalive connection closed by server", zap.Error(err))
+					return
+				}
+			}
+		}
+	}
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var clients []*redis.Client
 		var mu sync.Mutex
+		done := make(chan struct{})
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
 		currentCount := 0
 		ticker := time.NewTicker(time.Duration(intervalSec) * time.Second)
@@ -220,11 +346,14 @@ func RedisConnectionHandler(c *gin.Context) {
 			select {
 			case <-ticker.C:
 				for i := 0; i < increasePerInterval && currentCount < connectionCounts; i++ {
-					client, err := getRedisClient()
+					client, err := getRedisClientWith(configure)
 					if err != nil {
-						fmt.Println("Redis connection stress open failed", zap.Error(err))
+						logWarn("Redis connection stress open failed", zap.Error(err))
 						continue
 					}
+					if holdMode == redisHoldKeepalive {
+						go keepalive(client, done)
+					}
 					mu.Lock()
 					clients = append(clients, client)
 					currentCount++
@@ -237,41 +366,65 @@ func RedisConnectionHandler(c *gin.Context) {
 					break Loop
 				}
 			default:
-				if time.Now().After(endTime) {
+				if time.Now().After(endTime) || ctx.Err() != nil {
 					break Loop
 				}
-				time.Sleep(100 * time.Millisecond)
+				sleepContext(ctx, 100*time.Millisecond)
 			}
 		}
 		remaining := time.Until(endTime)
 		if remaining > 0 {
-			time.Sleep(remaining)
+			sleepContext(ctx, remaining)
 		}
+		close(done)
 		mu.Lock()
-		for _, client := range clients {
-			client.Close()
+		if leak {
+			leakedRedisMutex.Lock()
+			leakedRedisClients = append(leakedRedisClients, clients...)
+			leakedRedisMutex.Unlock()
+		} else {
+			for _, client := range clients {
+				client.Close()
+			}
 		}
 		mu.Unlock()
-		fmt.Println("Redis connection stress completed", zap.Int("connections", currentCount))
+		logInfo("Redis connection stress completed",
+			zap.Int("connections", currentCount),
+			zap.String("hold_mode", holdMode),
+			zap.Bool("leaked", leak),
+			zap.Int64("reaped_by_server", atomic.LoadInt64(&reaped)))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
-			"message":               "Redis connection stress started",
-			"maintain_second":       maintainSec,
-			"connection_counts":     connectionCounts,
-			"increase_per_interval": increasePerInterval,
-			"interval_second":       intervalSec,
+			"message":                   "Redis connection stress started",
+			"maintain_second":           maintainSec,
+			"connection_counts":         connectionCounts,
+			"increase_per_interval":     increasePerInterval,
+			"interval_second":           intervalSec,
+			"hold_mode":                 holdMode,
+			"keepalive_interval_second": keepaliveSec,
+			"leak":                      leak,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
+		leakedRedisMutex.Lock()
+		leakedTotal := len(leakedRedisClients)
+		leakedRedisMutex.Unlock()
 		ResponseJSON(c, 200, gin.H{
-			"message":               "Redis connection stress completed",
-			"maintain_second":       maintainSec,
-			"connection_counts":     connectionCounts,
-			"increase_per_interval": increasePerInterval,
-			"interval_second":       intervalSec,
+			"message":                   "Redis connection stress completed",
+			"maintain_second":           maintainSec,
+			"connection_counts":         connectionCounts,
+			"increase_per_interval":     increasePerInterval,
+			"interval_second":           intervalSec,
+			"hold_mode":                 holdMode,
+			"keepalive_interval_second": keepaliveSec,
+			"leak":                      leak,
+			"reaped_by_server":          atomic.LoadInt64(&reaped),
+			"leaked_connections_total":  leakedTotal,
 		})
 	}
 }
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -46,7 +46,7 @@ type RedshiftConnectionPayload struct {
 // It opens a single connection and repeatedly executes read/write queries for the specified duration.
 func RedshiftHeavyHandler(c *gin.Context) {
 	var payload RedshiftHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -54,15 +54,12 @@ func RedshiftHeavyHandler(c *gin.Context) {
 	queryPerInterval := int(payload.QueryPerInterval)
 	intervalSec := int(payload.IntervalSecond)
 
-	cfg, err := GetRedshiftConfig()
+	engine, driver, dsn, err := stressDBTarget("redshift")
 	if err != nil {
 		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
 		return
 	}
-	// Redshift uses a DSN similar to PostgreSQL.
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	db, err := sql.Open("pgx", dsn)
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		ErrorJSON(c, 500, "DB_ERROR", err.Error())
 		return
@@ -72,33 +69,34 @@ func RedshiftHeavyHandler(c *gin.Context) {
 		return
 	}
 
-	if err := SetupTestDatabase("redshift", db); err != nil {
+	if err := SetupTestDatabase(engine, db); err != nil {
 		ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
 		return
 	}
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-		for time.Now().Before(endTime) {
+		for time.Now().Before(endTime) && ctx.Err() == nil {
 			for i := 0; i < queryPerInterval; i++ {
 				if payload.Reads {
 					if _, err := db.Query("SELECT 1"); err != nil {
-						fmt.Println("Redshift heavy read query failed", zap.Error(err))
+						logWarn("Redshift heavy read query failed", zap.Error(err))
 					}
 				}
 				if payload.Writes {
 					if _, err := db.Exec("INSERT INTO biggie_test_table(value) VALUES('stress')"); err != nil {
-						fmt.Println("Redshift heavy write query failed", zap.Error(err))
+						logWarn("Redshift heavy write query failed", zap.Error(err))
 					}
 				}
 			}
-			time.Sleep(time.Duration(intervalSec) * time.Second)
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 		}
 		db.Close()
-		fmt.Println("Redshift heavy query (single connection) completed", zap.Int("duration_sec", maintainSec))
+		logInfo("Redshift heavy query (single connection) completed", zap.Int("duration_sec", maintainSec))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redshift heavy query (single connection) started",
 			"maintain_second":    maintainSec,
@@ -106,7 +104,9 @@ func RedshiftHeavyHandler(c *gin.Context) {
 			"interval_second":    intervalSec,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redshift heavy query (single connection) completed",
 			"maintain_second":    maintainSec,
@@ -121,7 +121,7 @@ func RedshiftHeavyHandler(c *gin.Context) {
 // with each connection executing queries for the specified duration.
 func RedshiftMultiHeavyHandler(c *gin.Context) {
 	var payload RedshiftMultiHeavyPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -130,58 +130,57 @@ func RedshiftMultiHeavyHandler(c *gin.Context) {
 	intervalSec := int(payload.IntervalSecond)
 	connectionCounts := int(payload.ConnectionCounts)
 
-	cfg, err := GetRedshiftConfig()
+	engine, driver, dsn, err := stressDBTarget("redshift")
 	if err != nil {
 		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
 		return
 	}
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var wg sync.WaitGroup
 		for i := 0; i < connectionCounts; i++ {
 			wg.Add(1)
 			go func(connNum int) {
 				defer wg.Done()
-				db, err := sql.Open("pgx", dsn)
+				db, err := sql.Open(driver, dsn)
 				if err != nil {
-					fmt.Println("Redshift multi heavy connection open failed", zap.Int("conn", connNum), zap.Error(err))
+					logWarn("Redshift multi heavy connection open failed", zap.Int("conn", connNum), zap.Error(err))
 					return
 				}
 				defer db.Close()
 				if err = db.Ping(); err != nil {
-					fmt.Println("Redshift multi heavy ping failed", zap.Int("conn", connNum), zap.Error(err))
+					logWarn("Redshift multi heavy ping failed", zap.Int("conn", connNum), zap.Error(err))
 					return
 				}
-				if err := SetupTestDatabase("redshift", db); err != nil {
+				if err := SetupTestDatabase(engine, db); err != nil {
 					ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
 					return
 				}
 				endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
-				for time.Now().Before(endTime) {
+				for time.Now().Before(endTime) && ctx.Err() == nil {
 					for j := 0; j < queryPerInterval; j++ {
 						if payload.Reads {
 							if _, err := db.Query("SELECT 1"); err != nil {
-								fmt.Println("Redshift multi heavy read query failed", zap.Int("conn", connNum), zap.Error(err))
+								logWarn("Redshift multi heavy read query failed", zap.Int("conn", connNum), zap.Error(err))
 							}
 						}
 						if payload.Writes {
 							if _, err := db.Exec("INSERT INTO biggie_test_table(value) VALUES('stress')"); err != nil {
-								fmt.Println("Redshift multi heavy write query failed", zap.Int("conn", connNum), zap.Error(err))
+								logWarn("Redshift multi heavy write query failed", zap.Int("conn", connNum), zap.Error(err))
 							}
 						}
 					}
-					time.Sleep(time.Duration(intervalSec) * time.Second)
+					sleepContext(ctx, time.Duration(intervalSec)*time.Second)
 				}
 			}(i)
 		}
 		wg.Wait()
-		fmt.Println("Redshift multi heavy query completed", zap.Int("connections", connectionCounts))
+		logInfo("Redshift multi heavy query completed", zap.Int("connections", connectionCounts))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redshift multi heavy query started",
 			"maintain_second":    maintainSec,
@@ -190,7 +189,9 @@ func RedshiftMultiHeavyHandler(c *gin.Context) {
 			"connection_counts":  connectionCounts,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
 			"message":            "Redshift multi heavy query completed",
 			"maintain_second":    maintainSec,
@@ -206,7 +207,7 @@ func RedshiftMultiHeavyHandler(c *gin.Context) {
 // or the duration expires, then maintains them until maintain_second seconds have elapsed.
 func RedshiftConnectionHandler(c *gin.Context) {
 	var payload RedshiftConnectionPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
 		return
 	}
@@ -215,15 +216,14 @@ func RedshiftConnectionHandler(c *gin.Context) {
 	increasePerInterval := int(payload.IncreasePerInterval)
 	intervalSec := int(payload.IntervalSecond)
 
-	cfg, err := GetRedshiftConfig()
+	engine, driver, dsn, err := stressDBTarget("redshift")
 	if err != nil {
 		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
 		return
 	}
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
 
-	stressFunc := func() {
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
 		var connections []*sql.DB
 		var mu sync.Mutex
 		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
@@ -236,17 +236,17 @@ func RedshiftConnectionHandler(c *gin.Context) {
 			select {
 			case <-ticker.C:
 				for i := 0; i < increasePerInterval && currentCount < connectionCounts; i++ {
-					db, err := sql.Open("pgx", dsn)
+					db, err := sql.Open(driver, dsn)
 					if err != nil {
-						fmt.Println("Redshift connection stress open failed", zap.Error(err))
+						logWarn("Redshift connection stress open failed", zap.Error(err))
 						continue
 					}
 					if err = db.Ping(); err != nil {
-						fmt.Println("Redshift connection stress ping failed", zap.Error(err))
+						logWarn("Redshift connection stress ping failed", zap.Error(err))
 						db.Close()
 						continue
 					}
-					if err := SetupTestDatabase("redshift", db); err != nil {
+					if err := SetupTestDatabase(engine, db); err != nil {
 						ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
 						return
 					}
@@ -262,26 +262,26 @@ func RedshiftConnectionHandler(c *gin.Context) {
 					break Loop
 				}
 			default:
-				if time.Now().After(endTime) {
+				if time.Now().After(endTime) || ctx.Err() != nil {
 					break Loop
 				}
-				time.Sleep(100 * time.Millisecond)
+				sleepContext(ctx, 100*time.Millisecond)
 			}
 		}
 		remaining := time.Until(endTime)
 		if remaining > 0 {
-			time.Sleep(remaining)
+			sleepContext(ctx, remaining)
 		}
 		mu.Lock()
 		for _, db := range connections {
 			db.Close()
 		}
 		mu.Unlock()
-		fmt.Println("Redshift connection stress completed", zap.Int("connections", currentCount))
+		logInfo("Redshift connection stress completed", zap.Int("connections", currentCount))
 	}
 
 	if payload.Async {
-		go stressFunc()
+		go job.run(stressFunc)
 		ResponseJSON(c, 200, gin.H{
 			"message":               "Redshift connection stress started",
 			"maintain_second":       maintainSec,
@@ -290,7 +290,9 @@ func RedshiftConnectionHandler(c *gin.Context) {
 			"interval_second":       intervalSec,
 		})
 	} else {
-		stressFunc()
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
 		ResponseJSON(c, 200, gin.H{
 			"message":               "Redshift connection stress completed",
 			"maintain_second":       maintainSec,
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Redshift workload profiles.
+const (
+	redshiftProfileAnalyticScan = "analytic_scan"
+	redshiftProfileWLMFill      = "wlm_fill"
+	redshiftProfileCopy         = "copy"
+)
+
+// RedshiftWorkloadPayload defines the payload for Redshift-specific workload profiles.
+type RedshiftWorkloadPayload struct {
+	Profile        string  `json:"profile"`     // analytic_scan, wlm_fill or copy.
+	Rows           DuckInt `json:"rows"`        // Rows of generated data, default 1000000.
+	Concurrency    DuckInt `json:"concurrency"` // Concurrent sessions; default 1, or 20 for wlm_fill.
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+	S3Path         string  `json:"s3_path"`      // copy: S3 prefix the generated data is unloaded to and copied from.
+	IAMRole        string  `json:"iam_role"`     // copy: role ARN with access to s3_path.
+	CopyOptions    string  `json:"copy_options"` // copy: extra COPY options.
+}
+
+// Formats of the copy profile fields, which are embedded in the COPY and UNLOAD statements
+// as Redshift takes no bind parameters there. None of them can contain a quote or ';'.
+var (
+	redshiftS3PathRegex  = regexp.MustCompile(`^s3://[a-z0-9][a-z0-9.-]{1,61}[a-z0-9](/[A-Za-z0-9!_.*()/=-]*)?$`)
+	redshiftIAMRoleRegex = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/[A-Za-z0-9+=,.@_/-]{1,512}$`)
+	// Keywords, numbers and quoted literals such as DELIMITER '|' or TIMEFORMAT 'auto'.
+	redshiftCopyOptionsRegex = regexp.MustCompile(`^([A-Za-z0-9_ ]|'[^';\\]*')*$`)
+)
+
+// redshiftSetupMutex serializes the setup of the generated data between workload runs.
+var redshiftSetupMutex sync.Mutex
+
+// redshiftAnalyticQuery joins and aggregates the generated data; it is heavy enough to keep
+// compute nodes busy for seconds per run on a small cluster.
+const redshiftAnalyticQuery = `
+	SELECT a.category,
+		COUNT(*),
+		SUM(a.amount * b.amount),
+		APPROXIMATE COUNT(DISTINCT a.id),
+		MEDIAN(b.amount)
+	FROM biggie_analytic_table a
+	JOIN biggie_analytic_table b ON a.category = b.category AND a.id % 1000 = b.id % 1000
+	GROUP BY a.category
+	ORDER BY 3 DESC`
+
+// setupRedshiftAnalyticData makes biggie_analytic_table hold the given number of generated
+// rows. The tables are created once and the data is only generated again when the row count
+// differs, so repeated runs neither drop the table nor regenerate it. Rows are produced by
+// cross-joining a digits table, as generate_series only runs on the leader node.
+func setupRedshiftAnalyticData(db *sql.DB, rows int) error {
+	redshiftSetupMutex.Lock()
+	defer redshiftSetupMutex.Unlock()
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS biggie_digits (d INT)`,
+		`CREATE TABLE IF NOT EXISTS biggie_analytic_table (
+			id BIGINT,
+			category INT,
+			amount DOUBLE PRECISION,
+			created_at TIMESTAMP
+		) DISTKEY (id) SORTKEY (created_at)`,
+		// The target of the copy profile, so COPY never changes the generated data.
+		`CREATE TABLE IF NOT EXISTS biggie_copy_table (LIKE biggie_analytic_table)`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	var digits, existing int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM biggie_digits`).Scan(&digits); err != nil {
+		return err
+	}
+	if digits != 10 {
+		if _, err := db.Exec(`DELETE FROM biggie_digits`); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`INSERT INTO biggie_digits VALUES (0), (1), (2), (3), (4), (5), (6), (7), (8), (9)`); err != nil {
+			return err
+		}
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM biggie_analytic_table`).Scan(&existing); err != nil {
+		return err
+	}
+	if existing == rows {
+		return nil
+	}
+	if _, err := db.Exec(`TRUNCATE biggie_analytic_table`); err != nil {
+		return err
+	}
+	// Cross join enough digit tables to cover the requested row count.
+	var from []string
+	var terms []string
+	for i, scale := 0, 1; scale < rows || i == 0; i, scale = i+1, scale*10 {
+		from = append(from, fmt.Sprintf("biggie_digits d%d", i))
+		terms = append(terms, fmt.Sprintf("d%d.d * %d", i, scale))
+	}
+	insert := fmt.Sprintf(`
+		INSERT INTO biggie_analytic_table
+		SELECT n, n %% 100, RANDOM() * 1000, DATEADD(second, -(n %% 31536000)::int, GETDATE())
+		FROM (SELECT %s AS n FROM %s) numbers
+		WHERE n < %d`, strings.Join(terms, " + "), strings.Join(from, " CROSS JOIN "), rows)
+	if _, err := db.Exec(insert); err != nil {
+		return err
+	}
+	_, err := db.Exec(`ANALYZE biggie_analytic_table`)
+	return err
+}
+
+// redshiftWorkloadStats counts query outcomes of a workload run.
+type redshiftWorkloadStats struct {
+	completed     int64
+	failed        int64
+	totalDuration int64 // Nanoseconds of completed queries.
+	maxQueued     int64 // Highest number of queued queries seen in STV_WLM_QUERY_STATE.
+}
+
+func (s *redshiftWorkloadStats) toMap() gin.H {
+	completed := atomic.LoadInt64(&s.completed)
+	avgMs := 0.0
+	if completed > 0 {
+		avgMs = float64(atomic.LoadInt64(&s.totalDuration)) / float64(completed) / 1e6
+	}
+	return gin.H{
+		"completed":       completed,
+		"failed":          atomic.LoadInt64(&s.failed),
+		"avg_duration_ms": avgMs,
+		"max_wlm_queued":  atomic.LoadInt64(&s.maxQueued),
+	}
+}
+
+// sampleWLMQueue records the highest number of queued queries until done is closed.
+func sampleWLMQueue(db *sql.DB, stats *redshiftWorkloadStats, done <-chan struct{}) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			var queued int64
+			if err := db.QueryRow(`SELECT COUNT(*) FROM stv_wlm_query_state WHERE state LIKE 'Queued%'`).Scan(&queued); err != nil {
+				logWarn("Redshift WLM queue sample failed", zap.Error(err))
+				continue
+			}
+			if queued > atomic.LoadInt64(&stats.maxQueued) {
+				atomic.StoreInt64(&stats.maxQueued, queued)
+			}
+		}
+	}
+}
+
+// RedshiftWorkloadHandler handles POST /redshift/workload.
+// Unlike the OLTP-style heavy handlers, it runs Redshift-shaped load over generated data:
+// analytic_scan repeats a large join/aggregation, wlm_fill runs it from many sessions at once
+// to fill WLM queue slots (and trigger concurrency scaling), and copy repeatedly loads the
+// generated data from S3 with COPY.
+func RedshiftWorkloadHandler(c *gin.Context) {
+	var payload RedshiftWorkloadPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	profile := payload.Profile
+	if profile == "" {
+		profile = redshiftProfileAnalyticScan
+	}
+	if profile != redshiftProfileAnalyticScan && profile != redshiftProfileWLMFill && profile != redshiftProfileCopy {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "profile must be analytic_scan, wlm_fill or copy")
+		return
+	}
+	if profile == redshiftProfileCopy && (payload.S3Path == "" || payload.IAMRole == "") {
+		ErrorJSON(c, 400, "INVALID_PAYLOAD", "copy profile requires s3_path and iam_role")
+		return
+	}
+	if profile == redshiftProfileCopy {
+		switch {
+		case !redshiftS3PathRegex.MatchString(payload.S3Path):
+			ErrorJSON(c, 400, "INVALID_PAYLOAD", "s3_path must be an s3://bucket/prefix path without quotes")
+			return
+		case !redshiftIAMRoleRegex.MatchString(payload.IAMRole):
+			ErrorJSON(c, 400, "INVALID_PAYLOAD", "iam_role must be an IAM role ARN")
+			return
+		case !redshiftCopyOptionsRegex.MatchString(payload.CopyOptions):
+			ErrorJSON(c, 400, "INVALID_PAYLOAD", "copy_options may only contain keywords, numbers and quoted literals without ';'")
+			return
+		}
+	}
+	rows := int(payload.Rows)
+	if rows <= 0 {
+		rows = 1000000
+	}
+	concurrency := int(payload.Concurrency)
+	if concurrency <= 0 {
+		concurrency = 1
+		if profile == redshiftProfileWLMFill {
+			concurrency = 20
+		}
+	}
+	maintainSec := int(payload.MaintainSecond)
+	copyOptions := payload.CopyOptions
+	if copyOptions == "" {
+		copyOptions = "FORMAT AS CSV"
+	}
+
+	cfg, err := GetRedshiftConfig()
+	if err != nil {
+		ErrorJSON(c, 500, "CONFIG_ERROR", err.Error())
+		return
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	db, err := sql.Open(pgxEgressDriver, dsn)
+	if err != nil {
+		ErrorJSON(c, 500, "DB_ERROR", err.Error())
+		return
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		ErrorJSON(c, 500, "DB_ERROR", err.Error())
+		return
+	}
+	db.SetMaxOpenConns(concurrency + 1)
+
+	// The query each session runs in a loop.
+	query := redshiftAnalyticQuery
+	if profile == redshiftProfileCopy {
+		query = fmt.Sprintf("COPY biggie_copy_table FROM '%s' IAM_ROLE '%s' %s",
+			payload.S3Path, payload.IAMRole, copyOptions)
+	}
+
+	var stats redshiftWorkloadStats
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		defer db.Close()
+		if err := setupRedshiftAnalyticData(db, rows); err != nil {
+			logWarn("Redshift workload data setup failed", zap.Error(err))
+			return
+		}
+		if profile == redshiftProfileCopy {
+			if _, err := db.Exec(`TRUNCATE biggie_copy_table`); err != nil {
+				logWarn("Redshift workload copy table setup failed", zap.Error(err))
+				return
+			}
+			unload := fmt.Sprintf("UNLOAD ('SELECT * FROM biggie_analytic_table') TO '%s' IAM_ROLE '%s' FORMAT AS CSV ALLOWOVERWRITE",
+				payload.S3Path, payload.IAMRole)
+			if _, err := db.Exec(unload); err != nil {
+				logWarn("Redshift workload unload failed", zap.Error(err))
+				return
+			}
+		}
+
+		done := make(chan struct{})
+		go sampleWLMQueue(db, &stats, done)
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(session int) {
+				defer wg.Done()
+				for time.Now().Before(endTime) && ctx.Err() == nil {
+					start := time.Now()
+					if _, err := db.Exec(query); err != nil {
+						atomic.AddInt64(&stats.failed, 1)
+						logWarn("Redshift workload query failed", zap.Int("session", session), zap.Error(err))
+						sleepContext(ctx, time.Second)
+						continue
+					}
+					atomic.AddInt64(&stats.completed, 1)
+					atomic.AddInt64(&stats.totalDuration, int64(time.Since(start)))
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(done)
+		logInfo("Redshift workload completed",
+			zap.String("profile", profile),
+			zap.Int("concurrency", concurrency),
+			zap.Int64("completed", atomic.LoadInt64(&stats.completed)),
+			zap.Int64("failed", atomic.LoadInt64(&stats.failed)),
+			zap.Int64("max_wlm_queued", atomic.LoadInt64(&stats.maxQueued)))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "Redshift workload started",
+			"profile":         profile,
+			"rows":            rows,
+			"concurrency":     concurrency,
+			"maintain_second": maintainSec,
+		})
+	} else {
+		stopDB := startServerTiming(c, "db")
+		job.run(stressFunc)
+		stopDB()
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "Redshift workload completed",
+			"profile":         profile,
+			"rows":            rows,
+			"concurrency":     concurrency,
+			"maintain_second": maintainSec,
+			"results":         stats.toMap(),
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// measureReplicationLag writes a row on the writer and polls the reader until the row is visible.
+// It returns the time from the committed write until the reader saw the row, the number of
+// reader polls, and whether the row became visible before the timeout.
+func measureReplicationLag(dbType string, writer, reader *sql.DB, poll, timeout time.Duration) (time.Duration, int, bool, error) {
+	table := testTableName(dbType)
+	var id int64
+	if dbType == "postgres" {
+		if err := writer.QueryRow("INSERT INTO " + table + "(value) VALUES('replication_lag') RETURNING id").Scan(&id); err != nil {
+			return 0, 0, false, err
+		}
+	} else {
+		result, err := writer.Exec("INSERT INTO " + table + "(value) VALUES('replication_lag')")
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	committedAt := time.Now()
+
+	query := "SELECT count(*) FROM " + table + " WHERE id = ?"
+	if dbType == "postgres" {
+		query = "SELECT count(*) FROM " + table + " WHERE id = $1"
+	}
+	polls := 0
+	for {
+		polls++
+		var count int
+		if err := reader.QueryRow(query, id).Scan(&count); err != nil {
+			return 0, polls, false, err
+		}
+		lag := time.Since(committedAt)
+		if count > 0 {
+			return lag, polls, true, nil
+		}
+		if lag >= timeout {
+			return lag, polls, false, nil
+		}
+		time.Sleep(poll)
+	}
+}
+
+// replicationLagHandler measures replication lag between the writer and reader DSNs.
+func replicationLagHandler(c *gin.Context, dbType, driver, writerDSN, readerDSN string) {
+	pollMs, err := strconv.Atoi(c.DefaultQuery("poll_ms", "10"))
+	if err != nil || pollMs <= 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "poll_ms must be a positive integer")
+		return
+	}
+	timeoutMs, err := strconv.Atoi(c.DefaultQuery("timeout_ms", "10000"))
+	if err != nil || timeoutMs <= 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "timeout_ms must be a positive integer")
+		return
+	}
+
+	writer, err := sql.Open(driver, writerDSN)
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	defer writer.Close()
+	if err := SetupTestDatabase(dbType, writer); err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "SETUP_TEST_DB_ERROR", err.Error())
+		return
+	}
+	reader, err := sql.Open(driver, readerDSN)
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	defer reader.Close()
+	// Connect to the reader up front so the handshake is not counted as lag.
+	if err := reader.Ping(); err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+
+	stopDB := startServerTiming(c, "db")
+	lag, polls, replicated, err := measureReplicationLag(dbType, writer, reader,
+		time.Duration(pollMs)*time.Millisecond, time.Duration(timeoutMs)*time.Millisecond)
+	stopDB()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	lagMs := float64(lag.Microseconds()) / 1000
+	logInfo("Replication lag measured",
+		zap.String("db", dbType),
+		zap.Float64("lag_ms", lagMs),
+		zap.Bool("replicated", replicated))
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"db":         dbType,
+		"lag_ms":     lagMs,
+		"replicated": replicated,
+		"polls":      polls,
+		"poll_ms":    pollMs,
+		"timeout_ms": timeoutMs,
+	})
+}
+
+// MySQLReplicationLagHandler handles GET /mysql/replication_lag.
+// It writes a row on the writer and reports how long it took to become visible on the reader.
+func MySQLReplicationLagHandler(c *gin.Context) {
+	cfg, err := GetMySQLConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	readerCfg, err := GetMySQLReaderConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	readerDSN := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", readerCfg.Username, readerCfg.Password, readerCfg.Host, readerCfg.Port, readerCfg.DBName)
+	replicationLagHandler(c, "mysql", "mysql", dsn, readerDSN)
+}
+
+// PostgresReplicationLagHandler handles GET /postgres/replication_lag.
+// It writes a row on the writer and reports how long it took to become visible on the reader.
+func PostgresReplicationLagHandler(c *gin.Context) {
+	cfg, err := GetPostgresConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	readerCfg, err := GetPostgresReaderConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+	readerDSN := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		readerCfg.Username, readerCfg.Password, readerCfg.Host, readerCfg.Port, readerCfg.DBName)
+	replicationLagHandler(c, "postgres", pgxEgressDriver, dsn, readerDSN)
+}
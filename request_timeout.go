@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// RequestTimeoutPayload defines the payload for configuring request timeouts.
+type RequestTimeoutPayload struct {
+	DefaultMs DuckInt            `json:"default_ms"` // Deadline of routes without their own; 0 disables it.
+	Routes    map[string]DuckInt `json:"routes"`     // Path prefix (route group) to deadline in milliseconds.
+}
+
+// Global variables for request timeouts.
+var (
+	requestTimeoutMutex     sync.Mutex
+	requestTimeoutDefault   time.Duration
+	requestTimeoutRoutes    = map[string]time.Duration{}
+	requestTimeoutTriggered int64
+)
+
+// initRequestTimeouts reads REQUEST_TIMEOUT_MS and REQUEST_TIMEOUT_ROUTES
+// (comma separated prefix=milliseconds entries, e.g. "/simple=2000,/mysql=30000").
+func initRequestTimeouts() {
+	routes := map[string]time.Duration{}
+	for _, entry := range strings.Split(viper.GetString("REQUEST_TIMEOUT_ROUTES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, value, ok := strings.Cut(entry, "=")
+		ms, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || ms < 0 || !strings.HasPrefix(prefix, "/") {
+			logWarn("invalid REQUEST_TIMEOUT_ROUTES entry, ignoring", zap.String("entry", entry))
+			continue
+		}
+		routes[strings.TrimSpace(prefix)] = time.Duration(ms) * time.Millisecond
+	}
+	requestTimeoutMutex.Lock()
+	requestTimeoutDefault = time.Duration(viper.GetInt("REQUEST_TIMEOUT_MS")) * time.Millisecond
+	requestTimeoutRoutes = routes
+	requestTimeoutMutex.Unlock()
+}
+
+// requestTimeoutFor returns the deadline of path: the one of the longest matching route
+// prefix, or the default.
+func requestTimeoutFor(path string) time.Duration {
+	requestTimeoutMutex.Lock()
+	defer requestTimeoutMutex.Unlock()
+	timeout, matched := requestTimeoutDefault, ""
+	for prefix, d := range requestTimeoutRoutes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+			timeout, matched = d, prefix
+		}
+	}
+	return timeout
+}
+
+// requestTimeoutStatus returns the configured request timeouts.
+func requestTimeoutStatus() gin.H {
+	requestTimeoutMutex.Lock()
+	defer requestTimeoutMutex.Unlock()
+	prefixes := make([]string, 0, len(requestTimeoutRoutes))
+	for prefix := range requestTimeoutRoutes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	routes := gin.H{}
+	for _, prefix := range prefixes {
+		routes[prefix] = requestTimeoutRoutes[prefix].Milliseconds()
+	}
+	return gin.H{
+		"default_ms": requestTimeoutDefault.Milliseconds(),
+		"routes":     routes,
+		"timed_out":  requestTimeoutTriggered,
+	}
+}
+
+// RequestTimeoutStatusHandler handles GET /admin/timeouts.
+func RequestTimeoutStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, requestTimeoutStatus())
+}
+
+// RequestTimeoutHandler handles POST /admin/timeouts.
+// It sets the default deadline and merges the given route deadlines; a route set to 0 is removed.
+func RequestTimeoutHandler(c *gin.Context) {
+	var payload RequestTimeoutPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.DefaultMs < 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "default_ms must not be negative")
+		return
+	}
+	for prefix, ms := range payload.Routes {
+		if !strings.HasPrefix(prefix, "/") || ms < 0 {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "routes must map path prefixes starting with / to non-negative milliseconds")
+			return
+		}
+	}
+
+	requestTimeoutMutex.Lock()
+	requestTimeoutDefault = time.Duration(payload.DefaultMs) * time.Millisecond
+	for prefix, ms := range payload.Routes {
+		if ms == 0 {
+			delete(requestTimeoutRoutes, prefix)
+			continue
+		}
+		requestTimeoutRoutes[prefix] = time.Duration(ms) * time.Millisecond
+	}
+	requestTimeoutMutex.Unlock()
+	logInfo("Request timeouts updated", zap.Int("default_ms", int(payload.DefaultMs)), zap.Int("routes", len(payload.Routes)))
+
+	status := requestTimeoutStatus()
+	status["message"] = "request timeouts updated"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// RequestTimeoutResetHandler handles DELETE /admin/timeouts.
+// It restores the timeouts configured by the environment.
+func RequestTimeoutResetHandler(c *gin.Context) {
+	initRequestTimeouts()
+	status := requestTimeoutStatus()
+	status["message"] = "request timeouts reset"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// timeoutWriter lets the handler write the response until the deadline. Past it, the
+// 504 response is sent instead and later writes of the handler fail with
+// http.ErrHandlerTimeout. The handler writes its headers to a private map, copied to the
+// response when it commits, so the timeout response can be sent from another goroutine.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx       context.Context
+	deadline  time.Duration
+	mu        sync.Mutex
+	header    http.Header
+	committed bool
+	timedOut  bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// commit copies the handler's headers to the response, or sends the 504 response if the
+// deadline passed before the watcher got to it. w.mu must be held.
+func (w *timeoutWriter) commit() {
+	if w.committed {
+		return
+	}
+	if w.ctx.Err() == context.DeadlineExceeded {
+		w.sendTimeout()
+		return
+	}
+	w.committed = true
+	dst := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		dst[key] = values
+	}
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.commit()
+	if !w.timedOut {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.commit()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.commit()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.commit()
+	if !w.timedOut {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Hijack hands the connection to the handler; no timeout response is sent afterwards.
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	w.committed = true
+	return w.ResponseWriter.Hijack()
+}
+
+// timeout sends the 504 response unless the handler already started its own.
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.committed {
+		w.sendTimeout()
+	}
+}
+
+// sendTimeout sends the 504 response. w.mu must be held.
+func (w *timeoutWriter) sendTimeout() {
+	w.committed = true
+	w.timedOut = true
+	body, _ := json.Marshal(gin.H{
+		"error":        "GATEWAY_TIMEOUT",
+		"message":      "request exceeded its " + w.deadline.String() + " deadline",
+		"timeout_ms":   w.deadline.Milliseconds(),
+		"requested_at": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.Header().Set("X-Request-Timeout", "true")
+	w.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	w.ResponseWriter.Write(body)
+	w.ResponseWriter.Flush()
+}
+
+// RequestTimeoutMiddleware cancels the request context after the deadline of its route and
+// answers 504 Gateway Timeout if the handler has not started its response by then. Handlers
+// that do not watch the context keep running, but their response is discarded.
+// /admin/ is exempt so the timeouts can always be changed.
+func RequestTimeoutMiddleware(c *gin.Context) {
+	timeout := requestTimeoutFor(c.Request.URL.Path)
+	if timeout <= 0 || strings.HasPrefix(c.Request.URL.Path, "/admin/") {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	c.Request = c.Request.WithContext(ctx)
+	writer := &timeoutWriter{
+		ResponseWriter: c.Writer,
+		ctx:            ctx,
+		deadline:       timeout,
+		header:         c.Writer.Header().Clone(),
+	}
+	c.Writer = writer
+
+	done := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				writer.timeout()
+			}
+		}
+	}()
+
+	c.Next()
+	close(done)
+	<-watcherDone
+	cancel()
+
+	// Headers of a response without body are sent by gin after the middlewares return.
+	writer.mu.Lock()
+	writer.commit()
+	timedOut := writer.timedOut
+	writer.mu.Unlock()
+	if timedOut {
+		requestTimeoutMutex.Lock()
+		requestTimeoutTriggered++
+		requestTimeoutMutex.Unlock()
+		c.Abort()
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ResponseHeadersPayload defines a response header injection rule.
+type ResponseHeadersPayload struct {
+	PathPrefix string            `json:"path_prefix"` // Responses of paths starting with it; default "/" (all).
+	Headers    map[string]string `json:"headers"`     // An empty value removes the header.
+}
+
+// Global variables for response header injection. Rules are keyed by path prefix and
+// replaced copy-on-write, so the middleware reads them without locking.
+var (
+	responseHeaderMutex sync.Mutex
+	responseHeaderRules atomic.Pointer[map[string]map[string]string]
+)
+
+func init() {
+	responseHeaderRules.Store(&map[string]map[string]string{})
+}
+
+// injectedResponseHeaders returns the headers to inject for path. Rules with longer
+// prefixes override shorter ones for the same header.
+func injectedResponseHeaders(path string) map[string]string {
+	rules := *responseHeaderRules.Load()
+	if len(rules) == 0 {
+		return nil
+	}
+	prefixes := make([]string, 0, len(rules))
+	for prefix := range rules {
+		if strings.HasPrefix(path, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+	headers := map[string]string{}
+	for _, prefix := range prefixes {
+		for name, value := range rules[prefix] {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// responseHeadersStatus returns every rule.
+func responseHeadersStatus() gin.H {
+	rules := gin.H{}
+	for prefix, headers := range *responseHeaderRules.Load() {
+		rules[prefix] = headers
+	}
+	return gin.H{"rules": rules}
+}
+
+// ResponseHeadersStatusHandler handles GET /admin/response_headers.
+func ResponseHeadersStatusHandler(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, responseHeadersStatus())
+}
+
+// ResponseHeadersHandler handles POST /admin/response_headers.
+// It sets the headers injected into every response whose path starts with path_prefix,
+// replacing the previous rule of that prefix, e.g. Surrogate-Control or Vary for CDN tests.
+func ResponseHeadersHandler(c *gin.Context) {
+	var payload ResponseHeadersPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.PathPrefix == "" {
+		payload.PathPrefix = "/"
+	}
+	if !strings.HasPrefix(payload.PathPrefix, "/") {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "path_prefix must start with /")
+		return
+	}
+	if len(payload.Headers) == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "headers is required")
+		return
+	}
+	headers := make(map[string]string, len(payload.Headers))
+	for name, value := range payload.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "invalid header: "+name)
+			return
+		}
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+
+	responseHeaderMutex.Lock()
+	rules := map[string]map[string]string{}
+	for prefix, h := range *responseHeaderRules.Load() {
+		rules[prefix] = h
+	}
+	rules[payload.PathPrefix] = headers
+	responseHeaderRules.Store(&rules)
+	responseHeaderMutex.Unlock()
+	logInfo("Response header injection set", zap.String("path_prefix", payload.PathPrefix), zap.Int("headers", len(headers)))
+
+	status := responseHeadersStatus()
+	status["message"] = "response headers set"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// ResponseHeadersDeleteHandler handles DELETE /admin/response_headers?path_prefix=<prefix>.
+// It removes the rule of path_prefix, or every rule without it.
+func ResponseHeadersDeleteHandler(c *gin.Context) {
+	prefix := c.Query("path_prefix")
+	responseHeaderMutex.Lock()
+	rules := map[string]map[string]string{}
+	if prefix != "" {
+		for p, h := range *responseHeaderRules.Load() {
+			if p != prefix {
+				rules[p] = h
+			}
+		}
+	}
+	responseHeaderRules.Store(&rules)
+	responseHeaderMutex.Unlock()
+
+	status := responseHeadersStatus()
+	status["message"] = "response headers removed"
+	ResponseJSON(c, http.StatusOK, status)
+}
+
+// responseHeaderWriter applies the injected headers right before the response headers are
+// sent, so they override the ones set by the handler.
+type responseHeaderWriter struct {
+	gin.ResponseWriter
+	headers map[string]string
+	once    sync.Once
+}
+
+func (w *responseHeaderWriter) apply() {
+	w.once.Do(func() {
+		for name, value := range w.headers {
+			if value == "" {
+				w.Header().Del(name)
+			} else {
+				w.Header().Set(name, value)
+			}
+		}
+	})
+}
+
+func (w *responseHeaderWriter) WriteHeaderNow() {
+	w.apply()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *responseHeaderWriter) Write(data []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseHeaderWriter) WriteString(s string) (int, error) {
+	w.apply()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseHeaderWriter) Flush() {
+	w.apply()
+	w.ResponseWriter.Flush()
+}
+
+// ResponseHeadersMiddleware injects the headers of the matching rules into the response.
+func ResponseHeadersMiddleware(c *gin.Context) {
+	headers := injectedResponseHeaders(c.Request.URL.Path)
+	if len(headers) == 0 {
+		c.Next()
+		return
+	}
+	writer := &responseHeaderWriter{ResponseWriter: c.Writer, headers: headers}
+	c.Writer = writer
+	c.Next()
+	// Responses without body are sent by gin after the middlewares return.
+	writer.apply()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RetryStormPayload defines the payload for the retry storm generator.
+type RetryStormPayload struct {
+	TargetURL         string    `json:"target_url"`
+	Method            string    `json:"method"`          // Default GET.
+	CallRate          DuckInt   `json:"call_rate"`       // Logical calls started per interval.
+	IntervalSecond    DuckInt   `json:"interval_second"` // Interval between bursts, default 1.
+	MaintainSecond    DuckInt   `json:"maintain_second"` // Duration of the storm.
+	Async             bool      `json:"async"`
+	MaxRetries        *DuckInt  `json:"max_retries"`        // Retries per call after a failed attempt, default 3; 0 disables retries.
+	BackoffMs         DuckInt   `json:"backoff_ms"`         // Wait before the first retry; 0 retries immediately.
+	BackoffMultiplier DuckFloat `json:"backoff_multiplier"` // Factor applied to the wait on every retry, default 1.
+	Jitter            bool      `json:"jitter"`             // Randomize waits (full jitter); off keeps retries synchronized.
+	TimeoutMs         DuckInt   `json:"timeout_ms"`         // Per attempt, default 2000.
+	MaxInFlight       DuckInt   `json:"max_in_flight"`      // Calls in flight; more are dropped. Default 1000.
+}
+
+// retryStormStats counts logical calls and the attempts they caused, per attempt number,
+// so the retry amplification against the target can be measured.
+type retryStormStats struct {
+	calls     int64
+	requests  int64
+	retries   int64
+	succeeded int64
+	failed    int64 // Calls that failed after their last retry.
+	dropped   int64 // Calls not started because max_in_flight was reached.
+	attempts  []int64
+}
+
+func (s *retryStormStats) toMap() gin.H {
+	calls := atomic.LoadInt64(&s.calls)
+	requests := atomic.LoadInt64(&s.requests)
+	amplification := 0.0
+	if calls > 0 {
+		amplification = float64(requests) / float64(calls)
+	}
+	attempts := make([]int64, len(s.attempts))
+	for i := range s.attempts {
+		attempts[i] = atomic.LoadInt64(&s.attempts[i])
+	}
+	return gin.H{
+		"calls":               calls,
+		"requests":            requests,
+		"retries":             atomic.LoadInt64(&s.retries),
+		"succeeded":           atomic.LoadInt64(&s.succeeded),
+		"failed":              atomic.LoadInt64(&s.failed),
+		"dropped":             atomic.LoadInt64(&s.dropped),
+		"amplification":       amplification,
+		"requests_by_attempt": attempts,
+	}
+}
+
+// retryStormPolicy is the (deliberately bad) retry policy of a retry storm.
+type retryStormPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	multiplier float64
+	jitter     bool
+}
+
+// wait returns the time to wait before the given retry (1 for the first one).
+func (p retryStormPolicy) wait(retry int) time.Duration {
+	wait := float64(p.backoff)
+	for i := 1; i < retry && wait < float64(time.Minute); i++ {
+		wait *= p.multiplier
+	}
+	wait = min(wait, float64(time.Minute))
+	if p.jitter && wait > 0 {
+		wait = rand.Float64() * wait
+	}
+	return time.Duration(wait)
+}
+
+// retryStormCall performs one logical call, retrying every failed attempt (network error,
+// 429 or 5xx) according to policy.
+func retryStormCall(client *http.Client, method, targetURL string, policy retryStormPolicy, stats *retryStormStats) {
+	atomic.AddInt64(&stats.calls, 1)
+	for attempt := 0; attempt <= policy.maxRetries; attempt++ {
+		if attempt > 0 {
+			atomic.AddInt64(&stats.retries, 1)
+			time.Sleep(policy.wait(attempt))
+		}
+		atomic.AddInt64(&stats.requests, 1)
+		atomic.AddInt64(&stats.attempts[attempt], 1)
+		req, err := http.NewRequest(method, targetURL, nil)
+		if err != nil {
+			break
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		discardResponse(resp)
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			atomic.AddInt64(&stats.succeeded, 1)
+			return
+		}
+	}
+	atomic.AddInt64(&stats.failed, 1)
+}
+
+// RetryStormHandler handles POST /stress/retry_storm.
+// It starts call_rate calls per interval against target_url, and every failed attempt is
+// retried with the configured policy: zero backoff, high multipliers and no jitter make the
+// retries of many clients hit the target at once. The results show how many requests the
+// target received per logical call.
+func RetryStormHandler(c *gin.Context) {
+	var payload RetryStormPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.TargetURL == "" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "target_url is required")
+		return
+	}
+	if err := checkTargetAllowed(payload.TargetURL); err != nil {
+		ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+		return
+	}
+	method := payload.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	maintainSec := int(payload.MaintainSecond)
+	callRate := int(payload.CallRate)
+	intervalSec := int(payload.IntervalSecond)
+	if intervalSec <= 0 {
+		intervalSec = 1
+	}
+	maxRetries := 3
+	if payload.MaxRetries != nil {
+		maxRetries = int(*payload.MaxRetries)
+	}
+	if maxRetries < 0 || maxRetries > 100 || payload.BackoffMs < 0 || payload.BackoffMultiplier < 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "max_retries must be between 0 and 100 and backoff must not be negative")
+		return
+	}
+	multiplier := float64(payload.BackoffMultiplier)
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	timeoutMs := int(payload.TimeoutMs)
+	if timeoutMs <= 0 {
+		timeoutMs = 2000
+	}
+	maxInFlight := int(payload.MaxInFlight)
+	if maxInFlight <= 0 {
+		maxInFlight = 1000
+	}
+	client, err := newOutboundClient(time.Duration(timeoutMs)*time.Millisecond, connectionModeReuse, "")
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	policy := retryStormPolicy{
+		maxRetries: maxRetries,
+		backoff:    time.Duration(payload.BackoffMs) * time.Millisecond,
+		multiplier: multiplier,
+		jitter:     payload.Jitter,
+	}
+	stats := &retryStormStats{attempts: make([]int64, maxRetries+1)}
+	inFlight := make(chan struct{}, maxInFlight)
+	logInfo("Retry storm started",
+		zap.String("target_url", payload.TargetURL),
+		zap.Int("call_rate", callRate),
+		zap.Int("max_retries", maxRetries),
+		zap.Int("backoff_ms", int(payload.BackoffMs)),
+		zap.Float64("backoff_multiplier", multiplier),
+		zap.Bool("jitter", payload.Jitter))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stormFunc := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		for time.Now().Before(endTime) && ctx.Err() == nil {
+			for i := 0; i < callRate; i++ {
+				select {
+				case inFlight <- struct{}{}:
+					wg.Add(1)
+					go func() {
+						defer func() {
+							<-inFlight
+							wg.Done()
+						}()
+						retryStormCall(client, method, payload.TargetURL, policy, stats)
+					}()
+				default:
+					atomic.AddInt64(&stats.dropped, 1)
+				}
+			}
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
+		}
+		// Calls still retrying belong to the storm.
+		wg.Wait()
+		logInfo("Retry storm completed", zap.Int("duration_sec", maintainSec), zap.Any("results", stats.toMap()))
+	}
+
+	if payload.Async {
+		go job.run(stormFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":            "retry storm started",
+			"target_url":         payload.TargetURL,
+			"maintain_second":    maintainSec,
+			"call_rate":          callRate,
+			"interval_second":    intervalSec,
+			"max_retries":        maxRetries,
+			"backoff_ms":         int(payload.BackoffMs),
+			"backoff_multiplier": multiplier,
+			"jitter":             payload.Jitter,
+		})
+	} else {
+		job.run(stormFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":            "retry storm completed",
+			"target_url":         payload.TargetURL,
+			"maintain_second":    maintainSec,
+			"call_rate":          callRate,
+			"interval_second":    intervalSec,
+			"max_retries":        maxRetries,
+			"backoff_ms":         int(payload.BackoffMs),
+			"backoff_multiplier": multiplier,
+			"jitter":             payload.Jitter,
+			"results":            stats.toMap(),
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Rollback actions of a job.
+const (
+	rollbackClearFaults      = "clear_faults"      // Error injection, latency, packet loss and downtime of the job's namespace.
+	rollbackReleaseMemory    = "release_memory"    // Memory held by /stress/memory_leak.
+	rollbackCloseConnections = "close_connections" // Leaked database sessions and Redis connections.
+	rollbackRevertAll        = "revert_all"        // Everything reverted when the chaos window closes.
+)
+
+// RollbackSpec is the "rollback" field of a stress payload.
+type RollbackSpec struct {
+	Actions    []string `json:"actions"`     // clear_faults, release_memory, close_connections or revert_all.
+	WebhookURL string   `json:"webhook_url"` // Receives a POST describing the aborted job.
+}
+
+// rollbackOptions are the fields of a stress payload that declare rollback actions.
+type rollbackOptions struct {
+	Rollback *RollbackSpec `json:"rollback"`
+}
+
+// validateRollback checks the actions and the webhook of spec.
+func validateRollback(spec *RollbackSpec) error {
+	if len(spec.Actions) == 0 && spec.WebhookURL == "" {
+		return fmt.Errorf("rollback needs actions or a webhook_url")
+	}
+	for _, action := range spec.Actions {
+		switch action {
+		case rollbackClearFaults, rollbackReleaseMemory, rollbackCloseConnections, rollbackRevertAll:
+		default:
+			return fmt.Errorf("unknown rollback action %q", action)
+		}
+	}
+	if spec.WebhookURL != "" {
+		return checkTargetAllowed(spec.WebhookURL)
+	}
+	return nil
+}
+
+// rollbackJob runs the rollback actions of job, then calls the webhook.
+func rollbackJob(job *stressJob, spec RollbackSpec, namespace, cause string) {
+	for _, action := range spec.Actions {
+		switch action {
+		case rollbackClearFaults:
+			faultState.Update(namespace, func(f *faultSnapshot) {
+				*f = faultSnapshot{}
+			})
+		case rollbackReleaseMemory:
+			releaseLeakedMemory()
+			debug.FreeOSMemory()
+		case rollbackCloseConnections:
+			closeLeakedConnections()
+		case rollbackRevertAll:
+			revertAllFaults()
+		}
+	}
+	logInfo("Job rolled back",
+		zap.String("job_id", job.ID),
+		zap.String("cause", cause),
+		zap.Strings("actions", spec.Actions))
+	if spec.WebhookURL == "" {
+		return
+	}
+	body, _ := json.Marshal(gin.H{
+		"job_id":     job.ID,
+		"path":       job.Path,
+		"namespace":  namespace,
+		"cause":      cause,
+		"actions":    spec.Actions,
+		"started_at": job.StartedAt.UTC().Format(time.RFC3339Nano),
+		"aborted_at": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	client, err := newOutboundClient(10*time.Second, connectionModeReuse, "")
+	if err != nil {
+		logWarn("Rollback webhook failed", zap.String("job_id", job.ID), zap.Error(err))
+		return
+	}
+	resp, err := client.Post(spec.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logWarn("Rollback webhook failed", zap.String("job_id", job.ID), zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		logWarn("Rollback webhook failed", zap.String("job_id", job.ID), zap.Int("status", resp.StatusCode))
+	}
+}
+
+// RollbackMiddleware registers the rollback actions declared in the "rollback" field of a
+// stress request. They run whenever the job is aborted: when the request fails or panics,
+// or when a steady-state probe is violated. Jobs that complete normally are not rolled back.
+func RollbackMiddleware(c *gin.Context) {
+	raw, ok := c.Get("rawBody")
+	if !ok {
+		c.Next()
+		return
+	}
+	var opts rollbackOptions
+	if json.Unmarshal([]byte(raw.(string)), &opts) != nil || opts.Rollback == nil {
+		c.Next()
+		return
+	}
+	if err := validateRollback(opts.Rollback); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		c.Abort()
+		return
+	}
+	job := registerJob(c)
+	spec, namespace := *opts.Rollback, getNamespace(c)
+	job.onAbort(func(cause string) {
+		rollbackJob(job, spec, namespace, cause)
+	})
+	// Roll back before gin.Recovery turns the panic into a 500 response.
+	defer func() {
+		if r := recover(); r != nil {
+			job.abort(fmt.Sprintf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	c.Next()
+	discardRejectedJob(c, job)
+}
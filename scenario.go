@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ScenarioPayload defines a scenario: stages run one after the other, each running its steps
+// in sequence or, with parallel, all at once.
+type ScenarioPayload struct {
+	Name            string          `json:"name"`
+	Stages          []ScenarioStage `json:"stages"`
+	ContinueOnError bool            `json:"continue_on_error"` // Keep going when a step fails to start.
+	Async           bool            `json:"async"`
+}
+
+// ScenarioStage is a group of steps of a scenario.
+type ScenarioStage struct {
+	Name     string         `json:"name"`
+	Parallel bool           `json:"parallel"`
+	Steps    []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep is one action of a scenario, started asynchronously. The step lasts
+// duration_second, by default the maintain_second or downtime_second of its parameters; a
+// step without action only waits.
+type ScenarioStep struct {
+	Name           string                 `json:"name"`
+	Action         string                 `json:"action"`     // Route of the action, e.g. "/stress/cpu".
+	Method         string                 `json:"method"`     // POST by default.
+	Parameters     map[string]interface{} `json:"parameters"` // JSON body of the action.
+	DelaySecond    DuckInt                `json:"delay_second"`
+	DurationSecond DuckInt                `json:"duration_second"`
+}
+
+// maxScenarioSteps bounds the steps of a scenario.
+const maxScenarioSteps = 200
+
+// States of a scenario step, in addition to the states of a job.
+const (
+	stepPending = "pending"
+	stepFailed  = "failed"
+	stepSkipped = "skipped"
+)
+
+// scenarioStep is a step of a running scenario.
+type scenarioStep struct {
+	ScenarioStep
+	stage    int
+	index    int
+	duration time.Duration
+
+	state      string
+	startedAt  time.Time
+	finishedAt time.Time
+	statusCode int
+	jobID      string
+	response   gin.H
+	err        string
+}
+
+// scenarioRun is a scenario run as a job, under the job id.
+type scenarioRun struct {
+	id        string
+	name      string
+	namespace string
+	planned   time.Duration
+	startedAt time.Time
+
+	mu     sync.Mutex
+	stages []ScenarioStage
+	steps  [][]*scenarioStep
+	failed bool
+}
+
+// Global variables for the scenario runs.
+var (
+	scenarioMutex sync.Mutex
+	scenarioRuns  = map[string]*scenarioRun{}
+)
+
+// scenarioYAMLTypes are the content types of scenarios written in YAML.
+var scenarioYAMLTypes = []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}
+
+// bindScenario binds the scenario of the request, in JSON or, by its content type, YAML.
+func bindScenario(c *gin.Context, payload *ScenarioPayload) error {
+	if !slices.Contains(scenarioYAMLTypes, c.ContentType()) {
+		return bindPayload(c, payload)
+	}
+	raw, _ := c.Get("rawBody")
+	s, _ := raw.(string)
+	var document interface{}
+	if err := yaml.Unmarshal([]byte(s), &document); err != nil {
+		return err
+	}
+	// Convert through JSON for the duck-typed fields.
+	body, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, payload)
+}
+
+// validateScenario checks the steps of a scenario and returns them with their durations,
+// along with the planned duration of the scenario.
+func validateScenario(payload *ScenarioPayload) ([][]*scenarioStep, time.Duration, error) {
+	if len(payload.Stages) == 0 {
+		return nil, 0, fmt.Errorf("stages must not be empty")
+	}
+	var planned time.Duration
+	count := 0
+	steps := make([][]*scenarioStep, len(payload.Stages))
+	for i, stage := range payload.Stages {
+		if len(stage.Steps) == 0 {
+			return nil, 0, fmt.Errorf("stage %d has no steps", i+1)
+		}
+		var stageDuration time.Duration
+		for j, spec := range stage.Steps {
+			if count++; count > maxScenarioSteps {
+				return nil, 0, fmt.Errorf("a scenario has at most %d steps", maxScenarioSteps)
+			}
+			if spec.Method == "" {
+				spec.Method = http.MethodPost
+			}
+			spec.Method = strings.ToUpper(spec.Method)
+			if spec.Action != "" && !isChaosAction(spec.Action) {
+				return nil, 0, fmt.Errorf("stage %d step %d: action must be a stress route such as /stress/cpu", i+1, j+1)
+			}
+			if spec.Action == "" && spec.DurationSecond <= 0 {
+				return nil, 0, fmt.Errorf("stage %d step %d: a step without action needs duration_second", i+1, j+1)
+			}
+			if spec.DelaySecond < 0 || spec.DurationSecond < 0 {
+				return nil, 0, fmt.Errorf("stage %d step %d: delay_second and duration_second must not be negative", i+1, j+1)
+			}
+			step := &scenarioStep{ScenarioStep: spec, stage: i, index: j, state: stepPending}
+			step.duration = time.Duration(spec.DurationSecond) * time.Second
+			if step.duration == 0 {
+				step.duration = actionDuration(spec.Parameters)
+			}
+			span := time.Duration(spec.DelaySecond)*time.Second + step.duration
+			if stage.Parallel {
+				stageDuration = max(stageDuration, span)
+			} else {
+				stageDuration += span
+			}
+			steps[i] = append(steps[i], step)
+		}
+		planned += stageDuration
+	}
+	return steps, planned, nil
+}
+
+// runStep starts the action of step on this instance and waits for the step to end. It
+// reports false if the action failed to start.
+func (r *scenarioRun) runStep(ctx context.Context, step *scenarioStep) bool {
+	if !sleepContext(ctx, time.Duration(step.DelaySecond)*time.Second) {
+		return true
+	}
+	r.mu.Lock()
+	step.state = jobRunning
+	step.startedAt = time.Now()
+	r.mu.Unlock()
+	publishEvent(eventScenarioStep, r.stepEvent(step))
+
+	if step.Action != "" {
+		body := map[string]interface{}{}
+		for k, v := range step.Parameters {
+			body[k] = v
+		}
+		body["async"] = true
+		status, response, err := invokeLocalAction(step.Method, step.Action, body, r.namespace)
+		r.mu.Lock()
+		step.statusCode, step.response = status, response
+		if jobID, ok := response["job_id"].(string); ok {
+			step.jobID = jobID
+		}
+		switch {
+		case err != nil:
+			step.err = err.Error()
+		case status >= 400:
+			step.err = fmt.Sprintf("action returned status %d", status)
+		}
+		failed := step.err != ""
+		if failed {
+			step.state = stepFailed
+			step.finishedAt = time.Now()
+		}
+		r.mu.Unlock()
+		if failed {
+			logWarn("Scenario step failed", zap.String("scenario", r.id), zap.String("action", step.Action), zap.String("error", step.err))
+			publishEvent(eventScenarioStep, r.stepEvent(step))
+			return false
+		}
+	}
+
+	completed := sleepContext(ctx, step.duration)
+	r.mu.Lock()
+	step.finishedAt = time.Now()
+	step.state = jobCompleted
+	if !completed {
+		step.state = jobCancelled
+	}
+	r.mu.Unlock()
+	publishEvent(eventScenarioStep, r.stepEvent(step))
+	return true
+}
+
+// run runs the stages of the scenario in order, until one fails unless continueOnError is
+// set. When the scenario is cancelled or fails, the jobs of its steps are aborted.
+func (r *scenarioRun) run(ctx context.Context, continueOnError bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i, stage := range r.stages {
+		if ctx.Err() != nil {
+			break
+		}
+		if stage.Parallel {
+			var wg sync.WaitGroup
+			for _, step := range r.steps[i] {
+				wg.Add(1)
+				go func(step *scenarioStep) {
+					defer wg.Done()
+					if !r.runStep(ctx, step) {
+						r.fail(continueOnError, cancel)
+					}
+				}(step)
+			}
+			wg.Wait()
+			continue
+		}
+		for _, step := range r.steps[i] {
+			if ctx.Err() != nil {
+				break
+			}
+			if !r.runStep(ctx, step) {
+				r.fail(continueOnError, cancel)
+			}
+		}
+	}
+
+	// Abort the steps still running and skip the ones that never started.
+	r.mu.Lock()
+	var running []string
+	for _, stage := range r.steps {
+		for _, step := range stage {
+			switch step.state {
+			case stepPending:
+				step.state = stepSkipped
+			case jobCancelled:
+				running = append(running, step.jobID)
+			}
+		}
+	}
+	r.mu.Unlock()
+	for _, jobID := range running {
+		if job := getJob(jobID); job != nil && !job.finished() {
+			job.abort("scenario " + r.id + " stopped")
+		}
+	}
+	logInfo("Scenario finished", zap.String("scenario", r.id), zap.String("name", r.name), zap.Bool("failed", r.failed))
+}
+
+// fail marks the scenario as failed after a step failed, and stops it with cancel unless
+// continueOnError is set.
+func (r *scenarioRun) fail(continueOnError bool, cancel context.CancelFunc) {
+	r.mu.Lock()
+	r.failed = true
+	r.mu.Unlock()
+	if !continueOnError {
+		cancel()
+	}
+}
+
+// stepEvent returns the scenario.step event of step.
+func (r *scenarioRun) stepEvent(step *scenarioStep) gin.H {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event := step.toMap()
+	event["scenario_id"] = r.id
+	event["scenario"] = r.name
+	return event
+}
+
+// toMap returns the step; the caller holds the lock of its scenario.
+func (s *scenarioStep) toMap() gin.H {
+	m := gin.H{
+		"stage":           s.stage + 1,
+		"step":            s.index + 1,
+		"name":            s.Name,
+		"action":          s.Action,
+		"method":          s.Method,
+		"parameters":      s.Parameters,
+		"delay_second":    int(s.DelaySecond),
+		"duration_second": int(s.duration / time.Second),
+		"state":           s.state,
+	}
+	if !s.startedAt.IsZero() {
+		m["started_at"] = s.startedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if !s.finishedAt.IsZero() {
+		m["finished_at"] = s.finishedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if s.statusCode != 0 {
+		m["status_code"] = s.statusCode
+		m["job_id"] = s.jobID
+		m["response"] = s.response
+	}
+	if s.err != "" {
+		m["error"] = s.err
+	}
+	return m
+}
+
+func (r *scenarioRun) toMap() gin.H {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stages := make([]gin.H, len(r.stages))
+	for i, stage := range r.stages {
+		steps := make([]gin.H, len(r.steps[i]))
+		for j, step := range r.steps[i] {
+			steps[j] = step.toMap()
+		}
+		stages[i] = gin.H{"name": stage.Name, "parallel": stage.Parallel, "steps": steps}
+	}
+	m := gin.H{
+		"scenario_id":             r.id,
+		"name":                    r.name,
+		"namespace":               r.namespace,
+		"started_at":              r.startedAt.UTC().Format(time.RFC3339Nano),
+		"planned_duration_second": r.planned.Seconds(),
+		"failed":                  r.failed,
+		"stages":                  stages,
+	}
+	if job := getJob(r.id); job != nil {
+		m["status"] = job.toMap(time.Now())["status"]
+	}
+	return m
+}
+
+// ScenarioRunHandler handles POST /scenario/run.
+// It runs a scenario, a timeline of stress actions in sequential and parallel stages, as a
+// job: cancelling the job aborts the steps still running. The scenario is JSON or YAML.
+func ScenarioRunHandler(c *gin.Context) {
+	var payload ScenarioPayload
+	if err := bindScenario(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	steps, planned, err := validateScenario(&payload)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	job := startJob(c, planned)
+	r := &scenarioRun{
+		id:        job.ID,
+		name:      payload.Name,
+		namespace: getNamespace(c),
+		planned:   planned,
+		startedAt: time.Now(),
+		stages:    payload.Stages,
+		steps:     steps,
+	}
+	scenarioMutex.Lock()
+	// Runs are kept as long as their job.
+	for id := range scenarioRuns {
+		if getJob(id) == nil {
+			delete(scenarioRuns, id)
+		}
+	}
+	scenarioRuns[r.id] = r
+	scenarioMutex.Unlock()
+	logInfo("Scenario started", zap.String("scenario", r.id), zap.String("name", r.name), zap.Duration("planned", planned))
+
+	work := func(ctx context.Context) { r.run(ctx, payload.ContinueOnError) }
+	if payload.Async {
+		go job.run(work)
+		result := r.toMap()
+		result["message"] = "scenario started"
+		ResponseJSON(c, http.StatusOK, result)
+	} else {
+		job.run(work)
+		result := r.toMap()
+		result["message"] = "scenario completed"
+		ResponseJSON(c, http.StatusOK, result)
+	}
+}
+
+// ScenarioRunsHandler handles GET /scenario/runs.
+func ScenarioRunsHandler(c *gin.Context) {
+	scenarioMutex.Lock()
+	list := make([]*scenarioRun, 0, len(scenarioRuns))
+	for _, r := range scenarioRuns {
+		list = append(list, r)
+	}
+	scenarioMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].startedAt.Before(list[j].startedAt) })
+	runs := make([]gin.H, 0, len(list))
+	for _, r := range list {
+		runs = append(runs, r.toMap())
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{"runs": runs})
+}
+
+// ScenarioStatusHandler handles GET /scenario/runs/:id.
+// It returns the timeline of a scenario, with the state, job and response of every step.
+func ScenarioStatusHandler(c *gin.Context) {
+	scenarioMutex.Lock()
+	r, ok := scenarioRuns[c.Param("id")]
+	scenarioMutex.Unlock()
+	if !ok {
+		ErrorJSON(c, http.StatusNotFound, "SCENARIO_NOT_FOUND", "no scenario with id "+c.Param("id"))
+		return
+	}
+	ResponseJSON(c, http.StatusOK, r.toMap())
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Results of a self-test check.
+const (
+	selfTestPass = "pass"
+	selfTestFail = "fail"
+	selfTestSkip = "skip"
+)
+
+// selfTestCheck is the result of one capability check.
+type selfTestCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// selfTestDependencies tells for each named dependency whether it is configured.
+var selfTestDependencies = map[string]func() error{
+	"mysql":    func() error { _, err := GetMySQLConfig(); return err },
+	"postgres": func() error { _, err := GetPostgresConfig(); return err },
+	"redshift": func() error { _, err := GetRedshiftConfig(); return err },
+	"redis":    func() error { _, err := GetRedisConfig(); return err },
+	"kafka":    func() error { _, err := GetKafkaConfig(); return err },
+}
+
+// runSelfTestCheck runs check and times it. check returns a detail, or an error to fail.
+func runSelfTestCheck(name string, check func() (string, error)) selfTestCheck {
+	start := time.Now()
+	detail, err := check()
+	result := selfTestCheck{Name: name, Status: selfTestPass, Detail: detail}
+	if err != nil {
+		result.Status, result.Detail = selfTestFail, err.Error()
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result
+}
+
+// selfTestCPU burns CPU for half a second and checks the process was actually scheduled.
+func selfTestCPU() (string, error) {
+	wall := 500 * time.Millisecond
+	before := processCPUTime()
+	end := time.Now().Add(wall)
+	for time.Now().Before(end) {
+	}
+	used := processCPUTime() - before
+	if used < wall/4 {
+		return "", fmt.Errorf("only %s of CPU time in %s of busy loop", used, wall)
+	}
+	return fmt.Sprintf("%s of CPU time in %s", used.Round(time.Millisecond), wall), nil
+}
+
+// selfTestMemory allocates and touches 64 MiB, then checks it is released.
+func selfTestMemory() (string, error) {
+	const size = 64 * 1024 * 1024
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	baseline := stats.HeapAlloc
+
+	block := make([]byte, size)
+	for i := range block {
+		block[i] = byte(i)
+	}
+	runtime.ReadMemStats(&stats)
+	allocated := stats.HeapAlloc
+	runtime.KeepAlive(block)
+	if allocated < baseline+size/2 {
+		return "", fmt.Errorf("heap grew by %d bytes after allocating %d", int64(allocated)-int64(baseline), size)
+	}
+
+	block = nil
+	debug.FreeOSMemory()
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > allocated-size/2 {
+		return "", fmt.Errorf("heap still holds %d bytes after release", stats.HeapAlloc)
+	}
+	return fmt.Sprintf("allocated and released %d MiB", size/1024/1024), nil
+}
+
+// selfTestFilesystem writes 1 MiB to the temporary directory, reads it back and removes it.
+func selfTestFilesystem() (string, error) {
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("biggie_selftest_%d.tmp", time.Now().UnixNano()))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	read, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(read, data) {
+		return "", fmt.Errorf("data read back from %s differs from the data written", path)
+	}
+	return "wrote, synced and read back 1 MiB in " + os.TempDir(), nil
+}
+
+// selfTestHTTP requests /healthcheck from this instance through its listener.
+func selfTestHTTP() (string, error) {
+	client, err := newOutboundClient(5*time.Second, connectionModeReuse, "")
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/healthcheck", listenPort))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("/healthcheck returned status %d", resp.StatusCode)
+	}
+	return fmt.Sprintf("listening on port %d", listenPort), nil
+}
+
+// selfTestDependencyChecks pings every configured dependency in parallel: the databases,
+// Redis and Kafka, and the host:port entries of STARTUP_DEPENDENCIES.
+func selfTestDependencyChecks() []selfTestCheck {
+	names := make([]string, 0, len(selfTestDependencies))
+	for name := range selfTestDependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, dep := range strings.Split(viper.GetString("STARTUP_DEPENDENCIES"), ",") {
+		if dep = strings.TrimSpace(dep); dep != "" && selfTestDependencies[dep] == nil {
+			names = append(names, dep)
+		}
+	}
+
+	results := make([]selfTestCheck, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		if configured, ok := selfTestDependencies[name]; ok && configured() != nil {
+			results[i] = selfTestCheck{Name: "dependency:" + name, Status: selfTestSkip, Detail: "not configured"}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = runSelfTestCheck("dependency:"+name, func() (string, error) {
+				return "reachable", checkDependency(name)
+			})
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// selfTestStressChecks runs a micro-version of the stress of every configured dependency: one
+// query on each database after creating its test table, one write, read and delete on Redis,
+// and one message produced to the Kafka topic.
+func selfTestStressChecks() []selfTestCheck {
+	var checks []selfTestCheck
+	for _, dbType := range []string{"mysql", "postgres", "redshift"} {
+		engine, driver, dsn, err := stressDBTarget(dbType)
+		if err != nil {
+			checks = append(checks, selfTestCheck{Name: "stress:" + dbType, Status: selfTestSkip, Detail: "not configured"})
+			continue
+		}
+		checks = append(checks, runSelfTestCheck("stress:"+dbType, func() (string, error) {
+			db, err := sql.Open(driver, dsn)
+			if err != nil {
+				return "", err
+			}
+			defer db.Close()
+			if err := SetupTestDatabase(engine, db); err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var one int
+			if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+				return "", err
+			}
+			return "created the test table and ran one query on " + engine, nil
+		}))
+	}
+
+	if _, err := GetRedisConfig(); err != nil {
+		checks = append(checks, selfTestCheck{Name: "stress:redis", Status: selfTestSkip, Detail: "not configured"})
+	} else {
+		checks = append(checks, runSelfTestCheck("stress:redis", func() (string, error) {
+			client, err := getRedisClient()
+			if err != nil {
+				return "", err
+			}
+			defer client.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			key := "biggie_selftest:" + newJobID()
+			if err := client.Set(ctx, key, "ok", time.Minute).Err(); err != nil {
+				return "", err
+			}
+			if value, err := client.Get(ctx, key).Result(); err != nil || value != "ok" {
+				return "", fmt.Errorf("read back %q from %s: %v", value, key, err)
+			}
+			return "wrote, read and deleted one key", client.Del(ctx, key).Err()
+		}))
+	}
+
+	if _, err := GetKafkaConfig(); err != nil {
+		checks = append(checks, selfTestCheck{Name: "stress:kafka", Status: selfTestSkip, Detail: "not configured"})
+	} else {
+		checks = append(checks, runSelfTestCheck("stress:kafka", func() (string, error) {
+			writer, err := getKafkaWriter()
+			if err != nil {
+				return "", err
+			}
+			defer writer.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			message := kafka.Message{Key: []byte("biggie-selftest"), Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))}
+			if err := writer.WriteMessages(ctx, message); err != nil {
+				return "", err
+			}
+			return "produced one message to " + writer.Topic, nil
+		}))
+	}
+	return checks
+}
+
+// runSelfTest runs every check, and the stress micro-checks if stress is set. It reports
+// whether nothing failed, with the response of /admin/selftest.
+func runSelfTest(stress bool) (bool, gin.H) {
+	start := time.Now()
+	checks := []selfTestCheck{
+		runSelfTestCheck("cpu", selfTestCPU),
+		runSelfTestCheck("memory", selfTestMemory),
+		runSelfTestCheck("filesystem", selfTestFilesystem),
+		runSelfTestCheck("http", selfTestHTTP),
+	}
+	checks = append(checks, selfTestDependencyChecks()...)
+	if stress {
+		checks = append(checks, selfTestStressChecks()...)
+	}
+
+	passed := true
+	summary := gin.H{selfTestPass: 0, selfTestFail: 0, selfTestSkip: 0}
+	for _, check := range checks {
+		summary[check.Status] = summary[check.Status].(int) + 1
+		if check.Status == selfTestFail {
+			passed = false
+		}
+	}
+	logInfo("Self-test completed", zap.Bool("passed", passed), zap.Any("summary", summary))
+	return passed, gin.H{
+		"passed":      passed,
+		"summary":     summary,
+		"checks":      checks,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+}
+
+// SelfTestHandler handles POST /admin/selftest?stress=true.
+// It runs a short battery of checks (CPU, memory, filesystem, HTTP listener and dependency
+// pings, plus a micro-stress of each dependency with stress=true) and reports pass, fail or
+// skip per capability, so a new deployment can be verified before a game day. It responds
+// 200 when nothing failed and 503 otherwise.
+func SelfTestHandler(c *gin.Context) {
+	passed, result := runSelfTest(c.Query("stress") == "true")
+	status := http.StatusOK
+	if !passed {
+		status = http.StatusServiceUnavailable
+	}
+	ResponseJSON(c, status, result)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// serverTimingKey is the gin context key holding the request's *serverTiming.
+const serverTimingKey = "serverTiming"
+
+// serverTiming accumulates Server-Timing metrics for a single request.
+type serverTiming struct {
+	mu           sync.Mutex
+	start        time.Time
+	handlerStart time.Time
+	injected     time.Duration
+	db           time.Duration
+}
+
+// header renders the metrics measured up to now in Server-Timing syntax.
+// queue is the time spent in middlewares before the handler, excluding injected latency.
+func (st *serverTiming) header(total bool) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	handlerStart := st.handlerStart
+	if handlerStart.IsZero() {
+		// The request was aborted by a middleware before reaching the handler.
+		handlerStart = now
+	}
+	queue := handlerStart.Sub(st.start) - st.injected
+	if queue < 0 {
+		queue = 0
+	}
+	metrics := []string{
+		formatServerTiming("queue", queue),
+		formatServerTiming("injected-latency", st.injected),
+		formatServerTiming("handler", now.Sub(handlerStart)),
+		formatServerTiming("db", st.db),
+	}
+	if total {
+		metrics = append(metrics, formatServerTiming("total", now.Sub(st.start)))
+	}
+	return strings.Join(metrics, ", ")
+}
+
+func formatServerTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d.Microseconds())/1000)
+}
+
+// serverTimingWriter sets the Server-Timing header right before the response headers are sent.
+type serverTimingWriter struct {
+	gin.ResponseWriter
+	timing *serverTiming
+	once   sync.Once
+}
+
+func (w *serverTimingWriter) setHeader() {
+	w.once.Do(func() {
+		w.Header().Set("Server-Timing", w.timing.header(false))
+		// Declare the trailer so the final timings are also sent after the body.
+		w.Header().Set("Trailer", "Server-Timing")
+	})
+}
+
+func (w *serverTimingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *serverTimingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *serverTimingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *serverTimingWriter) Flush() {
+	w.setHeader()
+	w.ResponseWriter.Flush()
+}
+
+// ServerTimingMiddleware adds a Server-Timing header (queue, injected-latency, handler, db)
+// to every response when SERVER_TIMING_ENABLED is true, so injected chaos latency can be told
+// apart from genuine processing time. The final values, including total, are repeated as a trailer.
+// It must be registered before the middlewares it measures.
+func ServerTimingMiddleware() gin.HandlerFunc {
+	enabled := viper.GetBool("SERVER_TIMING_ENABLED")
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+		st := &serverTiming{start: time.Now()}
+		c.Set(serverTimingKey, st)
+		w := &serverTimingWriter{ResponseWriter: c.Writer, timing: st}
+		c.Writer = w
+		c.Next()
+		w.WriteHeaderNow()
+		w.Header().Set("Server-Timing", st.header(true))
+	}
+}
+
+// ServerTimingHandlerStart marks the end of the middleware chain. Register it last.
+func ServerTimingHandlerStart(c *gin.Context) {
+	if v, ok := c.Get(serverTimingKey); ok {
+		st := v.(*serverTiming)
+		st.mu.Lock()
+		st.handlerStart = time.Now()
+		st.mu.Unlock()
+	}
+	c.Next()
+}
+
+// addServerTiming adds d to the "injected-latency" or "db" metric of the request, if timing is enabled.
+func addServerTiming(c *gin.Context, metric string, d time.Duration) {
+	v, ok := c.Get(serverTimingKey)
+	if !ok {
+		return
+	}
+	st := v.(*serverTiming)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	switch metric {
+	case "injected-latency":
+		st.injected += d
+	case "db":
+		st.db += d
+	}
+}
+
+// startServerTiming starts measuring metric and returns a function that stops the measurement.
+func startServerTiming(c *gin.Context, metric string) func() {
+	start := time.Now()
+	return func() {
+		addServerTiming(c, metric, time.Since(start))
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 
+	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
@@ -12,6 +16,7 @@ import (
 // For MySQL: Creates a table "biggie_test_table" in the current database.
 // For PostgreSQL: Creates a schema "biggie_test_schema" and a table "biggie_test_table" within it.
 // For Redshift: Creates a table "biggie_test_table" in the default schema.
+// For SQLite: Creates a table "biggie_test_table" in the database file.
 func SetupTestDatabase(dbType string, db *sql.DB) error {
 	switch dbType {
 	case "mysql":
@@ -22,16 +27,16 @@ func SetupTestDatabase(dbType string, db *sql.DB) error {
 			);
 		`
 		if _, err := db.Exec(query); err != nil {
-			fmt.Println("failed to create test table for MySQL", zap.Error(err))
+			logError("failed to create test table for MySQL", zap.Error(err))
 			return err
 		}
-		fmt.Println("MySQL test table created or already exists")
+		logInfo("MySQL test table created or already exists")
 		return nil
 
 	case "postgres":
 		// Create schema if it does not exist.
 		if _, err := db.Exec(`CREATE SCHEMA IF NOT EXISTS biggie_test_schema;`); err != nil {
-			fmt.Println("failed to create test schema for PostgreSQL", zap.Error(err))
+			logError("failed to create test schema for PostgreSQL", zap.Error(err))
 			return err
 		}
 		query := `
@@ -41,10 +46,10 @@ func SetupTestDatabase(dbType string, db *sql.DB) error {
 			);
 		`
 		if _, err := db.Exec(query); err != nil {
-			fmt.Println("failed to create test table for PostgreSQL", zap.Error(err))
+			logError("failed to create test table for PostgreSQL", zap.Error(err))
 			return err
 		}
-		fmt.Println("PostgreSQL test schema and table created or already exists")
+		logInfo("PostgreSQL test schema and table created or already exists")
 		return nil
 
 	case "redshift":
@@ -56,13 +61,182 @@ func SetupTestDatabase(dbType string, db *sql.DB) error {
 			);
 		`
 		if _, err := db.Exec(query); err != nil {
-			fmt.Println("failed to create test table for Redshift", zap.Error(err))
+			logError("failed to create test table for Redshift", zap.Error(err))
 			return err
 		}
-		fmt.Println("Redshift test table created or already exists")
+		logInfo("Redshift test table created or already exists")
+		return nil
+
+	case dbEngineSQLite:
+		query := `
+			CREATE TABLE IF NOT EXISTS biggie_test_table (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				value TEXT NOT NULL
+			);
+		`
+		if _, err := db.Exec(query); err != nil {
+			logError("failed to create test table for SQLite", zap.Error(err))
+			return err
+		}
+		logInfo("SQLite test table created or already exists")
 		return nil
 
 	default:
 		return fmt.Errorf("unsupported dbType: %s", dbType)
 	}
 }
+
+// testTableName returns the qualified name of the table created by SetupTestDatabase.
+func testTableName(dbType string) string {
+	if dbType == "postgres" {
+		return "biggie_test_schema.biggie_test_table"
+	}
+	return "biggie_test_table"
+}
+
+// stressStatementQuery returns the i-th statement of prepareStressStatements, taking one
+// integer parameter. PostgreSQL cannot infer the type of a bare select parameter, so it is cast.
+func stressStatementQuery(dbType string, i int) string {
+	placeholder := "?"
+	if dbType == "postgres" {
+		placeholder = "$1::int"
+	}
+	return fmt.Sprintf("SELECT %d AS biggie_stmt, %s AS value", i, placeholder)
+}
+
+// prepareStressStatements prepares count textually distinct statements on db, so that each one
+// occupies its own entry in the server's prepared statement cache. It stops at the first error
+// (e.g. MySQL's max_prepared_stmt_count) and returns the statements prepared so far.
+func prepareStressStatements(dbType string, db *sql.DB, count int) ([]*sql.Stmt, error) {
+	stmts := make([]*sql.Stmt, 0, count)
+	for i := 0; i < count; i++ {
+		stmt, err := db.Prepare(stressStatementQuery(dbType, i))
+		if err != nil {
+			return stmts, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// closeStatements closes statements returned by prepareStressStatements.
+func closeStatements(stmts []*sql.Stmt) {
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+}
+
+// stressTransactionStats counts the outcomes of runStressTransaction calls.
+type stressTransactionStats struct {
+	committed  int64
+	rolledBack int64
+	failed     int64
+}
+
+func (s *stressTransactionStats) toMap() gin.H {
+	return gin.H{
+		"committed":   atomic.LoadInt64(&s.committed),
+		"rolled_back": atomic.LoadInt64(&s.rolledBack),
+		"failed":      atomic.LoadInt64(&s.failed),
+	}
+}
+
+// runStressTransaction runs BEGIN, then statements alternating between an INSERT and an UPDATE
+// of one of the first 100 rows (so concurrent transactions contend for row locks), and finally
+// ROLLBACK for rollbackPercent of the transactions and COMMIT for the rest.
+func runStressTransaction(dbType string, db *sql.DB, statements, rollbackPercent int, stats *stressTransactionStats) error {
+	table := testTableName(dbType)
+	placeholder := "?"
+	if dbType == "postgres" {
+		placeholder = "$1"
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		atomic.AddInt64(&stats.failed, 1)
+		return err
+	}
+	for i := 0; i < statements; i++ {
+		if i%2 == 0 {
+			_, err = tx.Exec("INSERT INTO " + table + "(value) VALUES('stress_tx')")
+		} else {
+			_, err = tx.Exec("UPDATE "+table+" SET value = 'stress_tx' WHERE id = "+placeholder, rand.Intn(100)+1)
+		}
+		if err != nil {
+			tx.Rollback()
+			atomic.AddInt64(&stats.failed, 1)
+			return err
+		}
+	}
+	if rand.Intn(100) < rollbackPercent {
+		if err = tx.Rollback(); err == nil {
+			atomic.AddInt64(&stats.rolledBack, 1)
+		}
+	} else if err = tx.Commit(); err == nil {
+		atomic.AddInt64(&stats.committed, 1)
+	}
+	if err != nil {
+		atomic.AddInt64(&stats.failed, 1)
+	}
+	return err
+}
+
+// Global variables for leaked database sessions. Each transaction pins its connection,
+// and referencing it here keeps the session open until the process exits.
+var (
+	leakedDBMutex    sync.Mutex
+	leakedDBSessions []*sql.Tx
+)
+
+// dbQuerier is implemented by both *sql.DB and *sql.Tx.
+type dbQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// beginLeakSession opens a transaction on db and runs a statement in it, so the server
+// sees a session that is "idle in transaction" and a proxy has to pin it.
+func beginLeakSession(db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	var one int
+	if err := tx.QueryRow("SELECT 1").Scan(&one); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// leakDBSessions hands the transactions over to the global leak list so they are never closed.
+func leakDBSessions(sessions []*sql.Tx) int {
+	leakedDBMutex.Lock()
+	defer leakedDBMutex.Unlock()
+	leakedDBSessions = append(leakedDBSessions, sessions...)
+	return len(leakedDBSessions)
+}
+
+// serverConnectionCount returns the number of connections the database server currently
+// has open and its max_connections setting. It supports "mysql" and "postgres"; SQLite has no server.
+func serverConnectionCount(dbType string, q dbQuerier) (int, int, error) {
+	var current, maxConns int
+	switch dbType {
+	case "mysql":
+		var name string
+		if err := q.QueryRow("SHOW GLOBAL STATUS LIKE 'Threads_connected'").Scan(&name, &current); err != nil {
+			return 0, 0, err
+		}
+		if err := q.QueryRow("SELECT @@max_connections").Scan(&maxConns); err != nil {
+			return 0, 0, err
+		}
+	case "postgres":
+		if err := q.QueryRow("SELECT count(*) FROM pg_stat_activity").Scan(&current); err != nil {
+			return 0, 0, err
+		}
+		if err := q.QueryRow("SELECT current_setting('max_connections')::int").Scan(&maxConns); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return current, maxConns, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestStressStatementQuery(t *testing.T) {
+	tests := []struct {
+		dbType string
+		want   string
+	}{
+		{"mysql", "SELECT 7 AS biggie_stmt, ? AS value"},
+		{"sqlite", "SELECT 7 AS biggie_stmt, ? AS value"},
+		// A bare $1 fails with "could not determine data type of parameter $1".
+		{"postgres", "SELECT 7 AS biggie_stmt, $1::int AS value"},
+	}
+	for _, tt := range tests {
+		if got := stressStatementQuery(tt.dbType, 7); got != tt.want {
+			t.Errorf("stressStatementQuery(%q, 7) = %q, want %q", tt.dbType, got, tt.want)
+		}
+	}
+}
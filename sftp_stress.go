@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPHeavyPayload defines the payload for the SFTP transfer stress test.
+type SFTPHeavyPayload struct {
+	ConnectionCounts DuckInt `json:"connection_counts"` // Number of concurrent SFTP sessions.
+	FileSize         DuckInt `json:"file_size"`         // Size of each transferred file in bytes.
+	Operation        string  `json:"operation"`         // "upload", "download" or "both" (default).
+	// Reconnect opens a new SSH connection for every transfer to stress session setup
+	// (e.g. bastion hosts) rather than throughput.
+	Reconnect      bool    `json:"reconnect"`
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+}
+
+// maxSFTPConnections bounds connection_counts; each one is an SSH connection to the target.
+const maxSFTPConnections = 1000
+
+// maxSFTPFileSize bounds file_size. Files are streamed from sftpChunkSize bytes of random data,
+// so this limits the load on the target rather than memory.
+const maxSFTPFileSize = 10 * 1024 * 1024 * 1024
+
+// sftpChunkSize is the size of the random buffer transferred files are streamed from.
+const sftpChunkSize = 1024 * 1024
+
+// repeatReader yields size bytes by cycling through buf.
+type repeatReader struct {
+	buf       []byte
+	offset    int
+	remaining int64
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.buf[r.offset:])
+	r.offset = (r.offset + n) % len(r.buf)
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// sftpStats counts sessions and transfers of an SFTP stress run.
+type sftpStats struct {
+	sessions        int64
+	sessionFailures int64
+	uploads         int64
+	downloads       int64
+	failures        int64
+	bytesUp         int64
+	bytesDown       int64
+}
+
+func (s *sftpStats) toMap(elapsed time.Duration) gin.H {
+	bytesUp := atomic.LoadInt64(&s.bytesUp)
+	bytesDown := atomic.LoadInt64(&s.bytesDown)
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = 1
+	}
+	return gin.H{
+		"sessions":          atomic.LoadInt64(&s.sessions),
+		"session_failures":  atomic.LoadInt64(&s.sessionFailures),
+		"uploads":           atomic.LoadInt64(&s.uploads),
+		"downloads":         atomic.LoadInt64(&s.downloads),
+		"transfer_failures": atomic.LoadInt64(&s.failures),
+		"bytes_uploaded":    bytesUp,
+		"bytes_downloaded":  bytesDown,
+		"upload_mbps":       float64(bytesUp) * 8 / 1e6 / seconds,
+		"download_mbps":     float64(bytesDown) * 8 / 1e6 / seconds,
+		"elapsed_second":    elapsed.Seconds(),
+	}
+}
+
+// sftpClientConfig builds an SSH client config from cfg. Host keys are not verified,
+// matching how TLS certificates are handled for the other external services.
+func sftpClientConfig(cfg *SFTPConfig) (*ssh.ClientConfig, error) {
+	var auths []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auths = append(auths, ssh.Password(cfg.Password))
+	}
+	return &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auths,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// openSFTPSession dials the SSH server and starts an SFTP subsystem on it.
+// Closing the returned SFTP client does not close the SSH connection; the caller must close both.
+func openSFTPSession(cfg *SFTPConfig, sshConfig *ssh.ClientConfig) (*ssh.Client, *sftp.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	conn, err := ssh.Dial("tcp", addr, sshConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, client, nil
+}
+
+// sftpTransfer uploads fileSize bytes streamed from chunk to remotePath and/or downloads them
+// back, depending on operation, then removes the remote file.
+func sftpTransfer(client *sftp.Client, remotePath string, chunk []byte, fileSize int64, operation string, stats *sftpStats) error {
+	// A download needs a file to read, so it is always preceded by an upload.
+	f, err := client.Create(remotePath)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, &repeatReader{buf: chunk, remaining: fileSize})
+	f.Close()
+	if err != nil {
+		return err
+	}
+	defer client.Remove(remotePath)
+	if operation != "download" {
+		atomic.AddInt64(&stats.uploads, 1)
+		atomic.AddInt64(&stats.bytesUp, n)
+	}
+	if operation == "upload" {
+		return nil
+	}
+	r, err := client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	n, err = io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&stats.downloads, 1)
+	atomic.AddInt64(&stats.bytesDown, n)
+	return nil
+}
+
+// SFTPHeavyHandler handles POST /sftp/heavy.
+// It opens connection_counts concurrent SFTP sessions against the configured host and
+// repeatedly transfers files of file_size bytes until maintain_second elapses.
+func SFTPHeavyHandler(c *gin.Context) {
+	var payload SFTPHeavyPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	operation := payload.Operation
+	if operation == "" {
+		operation = "both"
+	}
+	if operation != "upload" && operation != "download" && operation != "both" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "operation must be upload, download or both")
+		return
+	}
+	connectionCounts := int(payload.ConnectionCounts)
+	if connectionCounts <= 0 {
+		connectionCounts = 1
+	}
+	if connectionCounts > maxSFTPConnections {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("connection_counts must not exceed %d", maxSFTPConnections))
+		return
+	}
+	fileSize := int64(payload.FileSize)
+	if fileSize <= 0 {
+		fileSize = 1024 * 1024
+	}
+	if fileSize > maxSFTPFileSize {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("file_size must not exceed %d", int64(maxSFTPFileSize)))
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+
+	cfg, err := GetSFTPConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	sshConfig, err := sftpClientConfig(cfg)
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	chunk := make([]byte, min(fileSize, sftpChunkSize))
+	rand.Read(chunk)
+	stats := &sftpStats{}
+	var elapsed time.Duration
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		start := time.Now()
+		endTime := start.Add(time.Duration(maintainSec) * time.Second)
+		var wg sync.WaitGroup
+		for i := 0; i < connectionCounts; i++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				var conn *ssh.Client
+				var client *sftp.Client
+				for seq := 0; time.Now().Before(endTime) && ctx.Err() == nil; seq++ {
+					if client == nil {
+						atomic.AddInt64(&stats.sessions, 1)
+						var err error
+						conn, client, err = openSFTPSession(cfg, sshConfig)
+						if err != nil {
+							atomic.AddInt64(&stats.sessionFailures, 1)
+							logWarn("SFTP session failed", zap.Int("worker", worker), zap.Error(err))
+							sleepContext(ctx, time.Second)
+							continue
+						}
+					}
+					remotePath := path.Join(cfg.RemoteDir, fmt.Sprintf("biggie-%d-%d.bin", worker, seq))
+					if err := sftpTransfer(client, remotePath, chunk, fileSize, operation, stats); err != nil {
+						atomic.AddInt64(&stats.failures, 1)
+						logWarn("SFTP transfer failed", zap.String("path", remotePath), zap.Error(err))
+					}
+					if payload.Reconnect {
+						client.Close()
+						conn.Close()
+						client = nil
+					}
+				}
+				if client != nil {
+					client.Close()
+					conn.Close()
+				}
+			}(i)
+		}
+		wg.Wait()
+		elapsed = time.Since(start)
+		logInfo("SFTP heavy transfer completed",
+			zap.String("host", cfg.Host),
+			zap.Int("connection_counts", connectionCounts),
+			zap.Int("duration_sec", maintainSec))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":           "SFTP heavy transfer started",
+			"host":              cfg.Host,
+			"connection_counts": connectionCounts,
+			"file_size":         fileSize,
+			"operation":         operation,
+			"reconnect":         payload.Reconnect,
+			"maintain_second":   maintainSec,
+		})
+	} else {
+		job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":           "SFTP heavy transfer completed",
+			"host":              cfg.Host,
+			"connection_counts": connectionCounts,
+			"file_size":         fileSize,
+			"operation":         operation,
+			"reconnect":         payload.Reconnect,
+			"maintain_second":   maintainSec,
+			"results":           stats.toMap(elapsed),
+		})
+	}
+}
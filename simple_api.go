@@ -1,7 +1,12 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -10,6 +15,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 // defaultColor is selected at application startup.
@@ -39,7 +45,7 @@ func randomColor() string {
 // SimpleHandler handles GET /simple.
 // Responds with "ok".
 func SimpleHandler(c *gin.Context) {
-	ResponseJSON(c, http.StatusOK, gin.H{"message": "ok"})
+	ResponseNegotiated(c, http.StatusOK, gin.H{"message": "ok"})
 }
 
 // FooHandler handles GET /simple/foo.
@@ -47,7 +53,7 @@ func SimpleHandler(c *gin.Context) {
 func FooHandler(c *gin.Context) {
 	details := getRequestDetails(c)
 	details["message"] = "foo ok"
-	ResponseJSON(c, http.StatusOK, details)
+	ResponseNegotiated(c, http.StatusOK, details)
 }
 
 // BarHandler handles POST /simple/bar.
@@ -61,7 +67,7 @@ func BarHandler(c *gin.Context) {
 		"payload": body,
 	}
 	details["message"] = "bar ok"
-	ResponseJSON(c, http.StatusOK, details)
+	ResponseNegotiated(c, http.StatusOK, details)
 }
 
 // ColorHandler handles GET /simple/color?color=[string] and returns HTML (not JSON).
@@ -109,8 +115,17 @@ func ColorHandler(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
 }
 
-// LargeHandler handles GET /simple/large?length=<number>&sentence=[string].
-// It repeats the provided sentence (or a default sentence) length times.
+// largeContentTypes maps the content_type parameter of /simple/large to a MIME type.
+var largeContentTypes = map[string]string{
+	"json":   "application/json; charset=utf-8",
+	"text":   "text/plain; charset=utf-8",
+	"binary": "application/octet-stream",
+}
+
+// LargeHandler handles GET /simple/large?length=<number>&sentence=[string]&size_bytes=[number]&content_type=[json|text|binary]&chunked=[bool].
+// It repeats the provided sentence (or a default sentence) length times, or until the body is
+// exactly size_bytes long. The body is streamed in 64 KiB chunks, so multi-GB responses do
+// not need to fit in memory.
 func LargeHandler(c *gin.Context) {
 	// Parse "length" query parameter.
 	lengthStr := c.Query("length")
@@ -129,13 +144,404 @@ func LargeHandler(c *gin.Context) {
 			sentence = s
 		}
 	}
-	// Build large text by repeating the sentence.
-	var sb strings.Builder
-	for i := 0; i < length; i++ {
-		sb.WriteString(sentence)
-		if i < length-1 {
-			sb.WriteString(" ")
+	contentType := c.DefaultQuery("content_type", "json")
+	mimeType, ok := largeContentTypes[contentType]
+	if !ok {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "content_type must be json, text or binary")
+		return
+	}
+	chunked := c.DefaultQuery("chunked", "true") != "false"
+
+	// The sentence is repeated with a space in between; JSON escapes it once up front.
+	unit := sentence
+	var prefix, suffix string
+	if contentType == "json" {
+		escaped, _ := json.Marshal(sentence)
+		unit = string(escaped[1 : len(escaped)-1])
+		prefix = `{"large_text":"`
+		suffix = `","requested_at":"` + time.Now().UTC().Format(time.RFC3339Nano) + `"}`
+	}
+	pattern := unit + " "
+	maxBytes := viper.GetInt64("SIMPLE_LARGE_MAX_BYTES")
+	// Every repetition takes at least a byte, so this also keeps the product below from overflowing.
+	if int64(length) > maxBytes {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("length must not exceed SIMPLE_LARGE_MAX_BYTES (%d)", maxBytes))
+		return
+	}
+	fill := int64(length)*int64(len(pattern)) - 1
+	exact := true // The fill ends on a whole sentence.
+	if sizeStr := c.Query("size_bytes"); sizeStr != "" {
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		minSize := int64(len(prefix) + len(suffix))
+		if err != nil || size < minSize {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("size_bytes must be an integer of at least %d", minSize))
+			return
+		}
+		fill = size - minSize
+		exact = false
+	}
+	total := int64(len(prefix)) + fill + int64(len(suffix))
+	if total > maxBytes {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("response would be %d bytes, above SIMPLE_LARGE_MAX_BYTES (%d)", total, maxBytes))
+		return
+	}
+
+	c.Header("Content-Type", mimeType)
+	if !chunked {
+		c.Header("Content-Length", strconv.FormatInt(total, 10))
+	}
+	c.Status(http.StatusOK)
+	if !writeLargeBody(c, prefix, pattern, fill, exact, contentType == "json", suffix) {
+		logWarn("Large response aborted", zap.Int64("size_bytes", total))
+	}
+}
+
+// writeLargeBody streams prefix, fill bytes of the repeated pattern and suffix, flushing
+// after every chunk. If exact is false the fill may end inside a sentence; with padSpaces (JSON) the cut
+// is padded with spaces so no escape sequence is split. It returns false if the client went away.
+func writeLargeBody(c *gin.Context, prefix, pattern string, fill int64, exact, padSpaces bool, suffix string) bool {
+	block := []byte(strings.Repeat(pattern, max(1, 64*1024/len(pattern))))
+	if _, err := io.WriteString(c.Writer, prefix); err != nil {
+		return false
+	}
+	for fill >= int64(len(block)) {
+		if _, err := c.Writer.Write(block); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		fill -= int64(len(block))
+	}
+	rest := block[:fill/int64(len(pattern))*int64(len(pattern))]
+	remainder := int(fill) - len(rest)
+	tail := []byte(pattern[:remainder])
+	if padSpaces && !exact {
+		tail = []byte(strings.Repeat(" ", remainder))
+	}
+	if _, err := c.Writer.Write(append(rest, tail...)); err != nil {
+		return false
+	}
+	if _, err := io.WriteString(c.Writer, suffix); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+// infraHeaderPrefixes lists header prefixes added by service meshes and proxies.
+var infraHeaderPrefixes = []string{"x-envoy-", "l5d-", "x-b3-", "x-amzn-", "x-amz-", "cloudfront-", "cf-", "x-forwarded-", "x-istio-"}
+
+// infraHeaderNames lists individual infrastructure headers worth reflecting.
+var infraHeaderNames = []string{"via", "forwarded", "x-real-ip", "x-request-id", "b3", "traceparent", "tracestate", "cdn-loop", "true-client-ip", "x-cloud-trace-context"}
+
+// splitHeaderList splits a comma-separated header value into trimmed elements.
+func splitHeaderList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseAmznTraceID splits an X-Amzn-Trace-Id value such as
+// "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1" into its fields.
+func parseAmznTraceID(value string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(value, ";") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// HeadersHandler handles GET /simple/headers.
+// It reflects the proxy, load balancer, CDN and service-mesh headers it received in
+// structured JSON, so header manipulation along the request path can be verified quickly.
+func HeadersHandler(c *gin.Context) {
+	h := c.Request.Header
+	forwarded := gin.H{
+		"x_forwarded_for":   splitHeaderList(h.Get("X-Forwarded-For")),
+		"x_forwarded_proto": h.Get("X-Forwarded-Proto"),
+		"x_forwarded_port":  h.Get("X-Forwarded-Port"),
+		"x_forwarded_host":  h.Get("X-Forwarded-Host"),
+		"forwarded":         splitHeaderList(h.Get("Forwarded")),
+		"x_real_ip":         h.Get("X-Real-Ip"),
+	}
+	tracing := gin.H{
+		"x_amzn_trace_id": parseAmznTraceID(h.Get("X-Amzn-Trace-Id")),
+		"traceparent":     h.Get("Traceparent"),
+		"tracestate":      h.Get("Tracestate"),
+		"b3":              h.Get("B3"),
+		"x_b3_trace_id":   h.Get("X-B3-Traceid"),
+		"x_b3_span_id":    h.Get("X-B3-Spanid"),
+		"x_request_id":    h.Get("X-Request-Id"),
+	}
+	cdn := gin.H{
+		"cf_ray":              h.Get("Cf-Ray"),
+		"cf_connecting_ip":    h.Get("Cf-Connecting-Ip"),
+		"x_amz_cf_id":         h.Get("X-Amz-Cf-Id"),
+		"cloudfront_viewer":   h.Get("Cloudfront-Viewer-Address"),
+		"cdn_loop":            splitHeaderList(h.Get("Cdn-Loop")),
+		"true_client_ip":      h.Get("True-Client-Ip"),
+		"x_cloud_trace_ctx":   h.Get("X-Cloud-Trace-Context"),
+		"cloudfront_protocol": h.Get("Cloudfront-Forwarded-Proto"),
+	}
+
+	// Collect every infrastructure header as received, including ones not broken out above.
+	raw := make(map[string][]string)
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		matched := false
+		for _, n := range infraHeaderNames {
+			if lower == n {
+				matched = true
+				break
+			}
+		}
+		for _, p := range infraHeaderPrefixes {
+			if strings.HasPrefix(lower, p) {
+				matched = true
+				break
+			}
 		}
+		if matched {
+			raw[lower] = values
+		}
+	}
+
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":     "headers ok",
+		"remote_addr": c.Request.RemoteAddr,
+		"client_ip":   c.ClientIP(),
+		"host":        c.Request.Host,
+		"protocol":    c.Request.Proto,
+		"via":         splitHeaderList(h.Get("Via")),
+		"forwarded":   forwarded,
+		"tracing":     tracing,
+		"cdn":         cdn,
+		"infra":       raw,
+	})
+}
+
+// maxLargeHeaderBytes bounds the total size of the headers of /simple/large_headers.
+const maxLargeHeaderBytes = 64 * 1024 * 1024
+
+// maxLargeHeaderCount bounds the number of headers of /simple/large_headers; each one is a
+// map entry and a formatted name, so many tiny headers cost far more than their bytes.
+const maxLargeHeaderCount = 5000
+
+// LargeHeadersHandler handles GET /simple/large_headers?count=<number>&size=<number>&mode=[string].
+// It responds with count X-Biggie-Header-N headers whose values are size bytes long,
+// to test header size limits of proxies and load balancers.
+// With mode=invalid the response is written raw over the hijacked connection with header
+// names and values containing characters that HTTP forbids, since net/http would sanitize them.
+func LargeHeadersHandler(c *gin.Context) {
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count <= 0 {
+		count = 10
+	}
+	size, err := strconv.Atoi(c.Query("size"))
+	if err != nil || size <= 0 {
+		size = 100
+	}
+	if count > maxLargeHeaderCount {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("count must not exceed %d", maxLargeHeaderCount))
+		return
+	}
+	// Each factor is checked on its own first, so the product cannot overflow.
+	if count > maxLargeHeaderBytes || size > maxLargeHeaderBytes || count*size > maxLargeHeaderBytes {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "count * size must not exceed 64mib")
+		return
+	}
+	value := strings.Repeat("x", size)
+	mode := c.DefaultQuery("mode", "valid")
+
+	switch mode {
+	case "valid":
+		for i := 0; i < count; i++ {
+			c.Header(fmt.Sprintf("X-Biggie-Header-%d", i), value)
+		}
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":     "large headers ok",
+			"count":       count,
+			"size":        size,
+			"total_bytes": count * size,
+		})
+	case "invalid":
+		conn, buf, err := c.Writer.Hijack()
+		if err != nil {
+			ErrorJSON(c, http.StatusInternalServerError, "HIJACK_FAILED", err.Error())
+			return
+		}
+		defer conn.Close()
+		body := `{"message":"invalid headers"}`
+		buf.WriteString("HTTP/1.1 200 OK\r\n")
+		buf.WriteString("Content-Type: application/json\r\n")
+		for i := 0; i < count; i++ {
+			switch i % 3 {
+			case 0:
+				// Space and colon in the header name.
+				fmt.Fprintf(buf, "X-Biggie Invalid:%d: %s\r\n", i, value)
+			case 1:
+				// Control characters in the header value.
+				fmt.Fprintf(buf, "X-Biggie-Invalid-%d: %s\x01\x7f\r\n", i, value)
+			default:
+				// Bare LF line ending.
+				fmt.Fprintf(buf, "X-Biggie-Invalid-%d: %s\n", i, value)
+			}
+		}
+		fmt.Fprintf(buf, "Content-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+		buf.Flush()
+	default:
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", "mode must be valid or invalid")
+	}
+}
+
+// SlowReadHandler handles POST /simple/slow_read?bytes_per_second=<number>.
+// It consumes the request body at the given rate (default 1024 bytes/sec, at most
+// SLOW_READ_MAX_BYTES_PER_SECOND), so client write timeouts, load balancer idle timeouts
+// on uploads and request buffering can be tested.
+func SlowReadHandler(c *gin.Context) {
+	rate, err := strconv.Atoi(c.Query("bytes_per_second"))
+	if err != nil || rate <= 0 {
+		rate = 1024
+	}
+	if maxRate := viper.GetInt("SLOW_READ_MAX_BYTES_PER_SECOND"); rate > maxRate {
+		rate = maxRate
+	}
+	// Read in ten chunks per second for a smooth rate, at most 64 KiB at a time.
+	chunk := min(rate/10, 64*1024)
+	if chunk <= 0 {
+		chunk = 1
+	}
+	buf := make([]byte, chunk)
+	start := time.Now()
+	total := 0
+	for {
+		n, err := c.Request.Body.Read(buf)
+		total += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ErrorJSON(c, http.StatusBadRequest, "READ_BODY_FAILED", err.Error())
+			return
+		}
+		// Sleep until the total read so far matches the target rate.
+		due := start.Add(time.Duration(float64(total) / float64(rate) * float64(time.Second)))
+		time.Sleep(time.Until(due))
+	}
+	elapsed := time.Since(start)
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":          "slow read ok",
+		"bytes_read":       total,
+		"bytes_per_second": rate,
+		"elapsed_second":   elapsed.Seconds(),
+	})
+}
+
+// UploadHandler handles POST /simple/upload.
+// It streams the request body to a SHA-256 digest without holding it in memory, so uploads
+// of any size can be sent through load balancers and proxies, and returns the bytes read,
+// the digest and the throughput.
+func UploadHandler(c *gin.Context) {
+	hash := sha256.New()
+	start := time.Now()
+	total, err := io.Copy(hash, c.Request.Body)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "READ_BODY_FAILED", err.Error())
+		return
+	}
+	elapsed := time.Since(start)
+	throughput := 0.0
+	if elapsed > 0 {
+		throughput = float64(total) / elapsed.Seconds()
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":          "upload ok",
+		"bytes_read":       total,
+		"content_length":   c.Request.ContentLength,
+		"content_type":     c.ContentType(),
+		"sha256":           hex.EncodeToString(hash.Sum(nil)),
+		"elapsed_second":   elapsed.Seconds(),
+		"bytes_per_second": throughput,
+	})
+}
+
+// renderItem is a single row rendered by RenderHandler.
+type renderItem struct {
+	ID          int
+	Name        string
+	Description string
+	Price       float64
+	Stock       int
+	Tags        []string
+}
+
+// renderTemplate is a product listing page, escaped and rendered on every request.
+var renderTemplate = template.Must(template.New("render").Funcs(template.FuncMap{
+	"upper": strings.ToUpper,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Title}}</title></head>
+<body>
+	<h1>{{.Title}}</h1>
+	<p>{{len .Items}} items, rendered at {{.RenderedAt}}</p>
+	<table>
+		<tr><th>ID</th><th>Name</th><th>Description</th><th>Price</th><th>Stock</th><th>Tags</th></tr>
+		{{- range .Items}}
+		<tr class="{{if lt .Stock 10}}low-stock{{else}}in-stock{{end}}">
+			<td>{{.ID}}</td>
+			<td><a href="/items/{{.ID}}?name={{.Name}}">{{upper .Name}}</a></td>
+			<td>{{.Description}}</td>
+			<td>{{printf "%.2f" .Price}}</td>
+			<td>{{.Stock}}</td>
+			<td>{{range $i, $t := .Tags}}{{if $i}}, {{end}}<span>{{$t}}</span>{{end}}</td>
+		</tr>
+		{{- end}}
+	</table>
+</body>
+</html>
+`))
+
+// RenderHandler handles GET /simple/render?items=<number>.
+// It builds items rows (default 100, at most 100000) and renders them through an HTML template,
+// giving a CPU and allocation cost that grows with each request, unlike /stress/cpu.
+func RenderHandler(c *gin.Context) {
+	items, err := strconv.Atoi(c.Query("items"))
+	if err != nil || items <= 0 {
+		items = 100
+	}
+	if items > 100000 {
+		items = 100000
+	}
+	tags := []string{"new", "sale", "popular", "limited", "<b>html</b>", "eco", "gift"}
+	data := make([]renderItem, items)
+	for i := range data {
+		itemTags := make([]string, 1+rand.Intn(3))
+		for j := range itemTags {
+			itemTags[j] = tags[rand.Intn(len(tags))]
+		}
+		data[i] = renderItem{
+			ID:          i + 1,
+			Name:        fmt.Sprintf("item-%d-%s", i+1, randomColor()),
+			Description: strings.Repeat("Lorem ipsum dolor sit amet & <consectetur> adipiscing. ", 1+rand.Intn(4)),
+			Price:       rand.Float64() * 1000,
+			Stock:       rand.Intn(100),
+			Tags:        itemTags,
+		}
+	}
+	var sb strings.Builder
+	err = renderTemplate.Execute(&sb, gin.H{
+		"Title":      "The Biggie Catalog",
+		"Items":      data,
+		"RenderedAt": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "RENDER_FAILED", err.Error())
+		return
 	}
-	ResponseJSON(c, http.StatusOK, gin.H{"large_text": sb.String()})
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(sb.String()))
 }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SMTPHeavyPayload defines the payload for the SMTP send stress test.
+type SMTPHeavyPayload struct {
+	To                 []string `json:"to"`           // Overrides SMTP_TO; limited to SMTP_TO and SMTP_ALLOWED_RECIPIENTS.
+	Subject            string   `json:"subject"`      // Supports RANDOM syntax.
+	MessageSize        DuckInt  `json:"message_size"` // Approximate body size in bytes.
+	MaintainSecond     DuckInt  `json:"maintain_second"`
+	Async              bool     `json:"async"`
+	MessagePerInterval DuckInt  `json:"message_per_interval"`
+	IntervalSecond     DuckInt  `json:"interval_second"`
+}
+
+// maxSMTPMessageSize bounds message_size; every message is built in memory.
+const maxSMTPMessageSize = 10 * 1024 * 1024
+
+// maxSMTPMessagesPerInterval bounds message_per_interval; each message is its own SMTP session.
+const maxSMTPMessagesPerInterval = 1000
+
+// smtpStats counts delivered messages and groups failures by SMTP reply code.
+type smtpStats struct {
+	mu        sync.Mutex
+	sent      int
+	failed    int
+	codeCount map[string]int
+}
+
+func (s *smtpStats) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.sent++
+		return
+	}
+	s.failed++
+	code := "network"
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		code = strconv.Itoa(tpErr.Code)
+	}
+	s.codeCount[code]++
+}
+
+func (s *smtpStats) toMap() gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	codes := make(map[string]int, len(s.codeCount))
+	for k, v := range s.codeCount {
+		codes[k] = v
+	}
+	return gin.H{
+		"sent":             s.sent,
+		"failed":           s.failed,
+		"failures_by_code": codes,
+	}
+}
+
+// buildSMTPMessage builds an RFC 5322 message with a body of roughly size bytes.
+func buildSMTPMessage(from string, to []string, subject string, size int) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	sb.WriteString("Subject: " + subject + "\r\n")
+	sb.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("Message-ID: <" + strconv.FormatInt(time.Now().UnixNano(), 36) + "@biggie>\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	line := "The Biggie SMTP stress test message.\r\n"
+	for written := 0; written < size; written += len(line) {
+		sb.WriteString(line)
+	}
+	return []byte(sb.String())
+}
+
+// sendSMTPMessage opens a new SMTP session, authenticates if credentials are configured,
+// and sends a single message. STARTTLS is used when the server offers it.
+func sendSMTPMessage(cfg *SMTPConfig, to []string, msg []byte) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: true}
+	var conn net.Conn
+	var err error
+	if cfg.TLSEnabled {
+		// Implicit TLS (e.g. port 465).
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 10*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && !cfg.TLSEnabled {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// SMTPHeavyHandler handles POST /smtp/heavy.
+// It sends messages through the configured SMTP relay at the given rate for maintain_second seconds.
+func SMTPHeavyHandler(c *gin.Context) {
+	var payload SMTPHeavyPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	messagePerInterval := int(payload.MessagePerInterval)
+	intervalSec := int(payload.IntervalSecond)
+	messageSize := int(payload.MessageSize)
+	if messageSize > maxSMTPMessageSize {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("message_size must not exceed %d", maxSMTPMessageSize))
+		return
+	}
+	if messagePerInterval > maxSMTPMessagesPerInterval {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("message_per_interval must not exceed %d", maxSMTPMessagesPerInterval))
+		return
+	}
+
+	cfg, err := GetSMTPConfig()
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	for _, rcpt := range payload.To {
+		// Without this, any caller could use the relay to send mail anywhere.
+		if !cfg.recipientAllowed(rcpt) {
+			ErrorJSON(c, http.StatusForbidden, "RECIPIENT_NOT_ALLOWED", "recipient is not in SMTP_TO or SMTP_ALLOWED_RECIPIENTS: "+rcpt)
+			return
+		}
+	}
+	to := payload.To
+	if len(to) == 0 {
+		to = cfg.To
+	}
+	if len(to) == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "no recipients: set to or SMTP_TO")
+		return
+	}
+	subject := payload.Subject
+	if subject == "" {
+		subject = "The Biggie SMTP stress test"
+	}
+	stats := &smtpStats{codeCount: make(map[string]int)}
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		for time.Now().Before(endTime) && ctx.Err() == nil {
+			var wg sync.WaitGroup
+			for i := 0; i < messagePerInterval; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					subj := subject
+					if processed, err := processRandomValue(subject); err == nil {
+						subj = fmt.Sprint(processed)
+					}
+					err := sendSMTPMessage(cfg, to, buildSMTPMessage(cfg.From, to, subj, messageSize))
+					if err != nil {
+						logWarn("SMTP heavy send failed", zap.Error(err))
+					}
+					stats.record(err)
+				}()
+			}
+			wg.Wait()
+			sleepContext(ctx, time.Duration(intervalSec)*time.Second)
+		}
+		logInfo("SMTP heavy send completed", zap.Int("duration_sec", maintainSec))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":              "SMTP heavy send started",
+			"maintain_second":      maintainSec,
+			"message_per_interval": messagePerInterval,
+			"interval_second":      intervalSec,
+			"message_size":         messageSize,
+			"recipients":           to,
+		})
+	} else {
+		job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":              "SMTP heavy send completed",
+			"maintain_second":      maintainSec,
+			"message_per_interval": messagePerInterval,
+			"interval_second":      intervalSec,
+			"message_size":         messageSize,
+			"recipients":           to,
+			"results":              stats.toMap(),
+		})
+	}
+}
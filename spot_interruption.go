@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Instance events that can be simulated.
+const (
+	eventSpotInterruption        = "spot_interruption"
+	eventRebalanceRecommendation = "rebalance_recommendation"
+	eventScheduledMaintenance    = "scheduled_maintenance"
+)
+
+// SpotInterruptionPayload defines the payload for the spot interruption simulation.
+type SpotInterruptionPayload struct {
+	Event        string  `json:"event"`         // spot_interruption (default), rebalance_recommendation or scheduled_maintenance.
+	Action       string  `json:"action"`        // Spot action: terminate (default), stop or hibernate.
+	NoticeSecond DuckInt `json:"notice_second"` // Time between the notice and the reclaim, default 120.
+	DrainSecond  DuckInt `json:"drain_second"`  // Time readiness fails before exiting, default 30.
+	ExitCode     DuckInt `json:"exit_code"`
+}
+
+// Global variables for instance event simulation.
+var (
+	spotMutex          sync.Mutex
+	spotInstanceAction gin.H // Same shape as IMDS spot/instance-action.
+	spotRebalance      gin.H // Same shape as IMDS events/recommendations/rebalance.
+	spotScheduled      []gin.H
+
+	spotReclaimTimer *time.Timer
+
+	// draining is set once readiness should fail because the instance is going away.
+	draining int32
+)
+
+// isDraining reports whether the instance is draining before exit.
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// reclaimInstance fails readiness, keeps serving for drainSec so load balancers can
+// deregister the target, then exits like a reclaimed instance.
+func reclaimInstance(event string, drainSec, exitCode int) {
+	atomic.StoreInt32(&draining, 1)
+	logWarn("Instance reclaim started, failing readiness",
+		zap.String("event", event),
+		zap.Int("drain_second", drainSec),
+		zap.Int64("in_flight", atomic.LoadInt64(&inFlightRequests)))
+	time.Sleep(time.Duration(drainSec) * time.Second)
+	if !isDraining() {
+		// The event was cancelled while draining (e.g. the chaos window closed).
+		logWarn("Instance reclaim cancelled", zap.String("event", event))
+		return
+	}
+	logError("Instance reclaimed: exiting process",
+		zap.String("event", event),
+		zap.Int64("in_flight", atomic.LoadInt64(&inFlightRequests)),
+		zap.Int("exit_code", exitCode))
+	os.Exit(exitCode)
+}
+
+// SpotInterruptionHandler handles POST /stress/spot_interruption.
+// It publishes an interruption notice on /metadata/spot and, after notice_second, fails
+// readiness (/healthcheck returns 503), drains for drain_second and exits the process.
+// A rebalance recommendation only publishes the notice. The simulation always runs in the background.
+func SpotInterruptionHandler(c *gin.Context) {
+	var payload SpotInterruptionPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	event := payload.Event
+	if event == "" {
+		event = eventSpotInterruption
+	}
+	action := payload.Action
+	if action == "" {
+		action = "terminate"
+	}
+	if action != "terminate" && action != "stop" && action != "hibernate" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "action must be terminate, stop or hibernate")
+		return
+	}
+	noticeSec := int(payload.NoticeSecond)
+	if noticeSec <= 0 {
+		// EC2 gives spot instances a two-minute warning.
+		noticeSec = 120
+	}
+	drainSec := int(payload.DrainSecond)
+	if drainSec <= 0 {
+		drainSec = 30
+	}
+	exitCode := int(payload.ExitCode)
+
+	now := time.Now().UTC()
+	reclaimAt := now.Add(time.Duration(noticeSec) * time.Second)
+	reclaim := true
+	spotMutex.Lock()
+	switch event {
+	case eventSpotInterruption:
+		spotInstanceAction = gin.H{"action": action, "time": reclaimAt.Format(time.RFC3339)}
+		// EC2 also sends a rebalance recommendation no later than the interruption notice.
+		if spotRebalance == nil {
+			spotRebalance = gin.H{"noticeTime": now.Format(time.RFC3339)}
+		}
+	case eventRebalanceRecommendation:
+		spotRebalance = gin.H{"noticeTime": now.Format(time.RFC3339)}
+		reclaim = false
+	case eventScheduledMaintenance:
+		spotScheduled = append(spotScheduled, gin.H{
+			"Code":        "instance-retirement",
+			"Description": "The instance is running on degraded hardware",
+			"EventId":     fmt.Sprintf("instance-event-%x", now.UnixNano()),
+			"NotBefore":   reclaimAt.Format("2 Jan 2006 15:04:05 GMT"),
+			"NotAfter":    reclaimAt.Add(time.Hour).Format("2 Jan 2006 15:04:05 GMT"),
+			"State":       "active",
+		})
+	default:
+		spotMutex.Unlock()
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "event must be spot_interruption, rebalance_recommendation or scheduled_maintenance")
+		return
+	}
+	spotMutex.Unlock()
+	logInfo("Instance event notice published",
+		zap.String("event", event),
+		zap.String("action", action),
+		zap.Int("notice_second", noticeSec))
+
+	if reclaim {
+		spotMutex.Lock()
+		if spotReclaimTimer != nil {
+			spotReclaimTimer.Stop()
+		}
+		spotReclaimTimer = time.AfterFunc(time.Duration(noticeSec)*time.Second, func() {
+			reclaimInstance(event, drainSec, exitCode)
+		})
+		spotMutex.Unlock()
+	}
+
+	result := gin.H{
+		"message":       "instance event notice published",
+		"event":         event,
+		"notice_second": noticeSec,
+	}
+	if reclaim {
+		result["action"] = action
+		result["reclaim_at"] = reclaimAt.Format(time.RFC3339)
+		result["drain_second"] = drainSec
+		result["exit_code"] = exitCode
+	}
+	ResponseJSON(c, http.StatusOK, result)
+}
+
+// SpotMetadataHandler handles GET /metadata/spot.
+// It serves the simulated notices in the same format as the EC2 instance metadata service
+// (spot/instance-action, events/recommendations/rebalance and events/maintenance/scheduled).
+func SpotMetadataHandler(c *gin.Context) {
+	spotMutex.Lock()
+	defer spotMutex.Unlock()
+	scheduled := spotScheduled
+	if scheduled == nil {
+		scheduled = []gin.H{}
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"instance_action":          spotInstanceAction,
+		"rebalance_recommendation": spotRebalance,
+		"scheduled_events":         scheduled,
+		"draining":                 isDraining(),
+	})
+}
+
+// cancelInstanceEvents withdraws all simulated notices, cancels a pending reclaim and
+// restores readiness.
+func cancelInstanceEvents() {
+	spotMutex.Lock()
+	defer spotMutex.Unlock()
+	if spotReclaimTimer != nil {
+		spotReclaimTimer.Stop()
+		spotReclaimTimer = nil
+	}
+	spotInstanceAction = nil
+	spotRebalance = nil
+	spotScheduled = nil
+	atomic.StoreInt32(&draining, 0)
+}
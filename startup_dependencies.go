@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// knownDependencies are the dependencies resolved from the configuration rather than a host:port.
+var knownDependencies = map[string]bool{
+	"mysql": true, "postgres": true, "redshift": true, "redis": true, "kafka": true,
+}
+
+// checkDependency checks whether a startup dependency is reachable. name is one of mysql,
+// postgres, redshift, redis or kafka, or a host:port that is checked with a TCP connect.
+func checkDependency(name string) error {
+	switch name {
+	case "mysql":
+		cfg, err := GetMySQLConfig()
+		if err != nil {
+			return err
+		}
+		return checkMySQL(cfg)
+	case "postgres":
+		cfg, err := GetPostgresConfig()
+		if err != nil {
+			return err
+		}
+		return checkPostgres(cfg)
+	case "redshift":
+		cfg, err := GetRedshiftConfig()
+		if err != nil {
+			return err
+		}
+		return checkRedshift(cfg)
+	case "redis":
+		cfg, err := GetRedisConfig()
+		if err != nil {
+			return err
+		}
+		return checkRedis(cfg)
+	case "kafka":
+		cfg, err := GetKafkaConfig()
+		if err != nil {
+			return err
+		}
+		return checkKafka(cfg)
+	default:
+		if _, _, err := net.SplitHostPort(name); err != nil {
+			return fmt.Errorf("unknown dependency: %s", name)
+		}
+		conn, err := net.DialTimeout("tcp", name, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// clearCrashLoopCount removes the crash loop count kept in file, if any.
+func clearCrashLoopCount(file string) {
+	if file == "" {
+		return
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		logWarn("failed to clear crash loop count", zap.String("file", file), zap.Error(err))
+	}
+}
+
+// checkStartupDependencies waits for the dependencies listed in STARTUP_DEPENDENCIES
+// (comma-separated) before the server starts. Each one is retried STARTUP_DEPENDENCY_RETRIES
+// times with an exponential backoff starting at STARTUP_DEPENDENCY_BACKOFF_SECOND and capped at
+// STARTUP_DEPENDENCY_MAX_BACKOFF_SECOND. If one stays unreachable the process exits with
+// STARTUP_DEPENDENCY_EXIT_CODE, like a bad deploy.
+//
+// With STARTUP_CRASH_LOOP_COUNT=N only the first N failed startups exit; the count is kept in
+// STARTUP_CRASH_LOOP_FILE across restarts, so the crash loop ends by itself after N restarts.
+// Any clean start clears the count.
+func checkStartupDependencies() {
+	crashLoopFile := viper.GetString("STARTUP_CRASH_LOOP_FILE")
+	list := viper.GetString("STARTUP_DEPENDENCIES")
+	if list == "" {
+		clearCrashLoopCount(crashLoopFile)
+		return
+	}
+	retries := viper.GetInt("STARTUP_DEPENDENCY_RETRIES")
+	backoff := time.Duration(viper.GetInt("STARTUP_DEPENDENCY_BACKOFF_SECOND")) * time.Second
+	maxBackoff := time.Duration(viper.GetInt("STARTUP_DEPENDENCY_MAX_BACKOFF_SECOND")) * time.Second
+
+	var failed []string
+	for _, dependency := range strings.Split(list, ",") {
+		dependency = strings.TrimSpace(dependency)
+		if dependency == "" {
+			continue
+		}
+		wait := backoff
+		for attempt := 0; ; attempt++ {
+			err := checkDependency(dependency)
+			if err == nil {
+				logInfo("startup dependency reachable", zap.String("dependency", dependency), zap.Int("attempt", attempt+1))
+				break
+			}
+			logWarn("startup dependency unreachable",
+				zap.String("dependency", dependency),
+				zap.Int("attempt", attempt+1),
+				zap.Error(err))
+			if attempt >= retries {
+				failed = append(failed, dependency)
+				break
+			}
+			time.Sleep(wait)
+			wait *= 2
+			if maxBackoff > 0 && wait > maxBackoff {
+				wait = maxBackoff
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		clearCrashLoopCount(crashLoopFile)
+		return
+	}
+	exitCode := viper.GetInt("STARTUP_DEPENDENCY_EXIT_CODE")
+	crashLoopCount := viper.GetInt("STARTUP_CRASH_LOOP_COUNT")
+	if crashLoopCount > 0 && crashLoopFile == "" {
+		// Without a file on a volume that survives restarts the count cannot be kept.
+		logWarn("STARTUP_CRASH_LOOP_COUNT ignored, STARTUP_CRASH_LOOP_FILE is not set")
+		crashLoopCount = 0
+	}
+	if crashLoopCount <= 0 {
+		logError("startup dependencies unreachable: exiting", zap.Strings("dependencies", failed), zap.Int("exit_code", exitCode))
+		os.Exit(exitCode)
+	}
+
+	data, _ := os.ReadFile(crashLoopFile)
+	crashes, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if crashes < crashLoopCount {
+		crashes++
+		if err := os.WriteFile(crashLoopFile, []byte(strconv.Itoa(crashes)), 0644); err != nil {
+			logError("failed to record crash loop count", zap.String("file", crashLoopFile), zap.Error(err))
+		}
+		logError("startup dependencies unreachable: exiting",
+			zap.Strings("dependencies", failed),
+			zap.Int("crash", crashes),
+			zap.Int("crash_loop_count", crashLoopCount),
+			zap.Int("exit_code", exitCode))
+		os.Exit(exitCode)
+	}
+	logWarn("startup dependencies unreachable: crash loop count reached, starting anyway",
+		zap.Strings("dependencies", failed),
+		zap.Int("crash_loop_count", crashLoopCount))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// States of the startup smoke test.
+const (
+	smokeTestPending = "pending"
+	smokeTestPassed  = "passed"
+	smokeTestFailed  = "failed"
+)
+
+// Global variables for the startup smoke test.
+var (
+	smokeTestMutex   sync.Mutex
+	smokeTestEnabled bool
+	smokeTestState   string
+	smokeTestResult  gin.H
+)
+
+// startSmokeTest runs the self-test in the background once the server accepts connections
+// when STARTUP_SMOKE_TEST is set, with the dependency micro-stress when
+// STARTUP_SMOKE_TEST_STRESS is set too. /healthcheck/ready fails until it passed.
+func startSmokeTest(port int) {
+	if !viper.GetBool("STARTUP_SMOKE_TEST") {
+		return
+	}
+	stress := viper.GetBool("STARTUP_SMOKE_TEST_STRESS")
+	smokeTestMutex.Lock()
+	smokeTestEnabled, smokeTestState = true, smokeTestPending
+	smokeTestMutex.Unlock()
+	logInfo("startup smoke test enabled", zap.Bool("stress", stress))
+
+	go func() {
+		// The HTTP check needs the listener, which starts right after this returns.
+		waitForListener(port)
+		passed, result := runSelfTest(stress)
+		state := smokeTestPassed
+		if !passed {
+			state = smokeTestFailed
+			logError("startup smoke test failed, not reporting ready", zap.Any("checks", result["checks"]))
+		}
+		smokeTestMutex.Lock()
+		smokeTestState, smokeTestResult = state, result
+		smokeTestMutex.Unlock()
+	}()
+}
+
+// waitForListener waits up to 30 seconds for the server to accept connections on port.
+func waitForListener(port int) {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
+// smokeTestStatus reports whether the startup smoke test passed (or is disabled), with its
+// state and result for /healthcheck/ready.
+func smokeTestStatus() (bool, gin.H) {
+	smokeTestMutex.Lock()
+	defer smokeTestMutex.Unlock()
+	if !smokeTestEnabled {
+		return true, nil
+	}
+	return smokeTestState == smokeTestPassed, gin.H{"state": smokeTestState, "result": smokeTestResult}
+}
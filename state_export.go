@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// shift moves every expiry, deadline and window time of the state by d.
+func (s *persistedState) shift(d time.Duration) {
+	move := func(t *time.Time) {
+		if !t.IsZero() {
+			*t = t.Add(d)
+		}
+	}
+	moveFaults := func(f *faultSnapshot) {
+		move(&f.ErrorExpiry)
+		move(&f.LatencyExpiry)
+		move(&f.PacketLossExpiry)
+		move(&f.DowntimeExpiry)
+	}
+	move(&s.SavedAt)
+	moveFaults(&s.Global)
+	for name, f := range s.Namespaces {
+		moveFaults(&f)
+		s.Namespaces[name] = f
+	}
+	if s.ChaosWindow != nil {
+		move(&s.ChaosWindow.OpenedAt)
+		move(&s.ChaosWindow.Expiry)
+	}
+	for i := range s.Jobs {
+		move(&s.Jobs[i].Deadline)
+	}
+}
+
+// clamp caps every expiry and deadline of the state, and the window, at limit.
+func (s *persistedState) clamp(limit time.Time) {
+	capAt := func(t *time.Time) {
+		if t.After(limit) {
+			*t = limit
+		}
+	}
+	capFaults := func(f *faultSnapshot) {
+		capAt(&f.ErrorExpiry)
+		capAt(&f.LatencyExpiry)
+		capAt(&f.PacketLossExpiry)
+		capAt(&f.DowntimeExpiry)
+	}
+	capFaults(&s.Global)
+	for name, f := range s.Namespaces {
+		capFaults(&f)
+		s.Namespaces[name] = f
+	}
+	if s.ChaosWindow != nil {
+		capAt(&s.ChaosWindow.Expiry)
+	}
+	for i := range s.Jobs {
+		capAt(&s.Jobs[i].Deadline)
+	}
+}
+
+// validate checks that the state only names valid namespaces and resumable chaos routes.
+func (s *persistedState) validate() error {
+	for name := range s.Namespaces {
+		if !namespaceRegex.MatchString(name) {
+			return fmt.Errorf("invalid namespace %q", name)
+		}
+	}
+	for _, job := range s.Jobs {
+		if job.Namespace != "" && !namespaceRegex.MatchString(job.Namespace) {
+			return fmt.Errorf("job %s: invalid namespace %q", job.ID, job.Namespace)
+		}
+		path := strings.SplitN(job.URI, "?", 2)[0]
+		resumable := job.Method != http.MethodGet && !nonResumablePaths[path]
+		if resumable {
+			resumable = false
+			for _, prefix := range chaosRoutePrefixes {
+				if strings.HasPrefix(path, prefix) {
+					resumable = true
+				}
+			}
+		}
+		if !resumable {
+			return fmt.Errorf("job %s: %s %s is not a resumable job", job.ID, job.Method, job.URI)
+		}
+	}
+	return nil
+}
+
+// StateExportHandler handles GET /admin/state/export.
+// It returns one JSON document with the active request-path faults (global and per namespace),
+// the experiment window and the async jobs still running, for POST /admin/state/import.
+func StateExportHandler(c *gin.Context) {
+	c.Header("Content-Disposition", "attachment; filename=biggie-state.json")
+	c.JSON(http.StatusOK, captureState(time.Now()))
+}
+
+// StateImportHandler handles POST /admin/state/import?rebase=true.
+// It applies a document from GET /admin/state/export: the experiment window is opened, the
+// jobs are started with the time left until their deadline, and the request-path faults
+// replace the current ones. Expiries and deadlines are capped at CHAOS_WINDOW_MAX_SECOND from
+// now. With rebase=true, every time in the document is moved by the time
+// elapsed since it was exported, so the setup starts over with its full durations.
+func StateImportHandler(c *gin.Context) {
+	var state persistedState
+	if err := c.ShouldBindJSON(&state); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if err := state.validate(); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	now := time.Now()
+	if c.Query("rebase") == "true" {
+		if state.SavedAt.IsZero() {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "rebase needs saved_at")
+			return
+		}
+		state.shift(now.Sub(state.SavedAt))
+	}
+	// Nothing imported outlives a window opened now, as POST /admin/window would cap it.
+	state.clamp(now.Add(time.Duration(viper.GetInt("CHAOS_WINDOW_MAX_SECOND")) * time.Second))
+	windowImported := state.ChaosWindow != nil && now.Before(state.ChaosWindow.Expiry)
+	if viper.GetBool("CHAOS_WINDOW_REQUIRED") && !windowImported && !chaosWindowStatus()["open"].(bool) {
+		ErrorJSON(c, http.StatusForbidden, "CHAOS_WINDOW_CLOSED", "fault injection requires an open chaos window")
+		return
+	}
+	if windowImported {
+		restoreChaosWindow(state.ChaosWindow.OpenedAt, state.ChaosWindow.Expiry, state.ChaosWindow.Reason)
+		persistState()
+	}
+
+	// Jobs are started before the faults are applied, so these cannot fail them.
+	jobs := make([]gin.H, 0, len(state.Jobs))
+	started := 0
+	for _, job := range state.Jobs {
+		result := gin.H{"job_id": job.ID, "method": job.Method, "uri": job.URI}
+		switch err := resumeJob(listenPort, job); {
+		case !now.Before(job.Deadline):
+			result["status"] = "expired"
+		case err != nil:
+			result["status"], result["error"] = "failed", err.Error()
+		default:
+			result["status"] = "started"
+			started++
+		}
+		jobs = append(jobs, result)
+	}
+	applyStateFaults(&state)
+
+	namespaces := []string{}
+	for name, f := range state.Namespaces {
+		if f.active(time.Now()) {
+			namespaces = append(namespaces, name)
+		}
+	}
+	sort.Strings(namespaces)
+	logInfo("State imported",
+		zap.Bool("chaos_window", windowImported),
+		zap.Strings("namespaces", namespaces),
+		zap.Int("jobs_started", started))
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":      "state imported",
+		"chaos_window": chaosWindowStatus(),
+		"global":       faultState.Global().toMap(time.Now()),
+		"namespaces":   namespaces,
+		"jobs":         jobs,
+	})
+}
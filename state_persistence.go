@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Backends of the persisted state (STATE_PERSISTENCE).
+const (
+	stateBackendFile  = "file"
+	stateBackendRedis = "redis"
+)
+
+// resumedFromHeader marks a replayed request with the id of the job it resumes.
+const resumedFromHeader = "X-Biggie-Resumed-From"
+
+// nonResumablePaths are not replayed after a restart: a crash test would crash again, the
+// steps of a scenario are jobs replayed on their own, and the effect of the others is the
+// request-path fault state, which is restored directly.
+var nonResumablePaths = map[string]bool{
+	"/scenario/run":               true,
+	"/stress/crash":               true,
+	"/stress/error_injection":     true,
+	"/stress/slo_burn":            true,
+	"/stress/downtime":            true,
+	"/stress/network/latency":     true,
+	"/stress/network/packet_loss": true,
+}
+
+// resumableJob is an async job that is replayed with its remaining duration after a restart.
+type resumableJob struct {
+	ID        string    `json:"id"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Namespace string    `json:"namespace,omitempty"`
+	Body      string    `json:"body"`
+	Form      bool      `json:"form,omitempty"` // Body is form-encoded, as the payload was sent as a form or query.
+	Deadline  time.Time `json:"deadline"`
+}
+
+// persistedChaosWindow is the experiment window in the persisted state.
+type persistedChaosWindow struct {
+	OpenedAt time.Time `json:"opened_at"`
+	Expiry   time.Time `json:"expiry"`
+	Reason   string    `json:"reason"`
+}
+
+// persistedState is what survives a restart: the request-path faults, the experiment window
+// and the async jobs still running.
+type persistedState struct {
+	SavedAt     time.Time                `json:"saved_at"`
+	Global      faultSnapshot            `json:"global"`
+	Namespaces  map[string]faultSnapshot `json:"namespaces"`
+	ChaosWindow *persistedChaosWindow    `json:"chaos_window,omitempty"`
+	Jobs        []resumableJob           `json:"jobs"`
+}
+
+// Global variables for the state persistence.
+var (
+	statePersistenceActive atomic.Bool // Set once the state of the previous run is restored.
+	stateSaveRequests      = make(chan struct{}, 1)
+	resumableJobsMutex     sync.Mutex
+	resumableJobs          = map[string]*resumableJob{}
+	stateRedisMutex        sync.Mutex
+	stateRedisClient       *redis.Client
+)
+
+// statePersistenceBackend returns the configured backend, or "" when persistence is off.
+func statePersistenceBackend() string {
+	return strings.ToLower(viper.GetString("STATE_PERSISTENCE"))
+}
+
+// persistState asks for the state to be saved. Saves are coalesced and done in the background.
+func persistState() {
+	if !statePersistenceActive.Load() {
+		return
+	}
+	select {
+	case stateSaveRequests <- struct{}{}:
+	default:
+	}
+}
+
+// captureState returns the state to persist at now, without expired faults and jobs.
+func captureState(now time.Time) persistedState {
+	state := persistedState{
+		SavedAt:    now,
+		Global:     faultState.Global(),
+		Namespaces: map[string]faultSnapshot{},
+		Jobs:       []resumableJob{},
+	}
+	for name, f := range faultState.Namespaces() {
+		if f.active(now) {
+			state.Namespaces[name] = f
+		}
+	}
+	chaosWindowMutex.Lock()
+	if chaosWindowOpen {
+		state.ChaosWindow = &persistedChaosWindow{OpenedAt: chaosWindowOpenedAt, Expiry: chaosWindowExpiry, Reason: chaosWindowReason}
+	}
+	chaosWindowMutex.Unlock()
+	resumableJobsMutex.Lock()
+	for id, job := range resumableJobs {
+		if now.Before(job.Deadline) {
+			state.Jobs = append(state.Jobs, *job)
+		} else {
+			delete(resumableJobs, id)
+		}
+	}
+	resumableJobsMutex.Unlock()
+	return state
+}
+
+// getStateRedisClient returns the Redis client of the persisted state, connecting on first use.
+func getStateRedisClient() (*redis.Client, error) {
+	stateRedisMutex.Lock()
+	defer stateRedisMutex.Unlock()
+	if stateRedisClient == nil {
+		client, err := getRedisClient()
+		if err != nil {
+			return nil, err
+		}
+		stateRedisClient = client
+	}
+	return stateRedisClient, nil
+}
+
+// saveState writes state to the configured backend. The file is replaced atomically.
+func saveState(state persistedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	switch statePersistenceBackend() {
+	case stateBackendFile:
+		path := viper.GetString("STATE_FILE")
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	case stateBackendRedis:
+		client, err := getStateRedisClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return client.Set(ctx, viper.GetString("STATE_REDIS_KEY"), data, 0).Err()
+	}
+	return nil
+}
+
+// loadState reads the state saved by the previous run. A missing state is not an error.
+func loadState() (*persistedState, error) {
+	var data []byte
+	switch statePersistenceBackend() {
+	case stateBackendFile:
+		var err error
+		data, err = os.ReadFile(viper.GetString("STATE_FILE"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	case stateBackendRedis:
+		client, err := getStateRedisClient()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		data, err = client.Get(ctx, viper.GetString("STATE_REDIS_KEY")).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("STATE_PERSISTENCE must be %q or %q", stateBackendFile, stateBackendRedis)
+	}
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// stateSaver saves the state whenever persistState asks for it.
+func stateSaver() {
+	for range stateSaveRequests {
+		if err := saveState(captureState(time.Now())); err != nil {
+			logError("Failed to persist state", zap.String("backend", statePersistenceBackend()), zap.Error(err))
+		}
+	}
+}
+
+// resumeJob replays job against this instance with the duration left until its deadline.
+func resumeJob(port int, job resumableJob) error {
+	remaining := int(time.Until(job.Deadline).Seconds())
+	if remaining <= 0 {
+		return nil
+	}
+	var body []byte
+	contentType := "application/json"
+	if job.Form {
+		values, err := url.ParseQuery(job.Body)
+		if err != nil {
+			return err
+		}
+		for _, name := range chaosDurationFields {
+			if values.Has(name) {
+				values.Set(name, strconv.Itoa(remaining))
+			}
+		}
+		body, contentType = []byte(values.Encode()), formContentType
+	} else {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(job.Body), &fields); err != nil {
+			return err
+		}
+		for _, name := range chaosDurationFields {
+			if _, ok := fields[name]; ok {
+				fields[name], _ = json.Marshal(remaining)
+			}
+		}
+		var err error
+		if body, err = json.Marshal(fields); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(job.Method, fmt.Sprintf("http://127.0.0.1:%d%s", port, job.URI), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(resumedFromHeader, job.ID)
+	if job.Namespace != "" {
+		req.Header.Set(namespaceHeader, job.Namespace)
+	}
+	resp, err := newLocalClient(30 * time.Second).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// applyStateFaults replaces the request-path faults, global and per namespace, with those of
+// state. Namespaces missing from state lose their faults.
+func applyStateFaults(state *persistedState) {
+	faultState.Update("", func(f *faultSnapshot) { *f = state.Global })
+	for name := range faultState.Namespaces() {
+		if _, ok := state.Namespaces[name]; !ok {
+			faultState.Update(name, func(f *faultSnapshot) { *f = faultSnapshot{} })
+		}
+	}
+	for name, f := range state.Namespaces {
+		faultState.Update(name, func(s *faultSnapshot) { *s = f })
+	}
+}
+
+// restoreState restores the state persisted by the previous run when STATE_PERSISTENCE is
+// "file" (STATE_FILE) or "redis" (STATE_REDIS_KEY), then keeps it saved. The experiment window
+// is reopened right away; once the server listens on port, the async jobs still running are
+// replayed with their remaining duration, and then the request-path faults are restored.
+func restoreState(port int) {
+	backend := statePersistenceBackend()
+	if backend == "" {
+		return
+	}
+	state, err := loadState()
+	if err != nil {
+		logError("Failed to load persisted state, starting without it", zap.String("backend", backend), zap.Error(err))
+	}
+	now := time.Now()
+	if state != nil && state.ChaosWindow != nil && now.Before(state.ChaosWindow.Expiry) {
+		restoreChaosWindow(state.ChaosWindow.OpenedAt, state.ChaosWindow.Expiry, state.ChaosWindow.Reason)
+		logInfo("Chaos window restored", zap.Time("closes_at", state.ChaosWindow.Expiry))
+	}
+
+	go func() {
+		if state != nil {
+			// Jobs are replayed before the faults come back, so these cannot fail them.
+			waitForListener(port)
+			for _, job := range state.Jobs {
+				if err := resumeJob(port, job); err != nil {
+					logError("Failed to resume job", zap.String("job_id", job.ID), zap.String("uri", job.URI), zap.Error(err))
+				} else {
+					logInfo("Job resumed", zap.String("job_id", job.ID), zap.String("uri", job.URI), zap.Time("deadline", job.Deadline))
+				}
+			}
+			applyStateFaults(state)
+			logInfo("Persisted state restored",
+				zap.Time("saved_at", state.SavedAt),
+				zap.Int("namespaces", len(state.Namespaces)),
+				zap.Int("jobs", len(state.Jobs)))
+		}
+		statePersistenceActive.Store(true)
+		go stateSaver()
+		persistState()
+	}()
+}
+
+// StatePersistenceMiddleware records the async jobs of chaos routes, so they can be resumed
+// after a restart or exported. Durations given as RANDOM are resolved in the request body
+// first, so a replay runs for the time actually left.
+func StatePersistenceMiddleware(c *gin.Context) {
+	if !isChaosRoute(c) || nonResumablePaths[c.FullPath()] {
+		c.Next()
+		return
+	}
+	raw, _ := c.Get("rawBody")
+	body, _ := raw.(string)
+	var fields map[string]json.RawMessage
+	if body == "" || json.Unmarshal([]byte(body), &fields) != nil {
+		c.Next()
+		return
+	}
+	var async bool
+	json.Unmarshal(fields["async"], &async)
+	var maintainSec, downtimeSec DuckInt
+	for name, d := range map[string]*DuckInt{"maintain_second": &maintainSec, "downtime_second": &downtimeSec} {
+		if value, ok := fields[name]; ok && json.Unmarshal(value, d) == nil {
+			fields[name], _ = json.Marshal(int(*d))
+		}
+	}
+	duration := time.Duration(maintainSec) * time.Second
+	if downtimeSec > 0 {
+		duration = time.Duration(downtimeSec) * time.Second
+	}
+	if !async || duration <= 0 {
+		c.Next()
+		return
+	}
+	if newBody, err := json.Marshal(fields); err == nil {
+		body = string(newBody)
+		c.Request.Body = io.NopCloser(strings.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Set("rawBody", body)
+	}
+
+	job := registerJob(c)
+	c.Next()
+	if c.Writer.Status() >= 400 {
+		discardRejectedJob(c, job)
+		return
+	}
+	// Form and query payloads are kept as form values, so bindPayload types them as before.
+	form := false
+	if values, ok := formValues(c); ok {
+		body, form = values.Encode(), true
+	}
+	resumableJobsMutex.Lock()
+	resumableJobs[job.ID] = &resumableJob{
+		ID:        job.ID,
+		Method:    c.Request.Method,
+		URI:       c.Request.URL.RequestURI(),
+		Namespace: getNamespace(c),
+		Body:      body,
+		Form:      form,
+		Deadline:  job.StartedAt.Add(duration),
+	}
+	resumableJobsMutex.Unlock()
+	job.onAbort(func(string) {
+		resumableJobsMutex.Lock()
+		delete(resumableJobs, job.ID)
+		resumableJobsMutex.Unlock()
+		persistState()
+	})
+	persistState()
+}
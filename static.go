@@ -2,7 +2,125 @@ package main
 
 import (
 	"embed"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 )
 
 //go:embed static/*
 var staticContent embed.FS
+
+// generatedPathPrefix is the prefix of the files generated on the fly under /static.
+const generatedPathPrefix = "/generated/"
+
+// generatedLineSize is the size of a line of generated content. Each line holds its own
+// offset in hex, so the bytes received for a range show where they come from.
+const generatedLineSize = 32
+
+// generatedModTime is the modification time of generated files, so conditional requests
+// hit until the instance restarts.
+var generatedModTime = time.Now().UTC().Truncate(time.Second)
+
+// generatedSizeRegex matches the name of a generated file: a size with an optional unit and
+// extension, e.g. "1048576", "10MiB.bin" or "500KB.jpg".
+var generatedSizeRegex = regexp.MustCompile(`(?i)^(\d+)(b|kb|mb|gb|kib|mib|gib)?(\.[a-z0-9]+)?$`)
+
+// byteUnits maps the units of generated file sizes to bytes.
+var byteUnits = map[string]int64{
+	"": 1, "b": 1,
+	"kb": 1000, "mb": 1000 * 1000, "gb": 1000 * 1000 * 1000,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30,
+}
+
+// generatedContent is an io.ReadSeeker over size bytes of generated text, computed for any
+// offset so that ranges of a file are consistent across requests without storing it.
+type generatedContent struct {
+	size   int64
+	offset int64
+}
+
+func (g *generatedContent) Read(p []byte) (int, error) {
+	if g.offset >= g.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), g.size-g.offset))
+	var line []byte
+	lineStart := int64(-1)
+	for i := 0; i < n; i++ {
+		pos := g.offset + int64(i)
+		if start := pos - pos%generatedLineSize; start != lineStart {
+			lineStart = start
+			line = fmt.Appendf(line[:0], "%0*x\n", generatedLineSize-1, start)
+		}
+		p[i] = line[pos-lineStart]
+	}
+	g.offset += int64(n)
+	return n, nil
+}
+
+func (g *generatedContent) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += g.offset
+	case io.SeekEnd:
+		offset += g.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	g.offset = offset
+	return offset, nil
+}
+
+// serveGeneratedFile serves a file of the size in its name, generated on the fly, with the
+// MIME type of its extension (application/octet-stream without one).
+func serveGeneratedFile(c *gin.Context, name string) {
+	m := generatedSizeRegex.FindStringSubmatch(name)
+	if m == nil {
+		ErrorJSON(c, http.StatusNotFound, "NOT_FOUND", "generated files are named by their size, e.g. 10MiB.bin")
+		return
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	unit := byteUnits[strings.ToLower(m[2])]
+	if maxBytes := viper.GetInt64("SIMPLE_LARGE_MAX_BYTES"); err != nil || n > maxBytes/unit {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_SIZE", fmt.Sprintf("generated files are at most SIMPLE_LARGE_MAX_BYTES (%d) bytes", maxBytes))
+		return
+	}
+	size := n * unit
+	contentType := mime.TypeByExtension(strings.ToLower(m[3]))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", fmt.Sprintf(`"generated-%d-%d"`, size, generatedModTime.Unix()))
+	http.ServeContent(c.Writer, c.Request, name, generatedModTime, &generatedContent{size: size})
+}
+
+// StaticHandler handles GET and HEAD /static/*filepath.
+// It serves the files of STATIC_DIR, or the embedded pages when it is not set, and files of
+// any size generated on the fly under /static/generated/, with Range, conditional request
+// and MIME handling, as a CDN origin would. STATIC_CACHE_CONTROL sets their Cache-Control.
+func StaticHandler(c *gin.Context) {
+	filepath := c.Param("filepath")
+	if cacheControl := viper.GetString("STATIC_CACHE_CONTROL"); cacheControl != "" {
+		c.Header("Cache-Control", cacheControl)
+	}
+	if strings.HasPrefix(filepath, generatedPathPrefix) {
+		serveGeneratedFile(c, path.Base(filepath))
+		return
+	}
+	var fs http.FileSystem = http.FS(staticContent)
+	if dir := viper.GetString("STATIC_DIR"); dir != "" {
+		fs = http.Dir(dir)
+	}
+	http.StripPrefix("/static", http.FileServer(fs)).ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SteadyStateProbe is one check of the steady-state hypothesis of an experiment: either an
+// HTTP probe whose metric is compared to a threshold, or a dependency that must be reachable.
+type SteadyStateProbe struct {
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`        // HTTP probe: absolute URL, or a path on this instance such as "/simple".
+	Samples    DuckInt   `json:"samples"`    // Requests per evaluation, default 10.
+	TimeoutMs  DuckInt   `json:"timeout_ms"` // Timeout of a single request, default 5000.
+	Metric     string    `json:"metric"`     // p50_ms, p90_ms, p99_ms (default), max_ms, mean_ms or error_percent.
+	Operator   string    `json:"operator"`   // <, <=, >, >= or ==; default <.
+	Threshold  DuckFloat `json:"threshold"`
+	Dependency string    `json:"dependency"` // Dependency probe: mysql, postgres, redshift, redis, kafka or host:port.
+}
+
+// SteadyStateSpec is the "steady_state" field of a stress payload.
+type SteadyStateSpec struct {
+	Probes         []SteadyStateProbe `json:"probes"`
+	IntervalSecond DuckInt            `json:"interval_second"` // Between evaluations during the experiment, default 10.
+	RecoverySecond DuckInt            `json:"recovery_second"` // Wait after the experiment before the final evaluation.
+	DryRun         bool               `json:"dry_run"`         // Only record violations instead of aborting.
+}
+
+// Metrics of HTTP steady-state probes.
+var steadyStateMetrics = map[string]bool{
+	"p50_ms": true, "p90_ms": true, "p99_ms": true, "max_ms": true, "mean_ms": true, "error_percent": true,
+}
+
+// Phases at which the steady state is evaluated.
+const (
+	steadyStateBefore = "before"
+	steadyStateDuring = "during"
+	steadyStateAfter  = "after"
+)
+
+// maxSteadyStateEvaluations bounds the evaluations kept per job.
+const maxSteadyStateEvaluations = 1000
+
+// probeResult is the outcome of one probe.
+type probeResult struct {
+	Name      string  `json:"name"`
+	OK        bool    `json:"ok"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// steadyStateEvaluation is the outcome of every probe at one point of the experiment.
+type steadyStateEvaluation struct {
+	Phase       string        `json:"phase"`
+	EvaluatedAt time.Time     `json:"evaluated_at"`
+	OK          bool          `json:"ok"`
+	Probes      []probeResult `json:"probes"`
+}
+
+// violation describes the first failed probe of the evaluation.
+func (e *steadyStateEvaluation) violation() string {
+	for _, p := range e.Probes {
+		if p.OK {
+			continue
+		}
+		if p.Error != "" {
+			return fmt.Sprintf("%s: %s", p.Name, p.Error)
+		}
+		return fmt.Sprintf("%s: %s %g is not %s %g", p.Name, p.Metric, p.Value, p.Operator, p.Threshold)
+	}
+	return ""
+}
+
+// steadyStateCheck is the steady-state hypothesis of a job and its evaluations.
+type steadyStateCheck struct {
+	spec      SteadyStateSpec
+	namespace string
+
+	mu          sync.Mutex
+	status      string // running, passed, violated or aborted.
+	abortedAt   time.Time
+	evaluations []*steadyStateEvaluation
+}
+
+// record stores an evaluation of the check.
+func (s *steadyStateCheck) record(e *steadyStateEvaluation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.evaluations) >= maxSteadyStateEvaluations {
+		// Keep the evaluation before the experiment.
+		s.evaluations = append(s.evaluations[:1], s.evaluations[2:]...)
+	}
+	s.evaluations = append(s.evaluations, e)
+}
+
+func (s *steadyStateCheck) toMap() gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := gin.H{
+		"status":      s.status,
+		"dry_run":     s.spec.DryRun,
+		"evaluations": s.evaluations,
+	}
+	if !s.abortedAt.IsZero() {
+		result["aborted_at"] = s.abortedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return result
+}
+
+// validateSteadyState checks the probes of spec and applies their defaults.
+func validateSteadyState(spec *SteadyStateSpec) error {
+	if len(spec.Probes) == 0 {
+		return fmt.Errorf("steady_state needs at least one probe")
+	}
+	for i := range spec.Probes {
+		p := &spec.Probes[i]
+		if (p.URL == "") == (p.Dependency == "") {
+			return fmt.Errorf("steady_state probe %d needs either url or dependency", i)
+		}
+		if p.Name == "" {
+			p.Name = p.URL + p.Dependency
+		}
+		if p.Dependency != "" {
+			if !knownDependencies[p.Dependency] {
+				if err := checkTargetHostAllowed(p.Dependency); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if p.Metric == "" {
+			p.Metric = "p99_ms"
+		}
+		if !steadyStateMetrics[p.Metric] {
+			return fmt.Errorf("steady_state probe %s: unknown metric %q", p.Name, p.Metric)
+		}
+		if p.Operator == "" {
+			p.Operator = "<"
+		}
+		if _, ok := compareProbe(0, p.Operator, 0); !ok {
+			return fmt.Errorf("steady_state probe %s: operator must be <, <=, >, >= or ==", p.Name)
+		}
+		if p.Samples <= 0 {
+			p.Samples = 10
+		}
+		if p.Samples > 1000 {
+			return fmt.Errorf("steady_state probe %s: samples must be at most 1000", p.Name)
+		}
+		if p.TimeoutMs <= 0 {
+			p.TimeoutMs = 5000
+		}
+		if strings.HasPrefix(p.URL, "/") {
+			p.URL = localURL(p.URL)
+		} else if err := checkTargetAllowed(p.URL); err != nil {
+			return err
+		}
+	}
+	if spec.IntervalSecond <= 0 {
+		spec.IntervalSecond = 10
+	}
+	return nil
+}
+
+// compareProbe applies operator to value and threshold. ok is false for unknown operators.
+func compareProbe(value float64, operator string, threshold float64) (result, ok bool) {
+	switch operator {
+	case "<":
+		return value < threshold, true
+	case "<=":
+		return value <= threshold, true
+	case ">":
+		return value > threshold, true
+	case ">=":
+		return value >= threshold, true
+	case "==":
+		return value == threshold, true
+	}
+	return false, false
+}
+
+// evaluate runs every probe of the check once.
+func (s *steadyStateCheck) evaluate(phase string) *steadyStateEvaluation {
+	e := &steadyStateEvaluation{Phase: phase, EvaluatedAt: time.Now().UTC(), OK: true}
+	for _, p := range s.spec.Probes {
+		var result probeResult
+		if p.Dependency != "" {
+			// Dependency probes report reachable == 1.
+			result = probeResult{Name: p.Name, OK: true, Metric: "reachable", Value: 1, Operator: "==", Threshold: 1}
+			if err := checkDependency(p.Dependency); err != nil {
+				result.OK, result.Value, result.Error = false, 0, err.Error()
+			}
+		} else {
+			result = runHTTPProbe(p, s.namespace)
+		}
+		e.OK = e.OK && result.OK
+		e.Probes = append(e.Probes, result)
+	}
+	return e
+}
+
+// runHTTPProbe sends the samples of an HTTP probe and computes its metric. Requests carry the
+// namespace of the experiment, so they see the faults it injects.
+func runHTTPProbe(p SteadyStateProbe, namespace string) probeResult {
+	result := probeResult{Name: p.Name, Metric: p.Metric, Operator: p.Operator, Threshold: float64(p.Threshold)}
+	client, err := newOutboundClient(time.Duration(p.TimeoutMs)*time.Millisecond, connectionModeReuse, "")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if isLocalURL(p.URL) {
+		// Probes of this instance measure its request path, not its egress faults.
+		client = newLocalClient(time.Duration(p.TimeoutMs) * time.Millisecond)
+	}
+	latencies := make([]float64, 0, int(p.Samples))
+	failures := 0
+	for i := 0; i < int(p.Samples); i++ {
+		req, err := http.NewRequest(http.MethodGet, p.URL, nil)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if namespace != "" {
+			req.Header.Set(namespaceHeader, namespace)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		latencies = append(latencies, float64(time.Since(start))/1e6)
+		if err != nil {
+			failures++
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			failures++
+		}
+	}
+	sort.Float64s(latencies)
+	switch p.Metric {
+	case "error_percent":
+		result.Value = float64(failures) * 100 / float64(len(latencies))
+	case "mean_ms":
+		sum := 0.0
+		for _, l := range latencies {
+			sum += l
+		}
+		result.Value = sum / float64(len(latencies))
+	case "max_ms":
+		result.Value = latencies[len(latencies)-1]
+	default:
+		q := map[string]float64{"p50_ms": 0.5, "p90_ms": 0.9, "p99_ms": 0.99}[p.Metric]
+		result.Value = latencies[int(math.Ceil(q*float64(len(latencies))))-1]
+	}
+	result.OK, _ = compareProbe(result.Value, p.Operator, result.Threshold)
+	return result
+}
+
+// abort stops the experiment after a violation and aborts the job. An experiment in a
+// namespace only clears the faults of that namespace; otherwise every injected fault is
+// reverted and the chaos window is closed.
+func (s *steadyStateCheck) abort(job *stressJob, reason string) {
+	s.mu.Lock()
+	s.status = "aborted"
+	s.abortedAt = time.Now()
+	s.mu.Unlock()
+	logWarn("Steady state violated, aborting experiment",
+		zap.String("job_id", job.ID),
+		zap.String("namespace", s.namespace),
+		zap.String("violation", reason))
+	// Aborted first, so the job keeps the violation as its cause when the window closes.
+	job.abort("steady state violated: " + reason)
+	if s.namespace != "" {
+		faultState.Update(s.namespace, func(f *faultSnapshot) {
+			*f = faultSnapshot{}
+		})
+	} else {
+		// Closing an open window also rejects new faults when CHAOS_WINDOW_REQUIRED is set.
+		closeChaosWindow("steady state violated")
+		revertAllFaults()
+	}
+}
+
+// steadyStateOptions are the fields of a stress payload that declare a steady-state hypothesis.
+type steadyStateOptions struct {
+	SteadyState    *SteadyStateSpec `json:"steady_state"`
+	MaintainSecond DuckInt          `json:"maintain_second"`
+}
+
+// SteadyStateMiddleware evaluates the steady-state hypothesis declared in the "steady_state"
+// field of a stress request before, during and after the experiment. A violation before the
+// experiment rejects the request; a violation during it aborts the experiment unless dry_run
+// is set. The evaluations are served under GET /jobs/:id/steady_state.
+func SteadyStateMiddleware(c *gin.Context) {
+	raw, ok := c.Get("rawBody")
+	if !ok {
+		c.Next()
+		return
+	}
+	var opts steadyStateOptions
+	if json.Unmarshal([]byte(raw.(string)), &opts) != nil || opts.SteadyState == nil {
+		c.Next()
+		return
+	}
+	if err := validateSteadyState(opts.SteadyState); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		c.Abort()
+		return
+	}
+	check := &steadyStateCheck{spec: *opts.SteadyState, namespace: getNamespace(c), status: "running"}
+	before := check.evaluate(steadyStateBefore)
+	if !before.OK {
+		ErrorJSON(c, http.StatusPreconditionFailed, "STEADY_STATE_VIOLATED", "steady state violated before the experiment: "+before.violation())
+		c.Abort()
+		return
+	}
+	check.record(before)
+	job := registerJob(c)
+	job.mu.Lock()
+	job.steadyState = check
+	job.mu.Unlock()
+	go check.run(job, time.Duration(opts.MaintainSecond)*time.Second)
+	c.Next()
+	discardRejectedJob(c, job)
+}
+
+// run evaluates the steady state every interval until maintain elapses, then once more after
+// the recovery time.
+func (s *steadyStateCheck) run(job *stressJob, maintain time.Duration) {
+	interval := time.Duration(s.spec.IntervalSecond) * time.Second
+	end := job.StartedAt.Add(maintain)
+	violated := false
+	for time.Until(end) > interval {
+		select {
+		case <-job.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		e := s.evaluate(steadyStateDuring)
+		s.record(e)
+		if e.OK {
+			continue
+		}
+		violated = true
+		if !s.spec.DryRun {
+			s.abort(job, e.violation())
+			return
+		}
+		logWarn("Steady state violated", zap.String("job_id", job.ID), zap.String("violation", e.violation()))
+	}
+	select {
+	case <-job.ctx.Done():
+		return
+	case <-time.After(time.Until(end.Add(time.Duration(s.spec.RecoverySecond) * time.Second))):
+	}
+	e := s.evaluate(steadyStateAfter)
+	s.record(e)
+	s.mu.Lock()
+	if e.OK && !violated {
+		s.status = "passed"
+	} else {
+		s.status = "violated"
+	}
+	s.mu.Unlock()
+	logInfo("Steady state check completed", zap.String("job_id", job.ID), zap.Any("results", s.toMap()))
+}
+
+// JobSteadyStateHandler handles GET /jobs/:id/steady_state.
+// It returns the steady-state evaluations of a job.
+func JobSteadyStateHandler(c *gin.Context) {
+	job := getRequestJob(c)
+	if job == nil {
+		return
+	}
+	job.mu.Lock()
+	check := job.steadyState
+	job.mu.Unlock()
+	if check == nil {
+		ErrorJSON(c, http.StatusNotFound, "STEADY_STATE_NOT_FOUND", "job "+job.ID+" declares no steady state")
+		return
+	}
+	result := check.toMap()
+	result["job_id"] = job.ID
+	ResponseJSON(c, http.StatusOK, result)
+}
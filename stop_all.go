@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// stopAllPath is the route of the emergency stop.
+const stopAllPath = "/stress/stop_all"
+
+// stopAllWait bounds how long the emergency stop waits for the cancelled jobs to end.
+const stopAllWait = 5 * time.Second
+
+// stopAllJobs cancels every job still running and returns them, oldest first.
+func stopAllJobs(cause string) []*stressJob {
+	jobsMutex.Lock()
+	running := make([]*stressJob, 0, len(jobs))
+	for _, job := range jobs {
+		if !job.finished() {
+			running = append(running, job)
+		}
+	}
+	jobsMutex.Unlock()
+	sort.Slice(running, func(i, j int) bool { return running[i].StartedAt.Before(running[j].StartedAt) })
+	for _, job := range running {
+		job.abort(cause)
+	}
+	return running
+}
+
+// waitJobsFinished waits up to timeout for jobs to end and returns the ones still running.
+func waitJobsFinished(jobs []*stressJob, timeout time.Duration) []*stressJob {
+	deadline := time.Now().Add(timeout)
+	for {
+		var pending []*stressJob
+		for _, job := range jobs {
+			if !job.finished() {
+				pending = append(pending, job)
+			}
+		}
+		if len(pending) == 0 || !time.Now().Before(deadline) {
+			return pending
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// StopAllHandler handles POST /stress/stop_all.
+// It is the emergency stop of a runaway test: every running job is cancelled (CPU loops,
+// database and Redis connections, Kafka producers, floods, memory leak allocation, stress
+// tools), every fault is reverted and leaked memory and connections are released. It waits up
+// to five seconds for the jobs to end. The chaos window, maintenance mode and draining are
+// left as they are.
+func StopAllHandler(c *gin.Context) {
+	stopped := stopAllJobs("emergency stop")
+	revertAllFaults()
+	pending := waitJobsFinished(stopped, stopAllWait)
+
+	now := time.Now()
+	cancelled := make([]gin.H, 0, len(stopped))
+	for _, job := range stopped {
+		cancelled = append(cancelled, job.toMap(now))
+	}
+	stillStopping := make([]string, 0, len(pending))
+	for _, job := range pending {
+		stillStopping = append(stillStopping, job.ID)
+	}
+	logWarn("Emergency stop", zap.Int("jobs_cancelled", len(stopped)), zap.Strings("still_stopping", stillStopping))
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":        "all stress stopped and faults reverted",
+		"jobs_cancelled": len(stopped),
+		"jobs":           cancelled,
+		"still_stopping": stillStopping,
+		"state":          faultState.Global().toMap(now),
+	})
+}
+
+// EmergencyStopMiddleware serves POST /stress/stop_all ahead of every fault middleware, so a
+// test can be stopped while its downtime, error injection, latency or load shedding would
+// reject or delay the request, and the stop itself is never gated, notified or persisted.
+func EmergencyStopMiddleware(c *gin.Context) {
+	if c.Request.Method != http.MethodPost || c.Request.URL.Path != stopAllPath {
+		c.Next()
+		return
+	}
+	StopAllHandler(c)
+	c.Abort()
+}
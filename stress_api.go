@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +18,9 @@ import (
 type CPUStressPayload struct {
 	CPUPercent     DuckInt `json:"cpu_percent"`
 	MaintainSecond DuckInt `json:"maintain_second"`
+	Cores          DuckInt `json:"cores"`
+	Goroutines     DuckInt `json:"goroutines"`
+	Workload       string  `json:"workload"`
 	Async          bool    `json:"async"`
 }
 
@@ -37,33 +43,56 @@ var memoryLeakStore [][]byte
 var memoryLeakMutex sync.Mutex
 
 // CPUStressHandler handles POST /stress/cpu.
-// It runs a busy loop in cycles to approximate the given CPU percentage.
+// It runs a workload in cycles on each of the given cores to approximate the given CPU
+// percentage per core. Once the node is calibrated, the percentage is of a reference core and
+// is converted for this node.
 func CPUStressHandler(c *gin.Context) {
 	var payload CPUStressPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	workload, err := parseCPUWorkload(payload.Workload)
+	if err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	cpuPercent := int(payload.CPUPercent)
+	effectivePercent := normalizeCPUPercent(cpuPercent)
 	maintainSec := int(payload.MaintainSecond)
+	workers := cpuWorkerCount(int(payload.Cores), int(payload.Goroutines))
+	// The workers of every CPU stress share GOMAXPROCS; beyond it they share cores too.
+	oversubscribed := activeCPUWorkers.Load()+int64(workers) > int64(runtime.GOMAXPROCS(0))
+	var operations int64
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	work := func(ctx context.Context) {
+		operations = runCPUStress(ctx, effectivePercent, maintainSec, workers, workload)
+	}
+	result := gin.H{
+		"chosen_cpu_percent":    cpuPercent,
+		"effective_cpu_percent": effectivePercent,
+		"maintain_second":       maintainSec,
+		"workers":               workers,
+		"workload":              workload,
+		"gomaxprocs":            runtime.GOMAXPROCS(0),
+		"oversubscribed":        oversubscribed,
+	}
 	if payload.Async {
-		go runCPUStress(cpuPercent, maintainSec)
-		ResponseJSON(c, http.StatusOK, gin.H{
-			"message":            "cpu stress started",
-			"chosen_cpu_percent": cpuPercent,
-			"maintain_second":    maintainSec,
-		})
+		go job.run(work)
+		result["message"] = "cpu stress started"
+		ResponseJSON(c, http.StatusOK, result)
 	} else {
-		runCPUStress(cpuPercent, maintainSec)
-		ResponseJSON(c, http.StatusOK, gin.H{
-			"message":            "cpu stress completed",
-			"chosen_cpu_percent": cpuPercent,
-			"maintain_second":    maintainSec,
-		})
+		job.run(work)
+		result["message"] = "cpu stress completed"
+		result["operations"] = operations
+		ResponseJSON(c, http.StatusOK, result)
 	}
 }
 
-func runCPUStress(cpuPercent, maintainSec int) {
+// runCPUStress runs workers goroutines of workload for maintainSec seconds, each busy for
+// cpuPercent of every cycle, and returns the units of work done. Each worker is locked to its
+// OS thread, so with no more workers than GOMAXPROCS every one keeps a core of its own.
+func runCPUStress(ctx context.Context, cpuPercent, maintainSec, workers int, workload string) int64 {
 	duration := time.Duration(maintainSec) * time.Second
 	endTime := time.Now().Add(duration)
 	// Define a cycle period (e.g., 100ms).
@@ -72,19 +101,38 @@ func runCPUStress(cpuPercent, maintainSec int) {
 	busyTime := time.Duration(cpuPercent) * cycle / 100
 	sleepTime := cycle - busyTime
 
-	for time.Now().Before(endTime) {
-		start := time.Now()
-		// Busy loop for busyTime.
-		for {
-			if time.Since(start) >= busyTime {
-				break
+	var operations atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			activeCPUWorkers.Add(1)
+			defer activeCPUWorkers.Add(-1)
+			unit := cpuWorkloads[workload]()
+			var done int64
+			for time.Now().Before(endTime) && ctx.Err() == nil {
+				start := time.Now()
+				// Run the workload for busyTime.
+				for time.Since(start) < busyTime {
+					unit()
+					done++
+				}
+				time.Sleep(sleepTime)
 			}
-		}
-		time.Sleep(sleepTime)
+			operations.Add(done)
+		}()
 	}
-	fmt.Println("CPU stress test completed",
+	wg.Wait()
+	logInfo("CPU stress test completed",
 		zap.Int("cpu_percent", cpuPercent),
-		zap.Int("duration_sec", maintainSec))
+		zap.Int("duration_sec", maintainSec),
+		zap.Int("workers", workers),
+		zap.String("workload", workload),
+		zap.Int64("operations", operations.Load()))
+	return operations.Load()
 }
 
 // MemoryStressHandler handles POST /stress/memory.
@@ -92,21 +140,23 @@ func runCPUStress(cpuPercent, maintainSec int) {
 // and holds it for the specified duration.
 func MemoryStressHandler(c *gin.Context) {
 	var payload MemoryStressPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	memoryPercent := int(payload.MemoryPercent)
 	maintainSec := int(payload.MaintainSecond)
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	work := func(ctx context.Context) { runMemoryStress(ctx, memoryPercent, maintainSec) }
 	if payload.Async {
-		go runMemoryStress(memoryPercent, maintainSec)
+		go job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":               "memory stress started",
 			"chosen_memory_percent": memoryPercent,
 			"maintain_second":       maintainSec,
 		})
 	} else {
-		runMemoryStress(memoryPercent, maintainSec)
+		job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":               "memory stress completed",
 			"chosen_memory_percent": memoryPercent,
@@ -115,7 +165,7 @@ func MemoryStressHandler(c *gin.Context) {
 	}
 }
 
-func runMemoryStress(memoryPercent, maintainSec int) {
+func runMemoryStress(ctx context.Context, memoryPercent, maintainSec int) {
 	// Assume a baseline of 100MB for 100% stress.
 	allocMB := memoryPercent // e.g., 30 means 30MB.
 	blockSize := allocMB * 1024 * 1024
@@ -125,8 +175,9 @@ func runMemoryStress(memoryPercent, maintainSec int) {
 		memBlock[i] = byte(rand.Intn(256))
 	}
 	// Hold the allocation for the specified duration.
-	time.Sleep(time.Duration(maintainSec) * time.Second)
-	fmt.Println("Memory stress test completed",
+	sleepContext(ctx, time.Duration(maintainSec)*time.Second)
+	runtime.KeepAlive(memBlock)
+	logInfo("Memory stress test completed",
 		zap.Int("memory_percent", memoryPercent),
 		zap.Int("duration_sec", maintainSec))
 	// The allocated memory will be freed when this function returns.
@@ -137,21 +188,23 @@ func runMemoryStress(memoryPercent, maintainSec int) {
 // to simulate a memory leak.
 func MemoryLeakHandler(c *gin.Context) {
 	var payload MemoryLeakPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	if err := bindPayload(c, &payload); err != nil {
 		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
 		return
 	}
 	leakSizeMB := int(payload.LeakSizeMB)
 	maintainSec := int(payload.MaintainSecond)
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	work := func(ctx context.Context) { runMemoryLeak(ctx, leakSizeMB, maintainSec) }
 	if payload.Async {
-		go runMemoryLeak(leakSizeMB, maintainSec)
+		go job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":             "memory leak simulation started",
 			"chosen_leak_size_mb": leakSizeMB,
 			"maintain_second":     maintainSec,
 		})
 	} else {
-		runMemoryLeak(leakSizeMB, maintainSec)
+		job.run(work)
 		ResponseJSON(c, http.StatusOK, gin.H{
 			"message":             "memory leak simulation completed",
 			"chosen_leak_size_mb": leakSizeMB,
@@ -160,7 +213,7 @@ func MemoryLeakHandler(c *gin.Context) {
 	}
 }
 
-func runMemoryLeak(leakSizeMB, maintainSec int) {
+func runMemoryLeak(ctx context.Context, leakSizeMB, maintainSec int) {
 	totalBytes := leakSizeMB * 1024 * 1024
 	// Allocate memory in intervals; here we allocate every 500ms.
 	interval := 500 * time.Millisecond
@@ -183,8 +236,66 @@ func runMemoryLeak(leakSizeMB, maintainSec int) {
 			memoryLeakStore = append(memoryLeakStore, memBlock)
 			memoryLeakMutex.Unlock()
 		case <-done:
-			fmt.Println("Memory leak simulation completed", zap.Int("leak_size_mb", leakSizeMB))
+			logInfo("Memory leak simulation completed", zap.Int("leak_size_mb", leakSizeMB))
+			return
+		case <-ctx.Done():
+			logInfo("Memory leak simulation cancelled", zap.Int("leak_size_mb", leakSizeMB))
+			return
+		}
+	}
+}
+
+// workLimits bound the parameters of /work, so alloc_kb*1024 and the durations cannot overflow.
+var workLimits = map[string]int{
+	"cpu_ms":   60000,
+	"alloc_kb": 1024 * 1024,
+	"delay_ms": 60000,
+}
+
+// WorkHandler handles GET /work?cpu_ms=<number>&alloc_kb=<number>&delay_ms=<number>.
+// Within the request it burns cpu_ms of CPU, allocates and touches alloc_kb of memory and
+// waits delay_ms, so request-driven resource usage can be shaped by traffic alone.
+// Each parameter supports the RANDOM syntax, e.g. cpu_ms=RANDOM:10:50.
+func WorkHandler(c *gin.Context) {
+	params := make(map[string]int)
+	for _, name := range []string{"cpu_ms", "alloc_kb", "delay_ms"} {
+		value, err := processRandomInt(c.DefaultQuery(name, "0"), 0, 100)
+		if err != nil || value < 0 {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("invalid %s", name))
+			return
+		}
+		if value > workLimits[name] {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("%s must not exceed %d", name, workLimits[name]))
 			return
 		}
+		params[name] = value
 	}
+	start := time.Now()
+
+	// Allocate first so the memory is held while the CPU work runs.
+	mem := make([]byte, params["alloc_kb"]*1024)
+	for i := 0; i < len(mem); i += 4096 {
+		// Touch every page so it is actually committed.
+		mem[i] = byte(i)
+	}
+
+	busyUntil := time.Now().Add(time.Duration(params["cpu_ms"]) * time.Millisecond)
+	var acc uint64
+	for time.Now().Before(busyUntil) {
+		for i := 0; i < 1000; i++ {
+			acc = acc*6364136223846793005 + 1442695040888963407
+		}
+	}
+
+	time.Sleep(time.Duration(params["delay_ms"]) * time.Millisecond)
+	runtime.KeepAlive(mem)
+
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message":    "work ok",
+		"cpu_ms":     params["cpu_ms"],
+		"alloc_kb":   params["alloc_kb"],
+		"delay_ms":   params["delay_ms"],
+		"elapsed_ms": float64(time.Since(start).Microseconds()) / 1000,
+		"checksum":   acc,
+	})
 }
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// toolParam is an integer parameter of a tool profile with its allowed range.
+type toolParam struct {
+	def, min, max int
+}
+
+// toolProfile is an allowlisted argument template for an external stress tool.
+// Placeholders like {workers} are replaced by validated integers, {seconds} by maintain_second,
+// {dir} by STRESS_TOOL_DIR and {run} by an id unique to the run; nothing from the request reaches the command line unchecked.
+type toolProfile struct {
+	description string
+	args        []string
+	params      map[string]toolParam
+}
+
+// stressToolProfiles lists the profiles per tool.
+var stressToolProfiles = map[string]map[string]toolProfile{
+	"stress-ng": {
+		"cpu": {
+			description: "CPU workers at a given load",
+			args:        []string{"--cpu", "{workers}", "--cpu-load", "{percent}", "--timeout", "{seconds}s", "--metrics-brief"},
+			params:      map[string]toolParam{"workers": {1, 1, 256}, "percent": {100, 1, 100}},
+		},
+		"vm": {
+			description: "Memory workers continuously writing and verifying memory",
+			args:        []string{"--vm", "{workers}", "--vm-bytes", "{size_mb}M", "--timeout", "{seconds}s", "--metrics-brief"},
+			params:      map[string]toolParam{"workers": {1, 1, 256}, "size_mb": {256, 1, 65536}},
+		},
+		"numa": {
+			description: "Workers migrating memory between NUMA nodes",
+			args:        []string{"--numa", "{workers}", "--timeout", "{seconds}s", "--metrics-brief"},
+			params:      map[string]toolParam{"workers": {1, 1, 256}},
+		},
+		"cache": {
+			description: "Workers thrashing the CPU caches",
+			args:        []string{"--cache", "{workers}", "--timeout", "{seconds}s", "--metrics-brief"},
+			params:      map[string]toolParam{"workers": {1, 1, 256}},
+		},
+		"io_sync": {
+			description: "Workers calling sync() to flush dirty pages",
+			args:        []string{"--io", "{workers}", "--timeout", "{seconds}s", "--metrics-brief"},
+			params:      map[string]toolParam{"workers": {1, 1, 256}},
+		},
+	},
+	"fio": {
+		"dirty_pages": {
+			description: "Buffered sequential writes without fsync, leaving dirty pages for the kernel to flush",
+			args: []string{"--name=biggie-dirty-{run}", "--directory={dir}", "--rw=write", "--bs=1M", "--size={size_mb}M",
+				"--numjobs={workers}", "--direct=0", "--end_fsync=0", "--runtime={seconds}", "--time_based", "--group_reporting", "--unlink=1"},
+			params: map[string]toolParam{"workers": {1, 1, 64}, "size_mb": {1024, 1, 65536}},
+		},
+		"randread": {
+			description: "Direct random reads",
+			args: []string{"--name=biggie-randread-{run}", "--directory={dir}", "--rw=randread", "--bs={block_kb}k", "--size={size_mb}M",
+				"--numjobs={workers}", "--iodepth={iodepth}", "--ioengine=libaio", "--direct=1", "--runtime={seconds}", "--time_based", "--group_reporting", "--unlink=1"},
+			params: map[string]toolParam{"workers": {1, 1, 64}, "size_mb": {256, 1, 65536}, "block_kb": {4, 1, 16384}, "iodepth": {16, 1, 1024}},
+		},
+		"randwrite": {
+			description: "Direct random writes",
+			args: []string{"--name=biggie-randwrite-{run}", "--directory={dir}", "--rw=randwrite", "--bs={block_kb}k", "--size={size_mb}M",
+				"--numjobs={workers}", "--iodepth={iodepth}", "--ioengine=libaio", "--direct=1", "--runtime={seconds}", "--time_based", "--group_reporting", "--unlink=1"},
+			params: map[string]toolParam{"workers": {1, 1, 64}, "size_mb": {256, 1, 65536}, "block_kb": {4, 1, 16384}, "iodepth": {16, 1, 1024}},
+		},
+	},
+}
+
+// StressToolPayload defines the payload for running an external stress tool.
+type StressToolPayload struct {
+	Tool           string             `json:"tool"`    // stress-ng or fio.
+	Profile        string             `json:"profile"` // See GET /stress/tool.
+	Params         map[string]DuckInt `json:"params"`
+	MaintainSecond DuckInt            `json:"maintain_second"`
+	Async          bool               `json:"async"`
+}
+
+// allowedStressTool reports whether tool is listed in STRESS_TOOLS (comma-separated).
+func allowedStressTool(tool string) bool {
+	for _, allowed := range strings.Split(viper.GetString("STRESS_TOOLS"), ",") {
+		if strings.TrimSpace(allowed) == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// buildToolArgs fills the profile template with validated parameters.
+func buildToolArgs(profile toolProfile, params map[string]DuckInt, seconds int) ([]string, error) {
+	values := map[string]string{
+		"{seconds}": strconv.Itoa(seconds),
+		"{dir}":     viper.GetString("STRESS_TOOL_DIR"),
+		"{run}":     newJobID(), // Keeps the files of concurrent runs apart.
+	}
+	for name := range params {
+		if _, ok := profile.params[name]; !ok {
+			return nil, fmt.Errorf("unknown param: %s", name)
+		}
+	}
+	for name, p := range profile.params {
+		v := p.def
+		if given, ok := params[name]; ok {
+			v = int(given)
+		}
+		if v < p.min || v > p.max {
+			return nil, fmt.Errorf("param %s must be between %d and %d", name, p.min, p.max)
+		}
+		values["{"+name+"}"] = strconv.Itoa(v)
+	}
+	args := make([]string, len(profile.args))
+	for i, arg := range profile.args {
+		for placeholder, v := range values {
+			arg = strings.ReplaceAll(arg, placeholder, v)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// removeToolFiles deletes the files fio writes for a job (<name>.<job>.<file> in
+// STRESS_TOOL_DIR). fio removes them itself with --unlink=1, but not when it is killed.
+func removeToolFiles(args []string) {
+	for _, arg := range args {
+		name, ok := strings.CutPrefix(arg, "--name=")
+		if !ok {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(viper.GetString("STRESS_TOOL_DIR"), name+".*"))
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				logWarn("Stress tool file not removed", zap.String("file", file), zap.Error(err))
+			}
+		}
+	}
+}
+
+// tailOutput keeps the last limit bytes of a tool's output.
+func tailOutput(out []byte, limit int) string {
+	if len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return string(out)
+}
+
+// StressToolListHandler handles GET /stress/tool.
+// It lists the allowlisted tools, whether they are installed, and their profiles.
+func StressToolListHandler(c *gin.Context) {
+	tools := gin.H{}
+	for tool, profiles := range stressToolProfiles {
+		_, err := exec.LookPath(tool)
+		list := gin.H{}
+		for name, profile := range profiles {
+			params := gin.H{}
+			for param, p := range profile.params {
+				params[param] = gin.H{"default": p.def, "min": p.min, "max": p.max}
+			}
+			list[name] = gin.H{"description": profile.description, "params": params}
+		}
+		tools[tool] = gin.H{
+			"allowed":   allowedStressTool(tool),
+			"installed": err == nil,
+			"profiles":  list,
+		}
+	}
+	ResponseJSON(c, http.StatusOK, gin.H{"tools": tools})
+}
+
+// StressToolHandler handles POST /stress/tool.
+// It runs an allowlisted profile of stress-ng or fio, if the tool is installed in the image,
+// for stress patterns Go cannot produce itself (NUMA migration, dirty page flushing, ...).
+func StressToolHandler(c *gin.Context) {
+	var payload StressToolPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	profiles, ok := stressToolProfiles[payload.Tool]
+	if !ok || !allowedStressTool(payload.Tool) {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "tool is not allowed: "+payload.Tool)
+		return
+	}
+	profile, ok := profiles[payload.Profile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("profile must be one of %s", strings.Join(names, ", ")))
+		return
+	}
+	path, err := exec.LookPath(payload.Tool)
+	if err != nil {
+		ErrorJSON(c, http.StatusNotImplemented, "TOOL_NOT_INSTALLED", payload.Tool+" is not installed in this image")
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	if maintainSec <= 0 {
+		maintainSec = 1
+	}
+	args, err := buildToolArgs(profile, payload.Params, maintainSec)
+	if err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+
+	var output string
+	var exitCode int
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	runFunc := func(ctx context.Context) {
+		// The tool stops itself after maintain_second; the deadline only guards against hangs.
+		// Cancelling the job kills the tool.
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(maintainSec+60)*time.Second)
+		defer cancel()
+		logInfo("Stress tool started", zap.String("tool", payload.Tool), zap.Strings("args", args))
+		out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+		removeToolFiles(args)
+		output = tailOutput(out, 16*1024)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			exitCode = -1
+			output += err.Error()
+		}
+		logInfo("Stress tool completed",
+			zap.String("tool", payload.Tool),
+			zap.String("profile", payload.Profile),
+			zap.Int("exit_code", exitCode),
+			zap.String("output", output))
+	}
+
+	if payload.Async {
+		go job.run(runFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "stress tool started",
+			"tool":            payload.Tool,
+			"profile":         payload.Profile,
+			"args":            args,
+			"maintain_second": maintainSec,
+		})
+	} else {
+		job.run(runFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "stress tool completed",
+			"tool":            payload.Tool,
+			"profile":         payload.Profile,
+			"args":            args,
+			"maintain_second": maintainSec,
+			"exit_code":       exitCode,
+			"output":          output,
+		})
+	}
+}
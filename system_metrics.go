@@ -31,26 +31,27 @@ func SystemMetricsHandler(c *gin.Context) {
 		"network_out": 2048,
 	}
 
-	// Gather stress test details from global variables.
+	// Gather stress test details from the global fault state.
+	now := time.Now()
+	faults := faultState.Global()
 	stressTests := map[string]interface{}{
-		"error_injection_rate":   activeErrorRate,
-		"network_latency_ms":     activeLatencyMs,
-		"packet_loss_percentage": activePacketLoss,
+		"error_injection_rate":   faults.errorRate(now),
+		"network_latency_ms":     faults.latency(now),
+		"packet_loss_percentage": faults.packetLoss(now),
+		"downtime_active":        faults.down(now),
+		"cpu_workers":            activeCPUWorkers.Load(),
+		"gomaxprocs":             runtime.GOMAXPROCS(0),
 	}
 
-	// Include downtime status (accessed via mutex).
-	downtimeMutex.Lock()
-	stressTests["downtime_active"] = downtimeActive
-	downtimeMutex.Unlock()
-
 	// Aggregate all metrics.
 	metrics := map[string]interface{}{
 		"cpu_load":           cpuLoad,
 		"memory_usage":       memoryUsage,
 		"network_throughput": networkThroughput,
 		"stress_tests":       stressTests,
+		"injected_latency":   injectedLatencyHistogram.toMap(),
 		"requested_at":       time.Now().UTC().Format(time.RFC3339Nano),
 	}
 
-	c.JSON(http.StatusOK, metrics)
+	renderNegotiated(c, http.StatusOK, metrics)
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// targetAllowlist holds the hosts and networks that destructive network features
+// (flood, DDoS and similar) may send traffic to.
+type targetAllowlist struct {
+	allowAll  bool
+	hostnames []string // Exact names or "*.example.com" wildcards, lowercased.
+	networks  []*net.IPNet
+}
+
+var (
+	allowlist     *targetAllowlist
+	allowlistOnce sync.Once
+)
+
+// getTargetAllowlist builds the allowlist on first use. It always contains this instance
+// itself (localhost, its hostname, loopback and interface addresses), plus the comma-separated
+// CIDRs and hostnames in TARGET_ALLOWLIST. TARGET_ALLOWLIST=* disables the check.
+func getTargetAllowlist() *targetAllowlist {
+	allowlistOnce.Do(func() {
+		al := &targetAllowlist{hostnames: []string{"localhost"}}
+		for _, cidr := range []string{"127.0.0.0/8", "::1/128"} {
+			_, n, _ := net.ParseCIDR(cidr)
+			al.networks = append(al.networks, n)
+		}
+		if hostname, err := os.Hostname(); err == nil {
+			al.hostnames = append(al.hostnames, strings.ToLower(hostname))
+		}
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok {
+					bits := len(ipNet.IP) * 8
+					al.networks = append(al.networks, &net.IPNet{IP: ipNet.IP, Mask: net.CIDRMask(bits, bits)})
+				}
+			}
+		}
+		for _, entry := range strings.Split(viper.GetString("TARGET_ALLOWLIST"), ",") {
+			entry = strings.ToLower(strings.TrimSpace(entry))
+			switch {
+			case entry == "":
+			case entry == "*":
+				al.allowAll = true
+			case strings.Contains(entry, "/"):
+				_, n, err := net.ParseCIDR(entry)
+				if err != nil {
+					logWarn("invalid TARGET_ALLOWLIST entry ignored", zap.String("entry", entry), zap.Error(err))
+					continue
+				}
+				al.networks = append(al.networks, n)
+			case net.ParseIP(entry) != nil:
+				ip := net.ParseIP(entry)
+				bits := 128
+				if ip.To4() != nil {
+					ip = ip.To4()
+					bits = 32
+				}
+				al.networks = append(al.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			default:
+				al.hostnames = append(al.hostnames, entry)
+			}
+		}
+		allowlist = al
+	})
+	return allowlist
+}
+
+// allowsHostname reports whether host matches a hostname entry.
+func (al *targetAllowlist) allowsHostname(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range al.hostnames {
+		if h == host {
+			return true
+		}
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsIP reports whether ip is inside one of the allowed networks.
+func (al *targetAllowlist) allowsIP(ip net.IP) bool {
+	for _, n := range al.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTargetAllowed returns an error unless the host of rawURL is on the allowlist.
+// Hostnames that are not listed themselves are allowed only if every address they
+// resolve to is inside an allowed network.
+func checkTargetAllowed(rawURL string) error {
+	al := getTargetAllowlist()
+	if al.allowAll {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("target has no host: " + rawURL)
+	}
+	if al.allowsHostname(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if al.allowsIP(ip) {
+			return nil
+		}
+		return fmt.Errorf("target %s is not in TARGET_ALLOWLIST", host)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !al.allowsIP(ip) {
+			return fmt.Errorf("target %s (%s) is not in TARGET_ALLOWLIST", host, ip)
+		}
+	}
+	return nil
+}
+
+// checkTargetHostAllowed is checkTargetAllowed for a host:port address, for the features
+// that connect over raw TCP.
+func checkTargetHostAllowed(hostPort string) error {
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		return err
+	}
+	return checkTargetAllowed("tcp://" + hostPort)
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// proxyToxics are the faults injected by a TCP proxy. Latency and bandwidth apply to data
+// flowing back from the dependency, like toxiproxy's downstream toxics.
+type proxyToxics struct {
+	LatencyMs     int `json:"latency_ms"`
+	JitterMs      int `json:"jitter_ms"`
+	BandwidthKbps int `json:"bandwidth_kbps"` // 0 = unlimited.
+	ResetPercent  int `json:"reset_percent"`  // Share of new connections reset with RST.
+	SlowCloseMs   int `json:"slow_close_ms"`  // Delay before closing the client side after the dependency closes.
+}
+
+// ProxyPayload defines the payload for creating a TCP proxy.
+type ProxyPayload struct {
+	Name       string  `json:"name"`
+	Dependency string  `json:"dependency"` // mysql, postgres, redis or kafka; resolved from the configuration.
+	Upstream   string  `json:"upstream"`   // Explicit host:port, used when dependency is empty.
+	ListenPort DuckInt `json:"listen_port"`
+}
+
+// ProxyToxicsPayload defines the payload for changing the toxics of a TCP proxy.
+type ProxyToxicsPayload struct {
+	LatencyMs     DuckInt `json:"latency_ms"`
+	JitterMs      DuckInt `json:"jitter_ms"`
+	BandwidthKbps DuckInt `json:"bandwidth_kbps"`
+	ResetPercent  DuckInt `json:"reset_percent"`
+	SlowCloseMs   DuckInt `json:"slow_close_ms"`
+}
+
+// tcpProxy forwards connections from a local port to a dependency.
+type tcpProxy struct {
+	name     string
+	upstream string
+	listener net.Listener
+
+	mutex  sync.Mutex
+	toxics proxyToxics
+	conns  map[net.Conn]struct{}
+
+	active   int64
+	accepted int64
+	reset    int64
+	failed   int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+// Global variables for TCP proxies.
+var (
+	proxyMutex sync.Mutex
+	proxies    = map[string]*tcpProxy{}
+)
+
+// resolveProxyUpstream returns the host:port of a configured dependency.
+func resolveProxyUpstream(dependency string) (string, error) {
+	switch dependency {
+	case "mysql":
+		cfg, err := GetMySQLConfig()
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), nil
+	case "postgres":
+		cfg, err := GetPostgresConfig()
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), nil
+	case "redis":
+		cfg, err := GetRedisConfig()
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), nil
+	case "kafka":
+		cfg, err := GetKafkaConfig()
+		if err != nil {
+			return "", err
+		}
+		if len(cfg.Servers) == 0 {
+			return "", fmt.Errorf("no kafka servers configured")
+		}
+		return cfg.Servers[0], nil
+	default:
+		return "", fmt.Errorf("unsupported dependency: %s", dependency)
+	}
+}
+
+func (p *tcpProxy) getToxics() proxyToxics {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.toxics
+}
+
+// serve accepts client connections until the listener is closed.
+func (p *tcpProxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			logInfo("TCP proxy stopped", zap.String("name", p.name), zap.Error(err))
+			return
+		}
+		go p.handle(client)
+	}
+}
+
+// handle pipes one client connection to the upstream, applying the current toxics.
+func (p *tcpProxy) handle(client net.Conn) {
+	atomic.AddInt64(&p.accepted, 1)
+	if t := p.getToxics(); t.ResetPercent > 0 && rand.Intn(100) < t.ResetPercent {
+		atomic.AddInt64(&p.reset, 1)
+		resetConn(client)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", p.upstream, 5*time.Second)
+	if err != nil {
+		atomic.AddInt64(&p.failed, 1)
+		logWarn("TCP proxy upstream dial failed", zap.String("name", p.name), zap.String("upstream", p.upstream), zap.Error(err))
+		resetConn(client)
+		return
+	}
+	p.track(client, true)
+	p.track(upstream, true)
+	defer p.track(client, false)
+	defer p.track(upstream, false)
+	atomic.AddInt64(&p.active, 1)
+	defer atomic.AddInt64(&p.active, -1)
+
+	done := make(chan struct{})
+	go func() {
+		n, _ := io.Copy(upstream, client)
+		atomic.AddInt64(&p.bytesIn, n)
+		upstream.Close()
+		close(done)
+	}()
+	p.copyDownstream(client, upstream)
+	if t := p.getToxics(); t.SlowCloseMs > 0 {
+		time.Sleep(time.Duration(t.SlowCloseMs) * time.Millisecond)
+	}
+	client.Close()
+	<-done
+}
+
+// copyDownstream copies data from the upstream to the client, delaying each chunk by the
+// configured latency and throttling it to the bandwidth limit.
+func (p *tcpProxy) copyDownstream(client, upstream net.Conn) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := upstream.Read(buf)
+		if n > 0 {
+			t := p.getToxics()
+			delay := time.Duration(t.LatencyMs) * time.Millisecond
+			if t.JitterMs > 0 {
+				delay += time.Duration(rand.Intn(t.JitterMs+1)) * time.Millisecond
+			}
+			if t.BandwidthKbps > 0 {
+				delay += time.Duration(n) * time.Second / time.Duration(t.BandwidthKbps*1024)
+			}
+			if delay > 0 {
+				time.Sleep(delay)
+			}
+			if _, werr := client.Write(buf[:n]); werr != nil {
+				return
+			}
+			atomic.AddInt64(&p.bytesOut, int64(n))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *tcpProxy) track(conn net.Conn, add bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if add {
+		p.conns[conn] = struct{}{}
+	} else {
+		delete(p.conns, conn)
+	}
+}
+
+// close stops the listener and drops every active connection.
+func (p *tcpProxy) close() {
+	p.listener.Close()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+}
+
+func (p *tcpProxy) toMap() gin.H {
+	p.mutex.Lock()
+	toxics := p.toxics
+	p.mutex.Unlock()
+	return gin.H{
+		"name":               p.name,
+		"listen":             p.listener.Addr().String(),
+		"upstream":           p.upstream,
+		"toxics":             toxics,
+		"active_connections": atomic.LoadInt64(&p.active),
+		"accepted":           atomic.LoadInt64(&p.accepted),
+		"reset":              atomic.LoadInt64(&p.reset),
+		"upstream_failures":  atomic.LoadInt64(&p.failed),
+		"bytes_in":           atomic.LoadInt64(&p.bytesIn),
+		"bytes_out":          atomic.LoadInt64(&p.bytesOut),
+	}
+}
+
+// resetConn closes conn with SO_LINGER 0 so the peer receives a RST instead of a FIN.
+func resetConn(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// ProxyListHandler handles GET /proxy.
+func ProxyListHandler(c *gin.Context) {
+	proxyMutex.Lock()
+	list := make([]gin.H, 0, len(proxies))
+	for _, p := range proxies {
+		list = append(list, p.toMap())
+	}
+	proxyMutex.Unlock()
+	ResponseJSON(c, http.StatusOK, gin.H{"proxies": list})
+}
+
+// ProxyCreateHandler handles POST /proxy.
+// It listens on listen_port (0 picks a free port) and forwards connections to the dependency.
+func ProxyCreateHandler(c *gin.Context) {
+	var payload ProxyPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	name := payload.Name
+	if name == "" {
+		name = payload.Dependency
+	}
+	if name == "" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "name or dependency is required")
+		return
+	}
+	upstream := payload.Upstream
+	if payload.Dependency != "" {
+		var err error
+		if upstream, err = resolveProxyUpstream(payload.Dependency); err != nil {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+			return
+		}
+	}
+	if upstream == "" {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "dependency or upstream is required")
+		return
+	}
+	if payload.Dependency == "" {
+		if err := checkTargetHostAllowed(upstream); err != nil {
+			ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+			return
+		}
+	}
+
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+	if _, exists := proxies[name]; exists {
+		ErrorJSON(c, http.StatusConflict, "PROXY_EXISTS", "proxy already exists: "+name)
+		return
+	}
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(int(payload.ListenPort)))
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "LISTEN_ERROR", err.Error())
+		return
+	}
+	p := &tcpProxy{
+		name:     name,
+		upstream: upstream,
+		listener: listener,
+		conns:    map[net.Conn]struct{}{},
+	}
+	proxies[name] = p
+	go p.serve()
+	logInfo("TCP proxy created", zap.String("name", name), zap.String("listen", listener.Addr().String()), zap.String("upstream", upstream))
+
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message": "TCP proxy created",
+		"proxy":   p.toMap(),
+	})
+}
+
+// ProxyToxicsHandler handles POST /proxy/:name/toxics.
+// It replaces the toxics of the proxy; an empty payload removes them.
+func ProxyToxicsHandler(c *gin.Context) {
+	var payload ProxyToxicsPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if payload.LatencyMs < 0 || payload.JitterMs < 0 || payload.BandwidthKbps < 0 || payload.SlowCloseMs < 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "latency_ms, jitter_ms, bandwidth_kbps and slow_close_ms must not be negative")
+		return
+	}
+	if payload.ResetPercent < 0 || payload.ResetPercent > 100 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "reset_percent must be between 0 and 100")
+		return
+	}
+	proxyMutex.Lock()
+	p, ok := proxies[c.Param("name")]
+	proxyMutex.Unlock()
+	if !ok {
+		ErrorJSON(c, http.StatusNotFound, "PROXY_NOT_FOUND", "proxy not found: "+c.Param("name"))
+		return
+	}
+	p.mutex.Lock()
+	p.toxics = proxyToxics{
+		LatencyMs:     int(payload.LatencyMs),
+		JitterMs:      int(payload.JitterMs),
+		BandwidthKbps: int(payload.BandwidthKbps),
+		ResetPercent:  int(payload.ResetPercent),
+		SlowCloseMs:   int(payload.SlowCloseMs),
+	}
+	p.mutex.Unlock()
+	logInfo("TCP proxy toxics updated", zap.String("name", p.name), zap.Any("toxics", p.getToxics()))
+
+	ResponseJSON(c, http.StatusOK, gin.H{
+		"message": "TCP proxy toxics updated",
+		"proxy":   p.toMap(),
+	})
+}
+
+// ProxyDeleteHandler handles DELETE /proxy/:name.
+func ProxyDeleteHandler(c *gin.Context) {
+	name := c.Param("name")
+	proxyMutex.Lock()
+	p, ok := proxies[name]
+	delete(proxies, name)
+	proxyMutex.Unlock()
+	if !ok {
+		ErrorJSON(c, http.StatusNotFound, "PROXY_NOT_FOUND", "proxy not found: "+name)
+		return
+	}
+	p.close()
+	logInfo("TCP proxy deleted", zap.String("name", name))
+	ResponseJSON(c, http.StatusOK, gin.H{"message": "TCP proxy deleted", "name": name})
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// ThunderingHerdPayload defines the payload for the thundering herd simulation.
+type ThunderingHerdPayload struct {
+	Clients        DuckInt `json:"clients"`          // Concurrent cache readers per round, default 100.
+	Key            string  `json:"key"`              // Cache key, default "herd_key".
+	Origin         string  `json:"origin"`           // "none" (default), "mysql" or "postgres": recomputed on a miss.
+	RecomputeMs    DuckInt `json:"recompute_ms"`     // Cost of one recompute, default 200.
+	TTLSecond      DuckInt `json:"ttl_second"`       // TTL of the recomputed value, default 60.
+	Rounds         DuckInt `json:"rounds"`           // Expiries to simulate, default 1.
+	IntervalSecond DuckInt `json:"interval_second"`  // Between rounds.
+	StartAtUnixMs  DuckInt `json:"start_at_unix_ms"` // Wall clock start shared by every replica; 0 starts now.
+	Coalesce       string  `json:"coalesce"`         // "" (none), "local" (one recompute per replica) or "lock" (one per key via a Redis lock).
+	Async          bool    `json:"async"`
+}
+
+// Coalescing strategies of /stress/thundering_herd.
+const (
+	herdCoalesceLocal = "local"
+	herdCoalesceLock  = "lock"
+)
+
+// thunderingHerdStats counts what the readers of a herd did on the cache and the origin.
+type thunderingHerdStats struct {
+	requests   int64
+	hits       int64
+	misses     int64
+	recomputes int64 // Origin queries caused by misses.
+	coalesced  int64 // Misses served by another reader's recompute.
+	errors     int64
+	durationNs int64
+	maxNs      int64
+}
+
+func (s *thunderingHerdStats) observe(d time.Duration) {
+	atomic.AddInt64(&s.durationNs, int64(d))
+	for {
+		current := atomic.LoadInt64(&s.maxNs)
+		if int64(d) <= current || atomic.CompareAndSwapInt64(&s.maxNs, current, int64(d)) {
+			return
+		}
+	}
+}
+
+func (s *thunderingHerdStats) toMap() gin.H {
+	requests := atomic.LoadInt64(&s.requests)
+	avgMs := 0.0
+	if requests > 0 {
+		avgMs = float64(atomic.LoadInt64(&s.durationNs)) / float64(requests) / 1e6
+	}
+	return gin.H{
+		"requests":        requests,
+		"hits":            atomic.LoadInt64(&s.hits),
+		"misses":          atomic.LoadInt64(&s.misses),
+		"recomputes":      atomic.LoadInt64(&s.recomputes),
+		"coalesced":       atomic.LoadInt64(&s.coalesced),
+		"errors":          atomic.LoadInt64(&s.errors),
+		"avg_duration_ms": avgMs,
+		"max_duration_ms": float64(atomic.LoadInt64(&s.maxNs)) / 1e6,
+	}
+}
+
+// herdFlight is the in-process recompute of one round that the other readers wait for.
+type herdFlight struct {
+	started int32
+	done    chan struct{}
+	err     error
+}
+
+// herdOrigin recomputes the cached value, standing in for an expensive query.
+type herdOrigin struct {
+	db        *sql.DB
+	query     string // Takes the recompute time in seconds; empty sleeps locally.
+	recompute time.Duration
+}
+
+func (o *herdOrigin) fetch(ctx context.Context) error {
+	if o.db == nil || o.query == "" {
+		time.Sleep(o.recompute)
+		if o.db != nil {
+			return o.db.QueryRowContext(ctx, "SELECT 1").Scan(new(int))
+		}
+		return nil
+	}
+	_, err := o.db.ExecContext(ctx, o.query, o.recompute.Seconds())
+	return err
+}
+
+// openHerdOrigin opens the database recomputing the cached value, without a connection limit
+// so that every miss reaches it at once.
+func openHerdOrigin(origin string, recompute time.Duration) (*herdOrigin, error) {
+	if origin == "" || origin == "none" {
+		return &herdOrigin{recompute: recompute}, nil
+	}
+	if origin != "mysql" && origin != "postgres" {
+		return nil, fmt.Errorf("unsupported origin: %s", origin)
+	}
+	engine, driver, dsn, err := stressDBTarget(origin)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	o := &herdOrigin{db: db, recompute: recompute}
+	switch engine {
+	case "mysql":
+		o.query = "SELECT SLEEP(?)"
+	case "postgres":
+		o.query = "SELECT pg_sleep($1)"
+	}
+	return o, nil
+}
+
+// herdRead is one cache read of a herd: on a miss it recomputes the value from the origin
+// and stores it, unless coalescing lets another reader do it.
+func herdRead(ctx context.Context, client *redis.Client, origin *herdOrigin, key, coalesce string, ttl time.Duration, flight *herdFlight, stats *thunderingHerdStats) {
+	start := time.Now()
+	defer func() { stats.observe(time.Since(start)) }()
+	atomic.AddInt64(&stats.requests, 1)
+
+	err := client.Get(ctx, key).Err()
+	if err == nil {
+		atomic.AddInt64(&stats.hits, 1)
+		return
+	}
+	if err != redis.Nil {
+		atomic.AddInt64(&stats.errors, 1)
+		return
+	}
+	atomic.AddInt64(&stats.misses, 1)
+
+	recompute := func() error {
+		atomic.AddInt64(&stats.recomputes, 1)
+		if err := origin.fetch(ctx); err != nil {
+			return err
+		}
+		return client.Set(ctx, key, time.Now().UTC().Format(time.RFC3339Nano), ttl).Err()
+	}
+
+	switch coalesce {
+	case herdCoalesceLocal:
+		if atomic.CompareAndSwapInt32(&flight.started, 0, 1) {
+			flight.err = recompute()
+			close(flight.done)
+		} else {
+			<-flight.done
+			atomic.AddInt64(&stats.coalesced, 1)
+		}
+		err = flight.err
+	case herdCoalesceLock:
+		// The lock expires on its own if its holder dies, like a real recompute lock.
+		locked, lockErr := client.SetNX(ctx, key+":lock", "1", 2*origin.recompute+time.Second).Result()
+		if lockErr != nil {
+			err = lockErr
+		} else if locked {
+			err = recompute()
+			client.Del(ctx, key+":lock")
+		} else {
+			err = herdWaitForValue(ctx, client, key, 5*origin.recompute+time.Second)
+			atomic.AddInt64(&stats.coalesced, 1)
+		}
+	default:
+		err = recompute()
+	}
+	if err != nil {
+		atomic.AddInt64(&stats.errors, 1)
+		logWarn("Thundering herd read failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// herdWaitForValue polls the cache until another reader has stored key.
+func herdWaitForValue(ctx context.Context, client *redis.Client, key string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		err := client.Get(ctx, key).Err()
+		if err != redis.Nil {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for %s to be recomputed", key)
+}
+
+// ThunderingHerdHandler handles POST /stress/thundering_herd.
+// For every round it deletes the cache key in Redis, as if it had expired, and releases
+// clients readers at the same instant. Every reader that misses recomputes the value from the
+// origin database, so the origin sees a dog-pile of identical queries. coalesce applies a fix
+// to compare against: one recompute per replica, or one per key across replicas via a Redis
+// lock. Giving several replicas the same start_at_unix_ms makes their herds collide too.
+func ThunderingHerdHandler(c *gin.Context) {
+	var payload ThunderingHerdPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	clients := int(payload.Clients)
+	if clients <= 0 {
+		clients = 100
+	}
+	if clients > 10000 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "clients must be at most 10000")
+		return
+	}
+	if payload.Coalesce != "" && payload.Coalesce != herdCoalesceLocal && payload.Coalesce != herdCoalesceLock {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "coalesce must be local or lock")
+		return
+	}
+	key := payload.Key
+	if key == "" {
+		key = "herd_key"
+	}
+	recomputeMs := int(payload.RecomputeMs)
+	if recomputeMs <= 0 {
+		recomputeMs = 200
+	}
+	ttlSec := int(payload.TTLSecond)
+	if ttlSec <= 0 {
+		ttlSec = 60
+	}
+	rounds := int(payload.Rounds)
+	if rounds <= 0 {
+		rounds = 1
+	}
+	intervalSec := int(payload.IntervalSecond)
+	startAt := time.Now()
+	if payload.StartAtUnixMs > 0 {
+		startAt = time.UnixMilli(int64(payload.StartAtUnixMs))
+		if time.Until(startAt) > time.Hour {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "start_at_unix_ms must be within the next hour")
+			return
+		}
+	}
+
+	client, err := getRedisClientWith(func(o *redis.Options) { o.PoolSize = clients })
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "REDIS_ERROR", err.Error())
+		return
+	}
+	origin, err := openHerdOrigin(payload.Origin, time.Duration(recomputeMs)*time.Millisecond)
+	if err != nil {
+		client.Close()
+		ErrorJSON(c, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	stats := &thunderingHerdStats{}
+	ttl := time.Duration(ttlSec) * time.Second
+	logInfo("Thundering herd simulation started",
+		zap.Int("clients", clients),
+		zap.String("key", key),
+		zap.String("coalesce", payload.Coalesce),
+		zap.Time("start_at", startAt))
+
+	job := startJob(c, time.Until(startAt)+time.Duration((rounds-1)*intervalSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		sleepContext(ctx, time.Until(startAt))
+		for round := 0; round < rounds && ctx.Err() == nil; round++ {
+			if round > 0 && !sleepContext(ctx, time.Duration(intervalSec)*time.Second) {
+				break
+			}
+			if err := client.Del(ctx, key).Err(); err != nil {
+				logWarn("Thundering herd expiry failed", zap.String("key", key), zap.Error(err))
+			}
+			// Readers wait at the gate so that they all miss at the same instant.
+			gate := make(chan struct{})
+			flight := &herdFlight{done: make(chan struct{})}
+			var wg sync.WaitGroup
+			for i := 0; i < clients; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-gate
+					herdRead(ctx, client, origin, key, payload.Coalesce, ttl, flight, stats)
+				}()
+			}
+			close(gate)
+			wg.Wait()
+		}
+		client.Close()
+		if origin.db != nil {
+			origin.db.Close()
+		}
+		logInfo("Thundering herd simulation completed", zap.Any("results", stats.toMap()))
+	}
+
+	if payload.Async {
+		go job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":          "thundering herd simulation started",
+			"clients":          clients,
+			"key":              key,
+			"rounds":           rounds,
+			"coalesce":         payload.Coalesce,
+			"start_at_unix_ms": startAt.UnixMilli(),
+		})
+	} else {
+		job.run(stressFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":          "thundering herd simulation completed",
+			"clients":          clients,
+			"key":              key,
+			"rounds":           rounds,
+			"coalesce":         payload.Coalesce,
+			"start_at_unix_ms": startAt.UnixMilli(),
+			"results":          stats.toMap(),
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// maxSpansPerTrace bounds span_depth and children_per_span together.
+const maxSpansPerTrace = 10000
+
+// TraceGeneratorPayload defines the payload for the synthetic trace generator.
+type TraceGeneratorPayload struct {
+	SpansPerSecond  DuckInt `json:"spans_per_second"`  // Default 100.
+	SpanDepth       DuckInt `json:"span_depth"`        // Levels of each trace, default 3.
+	ChildrenPerSpan DuckInt `json:"children_per_span"` // Children of each span above the last level, default 1.
+	AttributeCount  DuckInt `json:"attribute_count"`   // Random attributes of each span, default 5.
+	AttributeSize   DuckInt `json:"attribute_size"`    // Bytes of each attribute value, default 32.
+	ErrorPercent    DuckInt `json:"error_percent"`     // Traces whose spans end with an error status.
+	BatchSize       DuckInt `json:"batch_size"`        // Spans per export request, default 512.
+	MaxInFlight     DuckInt `json:"max_in_flight"`     // Concurrent export requests, default 4.
+	ServiceName     string  `json:"service_name"`      // Overrides OTEL_SERVICE_NAME.
+	MaintainSecond  DuckInt `json:"maintain_second"`
+	Async           bool    `json:"async"`
+}
+
+// otlpSpan is a span in the OTLP/HTTP JSON encoding.
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// otlpAttribute is a string attribute in the OTLP/HTTP JSON encoding.
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpStatus is a span status; code 2 is an error.
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// OTLP span kinds.
+const (
+	otlpSpanKindServer = 2
+	otlpSpanKindClient = 3
+)
+
+// traceGenerator builds synthetic traces and exports them to an OTLP/HTTP collector.
+type traceGenerator struct {
+	endpoint        string
+	headers         map[string]string
+	gzip            bool
+	serviceName     string
+	depth           int
+	childrenPerSpan int
+	attributeCount  int
+	attributeSize   int
+	errorPercent    int
+	client          *http.Client
+
+	traces          int64
+	spans           int64
+	exportedSpans   int64
+	failedSpans     int64
+	droppedSpans    int64
+	exports         int64
+	failedExports   int64
+	throttled       int64 // Exports rejected with 429 or 503, the usual ingest limit responses.
+	bytesSent       int64
+	lastErrorMutex  sync.Mutex
+	lastError       string
+	inFlight        chan struct{}
+	inFlightWaiting sync.WaitGroup
+}
+
+// otlpTracesEndpoint returns the traces endpoint of the configured collector, as the
+// OpenTelemetry SDKs resolve it, or "" if none is configured.
+func otlpTracesEndpoint() string {
+	if endpoint := viper.GetString("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// parseOTLPHeaders parses OTEL_EXPORTER_OTLP_HEADERS: comma-separated key=value pairs with
+// URL-encoded values.
+func parseOTLPHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid OTLP header %q", pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", pair, err)
+		}
+		headers[strings.TrimSpace(key)] = decoded
+	}
+	return headers, nil
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// spansPerTrace returns the number of spans of each trace.
+func spansPerTrace(depth, children int) int {
+	total, level := 0, 1
+	for i := 0; i < depth; i++ {
+		total += level
+		level *= children
+		if total > maxSpansPerTrace {
+			return total
+		}
+	}
+	return total
+}
+
+// trace builds one trace ending at now: a server root span and depth-1 levels of client
+// spans, each child running within its parent.
+func (g *traceGenerator) trace(now time.Time) []otlpSpan {
+	traceID := randomHex(16)
+	failed := mathrand.Intn(100) < g.errorPercent
+	var spans []otlpSpan
+	var build func(parentID string, level int, start, end time.Time)
+	build = func(parentID string, level int, start, end time.Time) {
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            randomHex(8),
+			ParentSpanID:      parentID,
+			Name:              fmt.Sprintf("biggie.synthetic.level%d", level),
+			Kind:              otlpSpanKindClient,
+			StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+			Attributes:        make([]otlpAttribute, 0, g.attributeCount+1),
+		}
+		if level == 0 {
+			span.Kind = otlpSpanKindServer
+		}
+		span.Attributes = append(span.Attributes, otlpAttribute{"biggie.synthetic", otlpValue{"true"}})
+		for i := 0; i < g.attributeCount; i++ {
+			value := randomHex((g.attributeSize + 1) / 2)[:g.attributeSize]
+			span.Attributes = append(span.Attributes, otlpAttribute{fmt.Sprintf("biggie.attr_%d", i), otlpValue{value}})
+		}
+		if failed {
+			span.Status = otlpStatus{Code: 2, Message: "synthetic error"}
+		}
+		spans = append(spans, span)
+		if level+1 >= g.depth || g.childrenPerSpan <= 0 {
+			return
+		}
+		// Children run one after another within the parent.
+		slot := end.Sub(start) / time.Duration(g.childrenPerSpan)
+		for i := 0; i < g.childrenPerSpan; i++ {
+			childStart := start.Add(time.Duration(i) * slot)
+			build(span.SpanID, level+1, childStart, childStart.Add(slot*9/10))
+		}
+	}
+	duration := time.Duration(10+mathrand.Intn(490)) * time.Millisecond
+	build("", 0, now.Add(-duration), now)
+	return spans
+}
+
+// export sends spans to the collector in the background, or drops them when max_in_flight
+// exports are already running, like the batch processor of an SDK whose queue is full.
+func (g *traceGenerator) export(spans []otlpSpan) {
+	select {
+	case g.inFlight <- struct{}{}:
+	default:
+		atomic.AddInt64(&g.droppedSpans, int64(len(spans)))
+		return
+	}
+	g.inFlightWaiting.Add(1)
+	go func() {
+		defer g.inFlightWaiting.Done()
+		defer func() { <-g.inFlight }()
+		err := g.send(spans)
+		atomic.AddInt64(&g.exports, 1)
+		if err != nil {
+			atomic.AddInt64(&g.failedExports, 1)
+			atomic.AddInt64(&g.failedSpans, int64(len(spans)))
+			g.lastErrorMutex.Lock()
+			g.lastError = err.Error()
+			g.lastErrorMutex.Unlock()
+			return
+		}
+		atomic.AddInt64(&g.exportedSpans, int64(len(spans)))
+	}()
+}
+
+// send posts one OTLP/HTTP JSON export request.
+func (g *traceGenerator) send(spans []otlpSpan) error {
+	host, _ := os.Hostname()
+	body, err := json.Marshal(gin.H{
+		"resourceSpans": []gin.H{{
+			"resource": gin.H{"attributes": []otlpAttribute{
+				{"service.name", otlpValue{g.serviceName}},
+				{"host.name", otlpValue{host}},
+			}},
+			"scopeSpans": []gin.H{{
+				"scope": gin.H{"name": "biggie/stress/traces"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if g.gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(body)
+		w.Close()
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequest(http.MethodPost, g.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for key, value := range g.headers {
+		req.Header.Set(key, value)
+	}
+	atomic.AddInt64(&g.bytesSent, int64(len(body)))
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	discardResponse(resp)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		atomic.AddInt64(&g.throttled, 1)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// run generates spans_per_second spans in whole traces, exported in batches of batchSize,
+// until maintainSec has passed or ctx is done.
+func (g *traceGenerator) run(ctx context.Context, spansPerSecond, batchSize, maintainSec int) {
+	const tick = 100 * time.Millisecond
+	perTrace := float64(spansPerTrace(g.depth, g.childrenPerSpan))
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+	var credit float64
+	var batch []otlpSpan
+	for time.Now().Before(endTime) && ctx.Err() == nil {
+		credit += float64(spansPerSecond) * tick.Seconds()
+		now := time.Now()
+		for credit >= perTrace {
+			credit -= perTrace
+			spans := g.trace(now)
+			atomic.AddInt64(&g.traces, 1)
+			atomic.AddInt64(&g.spans, int64(len(spans)))
+			batch = append(batch, spans...)
+			if len(batch) >= batchSize {
+				g.export(batch)
+				batch = nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	if len(batch) > 0 {
+		g.export(batch)
+	}
+	g.inFlightWaiting.Wait()
+}
+
+// toMap returns the counters of the generator.
+func (g *traceGenerator) toMap() gin.H {
+	g.lastErrorMutex.Lock()
+	lastError := g.lastError
+	g.lastErrorMutex.Unlock()
+	return gin.H{
+		"traces":            atomic.LoadInt64(&g.traces),
+		"spans":             atomic.LoadInt64(&g.spans),
+		"exported_spans":    atomic.LoadInt64(&g.exportedSpans),
+		"failed_spans":      atomic.LoadInt64(&g.failedSpans),
+		"dropped_spans":     atomic.LoadInt64(&g.droppedSpans),
+		"exports":           atomic.LoadInt64(&g.exports),
+		"failed_exports":    atomic.LoadInt64(&g.failedExports),
+		"throttled_exports": atomic.LoadInt64(&g.throttled),
+		"bytes_sent":        atomic.LoadInt64(&g.bytesSent),
+		"last_error":        lastError,
+	}
+}
+
+// TraceGeneratorHandler handles POST /stress/traces.
+// It exports spans_per_second synthetic spans, in traces of span_depth levels with
+// children_per_span children per span, to the OTLP/HTTP collector configured with the standard
+// OTEL_EXPORTER_OTLP_* variables, so ingest limits and sampling of the tracing backend can be
+// load tested without real traffic.
+func TraceGeneratorHandler(c *gin.Context) {
+	var payload TraceGeneratorPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	endpoint := otlpTracesEndpoint()
+	if endpoint == "" {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", "OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is not set")
+		return
+	}
+	headers, err := parseOTLPHeaders(viper.GetString("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	compression := viper.GetString("OTEL_EXPORTER_OTLP_COMPRESSION")
+	if compression != "" && compression != "none" && compression != "gzip" {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", "OTEL_EXPORTER_OTLP_COMPRESSION must be gzip or none")
+		return
+	}
+	if payload.SpansPerSecond <= 0 {
+		payload.SpansPerSecond = 100
+	}
+	if payload.SpanDepth <= 0 {
+		payload.SpanDepth = 3
+	}
+	if payload.ChildrenPerSpan <= 0 {
+		payload.ChildrenPerSpan = 1
+	}
+	if payload.AttributeCount < 0 {
+		payload.AttributeCount = 0
+	} else if payload.AttributeCount == 0 {
+		payload.AttributeCount = 5
+	}
+	if payload.AttributeSize <= 0 {
+		payload.AttributeSize = 32
+	}
+	if payload.BatchSize <= 0 {
+		payload.BatchSize = 512
+	}
+	if payload.MaxInFlight <= 0 {
+		payload.MaxInFlight = 4
+	}
+	if payload.ServiceName == "" {
+		payload.ServiceName = viper.GetString("OTEL_SERVICE_NAME")
+	}
+	perTrace := spansPerTrace(int(payload.SpanDepth), int(payload.ChildrenPerSpan))
+	if perTrace > maxSpansPerTrace {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD",
+			fmt.Sprintf("span_depth and children_per_span give more than %d spans per trace", maxSpansPerTrace))
+		return
+	}
+	client, err := newOutboundClient(10*time.Second, connectionModeReuse, "")
+	if err != nil {
+		ErrorJSON(c, http.StatusInternalServerError, "CONFIG_ERROR", err.Error())
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	spansPerSecond, batchSize := int(payload.SpansPerSecond), int(payload.BatchSize)
+
+	g := &traceGenerator{
+		endpoint:        endpoint,
+		headers:         headers,
+		gzip:            compression == "gzip",
+		serviceName:     payload.ServiceName,
+		depth:           int(payload.SpanDepth),
+		childrenPerSpan: int(payload.ChildrenPerSpan),
+		attributeCount:  int(payload.AttributeCount),
+		attributeSize:   int(payload.AttributeSize),
+		errorPercent:    int(payload.ErrorPercent),
+		client:          client,
+		inFlight:        make(chan struct{}, int(payload.MaxInFlight)),
+	}
+	logInfo("Trace generation started",
+		zap.String("endpoint", endpoint),
+		zap.Int("spans_per_second", spansPerSecond),
+		zap.Int("spans_per_trace", perTrace),
+		zap.Int("duration_sec", maintainSec))
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	stressFunc := func(ctx context.Context) {
+		g.run(ctx, spansPerSecond, batchSize, maintainSec)
+		logInfo("Trace generation completed", zap.Any("results", g.toMap()))
+	}
+
+	result := gin.H{
+		"endpoint":          endpoint,
+		"service_name":      g.serviceName,
+		"spans_per_second":  spansPerSecond,
+		"span_depth":        g.depth,
+		"children_per_span": g.childrenPerSpan,
+		"spans_per_trace":   perTrace,
+		"attribute_count":   g.attributeCount,
+		"attribute_size":    g.attributeSize,
+		"error_percent":     g.errorPercent,
+		"batch_size":        batchSize,
+		"maintain_second":   maintainSec,
+	}
+	if payload.Async {
+		go job.run(stressFunc)
+		result["message"] = "trace generation started"
+	} else {
+		job.run(stressFunc)
+		result["message"] = "trace generation completed"
+		result["results"] = g.toMap()
+	}
+	ResponseJSON(c, http.StatusOK, result)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// BaselineRoute describes a single weighted request in the baseline traffic mix.
+type BaselineRoute struct {
+	Method string  `json:"method"`
+	Path   string  `json:"path"`
+	Body   string  `json:"body"`
+	Weight DuckInt `json:"weight"`
+}
+
+// BaselineTrafficPayload defines the payload for the baseline traffic generator.
+type BaselineTrafficPayload struct {
+	RequestsPerSecond DuckInt         `json:"requests_per_second"` // Average request rate.
+	MaintainSecond    DuckInt         `json:"maintain_second"`     // Duration.
+	Async             bool            `json:"async"`
+	Routes            []BaselineRoute `json:"routes"` // If empty, defaultBaselineRoutes is used.
+}
+
+// defaultBaselineRoutes is a mostly-healthy mix with a small share of client errors,
+// roughly shaped like ordinary user traffic.
+var defaultBaselineRoutes = []BaselineRoute{
+	{Method: "GET", Path: "/simple", Weight: 60},
+	{Method: "GET", Path: "/simple/foo", Weight: 15},
+	{Method: "POST", Path: "/simple/bar", Body: `{"hello":"world"}`, Weight: 10},
+	{Method: "GET", Path: "/simple/large?length=1000", Weight: 10},
+	{Method: "GET", Path: "/simple/not_found", Weight: 3},                     // 404
+	{Method: "POST", Path: "/stress/cpu", Body: `{"cpu_percent":`, Weight: 2}, // 400
+}
+
+// trafficStats counts the results of generated requests.
+type trafficStats struct {
+	sent      int64
+	success   int64
+	clientErr int64
+	serverErr int64
+	failed    int64
+}
+
+func (s *trafficStats) recordSent() {
+	atomic.AddInt64(&s.sent, 1)
+}
+
+func (s *trafficStats) recordFailure() {
+	atomic.AddInt64(&s.failed, 1)
+}
+
+// recordStatus classifies a completed response by its status code.
+func (s *trafficStats) recordStatus(status int) {
+	switch {
+	case status >= 500:
+		atomic.AddInt64(&s.serverErr, 1)
+	case status >= 400:
+		atomic.AddInt64(&s.clientErr, 1)
+	default:
+		atomic.AddInt64(&s.success, 1)
+	}
+}
+
+func (s *trafficStats) toMap() gin.H {
+	return gin.H{
+		"sent":          atomic.LoadInt64(&s.sent),
+		"success":       atomic.LoadInt64(&s.success),
+		"client_errors": atomic.LoadInt64(&s.clientErr),
+		"server_errors": atomic.LoadInt64(&s.serverErr),
+		"failed":        atomic.LoadInt64(&s.failed),
+	}
+}
+
+// pickBaselineRoute selects a route from routes according to their weights.
+func pickBaselineRoute(routes []BaselineRoute, totalWeight int) BaselineRoute {
+	n := rand.Intn(totalWeight)
+	for _, r := range routes {
+		n -= int(r.Weight)
+		if n < 0 {
+			return r
+		}
+	}
+	return routes[len(routes)-1]
+}
+
+// BaselineTrafficHandler handles POST /traffic/baseline.
+// It sends a low, continuous, weighted mix of requests to this instance's own endpoints
+// so that dashboards show a realistic baseline on which injected faults stand out.
+func BaselineTrafficHandler(c *gin.Context) {
+	var payload BaselineTrafficPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	rps := int(payload.RequestsPerSecond)
+	maintainSec := int(payload.MaintainSecond)
+	if rps <= 0 {
+		rps = 5
+	}
+	if rps > 1000 {
+		// Baseline traffic is meant to be ambient; use /stress/concurrent_flood for more.
+		rps = 1000
+	}
+	routes := payload.Routes
+	if len(routes) == 0 {
+		routes = defaultBaselineRoutes
+	}
+	totalWeight := 0
+	for _, r := range routes {
+		if r.Weight < 0 {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "route weight must not be negative")
+			return
+		}
+		totalWeight += int(r.Weight)
+	}
+	if totalWeight <= 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "at least one route must have a positive weight")
+		return
+	}
+	host := c.Request.Host
+	for _, r := range routes {
+		// A path not starting with "/" could change the host of the URL, e.g. "@evil.example/".
+		if !strings.HasPrefix(r.Path, "/") {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "route path must start with /: "+r.Path)
+			return
+		}
+		if err := checkTargetAllowed(baselineURL(host, r)); err != nil {
+			ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+			return
+		}
+	}
+	stats := &trafficStats{}
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	trafficFunc := func(ctx context.Context) {
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		client := &http.Client{Timeout: 10 * time.Second}
+		interval := time.Second / time.Duration(rps)
+		var wg sync.WaitGroup
+		for time.Now().Before(endTime) && ctx.Err() == nil {
+			route := pickBaselineRoute(routes, totalWeight)
+			wg.Add(1)
+			go func(r BaselineRoute) {
+				defer wg.Done()
+				sendBaselineRequest(client, host, r, stats)
+			}(route)
+			// Jitter each gap by +/-50% so the traffic does not look machine-generated.
+			jitter := time.Duration(rand.Int63n(int64(interval))) - interval/2
+			sleepContext(ctx, interval+jitter)
+		}
+		wg.Wait()
+		logInfo("Baseline traffic generation completed",
+			zap.Int("requests_per_second", rps),
+			zap.Int("duration_sec", maintainSec),
+			zap.Int64("sent", atomic.LoadInt64(&stats.sent)))
+	}
+
+	if payload.Async {
+		go job.run(trafficFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":             "baseline traffic generation started",
+			"requests_per_second": rps,
+			"maintain_second":     maintainSec,
+			"routes":              routes,
+		})
+	} else {
+		job.run(trafficFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":             "baseline traffic generation completed",
+			"requests_per_second": rps,
+			"maintain_second":     maintainSec,
+			"routes":              routes,
+			"results":             stats.toMap(),
+		})
+	}
+}
+
+// baselineURL returns the URL a baseline request for route is sent to.
+func baselineURL(host string, route BaselineRoute) string {
+	return fmt.Sprintf("http://%s%s", host, route.Path)
+}
+
+// sendBaselineRequest issues a single baseline request against host and records the outcome.
+func sendBaselineRequest(client *http.Client, host string, route BaselineRoute, stats *trafficStats) {
+	method := route.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if route.Body != "" {
+		body = bytes.NewBufferString(route.Body)
+	}
+	req, err := http.NewRequest(method, baselineURL(host, route), body)
+	if err != nil {
+		stats.recordFailure()
+		logWarn("baseline traffic request creation failed", zap.Error(err))
+		return
+	}
+	if route.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", "biggie-baseline/1.0")
+	stats.recordSent()
+	resp, err := client.Do(req)
+	if err != nil {
+		stats.recordFailure()
+		logWarn("baseline traffic request failed", zap.Error(err))
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	stats.recordStatus(resp.StatusCode)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// JourneyStep describes a single request in a user journey.
+type JourneyStep struct {
+	Name         string            `json:"name"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path"` // Appended to base_url.
+	Headers      map[string]string `json:"headers"`
+	Cookies      map[string]string `json:"cookies"` // Sent in addition to cookies set by earlier steps.
+	Body         string            `json:"body"`
+	ThinkTimeMs  DuckInt           `json:"think_time_ms"` // Pause after this step.
+	ExpectStatus DuckInt           `json:"expect_status"` // If set, any other status counts as a failure.
+	StopOnError  bool              `json:"stop_on_error"` // Abort the rest of this iteration on failure.
+}
+
+// JourneyPayload defines the payload for the synthetic user journey simulator.
+type JourneyPayload struct {
+	BaseURL        string        `json:"base_url"` // Defaults to this instance.
+	Steps          []JourneyStep `json:"steps"`
+	VirtualUsers   DuckInt       `json:"virtual_users"`
+	MaintainSecond DuckInt       `json:"maintain_second"`
+	Async          bool          `json:"async"`
+}
+
+// journeyStepStats aggregates results for a single step across all virtual users.
+type journeyStepStats struct {
+	Name         string      `json:"name"`
+	Requests     int         `json:"requests"`
+	Failures     int         `json:"failures"`
+	AvgLatencyMs float64     `json:"avg_latency_ms"`
+	MaxLatencyMs float64     `json:"max_latency_ms"`
+	StatusCodes  map[int]int `json:"status_codes"`
+	totalLatency time.Duration
+}
+
+// journeyStats collects results of a journey run.
+type journeyStats struct {
+	mu         sync.Mutex
+	iterations int
+	completed  int
+	steps      []*journeyStepStats
+}
+
+func newJourneyStats(steps []JourneyStep) *journeyStats {
+	s := &journeyStats{}
+	for i, step := range steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i+1)
+		}
+		s.steps = append(s.steps, &journeyStepStats{Name: name, StatusCodes: make(map[int]int)})
+	}
+	return s
+}
+
+func (s *journeyStats) record(index int, status int, latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.steps[index]
+	st.Requests++
+	if failed {
+		st.Failures++
+	}
+	if status > 0 {
+		st.StatusCodes[status]++
+	}
+	st.totalLatency += latency
+	st.AvgLatencyMs = float64(st.totalLatency.Microseconds()) / 1000 / float64(st.Requests)
+	if ms := float64(latency.Microseconds()) / 1000; ms > st.MaxLatencyMs {
+		st.MaxLatencyMs = ms
+	}
+}
+
+func (s *journeyStats) toMap() gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steps := make([]journeyStepStats, 0, len(s.steps))
+	for _, st := range s.steps {
+		codes := make(map[int]int, len(st.StatusCodes))
+		for k, v := range st.StatusCodes {
+			codes[k] = v
+		}
+		cp := *st
+		cp.StatusCodes = codes
+		steps = append(steps, cp)
+	}
+	return gin.H{
+		"iterations":           s.iterations,
+		"completed_iterations": s.completed,
+		"steps":                steps,
+	}
+}
+
+// maxJourneyVirtualUsers bounds virtual_users; each one is a goroutine with its own client.
+const maxJourneyVirtualUsers = 1000
+
+// JourneyHandler handles POST /traffic/journey.
+// Each virtual user repeatedly walks through the given steps with its own cookie jar,
+// pausing for each step's think time, until maintain_second elapses.
+func JourneyHandler(c *gin.Context) {
+	var payload JourneyPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	if len(payload.Steps) == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "at least one step is required")
+		return
+	}
+	virtualUsers := int(payload.VirtualUsers)
+	if virtualUsers <= 0 {
+		virtualUsers = 1
+	}
+	if virtualUsers > maxJourneyVirtualUsers {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("virtual_users must not exceed %d", maxJourneyVirtualUsers))
+		return
+	}
+	maintainSec := int(payload.MaintainSecond)
+	baseURL := strings.TrimSuffix(payload.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://%s", c.Request.Host)
+	}
+	for _, step := range payload.Steps {
+		// A path not starting with "/" could change the host of the URL, e.g. "@evil.example/".
+		if !strings.HasPrefix(step.Path, "/") {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "step path must start with /: "+step.Path)
+			return
+		}
+		if err := checkTargetAllowed(baseURL + step.Path); err != nil {
+			ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+			return
+		}
+	}
+	stats := newJourneyStats(payload.Steps)
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	journeyFunc := func(ctx context.Context) {
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		var wg sync.WaitGroup
+		for i := 0; i < virtualUsers; i++ {
+			wg.Add(1)
+			go func(vu int) {
+				defer wg.Done()
+				jar, _ := cookiejar.New(nil)
+				client := &http.Client{Timeout: 10 * time.Second, Jar: jar}
+				for time.Now().Before(endTime) && ctx.Err() == nil {
+					runJourneyIteration(ctx, client, baseURL, vu, payload.Steps, stats)
+				}
+			}(i)
+		}
+		wg.Wait()
+		logInfo("User journey simulation completed",
+			zap.Int("virtual_users", virtualUsers),
+			zap.Int("duration_sec", maintainSec))
+	}
+
+	if payload.Async {
+		go job.run(journeyFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "user journey simulation started",
+			"base_url":        baseURL,
+			"virtual_users":   virtualUsers,
+			"maintain_second": maintainSec,
+			"step_count":      len(payload.Steps),
+		})
+	} else {
+		job.run(journeyFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "user journey simulation completed",
+			"base_url":        baseURL,
+			"virtual_users":   virtualUsers,
+			"maintain_second": maintainSec,
+			"step_count":      len(payload.Steps),
+			"results":         stats.toMap(),
+		})
+	}
+}
+
+// runJourneyIteration walks through all steps once for a single virtual user, stopping early
+// when ctx is done.
+func runJourneyIteration(ctx context.Context, client *http.Client, baseURL string, vu int, steps []JourneyStep, stats *journeyStats) {
+	stats.mu.Lock()
+	stats.iterations++
+	stats.mu.Unlock()
+	for i, step := range steps {
+		status, latency, err := doJourneyStep(client, baseURL, vu, step)
+		failed := err != nil
+		if err == nil && step.ExpectStatus > 0 && status != int(step.ExpectStatus) {
+			failed = true
+		}
+		if err != nil {
+			logWarn("user journey step failed", zap.Int("vu", vu), zap.Int("step", i), zap.Error(err))
+		}
+		stats.record(i, status, latency, failed)
+		if failed && step.StopOnError {
+			return
+		}
+		if !sleepContext(ctx, time.Duration(step.ThinkTimeMs)*time.Millisecond) {
+			return
+		}
+	}
+	stats.mu.Lock()
+	stats.completed++
+	stats.mu.Unlock()
+}
+
+// doJourneyStep sends a single journey step and returns its status code and latency.
+func doJourneyStep(client *http.Client, baseURL string, vu int, step JourneyStep) (int, time.Duration, error) {
+	method := step.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if step.Body != "" {
+		// Allow per-user payloads, e.g. {"user":"{vu}"}.
+		body = bytes.NewBufferString(strings.ReplaceAll(step.Body, "{vu}", fmt.Sprintf("%d", vu)))
+	}
+	req, err := http.NewRequest(method, baseURL+step.Path, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	for key, value := range step.Headers {
+		req.Header.Set(key, value)
+	}
+	if step.Body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range step.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, time.Since(start), err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, time.Since(start), nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ReplayRequest is a single recorded request to be replayed.
+type ReplayRequest struct {
+	Method   string            `json:"method"`
+	URL      string            `json:"url"` // Absolute URL or path; the host is replaced by base_url when set.
+	Headers  map[string]string `json:"headers"`
+	Body     string            `json:"body"`
+	OffsetMs DuckInt           `json:"offset_ms"` // Time since the start of the recording.
+}
+
+// harNameValue is a HAR header entry.
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harFile holds the subset of the HAR 1.2 format needed for replay.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method   string         `json:"method"`
+				URL      string         `json:"url"`
+				Headers  []harNameValue `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ReplayPayload defines the payload for the traffic replay API.
+type ReplayPayload struct {
+	BaseURL   string          `json:"base_url"` // Defaults to this instance for relative URLs.
+	HAR       *harFile        `json:"har"`
+	AccessLog string          `json:"access_log"` // Apache/nginx common or combined log lines.
+	Requests  []ReplayRequest `json:"requests"`
+	Speed     DuckFloat       `json:"speed"` // 1 replays at original speed, 2 twice as fast, 0 as fast as possible.
+	Loop      bool            `json:"loop"`  // Restart the recording until maintain_second elapses.
+	// MaintainSecond only applies when loop is true.
+	MaintainSecond DuckInt `json:"maintain_second"`
+	Async          bool    `json:"async"`
+}
+
+// hopByHopHeaders are recorded headers that must not be replayed verbatim.
+var hopByHopHeaders = map[string]bool{
+	"host":              true,
+	"content-length":    true,
+	"connection":        true,
+	"keep-alive":        true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// harToReplayRequests converts HAR entries into replay requests ordered by start time.
+func harToReplayRequests(har *harFile) []ReplayRequest {
+	entries := har.Log.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	var requests []ReplayRequest
+	for _, e := range entries {
+		headers := make(map[string]string)
+		for _, h := range e.Request.Headers {
+			// HTTP/2 pseudo headers (":authority" etc.) are not real headers.
+			if strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			headers[h.Name] = h.Value
+		}
+		body := ""
+		if e.Request.PostData != nil {
+			body = e.Request.PostData.Text
+		}
+		requests = append(requests, ReplayRequest{
+			Method:   e.Request.Method,
+			URL:      e.Request.URL,
+			Headers:  headers,
+			Body:     body,
+			OffsetMs: DuckInt(e.StartedDateTime.Sub(entries[0].StartedDateTime).Milliseconds()),
+		})
+	}
+	return requests
+}
+
+// accessLogRegex matches the common/combined log format, e.g.
+// 10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /simple HTTP/1.1" 200 2326 "-" "curl/8.0"
+var accessLogRegex = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*"(?: \d{3} \S+(?: "[^"]*" "([^"]*)")?)?`)
+
+// accessLogToReplayRequests converts access log lines into replay requests.
+// Lines that do not match the common/combined log format are skipped.
+func accessLogToReplayRequests(accessLog string) []ReplayRequest {
+	var requests []ReplayRequest
+	var first time.Time
+	for _, line := range strings.Split(accessLog, "\n") {
+		m := accessLogRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[1])
+		if err != nil {
+			continue
+		}
+		if first.IsZero() {
+			first = ts
+		}
+		headers := map[string]string{}
+		if m[4] != "" && m[4] != "-" {
+			headers["User-Agent"] = m[4]
+		}
+		requests = append(requests, ReplayRequest{
+			Method:   m[2],
+			URL:      m[3],
+			Headers:  headers,
+			OffsetMs: DuckInt(ts.Sub(first).Milliseconds()),
+		})
+	}
+	return requests
+}
+
+// rewriteReplayURL replaces the scheme and host of raw with baseURL, keeping path and query.
+func rewriteReplayURL(raw, baseURL string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if baseURL == "" {
+		if u.Host == "" {
+			return "", errors.New("relative url without base_url: " + raw)
+		}
+		return raw, nil
+	}
+	return baseURL + u.RequestURI(), nil
+}
+
+// TrafficReplayHandler handles POST /traffic/replay.
+// It replays a HAR file, access log lines or a list of recorded requests against base_url, preserving
+// the original inter-request timing scaled by speed.
+func TrafficReplayHandler(c *gin.Context) {
+	var payload ReplayPayload
+	if err := bindPayload(c, &payload); err != nil {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+	requests := payload.Requests
+	if payload.HAR != nil {
+		requests = append(harToReplayRequests(payload.HAR), requests...)
+	}
+	if payload.AccessLog != "" {
+		requests = append(accessLogToReplayRequests(payload.AccessLog), requests...)
+	}
+	if len(requests) == 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "har, access_log or requests must contain at least one request")
+		return
+	}
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].OffsetMs < requests[j].OffsetMs })
+	speed := float64(payload.Speed)
+	if speed < 0 {
+		ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", "speed must not be negative")
+		return
+	}
+	baseURL := strings.TrimSuffix(payload.BaseURL, "/")
+	if baseURL == "" {
+		// Relative URLs are replayed against this instance.
+		for i := range requests {
+			if strings.HasPrefix(requests[i].URL, "/") {
+				requests[i].URL = fmt.Sprintf("http://%s%s", c.Request.Host, requests[i].URL)
+			}
+		}
+	}
+	checked := map[string]bool{}
+	for i := range requests {
+		target, err := rewriteReplayURL(requests[i].URL, baseURL)
+		if err != nil {
+			ErrorJSON(c, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+			return
+		}
+		requests[i].URL = target
+		if u, err := url.Parse(target); err == nil && !checked[u.Host] {
+			if err := checkTargetAllowed(target); err != nil {
+				ErrorJSON(c, http.StatusForbidden, "TARGET_NOT_ALLOWED", err.Error())
+				return
+			}
+			checked[u.Host] = true
+		}
+	}
+	maintainSec := int(payload.MaintainSecond)
+	stats := &trafficStats{}
+
+	job := startJob(c, time.Duration(maintainSec)*time.Second)
+	replayFunc := func(ctx context.Context) {
+		client := &http.Client{Timeout: 30 * time.Second}
+		endTime := time.Now().Add(time.Duration(maintainSec) * time.Second)
+		passes := 0
+		for {
+			replayOnce(ctx, client, requests, speed, stats)
+			passes++
+			if !payload.Loop || !time.Now().Before(endTime) || ctx.Err() != nil {
+				break
+			}
+		}
+		logInfo("Traffic replay completed",
+			zap.Int("requests", len(requests)),
+			zap.Int("passes", passes),
+			zap.Float64("speed", speed))
+	}
+
+	if payload.Async {
+		go job.run(replayFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "traffic replay started",
+			"request_count":   len(requests),
+			"speed":           speed,
+			"loop":            payload.Loop,
+			"maintain_second": maintainSec,
+		})
+	} else {
+		job.run(replayFunc)
+		ResponseJSON(c, http.StatusOK, gin.H{
+			"message":         "traffic replay completed",
+			"request_count":   len(requests),
+			"speed":           speed,
+			"loop":            payload.Loop,
+			"maintain_second": maintainSec,
+			"results":         stats.toMap(),
+		})
+	}
+}
+
+// replayOnce sends every request once, each at its scaled offset from the start of the pass,
+// until ctx is done.
+func replayOnce(ctx context.Context, client *http.Client, requests []ReplayRequest, speed float64, stats *trafficStats) {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, r := range requests {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(r.OffsetMs) / speed * float64(time.Millisecond)))
+			if wait := time.Until(due); wait > 0 && !sleepContext(ctx, wait) {
+				break
+			}
+		}
+		wg.Add(1)
+		go func(r ReplayRequest) {
+			defer wg.Done()
+			sendReplayRequest(client, r, stats)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// sendReplayRequest sends a single recorded request and records the outcome.
+func sendReplayRequest(client *http.Client, r ReplayRequest, stats *trafficStats) {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if r.Body != "" {
+		body = bytes.NewBufferString(r.Body)
+	}
+	req, err := http.NewRequest(method, r.URL, body)
+	if err != nil {
+		stats.recordFailure()
+		logWarn("traffic replay request creation failed", zap.Error(err))
+		return
+	}
+	for key, value := range r.Headers {
+		if hopByHopHeaders[strings.ToLower(key)] {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+	stats.recordSent()
+	resp, err := client.Do(req)
+	if err != nil {
+		stats.recordFailure()
+		logWarn("traffic replay request failed", zap.String("url", r.URL), zap.Error(err))
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	stats.recordStatus(resp.StatusCode)
+}
@@ -6,11 +6,13 @@ import (
 	"errors"
 	"io"
 	"math/rand"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 )
 
 // processRandomInt checks if the provided string uses the RANDOM syntax for integers.
@@ -162,6 +164,12 @@ func processRandomValue(value string) (interface{}, error) {
 
 // ResponseJSON writes a JSON response with an automatically added "requested_at" timestamp.
 func ResponseJSON(c *gin.Context, status int, payload interface{}) {
+	c.JSON(status, responseEnvelope(c, payload))
+}
+
+// responseEnvelope returns the standard response body for payload: gin.H payloads are merged
+// into it and others set as "data", with the request time and the job ID, if any.
+func responseEnvelope(c *gin.Context, payload interface{}) gin.H {
 	response := gin.H{
 		"requested_at": time.Now().UTC().Format(time.RFC3339Nano),
 	}
@@ -172,7 +180,10 @@ func ResponseJSON(c *gin.Context, status int, payload interface{}) {
 	} else {
 		response["data"] = payload
 	}
-	c.JSON(status, response)
+	if jobID, ok := c.Get("job_id"); ok {
+		response["job_id"] = jobID
+	}
+	return response
 }
 
 // ErrorJSON sends a standardized JSON error response.
@@ -204,19 +215,79 @@ func getRequestDetails(c *gin.Context) gin.H {
 			"length":  len(bodyStr),
 			"payload": bodyStr,
 		}
+	} else if reason := c.GetString("bodyCapture"); reason != "" {
+		details["body"] = gin.H{
+			"length":       c.Request.ContentLength,
+			"not_captured": reason,
+		}
 	}
 	return details
 }
 
+// streamingBodyPaths lists routes that consume the request body themselves,
+// so RequestBodyMiddleware must not buffer it.
+var streamingBodyPaths = map[string]bool{
+	"/simple/slow_read": true,
+	"/simple/upload":    true,
+}
+
+// binaryBodyTypes are the content types whose bodies are never captured.
+var binaryBodyTypes = []string{
+	"application/octet-stream", "multipart/", "image/", "audio/", "video/",
+	"application/zip", "application/gzip", "application/x-tar", "application/pdf",
+}
+
+// Reasons a request body is not captured, stored as "bodyCapture" in the Gin context.
+const (
+	bodyCaptureBinary    = "binary"    // Binary content type.
+	bodyCaptureTooLarge  = "too_large" // Content-Length above REQUEST_BODY_CAPTURE_LIMIT.
+	bodyCaptureTruncated = "truncated" // Chunked body found above the limit while reading.
+)
+
+// isBinaryBody reports whether contentType is one of binaryBodyTypes.
+func isBinaryBody(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range binaryBodyTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // RequestBodyMiddleware reads the raw request body and stores it in the Gin context.
+// Bodies of binary content types, or larger than REQUEST_BODY_CAPTURE_LIMIT bytes (0 for no
+// limit), are passed through to the handler unread, so large uploads are streamed instead
+// of held in memory twice.
 func RequestBodyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.Body != nil {
-			bodyBytes, err := io.ReadAll(c.Request.Body)
-			if err == nil {
-				c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-				c.Set("rawBody", string(bodyBytes))
+		if c.Request.Body == nil || c.Request.Body == http.NoBody || streamingBodyPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		limit := viper.GetInt64("REQUEST_BODY_CAPTURE_LIMIT")
+		switch {
+		case isBinaryBody(c.GetHeader("Content-Type")):
+			c.Set("bodyCapture", bodyCaptureBinary)
+		case limit > 0 && c.Request.ContentLength > limit:
+			c.Set("bodyCapture", bodyCaptureTooLarge)
+		default:
+			reader := io.Reader(c.Request.Body)
+			if limit > 0 {
+				reader = io.LimitReader(reader, limit+1)
+			}
+			bodyBytes, err := io.ReadAll(reader)
+			if err != nil {
+				break
+			}
+			if limit > 0 && int64(len(bodyBytes)) > limit {
+				// Hand the part read back in front of the rest, still unread.
+				c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(bodyBytes), c.Request.Body))
+				c.Set("bodyCapture", bodyCaptureTruncated)
+				break
 			}
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+			c.Set("rawBody", string(bodyBytes))
 		}
 		c.Next()
 	}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// xmlNamespace is the namespace of the documents returned by /simple/xml.
+const xmlNamespace = "urn:the-biggie:simple"
+
+// xmlContentTypes maps the content_type parameter of /simple/xml to a MIME type. Many legacy
+// clients only accept text/xml.
+var xmlContentTypes = map[string]string{
+	"xml":  "application/xml; charset=utf-8",
+	"text": "text/xml; charset=utf-8",
+}
+
+// Invalid XML faults of /simple/xml, for testing how clients and proxies cope with a broken
+// document. Except wrong_content_type, each makes the body unparsable.
+const (
+	xmlFaultMismatchedTag = "mismatched_tag"
+	xmlFaultUnclosed      = "unclosed"
+	xmlFaultTruncated     = "truncated"
+	xmlFaultUnescaped     = "unescaped"
+	xmlFaultInvalidChar   = "invalid_char"
+	xmlFaultContentType   = "wrong_content_type"
+)
+
+// xmlFaults lists the faults, for fault=random and error messages.
+var xmlFaults = []string{
+	xmlFaultMismatchedTag, xmlFaultUnclosed, xmlFaultTruncated,
+	xmlFaultUnescaped, xmlFaultInvalidChar, xmlFaultContentType,
+}
+
+// maxXMLFields bounds the fields of a posted document echoed in the response.
+const maxXMLFields = 100
+
+// xmlItem is a record of the generated documents.
+type xmlItem struct {
+	XMLName xml.Name `xml:"item"`
+	ID      int      `xml:"id,attr"`
+	Name    string   `xml:"name"`
+	Price   xmlPrice `xml:"price"`
+	Stock   int      `xml:"stock"`
+	Tags    []string `xml:"tags>tag"`
+}
+
+// xmlPrice is the price of an xmlItem.
+type xmlPrice struct {
+	Currency string `xml:"currency,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// xmlField is a leaf element of a posted document, by its path from the root.
+type xmlField struct {
+	XMLName xml.Name `xml:"field"`
+	Path    string   `xml:"path,attr"`
+	Value   string   `xml:",chardata"`
+}
+
+// xmlReceived summarizes a posted document.
+type xmlReceived struct {
+	XMLName    xml.Name   `xml:"received"`
+	Root       string     `xml:"root,attr"`
+	Namespace  string     `xml:"namespace,attr,omitempty"`
+	Bytes      int64      `xml:"bytes,attr"`
+	Elements   int        `xml:"elements,attr"`
+	Attributes int        `xml:"attributes,attr"`
+	Depth      int        `xml:"depth,attr"`
+	Truncated  bool       `xml:"fields_truncated,attr,omitempty"`
+	Fields     []xmlField `xml:"field"`
+}
+
+// xmlError is the XML equivalent of the standard error format.
+type xmlError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        string   `xml:"code"`
+	Message     string   `xml:"message"`
+	RequestedAt string   `xml:"requestedAt"`
+}
+
+// ErrorXML sends the standard error response as XML, for the XML APIs.
+func ErrorXML(c *gin.Context, status int, errorType, message string) {
+	body, _ := xml.MarshalIndent(xmlError{
+		Code:        strings.ToUpper(errorType),
+		Message:     strings.ToLower(message),
+		RequestedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}, "", "  ")
+	c.Data(status, xmlContentTypes["xml"], append([]byte(xml.Header), body...))
+}
+
+// parseXMLDocument parses a whole XML document strictly and summarizes it: the root element,
+// the element, attribute and depth counts, and the text of the leaf elements.
+func parseXMLDocument(r io.Reader) (*xmlReceived, error) {
+	counter := &countingReader{r: r}
+	decoder := xml.NewDecoder(counter)
+	received := &xmlReceived{}
+	var path []string
+	var text strings.Builder
+	hasChildren := []bool{}
+	closed := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if closed {
+				return nil, fmt.Errorf("element <%s> after the root element", t.Name.Local)
+			}
+			if len(path) == 0 {
+				received.Root, received.Namespace = t.Name.Local, t.Name.Space
+			} else {
+				hasChildren[len(hasChildren)-1] = true
+			}
+			path = append(path, t.Name.Local)
+			hasChildren = append(hasChildren, false)
+			received.Elements++
+			received.Attributes += len(t.Attr)
+			received.Depth = max(received.Depth, len(path))
+			text.Reset()
+		case xml.CharData:
+			if len(path) == 0 && len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("text outside the root element")
+			}
+			text.Write(t)
+		case xml.EndElement:
+			if !hasChildren[len(hasChildren)-1] {
+				if len(received.Fields) < maxXMLFields {
+					received.Fields = append(received.Fields, xmlField{
+						Path:  strings.Join(path, "/"),
+						Value: strings.TrimSpace(text.String()),
+					})
+				} else {
+					received.Truncated = true
+				}
+			}
+			path = path[:len(path)-1]
+			hasChildren = hasChildren[:len(hasChildren)-1]
+			closed = len(path) == 0
+			text.Reset()
+		}
+	}
+	if received.Root == "" {
+		return nil, fmt.Errorf("no root element")
+	}
+	received.Bytes = counter.n
+	return received, nil
+}
+
+// randomXMLItem returns the item id with random content.
+func randomXMLItem(id int) xmlItem {
+	tags := []string{"new", "sale", "popular", "limited", "eco", "gift"}
+	itemTags := make([]string, 1+rand.Intn(3))
+	for i := range itemTags {
+		itemTags[i] = tags[rand.Intn(len(tags))]
+	}
+	return xmlItem{
+		ID:    id,
+		Name:  fmt.Sprintf("item-%d-%s", id, randomColor()),
+		Price: xmlPrice{Currency: "USD", Value: strconv.FormatFloat(rand.Float64()*1000, 'f', 2, 64)},
+		Stock: rand.Intn(100),
+		Tags:  itemTags,
+	}
+}
+
+// XMLHandler handles GET and POST /simple/xml?items=[number]&size_bytes=[number]&content_type=[xml|text]&fault=[string]&fault_percent=[number].
+// It returns an XML document of generated items, after parsing the posted XML document and
+// summarizing it for POST, to emulate the XML APIs of legacy integrations. The document is
+// streamed; fault makes fault_percent of the responses invalid XML.
+func XMLHandler(c *gin.Context) {
+	items, err := strconv.Atoi(c.DefaultQuery("items", "10"))
+	if err != nil || items < 0 {
+		items = 10
+	}
+	items = min(items, 100000)
+	contentType := c.DefaultQuery("content_type", "xml")
+	mimeType, ok := xmlContentTypes[contentType]
+	if !ok {
+		ErrorXML(c, http.StatusBadRequest, "INVALID_QUERY", "content_type must be xml or text")
+		return
+	}
+	var size int64
+	if sizeStr := c.Query("size_bytes"); sizeStr != "" {
+		size, err = strconv.ParseInt(sizeStr, 10, 64)
+		if maxBytes := viper.GetInt64("SIMPLE_LARGE_MAX_BYTES"); err != nil || size <= 0 || size > maxBytes {
+			ErrorXML(c, http.StatusBadRequest, "INVALID_QUERY", fmt.Sprintf("size_bytes must be an integer between 1 and SIMPLE_LARGE_MAX_BYTES (%d)", maxBytes))
+			return
+		}
+	}
+	fault := c.Query("fault")
+	if fault == "random" {
+		fault = xmlFaults[rand.Intn(len(xmlFaults))]
+	} else if fault != "" && !slices.Contains(xmlFaults, fault) {
+		ErrorXML(c, http.StatusBadRequest, "INVALID_QUERY", "fault must be random or one of "+strings.Join(xmlFaults, ", "))
+		return
+	}
+	if fault != "" {
+		percent, err := strconv.ParseFloat(c.DefaultQuery("fault_percent", "100"), 64)
+		if err != nil {
+			ErrorXML(c, http.StatusBadRequest, "INVALID_QUERY", "fault_percent must be a number")
+			return
+		}
+		if rand.Float64()*100 >= percent {
+			fault = ""
+		}
+	}
+
+	var received *xmlReceived
+	message := "xml ok"
+	if c.Request.Method == http.MethodPost {
+		received, err = parseXMLDocument(c.Request.Body)
+		if err != nil {
+			ErrorXML(c, http.StatusBadRequest, "INVALID_XML", err.Error())
+			return
+		}
+		message = "xml received"
+	}
+	if fault == xmlFaultUnescaped {
+		message += " & <unescaped>"
+	} else if fault == xmlFaultInvalidChar {
+		message += " \x01\xff"
+	}
+
+	var head bytes.Buffer
+	head.WriteString(xml.Header)
+	fmt.Fprintf(&head, "<response xmlns=%q status=\"ok\">\n", xmlNamespace)
+	if fault == xmlFaultUnescaped || fault == xmlFaultInvalidChar {
+		fmt.Fprintf(&head, "  <message>%s</message>\n", message)
+	} else {
+		head.WriteString("  <message>")
+		xml.EscapeText(&head, []byte(message))
+		head.WriteString("</message>\n")
+	}
+	fmt.Fprintf(&head, "  <requestedAt>%s</requestedAt>\n", time.Now().UTC().Format(time.RFC3339Nano))
+	if received != nil {
+		body, _ := xml.MarshalIndent(received, "  ", "  ")
+		head.Write(body)
+		head.WriteString("\n")
+	}
+	head.WriteString("  <items>")
+	tail := "\n  </items>\n</response>\n"
+	switch fault {
+	case xmlFaultMismatchedTag:
+		tail = "\n  </items>\n</responce>\n"
+	case xmlFaultUnclosed:
+		tail = "\n  </items>\n"
+	case xmlFaultTruncated:
+		tail = "\n    <item id=\"0\"><name>item-0-"
+	case xmlFaultContentType:
+		mimeType = "application/json; charset=utf-8"
+	}
+
+	c.Header("Content-Type", mimeType)
+	if fault != "" {
+		c.Header("X-Biggie-XML-Fault", fault)
+	}
+	c.Status(http.StatusOK)
+	written, ok := writeXMLItems(c.Writer, head.Bytes(), items, size, tail)
+	if !ok {
+		logWarn("XML response aborted", zap.Int64("written_bytes", written))
+	}
+}
+
+// writeXMLItems streams head, the items and tail. With size, items are written as long as they
+// fit in size bytes and the rest is padded with a comment. It returns the bytes written and
+// false if the client went away.
+func writeXMLItems(w gin.ResponseWriter, head []byte, items int, size int64, tail string) (int64, bool) {
+	var written int64
+	write := func(b []byte) bool {
+		n, err := w.Write(b)
+		written += int64(n)
+		return err == nil
+	}
+	if !write(head) {
+		return written, false
+	}
+	var buf bytes.Buffer
+	for id := 1; size > 0 || id <= items; id++ {
+		buf.Reset()
+		buf.WriteString("\n    ")
+		item, _ := xml.Marshal(randomXMLItem(id))
+		buf.Write(item)
+		if size > 0 && written+int64(buf.Len())+int64(len(tail)) > size {
+			break
+		}
+		if !write(buf.Bytes()) {
+			return written, false
+		}
+		if id%100 == 0 {
+			w.Flush()
+		}
+	}
+	if padding := size - written - int64(len(tail)); size > 0 && padding > 0 {
+		// A comment needs 8 bytes; shorter padding is whitespace.
+		if padding >= 8 {
+			pad := "\n<!--" + strings.Repeat("x", int(padding)-8) + "-->"
+			if !write([]byte(pad)) {
+				return written, false
+			}
+		} else if !write([]byte(strings.Repeat(" ", int(padding)))) {
+			return written, false
+		}
+	}
+	return written, write([]byte(tail))
+}